@@ -3,6 +3,7 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"focuz-api/models"
 	"focuz-api/repository"
 	"focuz-api/types"
@@ -19,6 +20,9 @@ type ActivitiesHandler struct {
 	spacesRepo        *repository.SpacesRepository
 	notesRepo         *repository.NotesRepository
 	activityTypesRepo *repository.ActivityTypesRepository
+	filterCounter     *FilterCounter
+	goals             *GoalEvaluator
+	usersRepo         *repository.UsersRepository
 }
 
 func NewActivitiesHandler(
@@ -35,11 +39,33 @@ func NewActivitiesHandler(
 	}
 }
 
+// WithFilterCounter enables pushing saved filter counts after changes. It is optional.
+func (h *ActivitiesHandler) WithFilterCounter(fc *FilterCounter) *ActivitiesHandler {
+	h.filterCounter = fc
+	return h
+}
+
+// WithGoalEvaluator enables goal-reached notifications after changes. It is optional.
+func (h *ActivitiesHandler) WithGoalEvaluator(ge *GoalEvaluator) *ActivitiesHandler {
+	h.goals = ge
+	return h
+}
+
+// WithUserSettings buckets analyses in each user's time zone. It is optional;
+// without it periods are UTC.
+func (h *ActivitiesHandler) WithUserSettings(r *repository.UsersRepository) *ActivitiesHandler {
+	h.usersRepo = r
+	return h
+}
+
 func (h *ActivitiesHandler) CreateActivity(c *gin.Context) {
 	var req struct {
-		TypeID int    `json:"typeId" binding:"required"`
-		Value  string `json:"value" binding:"required"`
-		NoteID *int   `json:"note_id"`
+		TypeID     int        `json:"typeId" binding:"required"`
+		Value      string     `json:"value" binding:"required"`
+		Unit       string     `json:"unit"`
+		NoteID     *int       `json:"note_id"`
+		SpaceID    *int       `json:"spaceId"`
+		OccurredAt *time.Time `json:"occurredAt"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
@@ -63,10 +89,26 @@ func (h *ActivitiesHandler) CreateActivity(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeInvalidRequest, "Invalid note"))
 			return
 		}
+		if req.SpaceID != nil && *req.SpaceID != note.SpaceID {
+			c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeInvalidRequest, "spaceId does not match the note"))
+			return
+		}
 		spaceID = note.SpaceID
 	} else {
-		// If no note is specified, get space ID from activity type
-		spaceID = activityType.SpaceID
+		// Without a note the space is explicit, or that of a space-specific type
+		if req.SpaceID != nil {
+			spaceID = *req.SpaceID
+		} else {
+			spaceID = activityType.SpaceID
+		}
+		if spaceID == 0 {
+			c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "spaceId is required for activities without a note"))
+			return
+		}
+		if !activityType.IsDefault && activityType.SpaceID != spaceID {
+			c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeInvalidRequest, "Invalid or deleted activity type"))
+			return
+		}
 	}
 
 	roleID, rerr := h.spacesRepo.GetUserRoleIDInSpace(userID, spaceID)
@@ -79,13 +121,13 @@ func (h *ActivitiesHandler) CreateActivity(c *gin.Context) {
 		return
 	}
 
-	checkedValue, err := h.validateActivityValue(activityType, req.Value)
+	checkedValue, err := h.validateActivityValue(activityType, req.Value, req.Unit)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
 		return
 	}
 
-	created, err := h.activitiesRepo.CreateActivity(userID, req.TypeID, checkedValue, req.NoteID)
+	created, err := h.activitiesRepo.CreateActivity(userID, req.TypeID, checkedValue, req.NoteID, spaceID, req.OccurredAt)
 	if err != nil {
 		if strings.Contains(err.Error(), "activity with this type already exists for the given note") {
 			c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeConflict, err.Error()))
@@ -95,6 +137,114 @@ func (h *ActivitiesHandler) CreateActivity(c *gin.Context) {
 		return
 	}
 	c.JSON(http.StatusCreated, types.NewSuccessResponse(created))
+	if req.NoteID != nil {
+		h.filterCounter.Publish(spaceID)
+	}
+	if spaceID > 0 {
+		h.goals.Evaluate(spaceID)
+	}
+}
+
+// maxQuickLogBatch bounds the items of one quick-log batch.
+const maxQuickLogBatch = 500
+
+// quickLogItem is a note-less activity sent by a widget or wearable. Value may
+// be a JSON string or any other JSON value (e.g. 12000, true or an object for
+// composite types).
+type quickLogItem struct {
+	TypeID     int             `json:"typeId" binding:"required"`
+	Value      json.RawMessage `json:"value" binding:"required"`
+	Unit       string          `json:"unit"`
+	OccurredAt *time.Time      `json:"occurredAt"`
+}
+
+// QuickLog records one activity without a note in a space.
+func (h *ActivitiesHandler) QuickLog(c *gin.Context) {
+	var req quickLogItem
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
+		return
+	}
+	created, ok := h.quickLog(c, []quickLogItem{req})
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusCreated, types.NewSuccessResponse(created[0]))
+}
+
+// QuickLogBatch records up to maxQuickLogBatch activities without a note in
+// a space, all or none.
+func (h *ActivitiesHandler) QuickLogBatch(c *gin.Context) {
+	var req struct {
+		Items []quickLogItem `json:"items" binding:"required,dive"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
+		return
+	}
+	if len(req.Items) == 0 || len(req.Items) > maxQuickLogBatch {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, fmt.Sprintf("items must contain 1 to %d activities", maxQuickLogBatch)))
+		return
+	}
+	created, ok := h.quickLog(c, req.Items)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusCreated, types.NewSuccessResponse(created))
+}
+
+func (h *ActivitiesHandler) quickLog(c *gin.Context, items []quickLogItem) ([]*models.Activity, bool) {
+	spaceID, err := strconv.Atoi(c.Param("spaceId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "Invalid space ID"))
+		return nil, false
+	}
+	userID := c.GetInt("userId")
+	roleID, err := h.spacesRepo.GetUserRoleIDInSpace(userID, spaceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return nil, false
+	}
+	if roleID == 0 {
+		c.JSON(http.StatusForbidden, types.NewErrorResponse(types.ErrorCodeForbidden, "No access to this space"))
+		return nil, false
+	}
+
+	activityTypes := map[int]*models.ActivityType{}
+	batch := make([]repository.NewActivity, 0, len(items))
+	for i, it := range items {
+		at, cached := activityTypes[it.TypeID]
+		if !cached {
+			if at, err = h.activityTypesRepo.GetActivityTypeByID(it.TypeID); err != nil {
+				c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+				return nil, false
+			}
+			activityTypes[it.TypeID] = at
+		}
+		if at == nil || at.IsDeleted || (!at.IsDefault && at.SpaceID != spaceID) {
+			c.JSON(http.StatusBadRequest, types.NewErrorResponseWithDetails(types.ErrorCodeInvalidRequest, "Invalid or deleted activity type", map[string]interface{}{"index": i}))
+			return nil, false
+		}
+		raw := string(it.Value)
+		var str string
+		if json.Unmarshal(it.Value, &str) == nil {
+			raw = str
+		}
+		value, err := h.validateActivityValue(at, raw, it.Unit)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, types.NewErrorResponseWithDetails(types.ErrorCodeValidation, err.Error(), map[string]interface{}{"index": i}))
+			return nil, false
+		}
+		batch = append(batch, repository.NewActivity{TypeID: at.ID, Value: value, OccurredAt: it.OccurredAt})
+	}
+
+	created, err := h.activitiesRepo.CreateActivities(userID, spaceID, batch)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return nil, false
+	}
+	h.goals.Evaluate(spaceID)
+	return created, true
 }
 
 func (h *ActivitiesHandler) DeleteActivity(c *gin.Context) {
@@ -135,6 +285,12 @@ func (h *ActivitiesHandler) DeleteActivity(c *gin.Context) {
 		return
 	}
 	c.JSON(http.StatusOK, types.NewSuccessResponse(gin.H{"message": "Activity deleted successfully"}))
+	if activity.NoteID != nil && spaceID > 0 {
+		h.filterCounter.Publish(spaceID)
+	}
+	if spaceID > 0 {
+		h.goals.Evaluate(spaceID)
+	}
 }
 
 func (h *ActivitiesHandler) RestoreActivity(c *gin.Context) {
@@ -175,6 +331,12 @@ func (h *ActivitiesHandler) RestoreActivity(c *gin.Context) {
 		return
 	}
 	c.JSON(http.StatusOK, types.NewSuccessResponse(gin.H{"message": "Activity restored successfully"}))
+	if activity.NoteID != nil && spaceID > 0 {
+		h.filterCounter.Publish(spaceID)
+	}
+	if spaceID > 0 {
+		h.goals.Evaluate(spaceID)
+	}
 }
 
 func (h *ActivitiesHandler) UpdateActivity(c *gin.Context) {
@@ -193,8 +355,10 @@ func (h *ActivitiesHandler) UpdateActivity(c *gin.Context) {
 		return
 	}
 	var req struct {
-		Value  string `json:"value" binding:"required"`
-		NoteID *int   `json:"note_id"`
+		Value      string          `json:"value" binding:"required"`
+		Unit       string          `json:"unit"`
+		NoteID     *int            `json:"note_id"`
+		OccurredAt json.RawMessage `json:"occurredAt"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
@@ -226,22 +390,60 @@ func (h *ActivitiesHandler) UpdateActivity(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeInvalidRequest, "Invalid or deleted activity type"))
 		return
 	}
-	checkedValue, err := h.validateActivityValue(activityType, req.Value)
+	checkedValue, err := h.validateActivityValue(activityType, req.Value, req.Unit)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
 		return
 	}
-	err = h.activitiesRepo.UpdateActivity(id, checkedValue, req.NoteID)
+	// The activity stays in its space; a new note must be from the same space.
+	// Only their user may move activities without a space into a note of theirs.
+	if spaceID == 0 && activity.UserID != userID {
+		c.JSON(http.StatusForbidden, types.NewErrorResponse(types.ErrorCodeForbidden, "No access to this activity"))
+		return
+	}
+	newSpaceID := spaceID
+	if req.NoteID != nil {
+		note, nerr := h.notesRepo.GetNoteByID(*req.NoteID)
+		if nerr != nil || note == nil || note.IsDeleted || (spaceID > 0 && note.SpaceID != spaceID) {
+			c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeInvalidRequest, "Invalid note"))
+			return
+		}
+		if spaceID == 0 {
+			roleID, rerr := h.spacesRepo.GetUserRoleIDInSpace(userID, note.SpaceID)
+			if rerr != nil {
+				c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, rerr.Error()))
+				return
+			}
+			if roleID == 0 {
+				c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeInvalidRequest, "Invalid note"))
+				return
+			}
+		}
+		newSpaceID = note.SpaceID
+	}
+	// occurredAt is kept when omitted and cleared by null
+	occurredAt := activity.OccurredAt
+	if req.OccurredAt != nil {
+		if err := json.Unmarshal(req.OccurredAt, &occurredAt); err != nil {
+			c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "occurredAt must be an RFC3339 date or null"))
+			return
+		}
+	}
+	err = h.activitiesRepo.UpdateActivity(id, checkedValue, req.NoteID, newSpaceID, occurredAt)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
 		return
 	}
 	c.JSON(http.StatusOK, types.NewSuccessResponse(gin.H{"message": "Activity updated successfully"}))
+	if spaceID > 0 {
+		h.filterCounter.Publish(spaceID)
+		h.goals.Evaluate(spaceID)
+	}
 }
 
 func (h *ActivitiesHandler) getSpaceIDForActivity(activity *models.Activity) (int, error) {
 	if activity.NoteID == nil {
-		return 0, nil
+		return activity.SpaceID, nil
 	}
 	note, err := h.notesRepo.GetNoteByID(*activity.NoteID)
 	if err != nil || note == nil || note.IsDeleted {
@@ -250,7 +452,31 @@ func (h *ActivitiesHandler) getSpaceIDForActivity(activity *models.Activity) (in
 	return note.SpaceID, nil
 }
 
-func (h *ActivitiesHandler) validateActivityValue(t *models.ActivityType, raw string) ([]byte, error) {
+// validateActivityValue checks raw against type t and encodes it for storage.
+// A value entered in another unit than the type's is converted, and the
+// entered value and unit are kept next to it.
+func (h *ActivitiesHandler) validateActivityValue(t *models.ActivityType, raw, unit string) ([]byte, error) {
+	m := map[string]any{}
+	if unit != "" {
+		converted, entered, err := convertEnteredValue(t, raw, unit)
+		if err != nil {
+			return nil, err
+		}
+		enteredValue, _ := strconv.ParseFloat(raw, 64)
+		m["entered"] = map[string]any{"value": enteredValue, "unit": entered.Symbol}
+		raw = converted
+	}
+	v, err := parseActivityValue(t, raw)
+	if err != nil {
+		return nil, err
+	}
+	m["data"] = v
+	return json.Marshal(m)
+}
+
+// parseActivityValue checks raw against type t and returns the value stored
+// under "data".
+func parseActivityValue(t *models.ActivityType, raw string) (any, error) {
 	if strings.TrimSpace(raw) == "" {
 		return nil, errors.New("empty value")
 	}
@@ -266,8 +492,7 @@ func (h *ActivitiesHandler) validateActivityValue(t *models.ActivityType, raw st
 		if t.MaxValue != nil && float64(v) > *t.MaxValue {
 			return nil, errors.New("value is out of range")
 		}
-		m := map[string]any{"data": v}
-		return json.Marshal(m)
+		return v, nil
 	case "float":
 		f, err := strconv.ParseFloat(raw, 64)
 		if err != nil {
@@ -279,30 +504,64 @@ func (h *ActivitiesHandler) validateActivityValue(t *models.ActivityType, raw st
 		if t.MaxValue != nil && f > *t.MaxValue {
 			return nil, errors.New("value is out of range")
 		}
-		m := map[string]any{"data": f}
-		return json.Marshal(m)
+		return f, nil
 	case "boolean":
 		b, err := strconv.ParseBool(raw)
 		if err != nil {
 			return nil, errors.New("value must be boolean")
 		}
-		m := map[string]any{"data": b}
-		return json.Marshal(m)
+		return b, nil
 	case "text":
-		m := map[string]any{"data": raw}
-		return json.Marshal(m)
+		return raw, nil
 	case "time":
 		_, err := time.Parse(time.RFC3339, raw)
 		if err != nil {
 			return nil, errors.New("value must be valid RFC3339 time")
 		}
-		m := map[string]any{"data": raw}
-		return json.Marshal(m)
+		return raw, nil
+	case "enum", "rating":
+		return convertActivityValue(raw, t, false)
+	case "composite":
+		return parseCompositeValue(t, raw)
 	default:
 		return nil, errors.New("unsupported value type")
 	}
 }
 
+// parseCompositeValue checks a JSON object of field values against the field
+// schema of t. Fields may be omitted; each given field is parsed by its own
+// value type, so nested composite fields take nested objects.
+func parseCompositeValue(t *models.ActivityType, raw string) (map[string]any, error) {
+	var in map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(raw), &in); err != nil {
+		return nil, errors.New("value must be a JSON object of fields")
+	}
+	out := make(map[string]any, len(in))
+	for key, msg := range in {
+		f := t.Field(key)
+		if f == nil {
+			return nil, fmt.Errorf("unknown field %q", key)
+		}
+		if string(msg) == "null" {
+			continue
+		}
+		// Strings are taken as is; numbers, booleans and objects as JSON text
+		var fieldRaw string
+		if err := json.Unmarshal(msg, &fieldRaw); err != nil {
+			fieldRaw = string(msg)
+		}
+		v, err := parseActivityValue(f.AsType(), fieldRaw)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", key, err)
+		}
+		out[key] = v
+	}
+	if len(out) == 0 {
+		return nil, errors.New("value must set at least one field")
+	}
+	return out, nil
+}
+
 // NEW
 func (h *ActivitiesHandler) GetActivitiesAnalysis(c *gin.Context) {
 	spaceIDStr := c.Query("spaceId")
@@ -353,10 +612,23 @@ func (h *ActivitiesHandler) GetActivitiesAnalysis(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeInvalidRequest, "Invalid activity type"))
 		return
 	}
+	var field []string
+	if path := c.Query("field"); path != "" {
+		at, field, err = at.ResolveField(path)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
+			return
+		}
+	}
+	zone, loc, err := timeSettings(c, h.usersRepo)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
+		return
+	}
 	startDateStr := c.Query("startDate")
 	var startDate *time.Time
 	if startDateStr != "" {
-		t, e := time.Parse(time.RFC3339, startDateStr)
+		t, e := parseRangeDate(startDateStr, loc, false)
 		if e == nil {
 			startDate = &t
 		} else {
@@ -367,7 +639,7 @@ func (h *ActivitiesHandler) GetActivitiesAnalysis(c *gin.Context) {
 	endDateStr := c.Query("endDate")
 	var endDate *time.Time
 	if endDateStr != "" {
-		t, e := time.Parse(time.RFC3339, endDateStr)
+		t, e := parseRangeDate(endDateStr, loc, true)
 		if e == nil {
 			endDate = &t
 		} else {
@@ -376,6 +648,45 @@ func (h *ActivitiesHandler) GetActivitiesAnalysis(c *gin.Context) {
 		}
 	}
 	tags := c.QueryArray("tags")
+	transform := c.Query("transform")
+	if at, err = withAggregation(at, c.Query("aggregation"), transform); err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
+		return
+	}
+	factor, err := displayFactor(at, c.Query("unit"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
+		return
+	}
+	tq, err := parseTrendQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
+		return
+	}
+
+	if compare := c.Query("compare"); compare != "" {
+		if tq.isSet() {
+			c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "trend and forecast cannot be combined with compare"))
+			return
+		}
+		if !types.IsComparison(compare) {
+			c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "compare must be previous or year_ago"))
+			return
+		}
+		if strings.EqualFold(at.ValueType, "enum") && strings.EqualFold(at.Aggregation, "mode") {
+			c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "compare needs a numeric aggregation"))
+			return
+		}
+		comparison, err := h.activitiesRepo.GetAnalysisComparison(spaceID, startDate, endDate, tags, at, field, periodID, transform, compare, zone)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+			return
+		}
+		scaleAnalysis(comparison.Periods, factor)
+		comparison.Summary.Scale(factor)
+		c.JSON(http.StatusOK, types.NewSuccessResponse(comparison))
+		return
+	}
 
 	results, err := h.activitiesRepo.GetActivitiesAnalysis(
 		spaceID,
@@ -383,11 +694,34 @@ func (h *ActivitiesHandler) GetActivitiesAnalysis(c *gin.Context) {
 		endDate,
 		tags,
 		at,
+		field,
 		periodID,
+		transform,
+		zone,
 	)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
 		return
 	}
+	scaleAnalysis(results, factor)
+	if tq.isSet() {
+		c.JSON(http.StatusOK, types.NewSuccessResponse(analysisTrend(results, periodType.Name, tq)))
+		return
+	}
 	c.JSON(http.StatusOK, types.NewSuccessResponse(results))
 }
+
+// scaleAnalysis converts the numbers of analysis periods by the display
+// factor; percents and counts are unchanged.
+func scaleAnalysis(results []map[string]any, factor float64) {
+	if factor == 1 {
+		return
+	}
+	for _, item := range results {
+		for _, key := range []string{"value", "baseValue", "compareValue", "delta"} {
+			if v, ok := item[key].(float64); ok {
+				item[key] = v * factor
+			}
+		}
+	}
+}
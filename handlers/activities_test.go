@@ -2,9 +2,13 @@ package handlers
 
 import (
 	"bytes"
+	"database/sql"
 	"encoding/json"
+	"focuz-api/repository"
 	"net/http"
+	"os"
 	"strconv"
+	"time"
 )
 
 func (s *E2ETestSuite) Test56_CreateActivityValid() {
@@ -495,3 +499,462 @@ func (s *E2ETestSuite) Test64_CanCreateActivityWhenExistingIsDeleted() {
 		s.Fail("Activity creation response does not contain data")
 	}
 }
+
+func (s *E2ETestSuite) Test64C_QuickLogWithoutNote() {
+	do := s.doJSON
+	spacePath := "/spaces/" + strconv.Itoa(s.createdSpaceID)
+
+	code, out := do("POST", spacePath+"/activity-types", s.ownerToken, map[string]interface{}{
+		"name": "Quick steps", "valueType": "integer", "aggregation": "sum",
+	})
+	s.Equal(http.StatusCreated, code)
+	typeID := int(out["data"].(map[string]interface{})["id"].(float64))
+
+	now := time.Now().UTC()
+	earlier := now.AddDate(0, 0, -3)
+	code, out = do("POST", spacePath+"/quick-log", s.ownerToken, map[string]interface{}{"typeId": typeID, "value": 3000})
+	s.Equal(http.StatusCreated, code)
+	activity := out["data"].(map[string]interface{})
+	s.Equal(float64(s.createdSpaceID), activity["spaceId"])
+	s.Nil(activity["noteId"])
+
+	code, out = do("POST", spacePath+"/quick-log/batch", s.ownerToken, map[string]interface{}{"items": []map[string]interface{}{
+		{"typeId": typeID, "value": "2000", "occurredAt": now.Format(time.RFC3339)},
+		{"typeId": typeID, "value": 500, "occurredAt": earlier.Format(time.RFC3339)},
+	}})
+	s.Equal(http.StatusCreated, code)
+	s.Len(out["data"].([]interface{}), 2)
+
+	// One invalid item rejects the whole batch.
+	code, out = do("POST", spacePath+"/quick-log/batch", s.ownerToken, map[string]interface{}{"items": []map[string]interface{}{
+		{"typeId": typeID, "value": 1},
+		{"typeId": typeID, "value": "many"},
+	}})
+	s.Equal(http.StatusBadRequest, code)
+	s.Equal(1.0, out["error"].(map[string]interface{})["details"].(map[string]interface{})["index"])
+
+	code, _ = do("POST", "/activities", s.ownerToken, map[string]interface{}{"typeId": 1, "value": "1"})
+	s.Equal(http.StatusBadRequest, code)
+
+	code, out = do("GET", "/activities?spaceId="+strconv.Itoa(s.createdSpaceID)+"&typeId="+strconv.Itoa(typeID)+"&periodId=1", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	values := map[string]float64{}
+	for _, p := range out["data"].([]interface{}) {
+		item := p.(map[string]interface{})
+		values[item["period"].(string)] = item["value"].(float64)
+	}
+	s.Equal(5000.0, values[now.Format("2006-01-02")])
+	s.Equal(500.0, values[earlier.Format("2006-01-02")])
+}
+
+func (s *E2ETestSuite) Test64D_StatisticalAggregations() {
+	do := s.doJSON
+	spacePath := "/spaces/" + strconv.Itoa(s.createdSpaceID)
+
+	code, out := do("POST", spacePath+"/activity-types", s.ownerToken, map[string]interface{}{
+		"name": "Reaction time", "valueType": "float", "aggregation": "sum",
+	})
+	s.Equal(http.StatusCreated, code)
+	typeID := int(out["data"].(map[string]interface{})["id"].(float64))
+
+	// Day one: 1, 2, 3, 10; day two: 4.
+	day1 := time.Now().UTC().AddDate(0, 0, -1)
+	day2 := time.Now().UTC()
+	items := []map[string]interface{}{}
+	for _, v := range []float64{1, 2, 3, 10} {
+		items = append(items, map[string]interface{}{"typeId": typeID, "value": v, "occurredAt": day1.Format(time.RFC3339)})
+	}
+	items = append(items, map[string]interface{}{"typeId": typeID, "value": 4, "occurredAt": day2.Format(time.RFC3339)})
+	code, _ = do("POST", spacePath+"/quick-log/batch", s.ownerToken, map[string]interface{}{"items": items})
+	s.Equal(http.StatusCreated, code)
+
+	analysis := "/activities?spaceId=" + strconv.Itoa(s.createdSpaceID) + "&typeId=" + strconv.Itoa(typeID) + "&periodId=1"
+	first := func(query string) map[string]interface{} {
+		code, out := do("GET", analysis+query, s.ownerToken, nil)
+		s.Equal(http.StatusOK, code)
+		return out["data"].([]interface{})[0].(map[string]interface{})
+	}
+	s.InDelta(2.5, first("&aggregation=median")["value"], 0.0001)
+	s.InDelta(7.9, first("&aggregation=p90")["value"], 0.0001)
+	s.InDelta(16.6667, first("&aggregation=variance")["value"], 0.001)
+	s.InDelta(4.0825, first("&aggregation=stddev")["value"], 0.001)
+	code, _ = do("GET", analysis+"&aggregation=p100", s.ownerToken, nil)
+	s.Equal(http.StatusBadRequest, code)
+	code, _ = do("GET", analysis+"&aggregation=count_true", s.ownerToken, nil)
+	s.Equal(http.StatusBadRequest, code)
+
+	// The running total keeps each day's sum as baseValue.
+	code, out = do("GET", analysis+"&transform=cumsum", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	series := out["data"].([]interface{})
+	s.Len(series, 2)
+	last := series[1].(map[string]interface{})
+	s.Equal(20.0, last["value"])
+	s.Equal(4.0, last["baseValue"])
+	code, _ = do("GET", analysis+"&transform=ma3", s.ownerToken, nil)
+	s.Equal(http.StatusBadRequest, code)
+
+	// The type keeps its own aggregation.
+	s.Equal(16.0, first("")["value"])
+
+	code, out = do("POST", "/charts", s.ownerToken, map[string]interface{}{
+		"spaceId": s.createdSpaceID, "kindId": 1, "activityTypeId": typeID, "periodId": 2,
+		"name": "Reaction p90", "aggregation": "P90", "transform": "ma7",
+	})
+	s.Equal(http.StatusCreated, code)
+	chart := out["data"].(map[string]interface{})
+	s.Equal("p90", chart["aggregation"])
+	s.Equal("ma7", chart["transform"])
+	chartPath := "/charts/" + strconv.Itoa(int(chart["id"].(float64)))
+	code, _ = do("GET", chartPath+"/data", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	code, _ = do("PATCH", chartPath, s.ownerToken, map[string]interface{}{"transform": nil, "aggregation": "mode"})
+	s.Equal(http.StatusBadRequest, code)
+	code, _ = do("PATCH", chartPath, s.ownerToken, map[string]interface{}{"transform": nil})
+	s.Equal(http.StatusOK, code)
+}
+
+func (s *E2ETestSuite) Test64E_Correlation() {
+	do := s.doJSON
+	spacePath := "/spaces/" + strconv.Itoa(s.createdSpaceID)
+
+	typeIDs := make([]int, 2)
+	for i, name := range []string{"Corr sleep", "Corr mood"} {
+		code, out := do("POST", spacePath+"/activity-types", s.ownerToken, map[string]interface{}{
+			"name": name, "valueType": "float", "aggregation": "avg",
+		})
+		s.Equal(http.StatusCreated, code)
+		typeIDs[i] = int(out["data"].(map[string]interface{})["id"].(float64))
+	}
+
+	// Mood follows the previous night's sleep: mood(d) = sleep(d-1) - 2.
+	base := time.Now().UTC().AddDate(0, 0, -10)
+	sleep := []float64{6, 8, 5, 7, 9, 4}
+	items := []map[string]interface{}{}
+	for i, v := range sleep {
+		day := base.AddDate(0, 0, i).Format(time.RFC3339)
+		next := base.AddDate(0, 0, i+1).Format(time.RFC3339)
+		items = append(items,
+			map[string]interface{}{"typeId": typeIDs[0], "value": v, "occurredAt": day},
+			map[string]interface{}{"typeId": typeIDs[1], "value": v - 2, "occurredAt": next},
+		)
+	}
+	code, _ := do("POST", spacePath+"/quick-log/batch", s.ownerToken, map[string]interface{}{"items": items})
+	s.Equal(http.StatusCreated, code)
+
+	path := "/activities/correlation?spaceId=" + strconv.Itoa(s.createdSpaceID) +
+		"&typeA=" + strconv.Itoa(typeIDs[0]) + "&typeB=" + strconv.Itoa(typeIDs[1]) + "&periodId=1"
+	code, out := do("GET", path+"&lag=1", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	corr := out["data"].(map[string]interface{})
+	s.Equal(float64(len(sleep)), corr["n"])
+	s.InDelta(1.0, corr["pearson"], 0.0001)
+	s.InDelta(1.0, corr["spearman"], 0.0001)
+	point := corr["points"].([]interface{})[0].(map[string]interface{})
+	s.Equal(base.Format("2006-01-02"), point["periodA"])
+	s.Equal(base.AddDate(0, 0, 1).Format("2006-01-02"), point["periodB"])
+
+	code, out = do("GET", path, s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	s.Equal(float64(len(sleep)-1), out["data"].(map[string]interface{})["n"])
+
+	code, _ = do("GET", path+"&lag=1000", s.ownerToken, nil)
+	s.Equal(http.StatusBadRequest, code)
+	code, _ = do("GET", path, s.guestToken, nil)
+	s.Equal(http.StatusForbidden, code)
+}
+
+func (s *E2ETestSuite) Test64F_TimezoneBucketing() {
+	do := s.doJSON
+	spacePath := "/spaces/" + strconv.Itoa(s.createdSpaceID)
+
+	code, out := do("POST", spacePath+"/activity-types", s.ownerToken, map[string]interface{}{
+		"name": "Late walks", "valueType": "integer", "aggregation": "sum",
+	})
+	s.Equal(http.StatusCreated, code)
+	typeID := int(out["data"].(map[string]interface{})["id"].(float64))
+
+	// 22:30 UTC on Jan 10 is already Jan 11 in Moscow (UTC+3).
+	late := time.Date(2030, 1, 10, 22, 30, 0, 0, time.UTC)
+	code, _ = do("POST", spacePath+"/quick-log", s.ownerToken, map[string]interface{}{"typeId": typeID, "value": 1, "occurredAt": late.Format(time.RFC3339)})
+	s.Equal(http.StatusCreated, code)
+
+	analysis := "/activities?spaceId=" + strconv.Itoa(s.createdSpaceID) + "&typeId=" + strconv.Itoa(typeID) + "&periodId=1"
+	period := func(query string) string {
+		code, out := do("GET", analysis+query, s.ownerToken, nil)
+		s.Equal(http.StatusOK, code)
+		data := out["data"].([]interface{})
+		s.Len(data, 1)
+		return data[0].(map[string]interface{})["period"].(string)
+	}
+	s.Equal("2030-01-10", period(""))
+	s.Equal("2030-01-11", period("&tz=Europe/Moscow"))
+	// Plain dates are read in the zone.
+	s.Equal("2030-01-11", period("&tz=Europe/Moscow&startDate=2030-01-11&endDate=2030-01-11"))
+	code, _ = do("GET", analysis+"&tz=Mars/Olympus", s.ownerToken, nil)
+	s.Equal(http.StatusBadRequest, code)
+
+	// The user's setting applies without tz=.
+	code, out = do("PATCH", "/me/settings", s.ownerToken, map[string]interface{}{"timezone": "Europe/Moscow", "weekStart": "sunday"})
+	s.Equal(http.StatusOK, code)
+	s.Equal("sunday", out["data"].(map[string]interface{})["weekStart"])
+	s.Equal("2030-01-11", period(""))
+	// Friday Jan 11 falls in the Sunday week of Jan 6, labelled by ISO week 2.
+	code, out = do("GET", "/activities?spaceId="+strconv.Itoa(s.createdSpaceID)+"&typeId="+strconv.Itoa(typeID)+"&periodId=2", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	s.Equal("2030-W02", out["data"].([]interface{})[0].(map[string]interface{})["period"])
+
+	code, _ = do("PATCH", "/me/settings", s.ownerToken, map[string]interface{}{"weekStart": "friday"})
+	s.Equal(http.StatusBadRequest, code)
+	code, _ = do("PATCH", "/me/settings", s.ownerToken, map[string]interface{}{"timezone": "UTC", "weekStart": "monday"})
+	s.Equal(http.StatusOK, code)
+}
+
+func (s *E2ETestSuite) Test64G_DailyRollups() {
+	do := s.doJSON
+	spacePath := "/spaces/" + strconv.Itoa(s.createdSpaceID)
+
+	// The space is rolled up in its members' zones, built in the background.
+	code, _ := do("PATCH", "/me/settings", s.ownerToken, map[string]interface{}{"timezone": "Europe/Moscow"})
+	s.Equal(http.StatusOK, code)
+	defer do("PATCH", "/me/settings", s.ownerToken, map[string]interface{}{"timezone": "UTC"})
+
+	code, out := do("POST", spacePath+"/activity-types", s.ownerToken, map[string]interface{}{
+		"name": "Rolled up pages", "valueType": "integer", "aggregation": "sum",
+	})
+	s.Equal(http.StatusCreated, code)
+	typeID := int(out["data"].(map[string]interface{})["id"].(float64))
+
+	// 2 and 3 on Mar 4; 4 late on Mar 4 UTC, which is Mar 5 in Moscow (UTC+3).
+	items := []map[string]interface{}{
+		{"typeId": typeID, "value": 2, "occurredAt": "2031-03-04T10:00:00Z"},
+		{"typeId": typeID, "value": 3, "occurredAt": "2031-03-04T11:00:00Z"},
+		{"typeId": typeID, "value": 4, "occurredAt": "2031-03-04T23:30:00Z"},
+	}
+	code, out = do("POST", spacePath+"/quick-log/batch", s.ownerToken, map[string]interface{}{"items": items})
+	s.Equal(http.StatusCreated, code)
+	created := out["data"].([]interface{})
+	s.Len(created, 3)
+	activityID := func(i int) string {
+		return strconv.Itoa(int(created[i].(map[string]interface{})["id"].(float64)))
+	}
+
+	// 7 through a note dated Mar 6.
+	code, out = do("POST", "/notes", s.ownerToken, map[string]interface{}{
+		"text": "Rolled up reading", "tags": []string{"rollups"}, "date": "2031-03-06T12:00:00Z", "spaceId": s.createdSpaceID,
+	})
+	s.Equal(http.StatusCreated, code)
+	noteID := int(out["data"].(map[string]interface{})["id"].(float64))
+	code, _ = do("POST", "/activities", s.ownerToken, map[string]interface{}{"typeId": typeID, "value": "7", "note_id": noteID})
+	s.Equal(http.StatusCreated, code)
+
+	analysis := "/activities?spaceId=" + strconv.Itoa(s.createdSpaceID) + "&typeId=" + strconv.Itoa(typeID) +
+		"&periodId=1&startDate=2031-03-01&endDate=2031-03-31"
+	days := func(tz string) map[string]float64 {
+		code, out := do("GET", analysis+"&tz="+tz, s.ownerToken, nil)
+		s.Equal(http.StatusOK, code)
+		values := map[string]float64{}
+		for _, p := range out["data"].([]interface{}) {
+			m := p.(map[string]interface{})
+			values[m["period"].(string)] = m["value"].(float64)
+		}
+		return values
+	}
+	s.Equal(map[string]float64{"2031-03-04": 9, "2031-03-06": 7}, days("UTC"))
+	s.Equal(map[string]float64{"2031-03-04": 5, "2031-03-05": 4, "2031-03-06": 7}, days("Europe/Moscow"))
+
+	// Updates and deletions show up in every zone.
+	code, _ = do("PATCH", "/activities/"+activityID(0), s.ownerToken, map[string]interface{}{"value": "6", "occurredAt": "2031-03-05T10:00:00Z"})
+	s.Equal(http.StatusOK, code)
+	code, _ = do("PATCH", "/activities/"+activityID(1)+"/delete", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	s.Equal(map[string]float64{"2031-03-04": 4, "2031-03-05": 6, "2031-03-06": 7}, days("UTC"))
+	s.Equal(map[string]float64{"2031-03-05": 10, "2031-03-06": 7}, days("Europe/Moscow"))
+
+	code, _ = do("PATCH", "/notes/"+strconv.Itoa(noteID)+"/delete", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	s.Equal(map[string]float64{"2031-03-04": 4, "2031-03-05": 6}, days("UTC"))
+	code, _ = do("PATCH", "/notes/"+strconv.Itoa(noteID)+"/restore", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+
+	// Charts over whole days read the same rollups.
+	code, out = do("POST", "/charts", s.ownerToken, map[string]interface{}{
+		"spaceId": s.createdSpaceID, "kindId": 1, "activityTypeId": typeID, "periodId": 1, "name": "Rolled up pages",
+	})
+	s.Equal(http.StatusCreated, code)
+	chartID := int(out["data"].(map[string]interface{})["id"].(float64))
+	code, out = do("GET", "/charts/"+strconv.Itoa(chartID)+"/data?from=2031-03-01&to=2031-03-31&tz=UTC", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	points := map[string]float64{}
+	for _, p := range out["data"].([]interface{}) {
+		m := p.(map[string]interface{})
+		if m["value"] != nil {
+			points[m["date"].(string)[:10]] = m["value"].(float64)
+		}
+	}
+	s.Equal(map[string]float64{"2031-03-04": 4, "2031-03-05": 6, "2031-03-06": 7}, points)
+
+	// Activities pushed through sync are rolled up too: 5 on Mar 7.
+	code, out = do("POST", "/sync", s.ownerToken, map[string]interface{}{
+		"notes": []map[string]interface{}{{
+			"clientId": "rollup-1", "space_id": s.createdSpaceID, "text": "Synced reading", "tags": []string{"rollups"},
+			"date": "2031-03-07T12:00:00Z", "created_at": time.Now().Format(time.RFC3339), "modified_at": time.Now().Format(time.RFC3339),
+			"activities": []map[string]interface{}{{"type_id": typeID, "value": map[string]interface{}{"data": 5}}},
+		}},
+		"tags": []interface{}{}, "filters": []interface{}{}, "charts": []interface{}{}, "activities": []interface{}{},
+	})
+	s.Equal(http.StatusOK, code)
+	s.Equal(map[string]float64{"2031-03-04": 4, "2031-03-05": 6, "2031-03-06": 7, "2031-03-07": 5}, days("UTC"))
+	s.Equal(map[string]float64{"2031-03-05": 10, "2031-03-06": 7, "2031-03-07": 5}, days("Europe/Moscow"))
+
+	// The rollups match the activities they were kept from.
+	dbURL := os.Getenv("DATABASE_URL")
+	s.Require().NotEmpty(dbURL, "DATABASE_URL is needed to check the rollups")
+	db, err := sql.Open("postgres", dbURL)
+	s.Require().NoError(err)
+	defer db.Close()
+	rollups := repository.NewRollupsRepository(db)
+	var zones []repository.RollupZone
+	for i := 0; i < 50; i++ {
+		zones, err = rollups.Zones(s.createdSpaceID)
+		s.Require().NoError(err)
+		if containsZone(zones, "Europe/Moscow") {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	s.True(containsZone(zones, "Europe/Moscow"))
+	for _, z := range zones {
+		mismatches, err := rollups.Check(z)
+		s.NoError(err)
+		s.Empty(mismatches)
+	}
+}
+
+func containsZone(zones []repository.RollupZone, timezone string) bool {
+	for _, z := range zones {
+		if z.Timezone == timezone {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *E2ETestSuite) Test64H_TrendAndForecast() {
+	do := s.doJSON
+	spacePath := "/spaces/" + strconv.Itoa(s.createdSpaceID)
+
+	code, out := do("POST", spacePath+"/activity-types", s.ownerToken, map[string]interface{}{
+		"name": "Steady pushups", "valueType": "integer", "aggregation": "sum",
+	})
+	s.Equal(http.StatusCreated, code)
+	typeID := int(out["data"].(map[string]interface{})["id"].(float64))
+
+	// Two more a day from May 1 to 5, then May 7 after a day without any.
+	items := []map[string]interface{}{}
+	for day, v := range map[int]int{1: 10, 2: 12, 3: 14, 4: 16, 5: 18, 7: 22} {
+		items = append(items, map[string]interface{}{
+			"typeId": typeID, "value": v, "occurredAt": time.Date(2032, 5, day, 12, 0, 0, 0, time.UTC).Format(time.RFC3339),
+		})
+	}
+	code, _ = do("POST", spacePath+"/quick-log/batch", s.ownerToken, map[string]interface{}{"items": items})
+	s.Equal(http.StatusCreated, code)
+
+	analysis := "/activities?spaceId=" + strconv.Itoa(s.createdSpaceID) + "&typeId=" + strconv.Itoa(typeID) + "&periodId=1&tz=UTC&startDate=2032-05-01"
+
+	// The line counts the missing day, so it fits exactly.
+	code, out = do("GET", analysis+"&endDate=2032-05-31&trend=linear", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	data := out["data"].(map[string]interface{})
+	trend := data["trend"].(map[string]interface{})
+	s.Equal("linear", trend["method"])
+	s.InDelta(2.0, trend["slope"], 0.0001)
+	periods := data["periods"].([]interface{})
+	s.Len(periods, 6)
+	last := periods[5].(map[string]interface{})
+	s.Equal("2032-05-07", last["period"])
+	s.InDelta(22.0, last["trend"], 0.0001)
+	s.Nil(data["forecast"])
+
+	// Holt's method continues the trend; a perfect fit has no spread.
+	code, out = do("GET", analysis+"&endDate=2032-05-05&forecast=3", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	forecast := out["data"].(map[string]interface{})["forecast"].([]interface{})
+	s.Len(forecast, 3)
+	for i, f := range forecast {
+		m := f.(map[string]interface{})
+		s.Equal("2032-05-0"+strconv.Itoa(6+i), m["period"])
+		s.InDelta(20.0+2*float64(i), m["value"], 0.0001)
+		s.InDelta(m["value"].(float64), m["lower"], 0.0001)
+		s.InDelta(m["value"].(float64), m["upper"], 0.0001)
+	}
+
+	// The missing day is interpolated before smoothing, so the fit stays perfect.
+	code, out = do("GET", analysis+"&endDate=2032-05-31&forecast=1", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	forecast = out["data"].(map[string]interface{})["forecast"].([]interface{})
+	s.Len(forecast, 1)
+	next := forecast[0].(map[string]interface{})
+	s.Equal("2032-05-08", next["period"])
+	s.InDelta(24.0, next["value"], 0.0001)
+	s.InDelta(24.0, next["upper"], 0.0001)
+
+	// Simple smoothing forecasts a flat level with a band widening each step.
+	code, out = do("GET", analysis+"&endDate=2032-05-31&forecast=2&forecastMethod=ses&trend=ewma", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	data = out["data"].(map[string]interface{})
+	s.Equal("ewma", data["trend"].(map[string]interface{})["method"])
+	forecast = data["forecast"].([]interface{})
+	s.Len(forecast, 2)
+	first, second := forecast[0].(map[string]interface{}), forecast[1].(map[string]interface{})
+	s.Equal("2032-05-08", first["period"])
+	s.Equal(first["value"], second["value"])
+	s.Less(first["lower"].(float64), first["value"].(float64))
+	s.Less(second["lower"].(float64), first["lower"].(float64))
+
+	for _, query := range []string{"&trend=quadratic", "&forecast=0", "&forecast=61", "&forecast=3&forecastMethod=arima", "&trend=linear&compare=previous"} {
+		code, _ = do("GET", analysis+query, s.ownerToken, nil)
+		s.Equal(http.StatusBadRequest, code, query)
+	}
+}
+
+func (s *E2ETestSuite) Test64I_MovingAverageSpansEmptyPeriods() {
+	do := s.doJSON
+	spacePath := "/spaces/" + strconv.Itoa(s.createdSpaceID)
+
+	code, out := do("POST", spacePath+"/activity-types", s.ownerToken, map[string]interface{}{
+		"name": "Sparse rowing", "valueType": "integer", "aggregation": "sum",
+	})
+	s.Equal(http.StatusCreated, code)
+	typeID := int(out["data"].(map[string]interface{})["id"].(float64))
+
+	// June 1 and 2, then nothing until June 10.
+	items := []map[string]interface{}{}
+	for day, v := range map[int]int{1: 10, 2: 20, 10: 40} {
+		items = append(items, map[string]interface{}{
+			"typeId": typeID, "value": v, "occurredAt": time.Date(2033, 6, day, 12, 0, 0, 0, time.UTC).Format(time.RFC3339),
+		})
+	}
+	code, _ = do("POST", spacePath+"/quick-log/batch", s.ownerToken, map[string]interface{}{"items": items})
+	s.Equal(http.StatusCreated, code)
+
+	analysis := "/activities?spaceId=" + strconv.Itoa(s.createdSpaceID) + "&typeId=" + strconv.Itoa(typeID) + "&periodId=1&tz=UTC&startDate=2033-06-01&endDate=2033-06-30"
+	values := func(transform string) map[string]float64 {
+		code, out := do("GET", analysis+"&transform="+transform, s.ownerToken, nil)
+		s.Equal(http.StatusOK, code)
+		byPeriod := map[string]float64{}
+		for _, p := range out["data"].([]interface{}) {
+			p := p.(map[string]interface{})
+			byPeriod[p["period"].(string)] = p["value"].(float64)
+		}
+		return byPeriod
+	}
+
+	// June 1 and 2 are more than 7 days before June 10, but within 30.
+	ma7 := values("ma7")
+	s.Len(ma7, 3)
+	s.InDelta(15.0, ma7["2033-06-02"], 0.0001)
+	s.InDelta(40.0, ma7["2033-06-10"], 0.0001)
+	ma30 := values("ma30")
+	s.InDelta(70.0/3, ma30["2033-06-10"], 0.0001)
+}
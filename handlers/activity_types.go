@@ -1,26 +1,40 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"focuz-api/globals"
+	"focuz-api/models"
+	"focuz-api/pkg/units"
 	"focuz-api/repository"
 	"focuz-api/types"
+	"math"
 	"net/http"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 type ActivityTypesHandler struct {
-	repo       *repository.ActivityTypesRepository
-	spacesRepo *repository.SpacesRepository
+	repo           *repository.ActivityTypesRepository
+	spacesRepo     *repository.SpacesRepository
+	categoriesRepo *repository.CategoriesRepository
 }
 
 func NewActivityTypesHandler(r *repository.ActivityTypesRepository, s *repository.SpacesRepository) *ActivityTypesHandler {
 	return &ActivityTypesHandler{repo: r, spacesRepo: s}
 }
 
+// WithCategories enables category checks and the grouped listing.
+func (h *ActivityTypesHandler) WithCategories(r *repository.CategoriesRepository) *ActivityTypesHandler {
+	h.categoriesRepo = r
+	return h
+}
+
 func (h *ActivityTypesHandler) CreateActivityType(c *gin.Context) {
 	spaceID, err := strconv.Atoi(c.Param("spaceId"))
 	if err != nil {
@@ -48,50 +62,28 @@ func (h *ActivityTypesHandler) CreateActivityType(c *gin.Context) {
 		CategoryID  *int     `json:"categoryId"`
 		SpaceID     *int     `json:"spaceId"`
 		IsDefault   *bool    `json:"isDefault"`
+
+		Options []models.ActivityTypeOption `json:"options"`
+		Fields  []models.ActivityField      `json:"fields"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
 		return
 	}
-	validValueTypes := map[string]bool{
-		"integer": true,
-		"float":   true,
-		"text":    true,
-		"boolean": true,
-		"time":    true,
-	}
-	if !validValueTypes[req.ValueType] {
-		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "Invalid value_type. Allowed: integer, float, text, boolean, time"))
-		return
-	}
-
-	validAggregations := map[string]bool{
-		"sum": true, "avg": true, "count": true, "min": true, "max": true,
-		"and": true, "or": true,
-		"count_true": true, "count_false": true,
-		"percentage_true": true, "percentage_false": true,
+	def := &models.ActivityType{
+		ValueType:   req.ValueType,
+		Aggregation: req.Aggregation,
+		Unit:        req.Unit,
+		MinValue:    req.MinValue,
+		MaxValue:    req.MaxValue,
+		Options:     req.Options,
+		Fields:      req.Fields,
 	}
-	if !validAggregations[strings.ToLower(req.Aggregation)] {
-		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "Invalid aggregation. Allowed: sum, avg, count, min, max, and, or, count_true, count_false, percentage_true, percentage_false"))
-		return
-	}
-	if req.MinValue != nil && req.MaxValue != nil && *req.MinValue > *req.MaxValue {
-		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "min_value cannot be greater than max_value"))
-		return
-	}
-	if req.ValueType == "text" && strings.ToLower(req.Aggregation) != "count" {
-		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "text supports only count aggregation"))
-		return
-	}
-	boolAggSet := map[string]bool{
-		"and": true, "or": true, "count_true": true, "count_false": true, "percentage_true": true, "percentage_false": true,
-	}
-	if req.ValueType == "boolean" && !boolAggSet[strings.ToLower(req.Aggregation)] {
-		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "invalid aggregation for boolean"))
+	if err := validateActivityTypeDefinition(def); err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
 		return
 	}
-	if req.ValueType == "time" && req.Unit != nil && *req.Unit != "" {
-		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "time cannot have a unit"))
+	if req.CategoryID != nil && !h.checkCategory(c, *req.CategoryID, spaceID) {
 		return
 	}
 
@@ -99,12 +91,14 @@ func (h *ActivityTypesHandler) CreateActivityType(c *gin.Context) {
 	created, err := h.repo.CreateActivityType(
 		req.Name,
 		req.ValueType,
-		req.MinValue,
-		req.MaxValue,
+		def.MinValue,
+		def.MaxValue,
 		req.Aggregation,
 		spacePtr,
 		req.CategoryID,
 		req.Unit,
+		def.Options,
+		def.Fields,
 	)
 	if err != nil {
 		fmt.Printf("CreateActivityType error: %v\n", err)
@@ -118,6 +112,244 @@ func (h *ActivityTypesHandler) CreateActivityType(c *gin.Context) {
 	c.JSON(http.StatusCreated, types.NewSuccessResponse(created))
 }
 
+func (h *ActivityTypesHandler) UpdateActivityType(c *gin.Context) {
+	spaceID, err := strconv.Atoi(c.Param("spaceId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "Invalid space ID"))
+		return
+	}
+	typeID, err := strconv.Atoi(c.Param("typeId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "Invalid type ID"))
+		return
+	}
+	userID := c.GetInt("userId")
+	roleID, err := h.spacesRepo.GetUserRoleIDInSpace(userID, spaceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
+	if roleID == 0 || roleID != globals.DefaultOwnerRoleID {
+		c.JSON(http.StatusForbidden, types.NewErrorResponse(types.ErrorCodeForbidden, "No permission"))
+		return
+	}
+
+	// Nullable fields stay raw to tell an omitted field (keep) from null (clear).
+	var req struct {
+		Name        *string         `json:"name"`
+		ValueType   *string         `json:"valueType"`
+		Unit        json.RawMessage `json:"unit"`
+		MinValue    json.RawMessage `json:"minValue"`
+		MaxValue    json.RawMessage `json:"maxValue"`
+		Aggregation *string         `json:"aggregation"`
+		CategoryID  json.RawMessage `json:"categoryId"`
+		Convert     bool            `json:"convert"`
+
+		Options *[]models.ActivityTypeOption `json:"options"`
+		Fields  *[]models.ActivityField      `json:"fields"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
+		return
+	}
+
+	activityType, err := h.repo.GetActivityTypeByID(typeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
+	if activityType == nil || activityType.IsDeleted || (!activityType.IsDefault && activityType.SpaceID != spaceID) {
+		c.JSON(http.StatusNotFound, types.NewErrorResponse(types.ErrorCodeNotFound, "Activity type not found"))
+		return
+	}
+	if activityType.IsDefault {
+		c.JSON(http.StatusForbidden, types.NewErrorResponse(types.ErrorCodeForbidden, "Cannot edit default activity type"))
+		return
+	}
+
+	updated := *activityType
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "name cannot be empty"))
+			return
+		}
+		updated.Name = name
+	}
+	if req.ValueType != nil {
+		updated.ValueType = *req.ValueType
+	}
+	if req.Aggregation != nil {
+		updated.Aggregation = *req.Aggregation
+	}
+	if req.Options != nil {
+		updated.Options = *req.Options
+	}
+	if req.Fields != nil {
+		updated.Fields = *req.Fields
+	}
+	var categoryID *int
+	if activityType.CategoryID != 0 {
+		cid := activityType.CategoryID
+		categoryID = &cid
+	}
+	nullable := []struct {
+		raw json.RawMessage
+		dst interface{}
+	}{
+		{req.Unit, &updated.Unit},
+		{req.MinValue, &updated.MinValue},
+		{req.MaxValue, &updated.MaxValue},
+		{req.CategoryID, &categoryID},
+	}
+	for _, f := range nullable {
+		if len(f.raw) == 0 {
+			continue
+		}
+		if err := json.Unmarshal(f.raw, f.dst); err != nil {
+			c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
+			return
+		}
+	}
+	if categoryID != nil {
+		if *categoryID != activityType.CategoryID && !h.checkCategory(c, *categoryID, spaceID) {
+			return
+		}
+		updated.CategoryID = *categoryID
+	} else {
+		updated.CategoryID = 0
+	}
+	if err := validateActivityTypeDefinition(&updated); err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
+		return
+	}
+
+	// A value type change rewrites every stored value of this type. Edits of
+	// enum, rating and composite types recheck the stored values too, since
+	// options, range and fields restrict them. Values that are already valid are
+	// kept as is; anything else needs an explicit conversion, and values that
+	// cannot be converted block the change.
+	var converted map[int][]byte
+	if updated.ValueType != activityType.ValueType || updated.OptionValues() != nil || updated.ValueType == "composite" {
+		values, err := h.repo.GetActivityValuesByType(typeID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+			return
+		}
+		stored, err := h.repo.GetStoredActivityValuesByType(typeID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+			return
+		}
+		converted = make(map[int][]byte, len(values))
+		needsConversion, failed := 0, 0
+		for id, raw := range values {
+			v, err := convertActivityValue(raw, &updated, false)
+			if err != nil {
+				needsConversion++
+				v, err = convertActivityValue(raw, &updated, true)
+			}
+			if err != nil {
+				failed++
+				continue
+			}
+			if updated.ValueType == activityType.ValueType && (fmt.Sprint(v) == raw || updated.ValueType == "composite") {
+				continue
+			}
+			// Only data is replaced; the entered value and unit stay unless
+			// the type is no longer a number
+			m := map[string]any{}
+			if json.Unmarshal(stored[id], &m) != nil || m == nil {
+				m = map[string]any{}
+			}
+			m["data"] = v
+			if updated.ValueType != "integer" && updated.ValueType != "float" {
+				delete(m, "entered")
+			}
+			b, err := json.Marshal(m)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+				return
+			}
+			converted[id] = b
+		}
+		if failed > 0 {
+			c.JSON(http.StatusConflict, types.NewErrorResponse(types.ErrorCodeConflict, fmt.Sprintf("%d existing activities cannot be converted to %s", failed, updated.ValueType)))
+			return
+		}
+		if needsConversion > 0 && !req.Convert {
+			c.JSON(http.StatusConflict, types.NewErrorResponse(types.ErrorCodeConflict, fmt.Sprintf("%d existing activities are not valid %s values; set convert to true to convert them", needsConversion, updated.ValueType)))
+			return
+		}
+	}
+
+	// Values are stored in the type's unit, so a switch to another unit of the
+	// same dimension rescales them, and the range unless it is set as well.
+	oldUnit, oldOK := typeUnit(activityType)
+	newUnit, newOK := typeUnit(&updated)
+	if oldOK && newOK && updated.ValueType == activityType.ValueType && oldUnit.Symbol != newUnit.Symbol && oldUnit.Dimension == newUnit.Dimension {
+		k, _ := units.Factor(oldUnit.Symbol, newUnit.Symbol)
+		if len(req.MinValue) == 0 && updated.MinValue != nil {
+			v := *updated.MinValue * k
+			updated.MinValue = &v
+		}
+		if len(req.MaxValue) == 0 && updated.MaxValue != nil {
+			v := *updated.MaxValue * k
+			updated.MaxValue = &v
+		}
+		stored, err := h.repo.GetStoredActivityValuesByType(typeID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+			return
+		}
+		converted = make(map[int][]byte, len(stored))
+		rounded := 0
+		for id, doc := range stored {
+			var m map[string]any
+			if json.Unmarshal(doc, &m) != nil {
+				continue
+			}
+			f, ok := m["data"].(float64)
+			if !ok {
+				continue
+			}
+			f *= k
+			if updated.ValueType == "integer" && f != math.Round(f) {
+				rounded++
+				f = math.Round(f)
+			}
+			m["data"] = f
+			b, err := json.Marshal(m)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+				return
+			}
+			converted[id] = b
+		}
+		// Integer values that do not fit the new unit would lose precision
+		if rounded > 0 && !req.Convert {
+			c.JSON(http.StatusConflict, types.NewErrorResponse(types.ErrorCodeConflict, fmt.Sprintf("%d existing activities are not whole numbers of %s; set convert to true to round them or make the type float first", rounded, newUnit.Symbol)))
+			return
+		}
+	}
+
+	err = h.repo.UpdateActivityType(&updated, converted)
+	if err != nil {
+		if strings.Contains(err.Error(), "name conflict in this space") {
+			c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeConflict, "type name already exists in this space"))
+		} else {
+			c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		}
+		return
+	}
+	result, err := h.repo.GetActivityTypeByID(typeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, types.NewSuccessResponse(result))
+}
+
 func (h *ActivityTypesHandler) DeleteActivityType(c *gin.Context) {
 	spaceID, err := strconv.Atoi(c.Param("spaceId"))
 	if err != nil {
@@ -229,6 +461,11 @@ func (h *ActivityTypesHandler) GetActivityTypesBySpace(c *gin.Context) {
 		return
 	}
 
+	if c.Query("groupBy") == "category" {
+		h.getActivityTypesByCategory(c, spaceID)
+		return
+	}
+
 	// Use standardized pagination
 	pagination := types.ParsePaginationParams(c)
 
@@ -242,3 +479,279 @@ func (h *ActivityTypesHandler) GetActivityTypesBySpace(c *gin.Context) {
 	response := pagination.BuildResponse(activityTypes, total)
 	c.JSON(http.StatusOK, types.NewSuccessResponse(response))
 }
+
+// getActivityTypesByCategory lists all activity types of the space grouped by
+// category in category order. Types without a category, or whose category was
+// deleted, form a last group with a null category.
+func (h *ActivityTypesHandler) getActivityTypesByCategory(c *gin.Context, spaceID int) {
+	if h.categoriesRepo == nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "groupBy=category is not supported"))
+		return
+	}
+	categories, err := h.categoriesRepo.ListBySpace(spaceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
+	activityTypes, err := h.repo.GetActivityTypesBySpace(spaceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
+	groups := make([]models.ActivityTypeGroup, 0, len(categories)+1)
+	index := make(map[int]int, len(categories))
+	for _, cat := range categories {
+		index[cat.ID] = len(groups)
+		groups = append(groups, models.ActivityTypeGroup{Category: cat, ActivityTypes: []*models.ActivityType{}})
+	}
+	uncategorized := models.ActivityTypeGroup{ActivityTypes: []*models.ActivityType{}}
+	for _, t := range activityTypes {
+		if i, ok := index[t.CategoryID]; ok {
+			groups[i].ActivityTypes = append(groups[i].ActivityTypes, t)
+		} else {
+			uncategorized.ActivityTypes = append(uncategorized.ActivityTypes, t)
+		}
+	}
+	if len(uncategorized.ActivityTypes) > 0 {
+		groups = append(groups, uncategorized)
+	}
+	c.JSON(http.StatusOK, types.NewSuccessResponse(groups))
+}
+
+// checkCategory verifies a category can be used by types of the space.
+func (h *ActivityTypesHandler) checkCategory(c *gin.Context, categoryID, spaceID int) bool {
+	if h.categoriesRepo == nil {
+		return true
+	}
+	cat, err := h.categoriesRepo.GetByID(categoryID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return false
+	}
+	if cat == nil || !cat.AvailableIn(spaceID) {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "Invalid category"))
+		return false
+	}
+	return true
+}
+
+// validateActivityTypeDefinition applies the rules shared by create and update.
+// A rating type without a range gets the default 1-5 scale.
+func validateActivityTypeDefinition(t *models.ActivityType) error {
+	return validateActivityTypeLevel(t, 0)
+}
+
+// validateActivityTypeLevel validates t as a type or, below depth 0, as a
+// field of a composite type.
+func validateActivityTypeLevel(t *models.ActivityType, depth int) error {
+	validValueTypes := map[string]bool{
+		"integer":   true,
+		"float":     true,
+		"text":      true,
+		"boolean":   true,
+		"time":      true,
+		"enum":      true,
+		"rating":    true,
+		"composite": true,
+	}
+	if !validValueTypes[t.ValueType] {
+		return errors.New("Invalid value_type. Allowed: integer, float, text, boolean, time, enum, rating, composite")
+	}
+
+	aggregation := strings.ToLower(t.Aggregation)
+	validAggregations := map[string]bool{
+		"sum": true, "avg": true, "count": true, "min": true, "max": true,
+		"and": true, "or": true,
+		"count_true": true, "count_false": true,
+		"percentage_true": true, "percentage_false": true,
+		"mode": true, "distribution": true,
+	}
+	if !validAggregations[aggregation] {
+		return errors.New("Invalid aggregation. Allowed: sum, avg, count, min, max, and, or, count_true, count_false, percentage_true, percentage_false, mode, distribution")
+	}
+	if t.ValueType == "rating" {
+		if t.MinValue == nil {
+			v := 1.0
+			t.MinValue = &v
+		}
+		if t.MaxValue == nil {
+			v := 5.0
+			t.MaxValue = &v
+		}
+	}
+	if t.MinValue != nil && t.MaxValue != nil && *t.MinValue > *t.MaxValue {
+		return errors.New("min_value cannot be greater than max_value")
+	}
+	if t.ValueType == "text" && aggregation != "count" {
+		return errors.New("text supports only count aggregation")
+	}
+	boolAggSet := map[string]bool{
+		"and": true, "or": true, "count_true": true, "count_false": true, "percentage_true": true, "percentage_false": true,
+	}
+	if t.ValueType == "boolean" && !boolAggSet[aggregation] {
+		return errors.New("invalid aggregation for boolean")
+	}
+	if t.ValueType == "time" && t.Unit != nil && *t.Unit != "" {
+		return errors.New("time cannot have a unit")
+	}
+	if (aggregation == "mode" || aggregation == "distribution") && t.ValueType != "enum" && t.ValueType != "rating" {
+		return errors.New("mode and distribution are supported only for enum and rating")
+	}
+
+	switch t.ValueType {
+	case "enum":
+		if aggregation != "count" && aggregation != "mode" && aggregation != "distribution" {
+			return errors.New("enum supports only count, mode and distribution aggregations")
+		}
+		if t.MinValue != nil || t.MaxValue != nil || (t.Unit != nil && *t.Unit != "") {
+			return errors.New("enum cannot have min/max or a unit")
+		}
+		if len(t.Options) == 0 || len(t.Options) > maxActivityTypeOptions {
+			return fmt.Errorf("enum needs between 1 and %d options", maxActivityTypeOptions)
+		}
+		seen := make(map[string]bool, len(t.Options))
+		for i := range t.Options {
+			t.Options[i].Value = strings.TrimSpace(t.Options[i].Value)
+			v := t.Options[i].Value
+			if v == "" || seen[v] {
+				return errors.New("enum option values must be unique and non-empty")
+			}
+			seen[v] = true
+		}
+	case "rating":
+		if aggregation != "count" && aggregation != "avg" && aggregation != "min" && aggregation != "max" && aggregation != "mode" && aggregation != "distribution" {
+			return errors.New("rating supports only count, avg, min, max, mode and distribution aggregations")
+		}
+		lo, hi := *t.MinValue, *t.MaxValue
+		if lo != math.Trunc(lo) || hi != math.Trunc(hi) || hi-lo < 1 || hi-lo > maxRatingSteps {
+			return fmt.Errorf("rating range must be whole numbers spanning 2 to %d points", maxRatingSteps+1)
+		}
+		seen := make(map[string]bool, len(t.Options))
+		for i := range t.Options {
+			t.Options[i].Value = strings.TrimSpace(t.Options[i].Value)
+			v, err := strconv.Atoi(t.Options[i].Value)
+			if err != nil || float64(v) < lo || float64(v) > hi || seen[t.Options[i].Value] {
+				return errors.New("rating option values must be unique whole numbers within the range")
+			}
+			seen[t.Options[i].Value] = true
+		}
+	case "composite":
+		if aggregation != "count" {
+			return errors.New("composite supports only count aggregation; aggregate a field path instead")
+		}
+		if t.MinValue != nil || t.MaxValue != nil || (t.Unit != nil && *t.Unit != "") || len(t.Options) > 0 {
+			return errors.New("composite cannot have min/max, a unit or options")
+		}
+		if depth >= maxCompositeDepth {
+			return fmt.Errorf("composite fields can be nested at most %d levels", maxCompositeDepth)
+		}
+		if len(t.Fields) == 0 || len(t.Fields) > maxCompositeFields {
+			return fmt.Errorf("composite needs between 1 and %d fields", maxCompositeFields)
+		}
+		seen := make(map[string]bool, len(t.Fields))
+		for i := range t.Fields {
+			f := &t.Fields[i]
+			if !fieldKeyPattern.MatchString(f.Key) || seen[f.Key] {
+				return errors.New("field keys must be unique and match [a-z][a-z0-9_]*")
+			}
+			seen[f.Key] = true
+			ft := f.AsType()
+			if err := validateActivityTypeLevel(ft, depth+1); err != nil {
+				return fmt.Errorf("field %s: %v", f.Key, err)
+			}
+			// Keep defaults filled in by validation, such as the rating range
+			f.MinValue, f.MaxValue, f.Options, f.Fields = ft.MinValue, ft.MaxValue, ft.Options, ft.Fields
+		}
+	}
+	if t.ValueType != "enum" && t.ValueType != "rating" && len(t.Options) > 0 {
+		return errors.New("options are supported only for enum and rating")
+	}
+	if t.ValueType != "composite" && len(t.Fields) > 0 {
+		return errors.New("fields are supported only for composite")
+	}
+	return nil
+}
+
+const (
+	maxActivityTypeOptions = 100
+	maxRatingSteps         = 10
+	maxCompositeFields     = 20
+	maxCompositeDepth      = 3
+)
+
+var fieldKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,49}$`)
+
+// convertActivityValue turns a stored value (value->>'data') into a value of
+// type t. Without lenient only values that are already valid for t are
+// accepted; lenient also rounds floats to integers, maps booleans to 0/1 and
+// numbers to non-zero, and clamps ratings into their range.
+func convertActivityValue(raw string, t *models.ActivityType, lenient bool) (any, error) {
+	switch t.ValueType {
+	case "integer":
+		if v, err := strconv.Atoi(raw); err == nil {
+			return v, nil
+		}
+		if lenient {
+			if f, err := strconv.ParseFloat(raw, 64); err == nil {
+				return int(math.Round(f)), nil
+			}
+			if b, err := strconv.ParseBool(raw); err == nil {
+				if b {
+					return 1, nil
+				}
+				return 0, nil
+			}
+		}
+		return nil, errors.New("value must be integer")
+	case "float":
+		if f, err := strconv.ParseFloat(raw, 64); err == nil {
+			return f, nil
+		}
+		if lenient {
+			if b, err := strconv.ParseBool(raw); err == nil {
+				if b {
+					return 1.0, nil
+				}
+				return 0.0, nil
+			}
+		}
+		return nil, errors.New("value must be float")
+	case "boolean":
+		if b, err := strconv.ParseBool(raw); err == nil {
+			return b, nil
+		}
+		if lenient {
+			if f, err := strconv.ParseFloat(raw, 64); err == nil {
+				return f != 0, nil
+			}
+		}
+		return nil, errors.New("value must be boolean")
+	case "text":
+		return raw, nil
+	case "time":
+		if _, err := time.Parse(time.RFC3339, raw); err != nil {
+			return nil, errors.New("value must be valid RFC3339 time")
+		}
+		return raw, nil
+	case "enum":
+		for _, o := range t.Options {
+			if o.Value == raw {
+				return raw, nil
+			}
+		}
+		return nil, errors.New("value must be one of the options")
+	case "rating":
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, errors.New("value must be a rating")
+		}
+		if !lenient && (f != math.Trunc(f) || f < *t.MinValue || f > *t.MaxValue) {
+			return nil, errors.New("value must be a whole number within the rating range")
+		}
+		return int(math.Min(math.Max(math.Round(f), *t.MinValue), *t.MaxValue)), nil
+	case "composite":
+		return parseCompositeValue(t, raw)
+	default:
+		return nil, errors.New("unsupported value type")
+	}
+}
@@ -3,8 +3,10 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
+	"math"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 func (s *E2ETestSuite) Test42_CreateActivityType_Success() {
@@ -374,3 +376,373 @@ func (s *E2ETestSuite) Test55_CannotRestoreDefaultActivityType() {
 	defer resp.Body.Close()
 	s.Equal(http.StatusForbidden, resp.StatusCode)
 }
+
+func (s *E2ETestSuite) Test55B_UpdateActivityType() {
+	do := s.doJSON
+	base := "/spaces/" + strconv.Itoa(s.createdSpaceID) + "/activity-types"
+
+	code, out := do("POST", base, s.ownerToken, map[string]interface{}{
+		"name":        "Stepz",
+		"valueType":   "float",
+		"aggregation": "sum",
+		"unit":        "steps",
+	})
+	s.Equal(http.StatusCreated, code)
+	typeID := int(out["data"].(map[string]interface{})["id"].(float64))
+	modifiedAt := out["data"].(map[string]interface{})["modifiedAt"].(string)
+	typePath := base + "/" + strconv.Itoa(typeID)
+
+	code, _ = do("POST", "/activities", s.ownerToken, map[string]interface{}{"typeId": typeID, "value": "1200.6"})
+	s.Equal(http.StatusCreated, code)
+
+	// Rename, set a range and clear the unit.
+	code, out = do("PATCH", typePath, s.ownerToken, map[string]interface{}{
+		"name":     "Steps",
+		"minValue": 0,
+		"maxValue": 100000,
+		"unit":     nil,
+	})
+	s.Equal(http.StatusOK, code)
+	data := out["data"].(map[string]interface{})
+	s.Equal("Steps", data["name"])
+	s.Equal("float", data["valueType"])
+	s.Nil(data["unit"])
+	s.Equal(100000.0, data["maxValue"])
+	s.NotEqual(modifiedAt, data["modifiedAt"])
+
+	// Same validation as create.
+	code, _ = do("PATCH", typePath, s.ownerToken, map[string]interface{}{"minValue": 10, "maxValue": 5})
+	s.Equal(http.StatusBadRequest, code)
+	code, _ = do("PATCH", typePath, s.ownerToken, map[string]interface{}{"valueType": "text"})
+	s.Equal(http.StatusBadRequest, code)
+
+	// 1200.6 is not an integer: refused unless a conversion is requested.
+	code, _ = do("PATCH", typePath, s.ownerToken, map[string]interface{}{"valueType": "integer"})
+	s.Equal(http.StatusConflict, code)
+	code, out = do("PATCH", typePath, s.ownerToken, map[string]interface{}{"valueType": "integer", "convert": true})
+	s.Equal(http.StatusOK, code)
+	s.Equal("integer", out["data"].(map[string]interface{})["valueType"])
+
+	// Integers are valid floats, so going back needs no conversion.
+	code, _ = do("PATCH", typePath, s.ownerToken, map[string]interface{}{"valueType": "float"})
+	s.Equal(http.StatusOK, code)
+
+	// The rename is visible to sync.
+	code, out = do("GET", "/sync?since="+urlQuery(modifiedAt), s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	found := false
+	for _, item := range out["data"].(map[string]interface{})["activityTypes"].([]interface{}) {
+		at := item.(map[string]interface{})
+		if int(at["id"].(float64)) == typeID {
+			found = true
+			s.Equal("Steps", at["name"])
+		}
+	}
+	s.True(found)
+
+	// Default types cannot be edited, and guests have no permission.
+	code, _ = do("PATCH", base+"/1", s.ownerToken, map[string]interface{}{"name": "Renamed"})
+	s.Equal(http.StatusForbidden, code)
+	code, _ = do("PATCH", typePath, s.guestToken, map[string]interface{}{"name": "Guest"})
+	s.Equal(http.StatusForbidden, code)
+}
+
+func (s *E2ETestSuite) Test55C_EnumAndRatingTypes() {
+	do := s.doJSON
+	base := "/spaces/" + strconv.Itoa(s.createdSpaceID) + "/activity-types"
+
+	// Enum without options is rejected.
+	code, _ := do("POST", base, s.ownerToken, map[string]interface{}{
+		"name": "Workout kind", "valueType": "enum", "aggregation": "mode",
+	})
+	s.Equal(http.StatusBadRequest, code)
+
+	code, out := do("POST", base, s.ownerToken, map[string]interface{}{
+		"name":        "Workout kind",
+		"valueType":   "enum",
+		"aggregation": "distribution",
+		"options": []map[string]string{
+			{"value": "run", "label": "Running"},
+			{"value": "swim"},
+			{"value": "bike"},
+		},
+	})
+	s.Equal(http.StatusCreated, code)
+	enumID := int(out["data"].(map[string]interface{})["id"].(float64))
+	s.Len(out["data"].(map[string]interface{})["options"], 3)
+
+	// Rating defaults to a 1-5 scale; mode is only for enum and rating.
+	code, out = do("POST", base, s.ownerToken, map[string]interface{}{
+		"name": "Energy", "valueType": "rating", "aggregation": "avg",
+		"options": []map[string]string{{"value": "1", "label": "low"}, {"value": "5", "label": "high"}},
+	})
+	s.Equal(http.StatusCreated, code)
+	rating := out["data"].(map[string]interface{})
+	ratingID := int(rating["id"].(float64))
+	s.Equal(1.0, rating["minValue"])
+	s.Equal(5.0, rating["maxValue"])
+	code, _ = do("POST", base, s.ownerToken, map[string]interface{}{
+		"name": "Mode of floats", "valueType": "float", "aggregation": "mode",
+	})
+	s.Equal(http.StatusBadRequest, code)
+
+	// A note dated now so the analysis has one period.
+	code, out = do("POST", "/notes", s.ownerToken, map[string]interface{}{
+		"text": "workouts", "tags": []string{"enum"}, "spaceId": s.createdSpaceID,
+		"date": time.Now().Format(time.RFC3339),
+	})
+	s.Equal(http.StatusCreated, code)
+	noteID := int(out["data"].(map[string]interface{})["id"].(float64))
+
+	for _, v := range []string{"run", "run", "swim"} {
+		code, _ = do("POST", "/activities", s.ownerToken, map[string]interface{}{"typeId": enumID, "value": v, "note_id": noteID})
+		s.Equal(http.StatusCreated, code)
+	}
+	code, _ = do("POST", "/activities", s.ownerToken, map[string]interface{}{"typeId": enumID, "value": "ski", "note_id": noteID})
+	s.Equal(http.StatusBadRequest, code)
+	code, _ = do("POST", "/activities", s.ownerToken, map[string]interface{}{"typeId": ratingID, "value": "4", "note_id": noteID})
+	s.Equal(http.StatusCreated, code)
+	code, _ = do("POST", "/activities", s.ownerToken, map[string]interface{}{"typeId": ratingID, "value": "6", "note_id": noteID})
+	s.Equal(http.StatusBadRequest, code)
+
+	code, out = do("GET", "/activities?spaceId="+strconv.Itoa(s.createdSpaceID)+"&typeId="+strconv.Itoa(enumID)+"&periodId=4&tags=enum", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	periods := out["data"].([]interface{})
+	s.Len(periods, 1)
+	p := periods[0].(map[string]interface{})
+	s.Equal(3.0, p["value"])
+	counts := p["counts"].(map[string]interface{})
+	s.Equal(2.0, counts["run"])
+	s.Equal(1.0, counts["swim"])
+	s.Equal(0.0, counts["bike"])
+	s.InDelta(66.67, p["distribution"].(map[string]interface{})["run"].(float64), 0.01)
+
+	// Switching to mode reports the most frequent option.
+	code, _ = do("PATCH", base+"/"+strconv.Itoa(enumID), s.ownerToken, map[string]interface{}{"aggregation": "mode"})
+	s.Equal(http.StatusOK, code)
+	code, out = do("GET", "/activities?spaceId="+strconv.Itoa(s.createdSpaceID)+"&typeId="+strconv.Itoa(enumID)+"&periodId=4&tags=enum", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	s.Equal("run", out["data"].([]interface{})[0].(map[string]interface{})["value"])
+
+	// Dropping an option that is in use cannot be converted.
+	code, _ = do("PATCH", base+"/"+strconv.Itoa(enumID), s.ownerToken, map[string]interface{}{
+		"options": []map[string]string{{"value": "run"}, {"value": "bike"}}, "convert": true,
+	})
+	s.Equal(http.StatusConflict, code)
+}
+
+func (s *E2ETestSuite) Test55D_CompositeActivityTypes() {
+	do := s.doJSON
+	base := "/spaces/" + strconv.Itoa(s.createdSpaceID) + "/activity-types"
+
+	code, _ := do("POST", base, s.ownerToken, map[string]interface{}{
+		"name": "Bad composite", "valueType": "composite", "aggregation": "count",
+		"fields": []map[string]interface{}{{"key": "Bad Key", "valueType": "integer", "aggregation": "avg"}},
+	})
+	s.Equal(http.StatusBadRequest, code)
+
+	code, out := do("POST", base, s.ownerToken, map[string]interface{}{
+		"name":        "Vitals",
+		"valueType":   "composite",
+		"aggregation": "count",
+		"fields": []map[string]interface{}{
+			{"key": "bp", "valueType": "composite", "aggregation": "count", "fields": []map[string]interface{}{
+				{"key": "systolic", "valueType": "integer", "aggregation": "avg", "minValue": 50, "maxValue": 250},
+				{"key": "diastolic", "valueType": "integer", "aggregation": "avg"},
+			}},
+			{"key": "pulse", "valueType": "integer", "aggregation": "max"},
+		},
+	})
+	s.Equal(http.StatusCreated, code)
+	typeID := int(out["data"].(map[string]interface{})["id"].(float64))
+
+	code, out = do("POST", "/notes", s.ownerToken, map[string]interface{}{
+		"text": "vitals", "tags": []string{"vitals"}, "spaceId": s.createdSpaceID,
+		"date": time.Now().Format(time.RFC3339),
+	})
+	s.Equal(http.StatusCreated, code)
+	noteID := int(out["data"].(map[string]interface{})["id"].(float64))
+
+	for _, v := range []string{
+		`{"bp": {"systolic": 120, "diastolic": 80}, "pulse": 64}`,
+		`{"bp": {"systolic": "130", "diastolic": 85}}`,
+	} {
+		code, _ = do("POST", "/activities", s.ownerToken, map[string]interface{}{"typeId": typeID, "value": v, "note_id": noteID})
+		s.Equal(http.StatusCreated, code)
+	}
+	for _, v := range []string{`{"bp": {"systolic": 400}}`, `{"weight": 80}`, `120`} {
+		code, _ = do("POST", "/activities", s.ownerToken, map[string]interface{}{"typeId": typeID, "value": v, "note_id": noteID})
+		s.Equal(http.StatusBadRequest, code, v)
+	}
+
+	analysis := "/activities?spaceId=" + strconv.Itoa(s.createdSpaceID) + "&typeId=" + strconv.Itoa(typeID) + "&periodId=4&tags=vitals"
+	code, out = do("GET", analysis+"&field=bp.systolic", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	s.Equal(125.0, out["data"].([]interface{})[0].(map[string]interface{})["value"])
+	code, out = do("GET", analysis+"&field=pulse", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	s.Equal(64.0, out["data"].([]interface{})[0].(map[string]interface{})["value"])
+	code, out = do("GET", analysis, s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	s.Equal(2.0, out["data"].([]interface{})[0].(map[string]interface{})["value"])
+	code, _ = do("GET", analysis+"&field=bp", s.ownerToken, nil)
+	s.Equal(http.StatusBadRequest, code)
+
+	// Charts can target a field path.
+	chart := map[string]interface{}{
+		"spaceId": s.createdSpaceID, "kindId": 1, "activityTypeId": typeID, "periodId": 4,
+		"name": "Systolic", "fieldPath": "bp.nope",
+	}
+	code, _ = do("POST", "/charts", s.ownerToken, chart)
+	s.Equal(http.StatusBadRequest, code)
+	chart["fieldPath"] = "bp.systolic"
+	code, out = do("POST", "/charts", s.ownerToken, chart)
+	s.Equal(http.StatusCreated, code)
+	s.Equal("bp.systolic", out["data"].(map[string]interface{})["fieldPath"])
+	chartID := int(out["data"].(map[string]interface{})["id"].(float64))
+	code, _ = do("GET", "/charts/"+strconv.Itoa(chartID)+"/data", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+}
+
+func (s *E2ETestSuite) Test55E_UnitConversion() {
+	do := s.doJSON
+	spacePath := "/spaces/" + strconv.Itoa(s.createdSpaceID)
+
+	code, out := do("GET", "/units", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	s.NotEmpty(out["data"])
+
+	code, out = do("POST", spacePath+"/activity-types", s.ownerToken, map[string]interface{}{
+		"name": "Body weight", "valueType": "float", "aggregation": "avg", "unit": "kg",
+	})
+	s.Equal(http.StatusCreated, code)
+	typeID := int(out["data"].(map[string]interface{})["id"].(float64))
+	typePath := spacePath + "/activity-types/" + strconv.Itoa(typeID)
+
+	// Values entered in lb are stored in kg.
+	code, out = do("POST", spacePath+"/quick-log", s.ownerToken, map[string]interface{}{"typeId": typeID, "value": 165, "unit": "lbs"})
+	s.Equal(http.StatusCreated, code)
+	lbID := out["data"].(map[string]interface{})["id"].(float64)
+	code, _ = do("POST", "/activities", s.ownerToken, map[string]interface{}{"typeId": typeID, "value": "75", "unit": "kg", "spaceId": s.createdSpaceID})
+	s.Equal(http.StatusCreated, code)
+	code, _ = do("POST", spacePath+"/quick-log", s.ownerToken, map[string]interface{}{"typeId": typeID, "value": 5, "unit": "km"})
+	s.Equal(http.StatusBadRequest, code)
+
+	analysis := "/activities?spaceId=" + strconv.Itoa(s.createdSpaceID) + "&typeId=" + strconv.Itoa(typeID) + "&periodId=4"
+	code, out = do("GET", analysis, s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	kg := (165*0.45359237 + 75) / 2
+	s.InDelta(kg, out["data"].([]interface{})[0].(map[string]interface{})["value"], 0.001)
+
+	code, out = do("GET", analysis+"&unit=lb", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	s.InDelta(kg/0.45359237, out["data"].([]interface{})[0].(map[string]interface{})["value"], 0.001)
+	code, _ = do("GET", analysis+"&unit=km", s.ownerToken, nil)
+	s.Equal(http.StatusBadRequest, code)
+
+	// Switching the type to grams rescales stored values.
+	code, _ = do("PATCH", typePath, s.ownerToken, map[string]interface{}{"unit": "g"})
+	s.Equal(http.StatusOK, code)
+	code, out = do("GET", analysis, s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	s.InDelta(kg*1000, out["data"].([]interface{})[0].(map[string]interface{})["value"], 0.01)
+
+	// Neither rescaling nor converting the value type drops the entered value.
+	code, _ = do("PATCH", typePath, s.ownerToken, map[string]interface{}{"valueType": "integer", "aggregation": "avg", "convert": true})
+	s.Equal(http.StatusOK, code)
+	code, out = do("GET", "/sync?since=1970-01-01T00:00:00Z&spaceId="+strconv.Itoa(s.createdSpaceID), s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	var entered map[string]interface{}
+	for _, a := range out["data"].(map[string]interface{})["activities"].([]interface{}) {
+		if a := a.(map[string]interface{}); a["id"] == lbID {
+			value := a["value"].(map[string]interface{})
+			s.InDelta(math.Round(165*453.59237), value["data"], 0.001)
+			entered, _ = value["entered"].(map[string]interface{})
+		}
+	}
+	s.Require().NotNil(entered)
+	s.Equal("lb", entered["unit"])
+	s.InDelta(165, entered["value"], 0.001)
+
+	// Integer values that a larger unit leaves fractional are only rounded on request.
+	code, out = do("POST", spacePath+"/activity-types", s.ownerToken, map[string]interface{}{
+		"name": "Reading time", "valueType": "integer", "aggregation": "sum", "unit": "min",
+	})
+	s.Equal(http.StatusCreated, code)
+	readingID := int(out["data"].(map[string]interface{})["id"].(float64))
+	readingPath := spacePath + "/activity-types/" + strconv.Itoa(readingID)
+	code, _ = do("POST", spacePath+"/quick-log", s.ownerToken, map[string]interface{}{"typeId": readingID, "value": 90})
+	s.Equal(http.StatusCreated, code)
+	code, _ = do("PATCH", readingPath, s.ownerToken, map[string]interface{}{"unit": "h"})
+	s.Equal(http.StatusConflict, code)
+	code, _ = do("PATCH", readingPath, s.ownerToken, map[string]interface{}{"unit": "s"})
+	s.Equal(http.StatusOK, code)
+	code, _ = do("PATCH", readingPath, s.ownerToken, map[string]interface{}{"unit": "h", "convert": true})
+	s.Equal(http.StatusOK, code)
+}
+
+func (s *E2ETestSuite) Test55F_ActivityTypeCategories() {
+	do := s.doJSON
+	spacePath := "/spaces/" + strconv.Itoa(s.createdSpaceID)
+
+	code, out := do("POST", spacePath+"/activity-type-categories", s.ownerToken, map[string]interface{}{
+		"name": "Training", "icon": "dumbbell", "sortOrder": -1,
+	})
+	s.Equal(http.StatusCreated, code)
+	cat := out["data"].(map[string]interface{})
+	catID := int(cat["id"].(float64))
+	s.Equal(false, cat["isDefault"])
+	catPath := spacePath + "/activity-type-categories/" + strconv.Itoa(catID)
+
+	code, _ = do("POST", spacePath+"/activity-type-categories", s.ownerToken, map[string]interface{}{"name": "training"})
+	s.Equal(http.StatusConflict, code)
+	code, _ = do("POST", spacePath+"/activity-type-categories", s.guestToken, map[string]interface{}{"name": "Other"})
+	s.Equal(http.StatusForbidden, code)
+
+	code, out = do("POST", spacePath+"/activity-types", s.ownerToken, map[string]interface{}{
+		"name": "Push-ups", "valueType": "integer", "aggregation": "sum", "categoryId": catID,
+	})
+	s.Equal(http.StatusCreated, code)
+	typeID := out["data"].(map[string]interface{})["id"].(float64)
+	code, _ = do("POST", spacePath+"/activity-types", s.ownerToken, map[string]interface{}{
+		"name": "Pull-ups", "valueType": "integer", "aggregation": "sum", "categoryId": 999999,
+	})
+	s.Equal(http.StatusBadRequest, code)
+
+	// The custom category sorts first and holds the new type.
+	code, out = do("GET", spacePath+"/activity-types?groupBy=category", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	groups := out["data"].([]interface{})
+	first := groups[0].(map[string]interface{})
+	s.Equal(float64(catID), first["category"].(map[string]interface{})["id"])
+	s.Equal(typeID, first["activityTypes"].([]interface{})[0].(map[string]interface{})["id"])
+
+	code, out = do("PATCH", catPath, s.ownerToken, map[string]interface{}{"name": "Strength", "icon": nil})
+	s.Equal(http.StatusOK, code)
+	s.Equal("Strength", out["data"].(map[string]interface{})["name"])
+	s.Nil(out["data"].(map[string]interface{})["icon"])
+
+	// Deleted categories disappear from the list; their types become uncategorized.
+	code, _ = do("PATCH", catPath+"/delete", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	code, out = do("GET", spacePath+"/activity-types?groupBy=category", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	groups = out["data"].([]interface{})
+	last := groups[len(groups)-1].(map[string]interface{})
+	s.Nil(last["category"])
+
+	code, out = do("GET", "/sync?since=2000-01-01T00:00:00Z&spaceId="+strconv.Itoa(s.createdSpaceID), s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	found := false
+	for _, raw := range out["data"].(map[string]interface{})["activityTypeCategories"].([]interface{}) {
+		item := raw.(map[string]interface{})
+		if item["id"] == float64(catID) {
+			found = true
+			s.NotNil(item["deleted_at"])
+		}
+	}
+	s.True(found)
+
+	code, _ = do("PATCH", catPath+"/restore", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+}
@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"errors"
+	"focuz-api/models"
+	"focuz-api/repository"
+	"focuz-api/types"
+	"strings"
+)
+
+// withAggregation returns a copy of t aggregated by agg instead of its own
+// aggregation, checking that agg fits the value type and transform is known.
+// The activity type itself is not changed.
+func withAggregation(t *models.ActivityType, agg, transform string) (*models.ActivityType, error) {
+	out := *t
+	if agg != "" {
+		out.Aggregation = strings.ToLower(agg)
+		if !repository.AggregationSupported(out.ValueType, out.Aggregation) {
+			return nil, errors.New("aggregation " + agg + " is not supported for " + out.ValueType + " values")
+		}
+	}
+	if transform != "" {
+		if !types.IsTransform(transform) {
+			return nil, errors.New("invalid transform. Allowed: " + strings.Join(types.Transforms, ", "))
+		}
+		if out.ValueType == "enum" && out.Aggregation == "mode" {
+			return nil, errors.New("transforms need a numeric aggregation")
+		}
+	}
+	return &out, nil
+}
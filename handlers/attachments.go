@@ -21,12 +21,19 @@ type AttachmentsHandler struct {
 	attachmentsRepo *repository.AttachmentsRepository
 	notesRepo       *repository.NotesRepository
 	spacesRepo      *repository.SpacesRepository
+	filterCounter   *FilterCounter
 }
 
 func NewAttachmentsHandler(a *repository.AttachmentsRepository, n *repository.NotesRepository, s *repository.SpacesRepository) *AttachmentsHandler {
 	return &AttachmentsHandler{attachmentsRepo: a, notesRepo: n, spacesRepo: s}
 }
 
+// WithFilterCounter enables pushing saved filter counts after changes. It is optional.
+func (h *AttachmentsHandler) WithFilterCounter(fc *FilterCounter) *AttachmentsHandler {
+	h.filterCounter = fc
+	return h
+}
+
 func (h *AttachmentsHandler) UploadFile(c *gin.Context) {
 	userID := c.GetInt("userId")
 
@@ -118,6 +125,7 @@ func (h *AttachmentsHandler) UploadFile(c *gin.Context) {
 		"filename":      file.Filename,
 		"size":          file.Size,
 	}))
+	h.filterCounter.Publish(note.SpaceID)
 }
 
 func (h *AttachmentsHandler) uploadFileToMinIO(file *multipart.FileHeader, noteID int, clientID *string, contentType string) (string, error) {
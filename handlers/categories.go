@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"encoding/json"
+	"focuz-api/globals"
+	"focuz-api/models"
+	"focuz-api/repository"
+	"focuz-api/types"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CategoriesHandler struct {
+	repo       *repository.CategoriesRepository
+	spacesRepo *repository.SpacesRepository
+}
+
+func NewCategoriesHandler(r *repository.CategoriesRepository, s *repository.SpacesRepository) *CategoriesHandler {
+	return &CategoriesHandler{repo: r, spacesRepo: s}
+}
+
+// GetCategories lists the default categories and the space's custom ones.
+func (h *CategoriesHandler) GetCategories(c *gin.Context) {
+	spaceID, err := strconv.Atoi(c.Param("spaceId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "Invalid space ID"))
+		return
+	}
+	roleID, err := h.spacesRepo.GetUserRoleIDInSpace(c.GetInt("userId"), spaceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
+	if roleID == 0 {
+		c.JSON(http.StatusForbidden, types.NewErrorResponse(types.ErrorCodeForbidden, "No access to the space"))
+		return
+	}
+	list, err := h.repo.ListBySpace(spaceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, types.NewSuccessResponse(list))
+}
+
+func (h *CategoriesHandler) CreateCategory(c *gin.Context) {
+	spaceID, ok := h.ownerSpaceID(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Name      string  `json:"name" binding:"required"`
+		Icon      *string `json:"icon"`
+		SortOrder int     `json:"sortOrder"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
+		return
+	}
+	cat := &models.ActivityTypeCategory{SpaceID: &spaceID, Name: req.Name, Icon: req.Icon, SortOrder: req.SortOrder}
+	if !normalizeCategory(c, cat) {
+		return
+	}
+	created, err := h.repo.Create(cat)
+	if err != nil {
+		writeCategoryError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, types.NewSuccessResponse(created))
+}
+
+func (h *CategoriesHandler) UpdateCategory(c *gin.Context) {
+	cat, ok := h.loadCustomCategory(c)
+	if !ok {
+		return
+	}
+	if cat.IsDeleted {
+		c.JSON(http.StatusNotFound, types.NewErrorResponse(types.ErrorCodeNotFound, "Category not found"))
+		return
+	}
+	// Icon stays raw to tell an omitted field (keep) from null (clear).
+	var req struct {
+		Name      *string         `json:"name"`
+		Icon      json.RawMessage `json:"icon"`
+		SortOrder *int            `json:"sortOrder"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
+		return
+	}
+	if req.Name != nil {
+		cat.Name = *req.Name
+	}
+	if len(req.Icon) > 0 {
+		cat.Icon = nil
+		if err := json.Unmarshal(req.Icon, &cat.Icon); err != nil {
+			c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
+			return
+		}
+	}
+	if req.SortOrder != nil {
+		cat.SortOrder = *req.SortOrder
+	}
+	if !normalizeCategory(c, cat) {
+		return
+	}
+	if err := h.repo.Update(cat); err != nil {
+		writeCategoryError(c, err)
+		return
+	}
+	updated, err := h.repo.GetByID(cat.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, types.NewSuccessResponse(updated))
+}
+
+// DeleteCategory soft deletes a custom category. Activity types that use it
+// show up as uncategorized until it is restored.
+func (h *CategoriesHandler) DeleteCategory(c *gin.Context) {
+	h.setDeleted(c, true)
+}
+
+func (h *CategoriesHandler) RestoreCategory(c *gin.Context) {
+	h.setDeleted(c, false)
+}
+
+func (h *CategoriesHandler) setDeleted(c *gin.Context, isDeleted bool) {
+	cat, ok := h.loadCustomCategory(c)
+	if !ok {
+		return
+	}
+	if err := h.repo.SetDeleted(cat.ID, isDeleted); err != nil {
+		writeCategoryError(c, err)
+		return
+	}
+	if isDeleted {
+		c.JSON(http.StatusOK, types.NewSuccessResponse(gin.H{"message": "Category deleted successfully"}))
+		return
+	}
+	restored, err := h.repo.GetByID(cat.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, types.NewSuccessResponse(restored))
+}
+
+// ownerSpaceID parses the space and requires the caller to own it; like
+// activity types, categories are managed by space owners.
+func (h *CategoriesHandler) ownerSpaceID(c *gin.Context) (int, bool) {
+	spaceID, err := strconv.Atoi(c.Param("spaceId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "Invalid space ID"))
+		return 0, false
+	}
+	roleID, err := h.spacesRepo.GetUserRoleIDInSpace(c.GetInt("userId"), spaceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return 0, false
+	}
+	if roleID == 0 || roleID != globals.DefaultOwnerRoleID {
+		c.JSON(http.StatusForbidden, types.NewErrorResponse(types.ErrorCodeForbidden, "No permission"))
+		return 0, false
+	}
+	return spaceID, true
+}
+
+// loadCustomCategory loads the category of the route, which must belong to
+// the space; default categories are read-only.
+func (h *CategoriesHandler) loadCustomCategory(c *gin.Context) (*models.ActivityTypeCategory, bool) {
+	spaceID, ok := h.ownerSpaceID(c)
+	if !ok {
+		return nil, false
+	}
+	categoryID, err := strconv.Atoi(c.Param("categoryId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "Invalid category ID"))
+		return nil, false
+	}
+	cat, err := h.repo.GetByID(categoryID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return nil, false
+	}
+	if cat == nil || (cat.SpaceID != nil && *cat.SpaceID != spaceID) {
+		c.JSON(http.StatusNotFound, types.NewErrorResponse(types.ErrorCodeNotFound, "Category not found"))
+		return nil, false
+	}
+	if cat.IsDefault {
+		c.JSON(http.StatusForbidden, types.NewErrorResponse(types.ErrorCodeForbidden, "Cannot edit default category"))
+		return nil, false
+	}
+	return cat, true
+}
+
+// normalizeCategory trims the name and icon and checks their lengths.
+func normalizeCategory(c *gin.Context, cat *models.ActivityTypeCategory) bool {
+	cat.Name = strings.TrimSpace(cat.Name)
+	if cat.Name == "" || len(cat.Name) > 255 {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "name must be 1-255 characters"))
+		return false
+	}
+	if cat.Icon != nil {
+		icon := strings.TrimSpace(*cat.Icon)
+		if len(icon) > 64 {
+			c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "icon must be at most 64 characters"))
+			return false
+		}
+		cat.Icon = &icon
+		if icon == "" {
+			cat.Icon = nil
+		}
+	}
+	return true
+}
+
+func writeCategoryError(c *gin.Context, err error) {
+	if strings.Contains(err.Error(), "name conflict in this space") {
+		c.JSON(http.StatusConflict, types.NewErrorResponse(types.ErrorCodeConflict, "category name already exists in this space"))
+		return
+	}
+	c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+}
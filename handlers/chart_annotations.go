@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"focuz-api/models"
+	"focuz-api/repository"
+	"focuz-api/types"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxAnnotationLabel bounds the length of an annotation label in characters.
+const maxAnnotationLabel = 255
+
+// WithAnnotations lets charts carry annotations. Without it the annotation
+// endpoints answer 404 and annotations=true returns none.
+func (h *ChartsHandler) WithAnnotations(r *repository.ChartAnnotationsRepository) *ChartsHandler {
+	h.annotationsRepo = r
+	return h
+}
+
+// GetChartAnnotations lists the annotations of a chart: its own and those of
+// the notes carrying its annotation tag, dated in the user's time zone.
+func (h *ChartsHandler) GetChartAnnotations(c *gin.Context) {
+	chart, ok := h.readableChart(c)
+	if !ok || !h.checkAnnotations(c) {
+		return
+	}
+	zone, _, err := timeSettings(c, h.usersRepo)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
+		return
+	}
+	annotations, err := h.annotationsRepo.List(chart, zone, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, types.NewSuccessResponse(annotations))
+}
+
+func (h *ChartsHandler) CreateChartAnnotation(c *gin.Context) {
+	chart, ok := h.readableChart(c)
+	if !ok || !h.checkAnnotations(c) {
+		return
+	}
+	var req struct {
+		Date    string  `json:"date" binding:"required"`
+		EndDate *string `json:"endDate"`
+		Label   string  `json:"label" binding:"required"`
+		NoteID  *int    `json:"noteId"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
+		return
+	}
+	a := &models.ChartAnnotation{
+		ChartID: chart.ID,
+		UserID:  c.GetInt("userId"),
+		Date:    req.Date,
+		EndDate: req.EndDate,
+		Label:   strings.TrimSpace(req.Label),
+		NoteID:  req.NoteID,
+	}
+	if !h.checkAnnotation(c, chart.SpaceID, a) {
+		return
+	}
+	created, err := h.annotationsRepo.Create(a)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
+	c.JSON(http.StatusCreated, types.NewSuccessResponse(created))
+}
+
+// UpdateChartAnnotation changes the given fields; null clears endDate or
+// noteId.
+func (h *ChartsHandler) UpdateChartAnnotation(c *gin.Context) {
+	a, chart, ok := h.loadAnnotation(c, false)
+	if !ok {
+		return
+	}
+	var req struct {
+		Date  *string `json:"date"`
+		Label *string `json:"label"`
+		// Nullable fields stay raw to tell an omitted field (keep) from null (clear).
+		EndDate json.RawMessage `json:"endDate"`
+		NoteID  json.RawMessage `json:"noteId"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
+		return
+	}
+	if req.Date != nil {
+		a.Date = *req.Date
+	}
+	if req.Label != nil {
+		a.Label = strings.TrimSpace(*req.Label)
+	}
+	if len(req.EndDate) > 0 {
+		a.EndDate = nil
+		if err := json.Unmarshal(req.EndDate, &a.EndDate); err != nil {
+			c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "Invalid endDate"))
+			return
+		}
+	}
+	if len(req.NoteID) > 0 {
+		a.NoteID = nil
+		if err := json.Unmarshal(req.NoteID, &a.NoteID); err != nil {
+			c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "Invalid noteId"))
+			return
+		}
+	}
+	if !h.checkAnnotation(c, chart.SpaceID, a) {
+		return
+	}
+	if err := h.annotationsRepo.Update(a); err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, types.NewSuccessResponse(gin.H{"message": "Annotation updated successfully"}))
+}
+
+func (h *ChartsHandler) DeleteChartAnnotation(c *gin.Context) {
+	a, _, ok := h.loadAnnotation(c, false)
+	if !ok {
+		return
+	}
+	if err := h.annotationsRepo.UpdateDeleted(a.ID, true); err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, types.NewSuccessResponse(gin.H{"message": "Annotation deleted successfully"}))
+}
+
+func (h *ChartsHandler) RestoreChartAnnotation(c *gin.Context) {
+	a, _, ok := h.loadAnnotation(c, true)
+	if !ok {
+		return
+	}
+	if err := h.annotationsRepo.UpdateDeleted(a.ID, false); err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, types.NewSuccessResponse(gin.H{"message": "Annotation restored successfully"}))
+}
+
+// checkAnnotations writes a 404 when annotations are not enabled.
+func (h *ChartsHandler) checkAnnotations(c *gin.Context) bool {
+	if h.annotationsRepo == nil {
+		c.JSON(http.StatusNotFound, types.NewErrorResponse(types.ErrorCodeNotFound, "Annotations are not available"))
+		return false
+	}
+	return true
+}
+
+// loadAnnotation fetches the annotation of the :id param, deleted or live as
+// asked, with its live chart, for a member of the chart's space. It writes
+// the error response otherwise.
+func (h *ChartsHandler) loadAnnotation(c *gin.Context, deleted bool) (*models.ChartAnnotation, *models.Chart, bool) {
+	if !h.checkAnnotations(c) {
+		return nil, nil, false
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "Invalid ID"))
+		return nil, nil, false
+	}
+	a, err := h.annotationsRepo.GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return nil, nil, false
+	}
+	var chart *models.Chart
+	if a != nil && a.IsDeleted == deleted {
+		if chart, err = h.chartsRepo.GetChartByID(a.ChartID); err != nil {
+			c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+			return nil, nil, false
+		}
+	}
+	if chart == nil || chart.IsDeleted {
+		c.JSON(http.StatusNotFound, types.NewErrorResponse(types.ErrorCodeNotFound, "Annotation not found"))
+		return nil, nil, false
+	}
+	roleID, err := h.spacesRepo.GetUserRoleIDInSpace(c.GetInt("userId"), chart.SpaceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return nil, nil, false
+	}
+	if roleID == 0 {
+		c.JSON(http.StatusForbidden, types.NewErrorResponse(types.ErrorCodeForbidden, "No access to the space"))
+		return nil, nil, false
+	}
+	return a, chart, true
+}
+
+// checkAnnotation writes a 400 unless the annotation has a label, valid dates
+// and, if any, a live note of spaceID.
+func (h *ChartsHandler) checkAnnotation(c *gin.Context, spaceID int, a *models.ChartAnnotation) bool {
+	if err := validateAnnotation(a); err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
+		return false
+	}
+	if a.NoteID != nil {
+		note, err := h.notesRepo.GetNoteByID(*a.NoteID)
+		if err != nil || note == nil || note.IsDeleted || note.SpaceID != spaceID {
+			c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeInvalidRequest, "Invalid note for this space"))
+			return false
+		}
+	}
+	return true
+}
+
+func validateAnnotation(a *models.ChartAnnotation) error {
+	if a.Label == "" || utf8.RuneCountInString(a.Label) > maxAnnotationLabel {
+		return errors.New("label must have 1 to 255 characters")
+	}
+	date, err := time.Parse("2006-01-02", a.Date)
+	if err != nil {
+		return errors.New("date must be a date (YYYY-MM-DD)")
+	}
+	if a.EndDate != nil {
+		end, err := time.Parse("2006-01-02", *a.EndDate)
+		if err != nil {
+			return errors.New("endDate must be a date (YYYY-MM-DD)")
+		}
+		if end.Before(date) {
+			return errors.New("endDate must not be before date")
+		}
+	}
+	return nil
+}
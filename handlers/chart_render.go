@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"focuz-api/models"
+	"focuz-api/pkg/chartrender"
+	"focuz-api/types"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// renderCacheSize bounds the rendered images kept in memory.
+const renderCacheSize = 256
+
+// renderCache keeps the most recently used rendered images by key.
+type renderCache struct {
+	mu      sync.Mutex
+	max     int
+	order   *list.List // front is the most recently used
+	entries map[string]*list.Element
+}
+
+type renderedImage struct {
+	key  string
+	body []byte
+}
+
+func newRenderCache(max int) *renderCache {
+	return &renderCache{max: max, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+func (rc *renderCache) get(key string) ([]byte, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	e, ok := rc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	rc.order.MoveToFront(e)
+	return e.Value.(*renderedImage).body, true
+}
+
+func (rc *renderCache) put(key string, body []byte) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if e, ok := rc.entries[key]; ok {
+		e.Value.(*renderedImage).body = body
+		rc.order.MoveToFront(e)
+		return
+	}
+	rc.entries[key] = rc.order.PushFront(&renderedImage{key: key, body: body})
+	for rc.order.Len() > rc.max {
+		oldest := rc.order.Back()
+		rc.order.Remove(oldest)
+		delete(rc.entries, oldest.Value.(*renderedImage).key)
+	}
+}
+
+var renderContentTypes = map[string]string{
+	"svg": "image/svg+xml",
+	"png": "image/png",
+}
+
+// RenderChart draws a line or bar chart as an SVG or PNG image. It takes the
+// overrides of GetChartData except compare, trend, forecast and annotations.
+// Images are cached by the chart, its data version, the request and the
+// current day (minute for charts without a range, whose window slides), and
+// served with an ETag.
+func (h *ChartsHandler) RenderChart(c *gin.Context) {
+	chart, ok := h.readableChart(c)
+	if !ok {
+		return
+	}
+	format := strings.ToLower(c.DefaultQuery("format", "svg"))
+	contentType, ok := renderContentTypes[format]
+	if !ok {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "format must be svg or png"))
+		return
+	}
+	opts := chartrender.Options{Theme: chartrender.Theme(strings.ToLower(c.DefaultQuery("theme", "light")))}
+	var err error
+	if opts.Width, err = strconv.Atoi(c.DefaultQuery("width", "800")); err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "Invalid width"))
+		return
+	}
+	if opts.Height, err = strconv.Atoi(c.DefaultQuery("height", "400")); err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "Invalid height"))
+		return
+	}
+	if err := opts.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
+		return
+	}
+	q, err := parseChartQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
+		return
+	}
+	if q.Compare != "" {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "compare is not supported when rendering"))
+		return
+	}
+	if q.Trend.isSet() {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "trend and forecast are not supported when rendering"))
+		return
+	}
+	if q.Annotations {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "annotations are not supported when rendering"))
+		return
+	}
+	kind := types.GetChartTypeByID(chart.KindID)
+	if kind == nil || (kind.Name != "lineChart" && kind.Name != "barChart") {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, chartrender.ErrKind.Error()))
+		return
+	}
+	zone, loc, err := timeSettings(c, h.usersRepo)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
+		return
+	}
+
+	version, err := h.chartsRepo.GetDataVersion(chart)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
+	now := time.Now().In(loc)
+	stamp := now.Format("2006-01-02")
+	if chart.RangeDays == nil && chart.RangeFrom == nil && q.RangeDays == nil && q.From == "" && q.To == "" {
+		stamp = now.Format("2006-01-02T15:04")
+	}
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		strconv.Itoa(chart.ID), version, zone.Timezone, zone.WeekStart, stamp, c.Request.URL.Query().Encode(),
+	}, "\x00")))
+	key := hex.EncodeToString(sum[:])
+	etag := `"` + key[:32] + `"`
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "private, no-cache")
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	if body, ok := h.renders.get(key); ok {
+		c.Data(http.StatusOK, contentType, body)
+		return
+	}
+
+	data, err := h.chartData(chart, q, zone)
+	if err != nil {
+		writeChartDataError(c, err)
+		return
+	}
+	// chartData applied the overrides to chart, so the series resolve as
+	// they were computed
+	resolved, _, err := h.resolveSeries(chart, q.Unit)
+	if err != nil {
+		writeChartDataError(c, err)
+		return
+	}
+	body, err := renderChart(chart, kind.Name, resolved, q.Unit, data.([]models.ChartDataPoint), format, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
+	h.renders.put(key, body)
+	c.Data(http.StatusOK, contentType, body)
+}
+
+// renderChart draws the points of a line or bar chart, labelling each series
+// with its type or field name and unit.
+func renderChart(chart *models.Chart, kind string, resolved []*models.ActivityType, unit string, points []models.ChartDataPoint, format string, opts chartrender.Options) ([]byte, error) {
+	ch := chartrender.Chart{Title: chart.Name, Kind: chartrender.Line}
+	if kind == "barChart" {
+		ch.Kind = chartrender.Bar
+	}
+	if period := types.GetPeriodTypeByID(chart.PeriodID); period != nil {
+		ch.Period = period.Name
+	}
+	for i, s := range chart.Series {
+		name := resolved[i].Name
+		if name == "" {
+			name = stringValue(s.FieldPath)
+		}
+		ch.Series = append(ch.Series, chartrender.Series{
+			Name:  name,
+			Color: stringValue(s.Color),
+			Axis:  s.Axis,
+			Unit:  displayUnit(resolved[i], unit),
+		})
+	}
+	for _, p := range points {
+		ch.Points = append(ch.Points, chartrender.Point{Date: p.Date, Values: p.Values})
+	}
+	if format == "png" {
+		return chartrender.PNG(ch, opts)
+	}
+	return chartrender.SVG(ch, opts)
+}
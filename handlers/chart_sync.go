@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"encoding/json"
+	"focuz-api/models"
+	"focuz-api/types"
+	"strings"
+)
+
+// checkChartChange validates a chart pushed through sync as UpdateChart
+// validates a PATCH. The change is merged over the stored chart the way the
+// push applies it (omitted and null fields keep their value; kind, period and
+// activity type are replaced), and the result must have a valid kind and
+// period, series of activity types of the chart's space led by its activity
+// type, options fitting its kind, a valid range and a saved filter that
+// userID and the chart's owner can see. Tags and filter_id may be null to
+// clear them. The pushed series, options and tags are rewritten normalized.
+// It returns false when the change must not be written.
+func (h *ChartsHandler) checkChartChange(userID int, current *models.Chart, ch *types.ChartChange) (bool, error) {
+	if types.GetPeriodTypeByID(ch.PeriodID) == nil {
+		return false, nil
+	}
+	merged := *current
+	merged.KindID, merged.PeriodID, merged.ActivityTypeID = ch.KindID, ch.PeriodID, ch.ActivityTypeID
+	kept := []struct {
+		src *string
+		dst **string
+	}{
+		{ch.FieldPath, &merged.FieldPath},
+		{ch.Aggregation, &merged.Aggregation},
+		{ch.Transform, &merged.Transform},
+		{ch.RangeFrom, &merged.RangeFrom},
+		{ch.RangeTo, &merged.RangeTo},
+		{ch.Fill, &merged.Fill},
+	}
+	for _, f := range kept {
+		if f.src != nil {
+			*f.dst = f.src
+		}
+	}
+	if ch.RangeDays != nil {
+		merged.RangeDays = ch.RangeDays
+	}
+	seriesSent := len(ch.Series) > 0 && string(ch.Series) != "null"
+	if seriesSent {
+		merged.Series = nil
+		if err := json.Unmarshal(ch.Series, &merged.Series); err != nil || len(merged.Series) == 0 {
+			return false, nil
+		}
+	}
+	if len(ch.Options) > 0 && string(ch.Options) != "null" {
+		merged.Options = nil
+		if err := json.Unmarshal(ch.Options, &merged.Options); err != nil {
+			return false, nil
+		}
+	}
+	if len(ch.Tags) > 0 {
+		var tags []string
+		if err := json.Unmarshal(ch.Tags, &tags); err != nil {
+			return false, nil
+		}
+		merged.Tags = cleanTags(tags)
+	}
+	if len(ch.FilterID) > 0 {
+		merged.FilterID = nil
+		if err := json.Unmarshal(ch.FilterID, &merged.FilterID); err != nil {
+			return false, nil
+		}
+		if merged.FilterID != nil {
+			ok, err := h.chartFilterVisible(current.SpaceID, *merged.FilterID, userID, current.UserID)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+	}
+
+	checked := merged.Series
+	if len(checked) > 0 {
+		if checked[0].ActivityTypeID != merged.ActivityTypeID {
+			return false, nil
+		}
+	} else {
+		checked = []models.ChartSeries{{ActivityTypeID: merged.ActivityTypeID, FieldPath: merged.FieldPath, Aggregation: merged.Aggregation}}
+	}
+	seriesTypes, err := h.validateSeries(current.SpaceID, checked, merged.Transform)
+	if err != nil {
+		return false, nil
+	}
+	if err := validateChartKind(&merged, seriesTypes); err != nil {
+		return false, nil
+	}
+	if err := validateChartRange(&merged); err != nil {
+		return false, nil
+	}
+
+	if ch.Aggregation != nil {
+		aggregation := strings.ToLower(*ch.Aggregation)
+		ch.Aggregation = &aggregation
+	}
+	if ch.Fill != nil {
+		ch.Fill = merged.Fill
+	}
+	if seriesSent {
+		if ch.Series, err = json.Marshal(merged.Series); err != nil {
+			return false, err
+		}
+	}
+	if len(ch.Tags) > 0 {
+		if ch.Tags, err = json.Marshal(merged.Tags); err != nil {
+			return false, err
+		}
+	}
+	if merged.Options != nil {
+		if ch.Options, err = json.Marshal(merged.Options); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
@@ -1,20 +1,41 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"focuz-api/models"
 	"focuz-api/repository"
 	"focuz-api/types"
 	"net/http"
+	"regexp"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// maxChartRangeDays bounds a chart's range to about ten years of day buckets.
+const maxChartRangeDays = 3660
+
+// maxChartSeries bounds the series of one chart.
+const maxChartSeries = 8
+
+// maxHistogramBins bounds the bins of a histogram chart.
+const maxHistogramBins = 100
+
+var chartColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
 type ChartsHandler struct {
 	chartsRepo        *repository.ChartsRepository
 	spacesRepo        *repository.SpacesRepository
 	notesRepo         *repository.NotesRepository
 	activityTypesRepo *repository.ActivityTypesRepository
+	usersRepo         *repository.UsersRepository
+	filtersRepo       *repository.FiltersRepository
+	annotationsRepo   *repository.ChartAnnotationsRepository
+	renders           *renderCache
 }
 
 func NewChartsHandler(
@@ -28,9 +49,24 @@ func NewChartsHandler(
 		spacesRepo:        sr,
 		notesRepo:         nr,
 		activityTypesRepo: atr,
+		renders:           newRenderCache(renderCacheSize),
 	}
 }
 
+// WithUserSettings buckets chart data in each user's time zone. It is
+// optional; without it periods are UTC.
+func (h *ChartsHandler) WithUserSettings(r *repository.UsersRepository) *ChartsHandler {
+	h.usersRepo = r
+	return h
+}
+
+// WithFilters lets charts be scoped to a saved filter. Without it filterId is
+// rejected.
+func (h *ChartsHandler) WithFilters(r *repository.FiltersRepository) *ChartsHandler {
+	h.filtersRepo = r
+	return h
+}
+
 func (h *ChartsHandler) GetChartTypes(c *gin.Context) {
 	c.JSON(http.StatusOK, types.NewSuccessResponse(types.ChartTypes))
 }
@@ -43,16 +79,35 @@ func (h *ChartsHandler) CreateChart(c *gin.Context) {
 	var req struct {
 		SpaceID        int     `json:"spaceId" binding:"required"`
 		KindID         int     `json:"kindId" binding:"required"`
-		ActivityTypeID int     `json:"activityTypeId" binding:"required"`
+		ActivityTypeID int     `json:"activityTypeId"`
 		PeriodID       int     `json:"periodId" binding:"required"`
 		Name           string  `json:"name" binding:"required"`
 		Description    *string `json:"description"`
 		NoteID         *int    `json:"noteId"`
+		FieldPath      *string `json:"fieldPath"`
+		Aggregation    *string `json:"aggregation"`
+		Transform      *string `json:"transform"`
+		RangeDays      *int    `json:"rangeDays"`
+		RangeFrom      *string `json:"rangeFrom"`
+		RangeTo        *string `json:"rangeTo"`
+		Fill           *string `json:"fill"`
+		// Series replaces activityTypeId, fieldPath and aggregation when given
+		Series  []models.ChartSeries `json:"series"`
+		Options *models.ChartOptions `json:"options"`
+		// Tags and filterId scope every series
+		Tags     []string `json:"tags"`
+		FilterID *int     `json:"filterId"`
+		// Notes with annotationTag annotate the chart
+		AnnotationTag *string `json:"annotationTag"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
 		return
 	}
+	if req.ActivityTypeID == 0 && len(req.Series) == 0 {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "activityTypeId or series is required"))
+		return
+	}
 
 	chartType := types.GetChartTypeByID(req.KindID)
 	if chartType == nil {
@@ -77,9 +132,12 @@ func (h *ChartsHandler) CreateChart(c *gin.Context) {
 		return
 	}
 
-	activityType, err := h.activityTypesRepo.GetActivityTypeByID(req.ActivityTypeID)
-	if err != nil || activityType == nil || activityType.IsDeleted {
-		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeInvalidRequest, "Invalid activity type"))
+	series := req.Series
+	if len(series) == 0 {
+		series = []models.ChartSeries{{ActivityTypeID: req.ActivityTypeID, FieldPath: req.FieldPath, Aggregation: req.Aggregation}}
+	}
+	seriesTypes, ok := h.checkSeries(c, req.SpaceID, series, req.Transform)
+	if !ok {
 		return
 	}
 
@@ -90,8 +148,44 @@ func (h *ChartsHandler) CreateChart(c *gin.Context) {
 			return
 		}
 	}
+	if !h.checkChartFilter(c, req.SpaceID, req.FilterID, userID) {
+		return
+	}
 
-	chart, err := h.chartsRepo.CreateChart(userID, req.SpaceID, req.KindID, req.ActivityTypeID, req.PeriodID, req.Name, req.Description, req.NoteID)
+	newChart := &models.Chart{
+		UserID:         userID,
+		SpaceID:        req.SpaceID,
+		KindID:         req.KindID,
+		ActivityTypeID: series[0].ActivityTypeID,
+		PeriodID:       req.PeriodID,
+		Name:           req.Name,
+		Description:    req.Description,
+		NoteID:         req.NoteID,
+		FieldPath:      series[0].FieldPath,
+		Aggregation:    series[0].Aggregation,
+		Transform:      req.Transform,
+		RangeDays:      req.RangeDays,
+		RangeFrom:      req.RangeFrom,
+		RangeTo:        req.RangeTo,
+		Fill:           req.Fill,
+		Options:        req.Options,
+		Tags:           cleanTags(req.Tags),
+		FilterID:       req.FilterID,
+		AnnotationTag:  cleanAnnotationTag(req.AnnotationTag),
+	}
+	if len(req.Series) > 0 {
+		newChart.Series = series
+	}
+	if err := validateChartKind(newChart, seriesTypes); err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
+		return
+	}
+	if err := validateChartRange(newChart); err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
+		return
+	}
+
+	chart, err := h.chartsRepo.CreateChart(newChart)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
 		return
@@ -207,6 +301,21 @@ func (h *ChartsHandler) UpdateChart(c *gin.Context) {
 		Name           *string `json:"name"`
 		Description    *string `json:"description"`
 		NoteID         *int    `json:"noteId"`
+		// Nullable fields stay raw to tell an omitted field (keep) from null (clear).
+		FieldPath   json.RawMessage `json:"fieldPath"`
+		Aggregation json.RawMessage `json:"aggregation"`
+		Transform   json.RawMessage `json:"transform"`
+		RangeDays   json.RawMessage `json:"rangeDays"`
+		RangeFrom   json.RawMessage `json:"rangeFrom"`
+		RangeTo     json.RawMessage `json:"rangeTo"`
+		Fill        json.RawMessage `json:"fill"`
+		// Series replaces the list; null leaves only the first series
+		Series  json.RawMessage `json:"series"`
+		Options json.RawMessage `json:"options"`
+		Tags    json.RawMessage `json:"tags"`
+		// FilterID null removes the saved filter scope
+		FilterID      json.RawMessage `json:"filterId"`
+		AnnotationTag json.RawMessage `json:"annotationTag"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
@@ -229,14 +338,6 @@ func (h *ChartsHandler) UpdateChart(c *gin.Context) {
 		}
 	}
 
-	if req.ActivityTypeID != nil {
-		activityType, err := h.activityTypesRepo.GetActivityTypeByID(*req.ActivityTypeID)
-		if err != nil || activityType == nil || activityType.IsDeleted {
-			c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeInvalidRequest, "Invalid activity type"))
-			return
-		}
-	}
-
 	if req.NoteID != nil {
 		if *req.NoteID == 0 {
 			// explicit nulling via 0 not supported; require proper null handling by omitting or sending null
@@ -275,8 +376,136 @@ func (h *ChartsHandler) UpdateChart(c *gin.Context) {
 	if req.NoteID != nil {
 		noteID = req.NoteID
 	}
+	fieldPath, aggregation, transform := chart.FieldPath, chart.Aggregation, chart.Transform
+	rangeDays, rangeFrom, rangeTo, fill := chart.RangeDays, chart.RangeFrom, chart.RangeTo, chart.Fill
+	annotationTag := chart.AnnotationTag
+	// Setting one kind of range drops the other unless both are sent
+	if len(req.RangeDays) > 0 && string(req.RangeDays) != "null" && len(req.RangeFrom) == 0 && len(req.RangeTo) == 0 {
+		rangeFrom, rangeTo = nil, nil
+	}
+	if (len(req.RangeFrom) > 0 || len(req.RangeTo) > 0) && len(req.RangeDays) == 0 {
+		rangeDays = nil
+	}
+	if len(req.RangeDays) > 0 {
+		rangeDays = nil
+		if err := json.Unmarshal(req.RangeDays, &rangeDays); err != nil {
+			c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "Invalid rangeDays"))
+			return
+		}
+	}
+	nullable := []struct {
+		name string
+		raw  json.RawMessage
+		dst  **string
+	}{
+		{"fieldPath", req.FieldPath, &fieldPath},
+		{"aggregation", req.Aggregation, &aggregation},
+		{"transform", req.Transform, &transform},
+		{"rangeFrom", req.RangeFrom, &rangeFrom},
+		{"rangeTo", req.RangeTo, &rangeTo},
+		{"fill", req.Fill, &fill},
+		{"annotationTag", req.AnnotationTag, &annotationTag},
+	}
+	for _, f := range nullable {
+		if len(f.raw) == 0 {
+			continue
+		}
+		*f.dst = nil
+		if err := json.Unmarshal(f.raw, f.dst); err != nil {
+			c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "Invalid "+f.name))
+			return
+		}
+	}
+	// A new series list sets the chart's own fields; otherwise those fields
+	// update the first series
+	series := chart.Series
+	switch {
+	case string(req.Series) == "null":
+		series = nil
+	case len(req.Series) > 0:
+		series = nil
+		if err := json.Unmarshal(req.Series, &series); err != nil || len(series) == 0 {
+			c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "Invalid series"))
+			return
+		}
+		activityTypeID, fieldPath, aggregation = series[0].ActivityTypeID, series[0].FieldPath, series[0].Aggregation
+	}
+	checked := series
+	if len(series) > 0 {
+		series[0].ActivityTypeID, series[0].FieldPath, series[0].Aggregation = activityTypeID, fieldPath, aggregation
+	} else {
+		checked = []models.ChartSeries{{ActivityTypeID: activityTypeID, FieldPath: fieldPath, Aggregation: aggregation}}
+	}
+	options := chart.Options
+	if len(req.Options) > 0 {
+		options = nil
+		if err := json.Unmarshal(req.Options, &options); err != nil {
+			c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "Invalid options"))
+			return
+		}
+	}
+	tags, filterID := chart.Tags, chart.FilterID
+	if len(req.Tags) > 0 {
+		tags = nil
+		if err := json.Unmarshal(req.Tags, &tags); err != nil {
+			c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "Invalid tags"))
+			return
+		}
+		tags = cleanTags(tags)
+	}
+	if len(req.FilterID) > 0 {
+		filterID = nil
+		if err := json.Unmarshal(req.FilterID, &filterID); err != nil {
+			c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "Invalid filterId"))
+			return
+		}
+		if !h.checkChartFilter(c, chart.SpaceID, filterID, userID, chart.UserID) {
+			return
+		}
+	}
+	// The series must fit the (possibly new) activity types and chart kind
+	var seriesTypes []*models.ActivityType
+	if len(req.FieldPath) > 0 || len(req.Aggregation) > 0 || len(req.Transform) > 0 || len(req.Series) > 0 || len(req.Options) > 0 || req.ActivityTypeID != nil || req.KindID != nil {
+		var ok bool
+		if seriesTypes, ok = h.checkSeries(c, chart.SpaceID, checked, transform); !ok {
+			return
+		}
+		aggregation = checked[0].Aggregation
+	}
+
+	updated := &models.Chart{
+		ID:             id,
+		KindID:         kindID,
+		ActivityTypeID: activityTypeID,
+		PeriodID:       periodID,
+		Name:           name,
+		Description:    description,
+		NoteID:         noteID,
+		FieldPath:      fieldPath,
+		Aggregation:    aggregation,
+		Transform:      transform,
+		RangeDays:      rangeDays,
+		RangeFrom:      rangeFrom,
+		RangeTo:        rangeTo,
+		Fill:           fill,
+		Series:         series,
+		Options:        options,
+		Tags:           tags,
+		FilterID:       filterID,
+		AnnotationTag:  cleanAnnotationTag(annotationTag),
+	}
+	if seriesTypes != nil {
+		if err := validateChartKind(updated, seriesTypes); err != nil {
+			c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
+			return
+		}
+	}
+	if err := validateChartRange(updated); err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
+		return
+	}
 
-	err = h.chartsRepo.UpdateChart(id, kindID, activityTypeID, periodID, name, description, noteID)
+	err = h.chartsRepo.UpdateChart(updated)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
 		return
@@ -329,38 +558,645 @@ func (h *ChartsHandler) GetCharts(c *gin.Context) {
 }
 
 func (h *ChartsHandler) GetChartData(c *gin.Context) {
+	chart, ok := h.readableChart(c)
+	if !ok {
+		return
+	}
+	q, err := parseChartQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
+		return
+	}
+	zone, _, err := timeSettings(c, h.usersRepo)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
+		return
+	}
+	data, err := h.chartData(chart, q, zone)
+	if err != nil {
+		writeChartDataError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, types.NewSuccessResponse(data))
+}
+
+// readableChart loads the live chart of the :id param for a member of its
+// space, writing the error response otherwise.
+func (h *ChartsHandler) readableChart(c *gin.Context) (*models.Chart, bool) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "Invalid ID"))
-		return
+		return nil, false
 	}
 
 	chart, err := h.chartsRepo.GetChartByID(id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
-		return
+		return nil, false
 	}
 	if chart == nil || chart.IsDeleted {
 		c.JSON(http.StatusNotFound, types.NewErrorResponse(types.ErrorCodeNotFound, "Chart not found"))
-		return
+		return nil, false
 	}
 
 	userID := c.GetInt("userId")
 	roleID, err := h.spacesRepo.GetUserRoleIDInSpace(userID, chart.SpaceID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
-		return
+		return nil, false
 	}
 	if roleID == 0 {
 		c.JSON(http.StatusForbidden, types.NewErrorResponse(types.ErrorCodeForbidden, "No access to the space"))
+		return nil, false
+	}
+	return chart, true
+}
+
+// chartQuery holds the per-request overrides of a chart's settings: the
+// aggregation (of every series), transform, range (RangeDays, or From and
+// To), fill and tags, plus the display unit, an optional comparison, an
+// optional trend or forecast and whether to add the chart's annotations.
+type chartQuery struct {
+	Aggregation string
+	Transform   string
+	RangeDays   *int
+	From, To    string
+	Fill        string
+	Tags        []string
+	Unit        string
+	Compare     string
+	Trend       trendQuery
+	Annotations bool
+}
+
+func parseChartQuery(c *gin.Context) (chartQuery, error) {
+	q := chartQuery{
+		Aggregation: strings.ToLower(c.Query("aggregation")),
+		Transform:   c.Query("transform"),
+		From:        c.Query("from"),
+		To:          c.Query("to"),
+		Fill:        c.Query("fill"),
+		Tags:        c.QueryArray("tags"),
+		Unit:        c.Query("unit"),
+		Compare:     c.Query("compare"),
+		Annotations: c.Query("annotations") == "true",
+	}
+	if s := c.Query("rangeDays"); s != "" {
+		days, err := strconv.Atoi(s)
+		if err != nil {
+			return q, errors.New("Invalid rangeDays")
+		}
+		q.RangeDays = &days
+	}
+	trend, err := parseTrendQuery(c)
+	if err != nil {
+		return q, err
+	}
+	q.Trend = trend
+	return q, nil
+}
+
+// chartDataError is a failure of chartData that is not a server error, with
+// the status and code it is reported with.
+type chartDataError struct {
+	status int
+	code   string
+	msg    string
+}
+
+func (e *chartDataError) Error() string { return e.msg }
+
+func chartValidationError(err error) error {
+	return &chartDataError{http.StatusBadRequest, types.ErrorCodeValidation, err.Error()}
+}
+
+// writeChartDataError writes the response for an error of chartData.
+func writeChartDataError(c *gin.Context, err error) {
+	var e *chartDataError
+	if errors.As(err, &e) {
+		c.JSON(e.status, types.NewErrorResponse(e.code, e.msg))
 		return
 	}
+	c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+}
+
+// chartData computes the data of the chart with the overrides of q applied,
+// in the shape of its kind and converted to the requested unit. Invalid
+// overrides and a deleted saved filter are returned as *chartDataError.
+func (h *ChartsHandler) chartData(chart *models.Chart, q chartQuery, zone models.UserSettings) (interface{}, error) {
+	if q.Annotations {
+		// The data applies the overrides to chart, so the annotations follow
+		// the range it was computed over
+		q.Annotations = false
+		data, err := h.chartData(chart, q, zone)
+		if err != nil {
+			return nil, err
+		}
+		annotations := []models.ChartAnnotation{}
+		if h.annotationsRepo != nil {
+			if annotations, err = h.annotationsRepo.List(chart, zone, true); err != nil {
+				return nil, err
+			}
+		}
+		return models.AnnotatedChartData{Data: data, Annotations: annotations}, nil
+	}
+	// aggregation and transform override the chart's own; the aggregation
+	// applies to every series
+	if q.Aggregation != "" {
+		for i := range chart.Series {
+			agg := q.Aggregation
+			chart.Series[i].Aggregation = &agg
+		}
+	}
+	if q.Transform != "" {
+		transform := q.Transform
+		chart.Transform = &transform
+	}
+	// so do the range (rangeDays, or from and to), fill and tags
+	if q.RangeDays != nil {
+		chart.RangeDays, chart.RangeFrom, chart.RangeTo = q.RangeDays, nil, nil
+	}
+	if q.From != "" || q.To != "" {
+		chart.RangeDays, chart.RangeFrom, chart.RangeTo = nil, nil, nil
+		if q.From != "" {
+			from := q.From
+			chart.RangeFrom = &from
+		}
+		if q.To != "" {
+			to := q.To
+			chart.RangeTo = &to
+		}
+	}
+	if q.Fill != "" {
+		fill := q.Fill
+		chart.Fill = &fill
+	}
+	if len(q.Tags) > 0 {
+		chart.Tags = cleanTags(q.Tags)
+	}
+	if err := validateChartRange(chart); err != nil {
+		return nil, chartValidationError(err)
+	}
+	resolved, factors, err := h.resolveSeries(chart, q.Unit)
+	if err != nil {
+		return nil, err
+	}
+	kind := types.GetChartTypeByID(chart.KindID)
+	if kind == nil {
+		return nil, errors.New("invalid chart kind")
+	}
+	if err := validateChartKind(chart, resolved); err != nil {
+		return nil, chartValidationError(err)
+	}
+	if q.Compare != "" {
+		if !types.IsComparison(q.Compare) {
+			return nil, chartValidationError(errors.New("compare must be previous or year_ago"))
+		}
+		if kind.Name != "lineChart" && kind.Name != "barChart" {
+			return nil, chartValidationError(errors.New("compare applies to line and bar charts"))
+		}
+	}
+	if q.Trend.isSet() {
+		if q.Compare != "" {
+			return nil, chartValidationError(errors.New("trend and forecast cannot be combined with compare"))
+		}
+		if kind.Name != "lineChart" && kind.Name != "barChart" {
+			return nil, chartValidationError(errors.New("trend and forecast apply to line and bar charts"))
+		}
+	}
+	if err := h.resolveScope(chart); err != nil {
+		return nil, err
+	}
+
+	if kind.Name != "lineChart" && kind.Name != "barChart" {
+		return h.getKindData(kind.Name, chart, zone, resolved, factors, q.Unit)
+	}
+
+	if q.Compare != "" {
+		comparison, err := h.chartsRepo.GetChartComparison(chart, q.Compare, zone)
+		if err != nil {
+			return nil, err
+		}
+		scaleChartPoints(comparison.Points, factors)
+		for i, factor := range factors {
+			comparison.Summary[i].Scale(factor)
+		}
+		return comparison, nil
+	}
+
+	data, err := h.chartsRepo.GetChartData(chart, zone)
+	if err != nil {
+		return nil, err
+	}
+	scaleChartPoints(data, factors)
+	if q.Trend.isSet() {
+		period := types.GetPeriodTypeByID(chart.PeriodID)
+		if period == nil {
+			return nil, errors.New("invalid chart period")
+		}
+		return chartTrend(data, len(chart.Series), period.Name, q.Trend), nil
+	}
+	return data, nil
+}
+
+// resolveSeries returns the type each series of the chart aggregates (its
+// field, with its aggregation) and the factor converting its values into unit.
+func (h *ChartsHandler) resolveSeries(chart *models.Chart, unit string) ([]*models.ActivityType, []float64, error) {
+	// Each series is displayed in the requested unit where it applies
+	factors := make([]float64, len(chart.Series))
+	resolved := make([]*models.ActivityType, len(chart.Series))
+	for i := range chart.Series {
+		series := &chart.Series[i]
+		at, err := h.activityTypesRepo.GetActivityTypeByID(series.ActivityTypeID)
+		if err != nil || at == nil {
+			return nil, nil, errors.New("activity type not found")
+		}
+		if series.FieldPath != nil && *series.FieldPath != "" {
+			if at, _, err = at.ResolveField(*series.FieldPath); err != nil {
+				return nil, nil, chartValidationError(err)
+			}
+		}
+		if at, err = withAggregation(at, stringValue(series.Aggregation), stringValue(chart.Transform)); err != nil {
+			return nil, nil, chartValidationError(err)
+		}
+		if factors[i], err = displayFactor(at, unit); err != nil {
+			return nil, nil, chartValidationError(err)
+		}
+		resolved[i] = at
+	}
+	return resolved, factors, nil
+}
+
+// scaleChartPoints converts each series of the points by its display factor.
+// Value and BaseValue share the first series' numbers.
+func scaleChartPoints(data []models.ChartDataPoint, factors []float64) {
+	for _, point := range data {
+		for i, factor := range factors {
+			if point.Values[i] != nil {
+				*point.Values[i] *= factor
+			}
+			if point.BaseValues != nil && point.BaseValues[i] != nil {
+				*point.BaseValues[i] *= factor
+			}
+			if point.Compare != nil {
+				point.Compare[i].Scale(factor)
+			}
+		}
+	}
+}
+
+// getKindData returns the data of the chart kinds with their own shapes:
+// calendar heatmaps, pies, scatter plots and histograms.
+func (h *ChartsHandler) getKindData(kind string, chart *models.Chart, zone models.UserSettings, series []*models.ActivityType, factors []float64, unit string) (interface{}, error) {
+	switch kind {
+	case "calendarHeatmap":
+		heatmap, err := h.chartsRepo.GetHeatmapData(chart, zone)
+		if err != nil {
+			return nil, err
+		}
+		for i := range heatmap.Days {
+			heatmap.Days[i].Value *= factors[0]
+		}
+		for _, v := range []*float64{heatmap.Min, heatmap.Max} {
+			if v != nil {
+				*v *= factors[0]
+			}
+		}
+		return heatmap, nil
+	case "pie":
+		slices, err := h.chartsRepo.GetPieData(chart, zone)
+		if err != nil {
+			return nil, err
+		}
+		// Counts of values have no unit
+		if chart.Options.GroupBy == "tag" {
+			for i := range slices {
+				slices[i].Value *= factors[0]
+			}
+		}
+		return slices, nil
+	case "scatter":
+		points, err := h.chartsRepo.GetScatterData(chart, zone)
+		if err != nil {
+			return nil, err
+		}
+		for i := range points {
+			points[i].X *= factors[0]
+			points[i].Y *= factors[1]
+		}
+		return points, nil
+	case "histogram":
+		// Bins hold single values, which convert like a maximum
+		single := *series[0]
+		single.Aggregation = "max"
+		factor, err := displayFactor(&single, unit)
+		if err != nil {
+			return nil, chartValidationError(err)
+		}
+		bins, err := h.chartsRepo.GetHistogramData(chart, zone)
+		if err != nil {
+			return nil, err
+		}
+		for i := range bins {
+			bins[i].From *= factor
+			bins[i].To *= factor
+		}
+		return bins, nil
+	}
+	return nil, errors.New("invalid chart kind")
+}
+
+// errInvalidActivityType reports a series whose activity type is not usable
+// in the chart's space.
+var errInvalidActivityType = errors.New("Invalid activity type")
+
+// checkSeries validates the series of a chart in spaceID with validateSeries
+// and writes a 400 when one does not fit.
+func (h *ChartsHandler) checkSeries(c *gin.Context, spaceID int, series []models.ChartSeries, transform *string) ([]*models.ActivityType, bool) {
+	resolved, err := h.validateSeries(spaceID, series, transform)
+	if errors.Is(err, errInvalidActivityType) {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeInvalidRequest, err.Error()))
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
+		return nil, false
+	}
+	return resolved, true
+}
+
+// validateSeries checks the series of a chart in spaceID: each activity type
+// must be usable in the space and its field path, aggregation and the chart's
+// transform must fit that type. Axes default to left and aggregations are
+// lowercased in place.
+func (h *ChartsHandler) validateSeries(spaceID int, series []models.ChartSeries, transform *string) ([]*models.ActivityType, error) {
+	if len(series) > maxChartSeries {
+		return nil, errors.New("a chart has at most " + strconv.Itoa(maxChartSeries) + " series")
+	}
+	resolved := make([]*models.ActivityType, len(series))
+	for i := range series {
+		s := &series[i]
+		at, err := h.activityTypesRepo.GetActivityTypeByID(s.ActivityTypeID)
+		if err != nil || at == nil || at.IsDeleted || (at.SpaceID != 0 && at.SpaceID != spaceID) {
+			return nil, errInvalidActivityType
+		}
+		fail := func(msg string) ([]*models.ActivityType, error) {
+			return nil, errors.New("series[" + strconv.Itoa(i) + "]: " + msg)
+		}
+		if resolved[i], err = validateChartSeries(at, s.FieldPath, s.Aggregation, transform); err != nil {
+			return fail(err.Error())
+		}
+		s.Axis = strings.ToLower(s.Axis)
+		if s.Axis == "" {
+			s.Axis = "left"
+		}
+		if s.Axis != "left" && s.Axis != "right" {
+			return fail("axis must be left or right")
+		}
+		if s.Color != nil && !chartColorPattern.MatchString(*s.Color) {
+			return fail("color must be a hex color such as #1e88e5")
+		}
+		s.Tags = cleanTags(s.Tags)
+	}
+	return resolved, nil
+}
+
+// cleanAnnotationTag trims an annotation tag; a blank one is none.
+func cleanAnnotationTag(tag *string) *string {
+	if tag == nil {
+		return nil
+	}
+	t := strings.TrimSpace(*tag)
+	if t == "" {
+		return nil
+	}
+	return &t
+}
+
+// cleanTags trims a tag scope and drops empty entries; nil when none remain.
+func cleanTags(tags []string) []string {
+	var cleaned []string
+	for _, t := range tags {
+		if t = strings.TrimSpace(t); t != "" && t != "!" {
+			cleaned = append(cleaned, t)
+		}
+	}
+	return cleaned
+}
 
-	data, err := h.chartsRepo.GetChartData(chart)
+// checkChartFilter writes a 400 unless filterID is nil or names a saved filter
+// of spaceID that is not deleted and that each of userIDs can see.
+func (h *ChartsHandler) checkChartFilter(c *gin.Context, spaceID int, filterID *int, userIDs ...int) bool {
+	if filterID == nil {
+		return true
+	}
+	if h.filtersRepo == nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeInvalidRequest, "Saved filters are not available"))
+		return false
+	}
+	ok, err := h.chartFilterVisible(spaceID, *filterID, userIDs...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
-		return
+		return false
 	}
+	if !ok {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeInvalidRequest, "Invalid filter for this space"))
+		return false
+	}
+	return true
+}
 
-	c.JSON(http.StatusOK, types.NewSuccessResponse(data))
+// chartFilterVisible tells whether filterID names a live saved filter of
+// spaceID that each of userIDs can see.
+func (h *ChartsHandler) chartFilterVisible(spaceID, filterID int, userIDs ...int) (bool, error) {
+	if h.filtersRepo == nil {
+		return false, nil
+	}
+	f, err := h.filtersRepo.GetByID(filterID)
+	if err != nil || f == nil || f.IsDeleted || f.SpaceID != spaceID {
+		return false, err
+	}
+	for _, id := range userIDs {
+		if !f.VisibleTo(id) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// resolveScope loads the params of the chart's saved filter, with those it
+// inherits, into chart.Scope. A deleted filter, or one of another space or
+// private to another user, is a conflict rather than a reason to silently
+// widen the chart to every activity; restoring the filter or clearing
+// filterId brings the chart back.
+func (h *ChartsHandler) resolveScope(chart *models.Chart) error {
+	if chart.FilterID == nil {
+		return nil
+	}
+	if h.filtersRepo == nil {
+		return errors.New("saved filters are not available")
+	}
+	f, err := h.filtersRepo.GetByID(*chart.FilterID)
+	if err != nil {
+		return err
+	}
+	if f == nil || f.IsDeleted {
+		return &chartDataError{http.StatusConflict, types.ErrorCodeConflict, "The chart's filter was deleted"}
+	}
+	// Only filters of the chart's space that its owner can see scope it
+	if f.SpaceID != chart.SpaceID || !f.VisibleTo(chart.UserID) {
+		return &chartDataError{http.StatusConflict, types.ErrorCodeConflict, "The chart's filter is not available to it"}
+	}
+	ancestors, err := h.filtersRepo.GetAncestors(f.ID)
+	if err != nil {
+		return err
+	}
+	params, _, err := models.ResolveFilterParams(f, ancestors)
+	if err != nil {
+		return err
+	}
+	scope := params.ToNoteFilters(1, 1)
+	chart.Scope = &scope
+	return nil
+}
+
+// validateChartSeries checks that the field path, aggregation and transform
+// of a chart fit its activity type. The aggregation is lowercased in place.
+func validateChartSeries(at *models.ActivityType, fieldPath, aggregation, transform *string) (*models.ActivityType, error) {
+	var err error
+	if aggregation != nil {
+		*aggregation = strings.ToLower(*aggregation)
+	}
+	if fieldPath != nil && *fieldPath != "" {
+		if at, _, err = at.ResolveField(*fieldPath); err != nil {
+			return nil, err
+		}
+	}
+	return withAggregation(at, stringValue(aggregation), stringValue(transform))
+}
+
+// validateChartKind checks that the series of a chart fit its kind, given
+// their activity types as returned by checkSeries. Line and bar charts plot
+// any series; pie and histogram options get their defaults in place.
+func validateChartKind(ch *models.Chart, series []*models.ActivityType) error {
+	kind := types.GetChartTypeByID(ch.KindID)
+	if kind == nil {
+		return errors.New("invalid chart kind")
+	}
+	if kind.Name == "lineChart" || kind.Name == "barChart" {
+		return nil
+	}
+	if ch.Transform != nil && *ch.Transform != "" {
+		return errors.New("transforms apply to line and bar charts only")
+	}
+	want := 1
+	if kind.Name == "scatter" {
+		want = 2
+	}
+	if len(series) != want {
+		return fmt.Errorf("%s charts take %d series", kind.Name, want)
+	}
+	// The mode of an enum is its only non-numeric aggregate
+	numeric := func(at *models.ActivityType) bool { return !(at.ValueType == "enum" && at.Aggregation == "mode") }
+	opts := models.ChartOptions{}
+	if ch.Options != nil {
+		opts = *ch.Options
+	}
+	switch kind.Name {
+	case "calendarHeatmap":
+		if !numeric(series[0]) {
+			return errors.New("calendarHeatmap charts need a numeric aggregation")
+		}
+	case "scatter":
+		if !numeric(series[0]) || !numeric(series[1]) {
+			return errors.New("scatter charts need numeric aggregations")
+		}
+	case "pie":
+		discrete := series[0].ValueType == "boolean" || series[0].ValueType == "enum" || series[0].ValueType == "rating"
+		if opts.GroupBy == "" {
+			opts.GroupBy = "tag"
+			if discrete {
+				opts.GroupBy = "value"
+			}
+		}
+		switch opts.GroupBy {
+		case "value":
+			if !discrete {
+				return errors.New("pie charts group by value only for boolean, enum and rating types")
+			}
+		case "tag":
+			if !numeric(series[0]) {
+				return errors.New("pie charts by tag need a numeric aggregation")
+			}
+		default:
+			return errors.New("groupBy must be value or tag")
+		}
+		ch.Options = &models.ChartOptions{GroupBy: opts.GroupBy}
+	case "histogram":
+		switch series[0].ValueType {
+		case "integer", "float", "rating", "time":
+		default:
+			return errors.New("histogram charts need integer, float, rating or time values")
+		}
+		if opts.Bins == 0 {
+			opts.Bins = 10
+		}
+		if opts.Bins < 1 || opts.Bins > maxHistogramBins {
+			return errors.New("bins must be between 1 and " + strconv.Itoa(maxHistogramBins))
+		}
+		ch.Options = &models.ChartOptions{Bins: opts.Bins}
+	}
+	return nil
+}
+
+// validateChartRange checks the range and fill of a chart. The range is either
+// the last rangeDays days or the dates rangeFrom to rangeTo (today when
+// omitted). The fill is lowercased in place.
+func validateChartRange(ch *models.Chart) error {
+	if ch.Fill != nil {
+		fill := strings.ToLower(*ch.Fill)
+		if !types.IsChartFill(fill) {
+			return errors.New("fill must be one of " + strings.Join(types.ChartFills, ", "))
+		}
+		ch.Fill = &fill
+	}
+	if ch.RangeDays != nil {
+		if ch.RangeFrom != nil || ch.RangeTo != nil {
+			return errors.New("rangeDays cannot be combined with rangeFrom or rangeTo")
+		}
+		if *ch.RangeDays < 1 || *ch.RangeDays > maxChartRangeDays {
+			return errors.New("rangeDays must be between 1 and " + strconv.Itoa(maxChartRangeDays))
+		}
+		return nil
+	}
+	if ch.RangeFrom == nil {
+		if ch.RangeTo != nil {
+			return errors.New("rangeTo requires rangeFrom")
+		}
+		return nil
+	}
+	from, err := time.Parse("2006-01-02", *ch.RangeFrom)
+	if err != nil {
+		return errors.New("rangeFrom must be a date (YYYY-MM-DD)")
+	}
+	to := time.Now().UTC()
+	if ch.RangeTo != nil {
+		if to, err = time.Parse("2006-01-02", *ch.RangeTo); err != nil {
+			return errors.New("rangeTo must be a date (YYYY-MM-DD)")
+		}
+		if to.Before(from) {
+			return errors.New("rangeTo must not be before rangeFrom")
+		}
+	}
+	if to.Sub(from) > maxChartRangeDays*24*time.Hour {
+		return errors.New("range must be at most " + strconv.Itoa(maxChartRangeDays) + " days")
+	}
+	return nil
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
 }
@@ -251,3 +251,660 @@ func (s *E2ETestSuite) Test97_ListCharts_IncludesNoteId() {
 	}
 	s.True(foundWithNote)
 }
+
+func (s *E2ETestSuite) Test98_ChartRangeAndFill() {
+	do := s.doJSON
+	spacePath := "/spaces/" + strconv.Itoa(s.createdSpaceID)
+
+	code, out := do("POST", spacePath+"/activity-types", s.ownerToken, map[string]interface{}{
+		"name": "Range pushups", "valueType": "integer", "aggregation": "sum",
+	})
+	s.Equal(http.StatusCreated, code)
+	typeID := int(out["data"].(map[string]interface{})["id"].(float64))
+
+	// Activity two days ago and today, nothing yesterday.
+	now := time.Now().UTC()
+	items := []map[string]interface{}{
+		{"typeId": typeID, "value": 5, "occurredAt": now.AddDate(0, 0, -2).Format(time.RFC3339)},
+		{"typeId": typeID, "value": 3, "occurredAt": now.Format(time.RFC3339)},
+	}
+	code, _ = do("POST", spacePath+"/quick-log/batch", s.ownerToken, map[string]interface{}{"items": items})
+	s.Equal(http.StatusCreated, code)
+
+	code, out = do("POST", "/charts", s.ownerToken, map[string]interface{}{
+		"spaceId": s.createdSpaceID, "kindId": 2, "activityTypeId": typeID, "periodId": 1,
+		"name": "Pushups last week", "rangeDays": 7, "fill": "Zero",
+	})
+	s.Equal(http.StatusCreated, code)
+	chart := out["data"].(map[string]interface{})
+	s.Equal(7.0, chart["rangeDays"])
+	s.Equal("zero", chart["fill"])
+	chartPath := "/charts/" + strconv.Itoa(int(chart["id"].(float64)))
+
+	data := func(query string) []interface{} {
+		code, out := do("GET", chartPath+"/data"+query, s.ownerToken, nil)
+		s.Equal(http.StatusOK, code)
+		return out["data"].([]interface{})
+	}
+	value := func(p interface{}) interface{} { return p.(map[string]interface{})["value"] }
+
+	// One bucket per day of the range, empty days as zero.
+	points := data("")
+	s.Len(points, 7)
+	s.Equal(5.0, value(points[4]))
+	s.Equal(0.0, value(points[5]))
+	s.Equal(3.0, value(points[6]))
+
+	// fill=null keeps the bucket without a value; none leaves it out.
+	points = data("?fill=null")
+	s.Len(points, 7)
+	s.Nil(value(points[5]))
+	s.Len(data("?fill=none"), 2)
+
+	// An explicit range overrides the last N days.
+	from := now.AddDate(0, 0, -2).Format("2006-01-02")
+	to := now.AddDate(0, 0, -1).Format("2006-01-02")
+	points = data("?from=" + from + "&to=" + to)
+	s.Len(points, 2)
+	s.Equal(5.0, value(points[0]))
+
+	// The running total runs over the filled days.
+	points = data("?transform=cumsum")
+	s.Equal(5.0, value(points[5]))
+	s.Equal(8.0, value(points[6]))
+
+	for _, q := range []string{"?fill=maybe", "?rangeDays=0", "?to=" + to, "?from=" + to + "&to=" + from} {
+		code, _ = do("GET", chartPath+"/data"+q, s.ownerToken, nil)
+		s.Equal(http.StatusBadRequest, code, q)
+	}
+
+	// Switching the stored range to dates drops rangeDays.
+	code, _ = do("PATCH", chartPath, s.ownerToken, map[string]interface{}{"rangeFrom": from})
+	s.Equal(http.StatusOK, code)
+	code, out = do("GET", "/charts?spaceId="+strconv.Itoa(s.createdSpaceID)+"&pageSize=100", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	for _, it := range out["data"].(map[string]interface{})["data"].([]interface{}) {
+		m := it.(map[string]interface{})
+		if m["id"] == chart["id"] {
+			s.Equal(from, m["rangeFrom"])
+			s.Nil(m["rangeDays"])
+		}
+	}
+	s.Len(data(""), 3)
+	code, _ = do("PATCH", chartPath, s.ownerToken, map[string]interface{}{"rangeDays": 30, "rangeFrom": from})
+	s.Equal(http.StatusBadRequest, code)
+}
+
+func (s *E2ETestSuite) Test99_MultiSeriesChart() {
+	do := s.doJSON
+	spacePath := "/spaces/" + strconv.Itoa(s.createdSpaceID)
+
+	typeIDs := make([]int, 2)
+	for i, name := range []string{"Series sleep", "Series mood"} {
+		code, out := do("POST", spacePath+"/activity-types", s.ownerToken, map[string]interface{}{
+			"name": name, "valueType": "float", "aggregation": "avg",
+		})
+		s.Equal(http.StatusCreated, code)
+		typeIDs[i] = int(out["data"].(map[string]interface{})["id"].(float64))
+	}
+
+	// Sleep yesterday and today; mood today only, once on a tagged note.
+	now := time.Now().UTC()
+	items := []map[string]interface{}{
+		{"typeId": typeIDs[0], "value": 7, "occurredAt": now.AddDate(0, 0, -1).Format(time.RFC3339)},
+		{"typeId": typeIDs[0], "value": 8, "occurredAt": now.Format(time.RFC3339)},
+		{"typeId": typeIDs[1], "value": 2, "occurredAt": now.Format(time.RFC3339)},
+	}
+	code, _ := do("POST", spacePath+"/quick-log/batch", s.ownerToken, map[string]interface{}{"items": items})
+	s.Equal(http.StatusCreated, code)
+	code, out := do("POST", "/notes", s.ownerToken, map[string]interface{}{
+		"text": "good day", "tags": []string{"series-good"}, "spaceId": s.createdSpaceID,
+		"date": now.Format(time.RFC3339),
+	})
+	s.Equal(http.StatusCreated, code)
+	noteID := int(out["data"].(map[string]interface{})["id"].(float64))
+	code, _ = do("POST", "/activities", s.ownerToken, map[string]interface{}{"typeId": typeIDs[1], "value": "4", "note_id": noteID})
+	s.Equal(http.StatusCreated, code)
+
+	code, out = do("POST", "/charts", s.ownerToken, map[string]interface{}{
+		"spaceId": s.createdSpaceID, "kindId": 1, "periodId": 1, "name": "Sleep vs mood", "rangeDays": 2,
+		"series": []map[string]interface{}{
+			{"activityTypeId": typeIDs[0], "color": "#1e88e5"},
+			{"activityTypeId": typeIDs[1], "axis": "Right"},
+			{"activityTypeId": typeIDs[1], "tags": []string{"series-good"}, "aggregation": "max"},
+		},
+	})
+	s.Equal(http.StatusCreated, code)
+	chart := out["data"].(map[string]interface{})
+	s.Equal(float64(typeIDs[0]), chart["activityTypeId"])
+	series := chart["series"].([]interface{})
+	s.Len(series, 3)
+	s.Equal("left", series[0].(map[string]interface{})["axis"])
+	s.Equal("right", series[1].(map[string]interface{})["axis"])
+	chartPath := "/charts/" + strconv.Itoa(int(chart["id"].(float64)))
+
+	code, out = do("GET", chartPath+"/data", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	points := out["data"].([]interface{})
+	s.Len(points, 2)
+	yesterday := points[0].(map[string]interface{})
+	s.Equal(7.0, yesterday["value"])
+	s.Equal([]interface{}{7.0, nil, nil}, yesterday["values"])
+	s.Equal([]interface{}{8.0, 3.0, 4.0}, points[1].(map[string]interface{})["values"])
+
+	// Old clients still change the first series through activityTypeId.
+	code, _ = do("PATCH", chartPath, s.ownerToken, map[string]interface{}{"aggregation": "max"})
+	s.Equal(http.StatusOK, code)
+	code, out = do("GET", chartPath+"/data", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	s.Equal([]interface{}{8.0, 3.0, 4.0}, out["data"].([]interface{})[1].(map[string]interface{})["values"])
+
+	bad := []map[string]interface{}{
+		{"series": []map[string]interface{}{{"activityTypeId": typeIDs[0], "axis": "top"}}},
+		{"series": []map[string]interface{}{{"activityTypeId": typeIDs[0], "color": "blue"}}},
+		{"series": []map[string]interface{}{}},
+	}
+	for _, body := range bad {
+		code, _ = do("PATCH", chartPath, s.ownerToken, body)
+		s.Equal(http.StatusBadRequest, code)
+	}
+
+	// null keeps only the first series.
+	code, _ = do("PATCH", chartPath, s.ownerToken, map[string]interface{}{"series": nil})
+	s.Equal(http.StatusOK, code)
+	code, out = do("GET", chartPath+"/data", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	s.Equal([]interface{}{8.0}, out["data"].([]interface{})[1].(map[string]interface{})["values"])
+}
+
+func (s *E2ETestSuite) Test99B_ChartKinds() {
+	do := s.doJSON
+	spacePath := "/spaces/" + strconv.Itoa(s.createdSpaceID)
+
+	code, out := do("POST", spacePath+"/activity-types", s.ownerToken, map[string]interface{}{
+		"name": "Kinds workout", "valueType": "enum", "aggregation": "distribution",
+		"options": []map[string]string{{"value": "run", "label": "Running"}, {"value": "swim"}, {"value": "bike"}},
+	})
+	s.Equal(http.StatusCreated, code)
+	enumID := int(out["data"].(map[string]interface{})["id"].(float64))
+	floatIDs := make([]int, 2)
+	for i, name := range []string{"Kinds distance", "Kinds effort"} {
+		code, out = do("POST", spacePath+"/activity-types", s.ownerToken, map[string]interface{}{
+			"name": name, "valueType": "float", "aggregation": "sum",
+		})
+		s.Equal(http.StatusCreated, code)
+		floatIDs[i] = int(out["data"].(map[string]interface{})["id"].(float64))
+	}
+
+	now := time.Now().UTC()
+	yesterday := now.AddDate(0, 0, -1)
+	items := []map[string]interface{}{
+		{"typeId": enumID, "value": "run", "occurredAt": now.Format(time.RFC3339)},
+		{"typeId": enumID, "value": "run", "occurredAt": yesterday.Format(time.RFC3339)},
+		{"typeId": enumID, "value": "swim", "occurredAt": now.Format(time.RFC3339)},
+		{"typeId": floatIDs[0], "value": 2, "occurredAt": yesterday.Format(time.RFC3339)},
+		{"typeId": floatIDs[0], "value": 4, "occurredAt": now.Format(time.RFC3339)},
+		{"typeId": floatIDs[0], "value": 10, "occurredAt": now.Format(time.RFC3339)},
+		{"typeId": floatIDs[1], "value": 1, "occurredAt": yesterday.Format(time.RFC3339)},
+		{"typeId": floatIDs[1], "value": 3, "occurredAt": now.Format(time.RFC3339)},
+	}
+	code, _ = do("POST", spacePath+"/quick-log/batch", s.ownerToken, map[string]interface{}{"items": items})
+	s.Equal(http.StatusCreated, code)
+
+	create := func(kindID int, body map[string]interface{}) (int, map[string]interface{}) {
+		body["spaceId"], body["kindId"], body["periodId"], body["name"] = s.createdSpaceID, kindID, 3, "Kinds chart"
+		return do("POST", "/charts", s.ownerToken, body)
+	}
+	data := func(chart map[string]interface{}) interface{} {
+		code, out := do("GET", "/charts/"+strconv.Itoa(int(chart["data"].(map[string]interface{})["id"].(float64)))+"/data", s.ownerToken, nil)
+		s.Equal(http.StatusOK, code)
+		return out["data"]
+	}
+
+	// Calendar heatmap: daily sums over the last year.
+	code, out = create(3, map[string]interface{}{"activityTypeId": floatIDs[0]})
+	s.Equal(http.StatusCreated, code)
+	heatmap := data(out).(map[string]interface{})
+	s.Len(heatmap["days"], 2)
+	s.Equal(2.0, heatmap["min"])
+	s.Equal(14.0, heatmap["max"])
+
+	// Pie by value counts each option, including unused ones.
+	code, out = create(4, map[string]interface{}{"activityTypeId": enumID})
+	s.Equal(http.StatusCreated, code)
+	s.Equal("value", out["data"].(map[string]interface{})["options"].(map[string]interface{})["groupBy"])
+	slices := data(out).([]interface{})
+	s.Len(slices, 3)
+	first := slices[0].(map[string]interface{})
+	s.Equal("run", first["key"])
+	s.Equal("Running", first["label"])
+	s.Equal(2.0, first["value"])
+	s.Equal(0.0, slices[2].(map[string]interface{})["value"])
+
+	// Scatter pairs the two series by day.
+	code, out = create(5, map[string]interface{}{"series": []map[string]interface{}{
+		{"activityTypeId": floatIDs[0]}, {"activityTypeId": floatIDs[1]},
+	}})
+	s.Equal(http.StatusCreated, code)
+	points := data(out).([]interface{})
+	s.Len(points, 2)
+	last := points[1].(map[string]interface{})
+	s.Equal(14.0, last["x"])
+	s.Equal(3.0, last["y"])
+
+	// Histogram of single values in two bins: [2, 6) and [6, 10].
+	code, out = create(6, map[string]interface{}{"activityTypeId": floatIDs[0], "options": map[string]interface{}{"bins": 2}})
+	s.Equal(http.StatusCreated, code)
+	bins := data(out).([]interface{})
+	s.Len(bins, 2)
+	s.Equal(2.0, bins[0].(map[string]interface{})["count"])
+	s.Equal(1.0, bins[1].(map[string]interface{})["count"])
+	s.Equal(10.0, bins[1].(map[string]interface{})["to"])
+
+	// Kinds reject series they cannot plot.
+	bad := []struct {
+		kindID int
+		body   map[string]interface{}
+	}{
+		{3, map[string]interface{}{"activityTypeId": floatIDs[0], "transform": "cumsum"}},
+		{4, map[string]interface{}{"activityTypeId": floatIDs[0], "options": map[string]interface{}{"groupBy": "value"}}},
+		{5, map[string]interface{}{"activityTypeId": floatIDs[0]}},
+		{6, map[string]interface{}{"activityTypeId": enumID}},
+		{6, map[string]interface{}{"activityTypeId": floatIDs[0], "options": map[string]interface{}{"bins": 500}}},
+	}
+	for _, b := range bad {
+		code, _ = create(b.kindID, b.body)
+		s.Equal(http.StatusBadRequest, code, b.body)
+	}
+}
+
+func (s *E2ETestSuite) Test99C_ChartScoping() {
+	do := s.doJSON
+	spacePath := "/spaces/" + strconv.Itoa(s.createdSpaceID)
+
+	code, out := do("POST", spacePath+"/activity-types", s.ownerToken, map[string]interface{}{
+		"name": "Scoped steps", "valueType": "integer", "aggregation": "sum",
+	})
+	s.Equal(http.StatusCreated, code)
+	typeID := int(out["data"].(map[string]interface{})["id"].(float64))
+
+	log := func(tags []string, value string) {
+		code, out := do("POST", "/notes", s.ownerToken, map[string]interface{}{
+			"text": "steps", "tags": tags, "spaceId": s.createdSpaceID, "date": time.Now().Format(time.RFC3339),
+		})
+		s.Equal(http.StatusCreated, code)
+		noteID := int(out["data"].(map[string]interface{})["id"].(float64))
+		code, _ = do("POST", "/activities", s.ownerToken, map[string]interface{}{"typeId": typeID, "value": value, "note_id": noteID})
+		s.Equal(http.StatusCreated, code)
+	}
+	log([]string{"vacation", "beach"}, "1000")
+	log([]string{"vacation"}, "200")
+	log([]string{"work"}, "30")
+
+	create := func(body map[string]interface{}) (int, map[string]interface{}) {
+		body["spaceId"], body["kindId"], body["periodId"], body["name"] = s.createdSpaceID, 1, 4, "Scoped chart"
+		body["activityTypeId"], body["rangeDays"] = typeID, 7
+		return do("POST", "/charts", s.ownerToken, body)
+	}
+	total := func(chartID int) (int, float64) {
+		code, out := do("GET", "/charts/"+strconv.Itoa(chartID)+"/data", s.ownerToken, nil)
+		sum := 0.0
+		if code == http.StatusOK {
+			for _, p := range out["data"].([]interface{}) {
+				if v, ok := p.(map[string]interface{})["value"].(float64); ok {
+					sum += v
+				}
+			}
+		}
+		return code, sum
+	}
+
+	// Tags follow the analysis semantics: all included, none excluded.
+	code, out = create(map[string]interface{}{"tags": []string{"vacation", "!beach"}})
+	s.Equal(http.StatusCreated, code)
+	chart := out["data"].(map[string]interface{})
+	chartID := int(chart["id"].(float64))
+	s.Equal([]interface{}{"vacation", "!beach"}, chart["tags"])
+	code, sum := total(chartID)
+	s.Equal(http.StatusOK, code)
+	s.Equal(200.0, sum)
+
+	code, _ = do("PATCH", "/charts/"+strconv.Itoa(chartID), s.ownerToken, map[string]interface{}{"tags": nil})
+	s.Equal(http.StatusOK, code)
+	_, sum = total(chartID)
+	s.Equal(1230.0, sum)
+
+	// A saved filter scopes the chart to its notes.
+	code, out = do("POST", "/filters", s.ownerToken, map[string]interface{}{
+		"spaceId": s.createdSpaceID, "name": "Work steps", "params": map[string]interface{}{"tags": []string{"work"}},
+	})
+	s.Equal(http.StatusCreated, code)
+	filterID := int(out["data"].(map[string]interface{})["id"].(float64))
+	code, out = create(map[string]interface{}{"filterId": filterID})
+	s.Equal(http.StatusCreated, code)
+	chartID = int(out["data"].(map[string]interface{})["id"].(float64))
+	code, sum = total(chartID)
+	s.Equal(http.StatusOK, code)
+	s.Equal(30.0, sum)
+
+	// A deleted filter is reported rather than ignored.
+	code, _ = do("PATCH", "/filters/"+strconv.Itoa(filterID)+"/delete", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	code, _ = total(chartID)
+	s.Equal(http.StatusConflict, code)
+	code, _ = create(map[string]interface{}{"filterId": filterID})
+	s.Equal(http.StatusBadRequest, code)
+	code, _ = do("PATCH", "/filters/"+strconv.Itoa(filterID)+"/restore", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	code, sum = total(chartID)
+	s.Equal(http.StatusOK, code)
+	s.Equal(30.0, sum)
+}
+
+func (s *E2ETestSuite) Test99D_PeriodComparison() {
+	do := s.doJSON
+	spacePath := "/spaces/" + strconv.Itoa(s.createdSpaceID)
+
+	code, out := do("POST", spacePath+"/activity-types", s.ownerToken, map[string]interface{}{
+		"name": "Compared pages", "valueType": "integer", "aggregation": "sum",
+	})
+	s.Equal(http.StatusCreated, code)
+	typeID := int(out["data"].(map[string]interface{})["id"].(float64))
+
+	y, m, d := time.Now().UTC().Date()
+	today := time.Date(y, m, d, 12, 0, 0, 0, time.UTC)
+	day := func(offset int) string { return today.AddDate(0, 0, -offset).Format(time.RFC3339) }
+	items := []map[string]interface{}{
+		{"typeId": typeID, "value": 10, "occurredAt": day(0)},
+		{"typeId": typeID, "value": 5, "occurredAt": day(3)},
+		{"typeId": typeID, "value": 4, "occurredAt": day(7)},
+		{"typeId": typeID, "value": 2, "occurredAt": day(12)},
+	}
+	code, _ = do("POST", spacePath+"/quick-log/batch", s.ownerToken, map[string]interface{}{"items": items})
+	s.Equal(http.StatusCreated, code)
+
+	checkSummary := func(summary map[string]interface{}) {
+		s.Equal(15.0, summary["value"])
+		s.Equal(6.0, summary["compareValue"])
+		s.Equal(9.0, summary["delta"])
+		s.Equal(150.0, summary["deltaPercent"])
+	}
+
+	// The last 7 days against the 7 days before, bucketed per day.
+	code, out = do("POST", "/charts", s.ownerToken, map[string]interface{}{
+		"spaceId": s.createdSpaceID, "kindId": 1, "periodId": 1, "name": "Pages vs last week",
+		"activityTypeId": typeID, "rangeDays": 7,
+	})
+	s.Equal(http.StatusCreated, code)
+	dataPath := "/charts/" + strconv.Itoa(int(out["data"].(map[string]interface{})["id"].(float64))) + "/data?tz=UTC"
+	code, out = do("GET", dataPath+"&compare=previous", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	comparison := out["data"].(map[string]interface{})
+	s.Equal(today.AddDate(0, 0, -13).Format("2006-01-02"), comparison["compareFrom"])
+	checkSummary(comparison["summary"].([]interface{})[0].(map[string]interface{}))
+	points := comparison["points"].([]interface{})
+	s.Len(points, 3)
+	last := points[len(points)-1].(map[string]interface{})["compare"].([]interface{})[0].(map[string]interface{})
+	s.Equal(10.0, last["value"])
+	s.Equal(4.0, last["compareValue"])
+	s.Equal(6.0, last["delta"])
+
+	code, _ = do("GET", dataPath+"&compare=last_decade", s.ownerToken, nil)
+	s.Equal(http.StatusBadRequest, code)
+
+	// The same comparison over the analysis endpoint.
+	code, out = do("GET", "/activities?spaceId="+strconv.Itoa(s.createdSpaceID)+"&typeId="+strconv.Itoa(typeID)+
+		"&periodId=1&tz=UTC&compare=previous&startDate="+today.AddDate(0, 0, -6).Format("2006-01-02")+
+		"&endDate="+today.Format("2006-01-02"), s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	analysis := out["data"].(map[string]interface{})
+	checkSummary(analysis["summary"].(map[string]interface{}))
+	periods := analysis["periods"].([]interface{})
+	s.Len(periods, 3)
+	first := periods[0].(map[string]interface{})
+	s.Nil(first["value"])
+	s.Equal(2.0, first["compareValue"])
+}
+
+func (s *E2ETestSuite) Test99F_ChartRender() {
+	do := s.doJSON
+	spacePath := "/spaces/" + strconv.Itoa(s.createdSpaceID)
+
+	code, out := do("POST", spacePath+"/activity-types", s.ownerToken, map[string]interface{}{
+		"name": "Rendered weight", "valueType": "float", "aggregation": "avg", "unit": "kg",
+	})
+	s.Equal(http.StatusCreated, code)
+	typeID := int(out["data"].(map[string]interface{})["id"].(float64))
+	items := []map[string]interface{}{}
+	for i := 0; i < 5; i++ {
+		items = append(items, map[string]interface{}{
+			"typeId": typeID, "value": 70 + i, "occurredAt": time.Now().AddDate(0, 0, -i).Format(time.RFC3339),
+		})
+	}
+	code, _ = do("POST", spacePath+"/quick-log/batch", s.ownerToken, map[string]interface{}{"items": items})
+	s.Equal(http.StatusCreated, code)
+
+	code, out = do("POST", "/charts", s.ownerToken, map[string]interface{}{
+		"spaceId": s.createdSpaceID, "kindId": 1, "periodId": 1, "name": "Weight <7d>",
+		"activityTypeId": typeID, "rangeDays": 7,
+	})
+	s.Equal(http.StatusCreated, code)
+	renderPath := "/charts/" + strconv.Itoa(int(out["data"].(map[string]interface{})["id"].(float64))) + "/render"
+
+	get := func(path, etag string) (*http.Response, []byte) {
+		req, _ := http.NewRequest("GET", s.baseURL+path, nil)
+		req.Header.Set("Authorization", "Bearer "+s.ownerToken)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		resp, err := (&http.Client{}).Do(req)
+		s.Require().NoError(err)
+		defer resp.Body.Close()
+		body := new(bytes.Buffer)
+		body.ReadFrom(resp.Body)
+		return resp, body.Bytes()
+	}
+
+	// SVG by default, with the unit of the type and the escaped title.
+	resp, body := get(renderPath, "")
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Equal("image/svg+xml", resp.Header.Get("Content-Type"))
+	s.True(bytes.HasPrefix(body, []byte("<svg")))
+	s.Contains(string(body), ">kg</text>")
+	s.Contains(string(body), "Weight &lt;7d&gt;")
+	etag := resp.Header.Get("ETag")
+	s.NotEmpty(etag)
+
+	// The same request is cached and revalidates.
+	resp, again := get(renderPath, "")
+	s.Equal(body, again)
+	s.Equal(etag, resp.Header.Get("ETag"))
+	resp, _ = get(renderPath, etag)
+	s.Equal(http.StatusNotModified, resp.StatusCode)
+
+	// New data makes a new version.
+	code, _ = do("POST", spacePath+"/quick-log/batch", s.ownerToken, map[string]interface{}{"items": []map[string]interface{}{
+		{"typeId": typeID, "value": 90, "occurredAt": time.Now().Format(time.RFC3339)},
+	}})
+	s.Equal(http.StatusCreated, code)
+	resp, _ = get(renderPath, etag)
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.NotEqual(etag, resp.Header.Get("ETag"))
+
+	// So does deleting the note of an activity, though the chart has no tags.
+	code, out = do("POST", "/notes", s.ownerToken, map[string]interface{}{
+		"text": "weighed", "spaceId": s.createdSpaceID, "date": time.Now().Format(time.RFC3339),
+	})
+	s.Equal(http.StatusCreated, code)
+	notePath := "/notes/" + strconv.Itoa(int(out["data"].(map[string]interface{})["id"].(float64)))
+	code, _ = do("POST", "/activities", s.ownerToken, map[string]interface{}{
+		"typeId": typeID, "value": "80", "note_id": int(out["data"].(map[string]interface{})["id"].(float64)),
+	})
+	s.Equal(http.StatusCreated, code)
+	resp, _ = get(renderPath, "")
+	etag = resp.Header.Get("ETag")
+	code, _ = do("PATCH", notePath+"/delete", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	resp, _ = get(renderPath, etag)
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.NotEqual(etag, resp.Header.Get("ETag"))
+
+	resp, body = get(renderPath+"?format=png&width=400&height=200&theme=dark&unit=lb", "")
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Equal("image/png", resp.Header.Get("Content-Type"))
+	s.True(bytes.HasPrefix(body, []byte("\x89PNG")))
+
+	for _, query := range []string{"?format=gif", "?width=50", "?theme=blue", "?compare=previous"} {
+		resp, _ = get(renderPath+query, "")
+		s.Equal(http.StatusBadRequest, resp.StatusCode, query)
+	}
+
+	// Only line and bar charts are drawn.
+	code, out = do("POST", "/charts", s.ownerToken, map[string]interface{}{
+		"spaceId": s.createdSpaceID, "kindId": 6, "periodId": 1, "name": "Weight spread", "activityTypeId": typeID,
+	})
+	s.Equal(http.StatusCreated, code)
+	resp, _ = get("/charts/"+strconv.Itoa(int(out["data"].(map[string]interface{})["id"].(float64)))+"/render", "")
+	s.Equal(http.StatusBadRequest, resp.StatusCode)
+}
+
+func (s *E2ETestSuite) Test99G_ChartTrendAndForecast() {
+	do := s.doJSON
+	spacePath := "/spaces/" + strconv.Itoa(s.createdSpaceID)
+
+	code, out := do("POST", spacePath+"/activity-types", s.ownerToken, map[string]interface{}{
+		"name": "Weekly distance", "valueType": "float", "aggregation": "sum",
+	})
+	s.Equal(http.StatusCreated, code)
+	typeID := int(out["data"].(map[string]interface{})["id"].(float64))
+	// Mondays of four weeks: 5, 10, 15, 20.
+	items := []map[string]interface{}{}
+	for i := 0; i < 4; i++ {
+		items = append(items, map[string]interface{}{
+			"typeId": typeID, "value": 5 * (i + 1), "occurredAt": time.Date(2032, 6, 7+7*i, 9, 0, 0, 0, time.UTC).Format(time.RFC3339),
+		})
+	}
+	code, _ = do("POST", spacePath+"/quick-log/batch", s.ownerToken, map[string]interface{}{"items": items})
+	s.Equal(http.StatusCreated, code)
+
+	code, out = do("POST", "/charts", s.ownerToken, map[string]interface{}{
+		"spaceId": s.createdSpaceID, "kindId": 2, "periodId": 2, "name": "Distance trend",
+		"activityTypeId": typeID, "rangeFrom": "2032-06-07", "rangeTo": "2032-07-04",
+	})
+	s.Equal(http.StatusCreated, code)
+	chartPath := "/charts/" + strconv.Itoa(int(out["data"].(map[string]interface{})["id"].(float64)))
+
+	code, out = do("GET", chartPath+"/data?tz=UTC&weekStart=monday&trend=linear&forecast=2", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	data := out["data"].(map[string]interface{})
+	points := data["points"].([]interface{})
+	s.Len(points, 4)
+	s.InDelta(20.0, points[3].(map[string]interface{})["trend"].([]interface{})[0], 0.0001)
+	trends := data["trends"].([]interface{})
+	s.Len(trends, 1)
+	s.InDelta(5.0, trends[0].(map[string]interface{})["slope"], 0.0001)
+	forecast := data["forecast"].([]interface{})
+	s.Len(forecast, 2)
+	next := forecast[0].(map[string]interface{})
+	s.Equal("2032-07-05", next["date"].(string)[:10])
+	s.InDelta(25.0, next["values"].([]interface{})[0].(map[string]interface{})["value"], 0.0001)
+
+	code, _ = do("GET", chartPath+"/data?trend=linear&compare=previous", s.ownerToken, nil)
+	s.Equal(http.StatusBadRequest, code)
+	code, _ = do("GET", chartPath+"/render?trend=linear", s.ownerToken, nil)
+	s.Equal(http.StatusBadRequest, code)
+}
+
+func (s *E2ETestSuite) Test99H_ChartAnnotations() {
+	do := s.doJSON
+	spacePath := "/spaces/" + strconv.Itoa(s.createdSpaceID)
+
+	code, out := do("POST", spacePath+"/activity-types", s.ownerToken, map[string]interface{}{
+		"name": "Annotated steps", "valueType": "integer", "aggregation": "sum",
+	})
+	s.Equal(http.StatusCreated, code)
+	typeID := int(out["data"].(map[string]interface{})["id"].(float64))
+
+	code, out = do("POST", "/charts", s.ownerToken, map[string]interface{}{
+		"spaceId": s.createdSpaceID, "kindId": 1, "periodId": 1, "name": "Annotated",
+		"activityTypeId": typeID, "rangeFrom": "2033-06-01", "rangeTo": "2033-06-30", "annotationTag": "release",
+	})
+	s.Equal(http.StatusCreated, code)
+	chart := out["data"].(map[string]interface{})
+	s.Equal("release", chart["annotationTag"])
+	chartPath := "/charts/" + strconv.Itoa(int(chart["id"].(float64)))
+
+	code, out = do("POST", "/notes", s.ownerToken, map[string]interface{}{
+		"text": "Version 2 shipped\nwith details", "tags": []string{"release"}, "spaceId": s.createdSpaceID,
+		"date": time.Date(2033, 6, 15, 12, 0, 0, 0, time.UTC).Format(time.RFC3339),
+	})
+	s.Equal(http.StatusCreated, code)
+	noteID := int(out["data"].(map[string]interface{})["id"].(float64))
+
+	code, out = do("POST", chartPath+"/annotations", s.ownerToken, map[string]interface{}{
+		"date": "2033-06-10", "endDate": "2033-06-12", "label": "Vacation", "noteId": noteID,
+	})
+	s.Equal(http.StatusCreated, code)
+	created := out["data"].(map[string]interface{})
+	s.Equal("2033-06-10", created["date"])
+	s.Equal("2033-06-12", created["endDate"])
+	s.Equal("manual", created["source"])
+	annotationPath := "/chart-annotations/" + strconv.Itoa(int(created["id"].(float64)))
+
+	code, _ = do("POST", chartPath+"/annotations", s.ownerToken, map[string]interface{}{"date": "2033-07-20", "label": "Later"})
+	s.Equal(http.StatusCreated, code)
+
+	code, _ = do("POST", chartPath+"/annotations", s.ownerToken, map[string]interface{}{"date": "June 1", "label": "Bad"})
+	s.Equal(http.StatusBadRequest, code)
+	code, _ = do("POST", chartPath+"/annotations", s.ownerToken, map[string]interface{}{"date": "2033-06-10", "endDate": "2033-06-09", "label": "Bad"})
+	s.Equal(http.StatusBadRequest, code)
+	code, _ = do("POST", chartPath+"/annotations", s.ownerToken, map[string]interface{}{"date": "2033-06-10", "label": "  "})
+	s.Equal(http.StatusBadRequest, code)
+	code, out = do("POST", "/spaces", s.ownerToken, map[string]interface{}{"name": "Annotation notes"})
+	s.Equal(http.StatusCreated, code)
+	code, out = do("POST", "/notes", s.ownerToken, map[string]interface{}{
+		"text": "elsewhere", "spaceId": int(out["data"].(map[string]interface{})["id"].(float64)),
+	})
+	s.Equal(http.StatusCreated, code)
+	code, _ = do("POST", chartPath+"/annotations", s.ownerToken, map[string]interface{}{
+		"date": "2033-06-10", "label": "Foreign", "noteId": int(out["data"].(map[string]interface{})["id"].(float64)),
+	})
+	s.Equal(http.StatusBadRequest, code)
+	code, _ = do("POST", chartPath+"/annotations", s.guestToken, map[string]interface{}{"date": "2033-06-10", "label": "Guest"})
+	s.Equal(http.StatusForbidden, code)
+
+	code, out = do("GET", chartPath+"/annotations?tz=UTC", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	list := out["data"].([]interface{})
+	s.Len(list, 3)
+	tagged := list[1].(map[string]interface{})
+	s.Equal("tag", tagged["source"])
+	s.Equal("2033-06-15", tagged["date"])
+	s.Equal("Version 2 shipped", tagged["label"])
+	s.Equal(float64(noteID), tagged["noteId"])
+
+	code, _ = do("PATCH", annotationPath, s.ownerToken, map[string]interface{}{"label": "Holiday", "endDate": nil})
+	s.Equal(http.StatusOK, code)
+	code, out = do("GET", chartPath+"/data?tz=UTC&annotations=true", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	data := out["data"].(map[string]interface{})
+	s.Contains(data, "data")
+	inRange := data["annotations"].([]interface{})
+	s.Len(inRange, 2)
+	first := inRange[0].(map[string]interface{})
+	s.Equal("Holiday", first["label"])
+	s.Nil(first["endDate"])
+
+	code, _ = do("PATCH", annotationPath+"/delete", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	code, _ = do("PATCH", annotationPath, s.ownerToken, map[string]interface{}{"label": "Gone"})
+	s.Equal(http.StatusNotFound, code)
+	code, out = do("GET", chartPath+"/annotations", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	s.Len(out["data"].([]interface{}), 2)
+	code, _ = do("PATCH", annotationPath+"/restore", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+
+	code, _ = do("GET", chartPath+"/render?annotations=true", s.ownerToken, nil)
+	s.Equal(http.StatusBadRequest, code)
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"focuz-api/models"
+	"focuz-api/pkg/stats"
+	"focuz-api/types"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxCorrelationLag bounds the lag in periods.
+const maxCorrelationLag = 365
+
+// GetCorrelation aligns the per-period aggregates of two activity types and
+// returns their Pearson and Spearman coefficients with the paired points.
+// Periods where either type has no data are left out.
+func (h *ActivitiesHandler) GetCorrelation(c *gin.Context) {
+	spaceID, err := strconv.Atoi(c.Query("spaceId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "spaceId, typeA, typeB and periodId are required"))
+		return
+	}
+	typeAID, errA := strconv.Atoi(c.Query("typeA"))
+	typeBID, errB := strconv.Atoi(c.Query("typeB"))
+	periodID, errP := strconv.Atoi(c.Query("periodId"))
+	if errA != nil || errB != nil || errP != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "spaceId, typeA, typeB and periodId are required"))
+		return
+	}
+	periodType := types.GetPeriodTypeByID(periodID)
+	if periodType == nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeInvalidRequest, "invalid period type"))
+		return
+	}
+	lag := 0
+	if s := c.Query("lag"); s != "" {
+		if lag, err = strconv.Atoi(s); err != nil || lag < -maxCorrelationLag || lag > maxCorrelationLag {
+			c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, fmt.Sprintf("lag must be between %d and %d", -maxCorrelationLag, maxCorrelationLag)))
+			return
+		}
+	}
+
+	roleID, err := h.spacesRepo.GetUserRoleIDInSpace(c.GetInt("userId"), spaceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
+	if roleID == 0 {
+		c.JSON(http.StatusForbidden, types.NewErrorResponse(types.ErrorCodeForbidden, "No access to this space"))
+		return
+	}
+
+	zone, loc, err := timeSettings(c, h.usersRepo)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
+		return
+	}
+	var startDate, endDate *time.Time
+	for _, p := range []struct {
+		name string
+		dst  **time.Time
+		end  bool
+	}{{"startDate", &startDate, false}, {"endDate", &endDate, true}} {
+		if s := c.Query(p.name); s != "" {
+			t, err := parseRangeDate(s, loc, p.end)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "invalid "+p.name))
+				return
+			}
+			*p.dst = &t
+		}
+	}
+	// B is read lag periods later than A, so its range moves with the lag
+	startB, endB := shiftTime(startDate, periodType.Name, lag), shiftTime(endDate, periodType.Name, lag)
+	tags := c.QueryArray("tags")
+
+	seriesA, err := h.correlationSeries(spaceID, typeAID, c.Query("fieldA"), c.Query("aggregationA"), periodID, startDate, endDate, tags, zone)
+	if err != nil {
+		writeCorrelationError(c, "typeA", err)
+		return
+	}
+	seriesB, err := h.correlationSeries(spaceID, typeBID, c.Query("fieldB"), c.Query("aggregationB"), periodID, startB, endB, tags, zone)
+	if err != nil {
+		writeCorrelationError(c, "typeB", err)
+		return
+	}
+
+	result := models.Correlation{
+		TypeAID:  typeAID,
+		TypeBID:  typeBID,
+		PeriodID: periodID,
+		Lag:      lag,
+		Points:   make([]models.CorrelationPoint, 0),
+	}
+	valuesB := make(map[string]float64, len(seriesB))
+	for _, pb := range seriesB {
+		valuesB[pb.period] = pb.value
+	}
+	var xs, ys []float64
+	for _, pa := range seriesA {
+		periodB, err := shiftPeriod(pa.period, periodType.Name, lag)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+			return
+		}
+		b, ok := valuesB[periodB]
+		if !ok {
+			continue
+		}
+		result.Points = append(result.Points, models.CorrelationPoint{PeriodA: pa.period, PeriodB: periodB, A: pa.value, B: b})
+		xs = append(xs, pa.value)
+		ys = append(ys, b)
+	}
+	result.N = len(xs)
+	if result.N >= 3 {
+		if r, ok := stats.Pearson(xs, ys); ok {
+			result.Pearson = &r
+		}
+		if r, ok := stats.Spearman(xs, ys); ok {
+			result.Spearman = &r
+		}
+	}
+	c.JSON(http.StatusOK, types.NewSuccessResponse(result))
+}
+
+type periodValue struct {
+	period string
+	value  float64
+}
+
+type periodSeries []periodValue
+
+// correlationInputError is an invalid type, field or aggregation of a
+// correlated series, as opposed to a failure to load it.
+type correlationInputError struct{ err error }
+
+func (e *correlationInputError) Error() string { return e.err.Error() }
+
+// writeCorrelationError writes the response for an error of correlationSeries.
+func writeCorrelationError(c *gin.Context, series string, err error) {
+	var e *correlationInputError
+	if errors.As(err, &e) {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, series+": "+e.Error()))
+		return
+	}
+	c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+}
+
+// correlationSeries loads the per-period aggregates of one activity type the
+// way GET /activities does. Only numeric aggregates can be correlated; other
+// invalid input is returned as *correlationInputError.
+func (h *ActivitiesHandler) correlationSeries(spaceID, typeID int, field, aggregation string, periodID int, startDate, endDate *time.Time, tags []string, zone models.UserSettings) (periodSeries, error) {
+	at, err := h.activityTypesRepo.GetActivityTypeByID(typeID)
+	if err != nil {
+		return nil, err
+	}
+	if at == nil || at.IsDeleted || (at.SpaceID != 0 && at.SpaceID != spaceID) {
+		return nil, &correlationInputError{errors.New("invalid activity type")}
+	}
+	var path []string
+	if field != "" {
+		if at, path, err = at.ResolveField(field); err != nil {
+			return nil, &correlationInputError{err}
+		}
+	}
+	if at, err = withAggregation(at, aggregation, ""); err != nil {
+		return nil, &correlationInputError{err}
+	}
+	if at.ValueType == "enum" && at.Aggregation == "mode" {
+		return nil, &correlationInputError{errors.New("correlation needs a numeric aggregation")}
+	}
+	rows, err := h.activitiesRepo.GetActivitiesAnalysis(spaceID, startDate, endDate, tags, at, path, periodID, "", zone)
+	if err != nil {
+		return nil, err
+	}
+	series := make(periodSeries, 0, len(rows))
+	for _, r := range rows {
+		v, ok := r["value"].(float64)
+		if !ok {
+			continue
+		}
+		series = append(series, periodValue{period: r["period"].(string), value: v})
+	}
+	return series, nil
+}
+
+// shiftPeriod moves a period label as formatted by GET /activities (day
+// 2006-01-02, week 2006-W01, month 2006-01, year 2006) by n periods.
+func shiftPeriod(period, periodName string, n int) (string, error) {
+	if n == 0 {
+		return period, nil
+	}
+	start, err := models.ParsePeriodLabel(period, periodName)
+	if err != nil {
+		return "", err
+	}
+	return models.PeriodLabel(models.AddPeriods(start, periodName, n), periodName, "monday"), nil
+}
+
+// shiftTime moves a time by n periods; nil stays nil.
+func shiftTime(t *time.Time, periodName string, n int) *time.Time {
+	if t == nil || n == 0 {
+		return t
+	}
+	out := models.AddPeriods(*t, periodName, n)
+	return &out
+}
@@ -0,0 +1,400 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"focuz-api/models"
+	"focuz-api/repository"
+	"focuz-api/types"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// dashboardGridColumns is the width of the dashboard grid in cells.
+	dashboardGridColumns = 12
+	maxDashboardWidgets  = 24
+	// maxDashboardQueries bounds the widgets computed at once for one request.
+	maxDashboardQueries = 4
+)
+
+type DashboardsHandler struct {
+	repo       *repository.DashboardsRepository
+	charts     *ChartsHandler
+	spacesRepo *repository.SpacesRepository
+}
+
+// NewDashboardsHandler computes widget data with charts, so dashboards honour
+// the same settings, scopes and units as single charts.
+func NewDashboardsHandler(repo *repository.DashboardsRepository, charts *ChartsHandler, spacesRepo *repository.SpacesRepository) *DashboardsHandler {
+	return &DashboardsHandler{
+		repo:       repo,
+		charts:     charts,
+		spacesRepo: spacesRepo,
+	}
+}
+
+func (h *DashboardsHandler) List(c *gin.Context) {
+	spaceID, err := strconv.Atoi(c.Param("spaceId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "Invalid space ID"))
+		return
+	}
+	if !h.checkAccess(c, spaceID) {
+		return
+	}
+	pagination := types.ParsePaginationParams(c)
+	dashboards, total, err := h.repo.List(spaceID, pagination.Offset, pagination.PageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, types.NewSuccessResponse(pagination.BuildResponse(dashboards, total)))
+}
+
+func (h *DashboardsHandler) Create(c *gin.Context) {
+	spaceID, err := strconv.Atoi(c.Param("spaceId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "Invalid space ID"))
+		return
+	}
+	var req struct {
+		Name      string                   `json:"name" binding:"required"`
+		RangeDays *int                     `json:"rangeDays"`
+		RangeFrom *string                  `json:"rangeFrom"`
+		RangeTo   *string                  `json:"rangeTo"`
+		Tags      []string                 `json:"tags"`
+		Widgets   []models.DashboardWidget `json:"widgets"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
+		return
+	}
+	if !h.checkAccess(c, spaceID) {
+		return
+	}
+	d := &models.Dashboard{
+		SpaceID:   spaceID,
+		CreatedBy: c.GetInt("userId"),
+		Name:      strings.TrimSpace(req.Name),
+		RangeDays: req.RangeDays,
+		RangeFrom: req.RangeFrom,
+		RangeTo:   req.RangeTo,
+		Tags:      cleanTags(req.Tags),
+		Widgets:   req.Widgets,
+	}
+	if !h.checkDashboard(c, d) {
+		return
+	}
+	created, err := h.repo.Create(d)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
+	c.JSON(http.StatusCreated, types.NewSuccessResponse(created))
+}
+
+func (h *DashboardsHandler) Get(c *gin.Context) {
+	d, ok := h.loadDashboard(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, types.NewSuccessResponse(d))
+}
+
+// Update changes the given fields. widgets replaces the whole layout; the
+// range fields behave as on charts, and null clears a nullable field.
+func (h *DashboardsHandler) Update(c *gin.Context) {
+	d, ok := h.loadDashboard(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Name *string `json:"name"`
+		// Nullable fields stay raw to tell an omitted field (keep) from null (clear).
+		RangeDays json.RawMessage `json:"rangeDays"`
+		RangeFrom json.RawMessage `json:"rangeFrom"`
+		RangeTo   json.RawMessage `json:"rangeTo"`
+		Tags      json.RawMessage `json:"tags"`
+		Widgets   json.RawMessage `json:"widgets"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
+		return
+	}
+	if req.Name != nil {
+		d.Name = strings.TrimSpace(*req.Name)
+	}
+	// Setting one kind of range drops the other unless both are sent
+	if len(req.RangeDays) > 0 && string(req.RangeDays) != "null" && len(req.RangeFrom) == 0 && len(req.RangeTo) == 0 {
+		d.RangeFrom, d.RangeTo = nil, nil
+	}
+	if (len(req.RangeFrom) > 0 || len(req.RangeTo) > 0) && len(req.RangeDays) == 0 {
+		d.RangeDays = nil
+	}
+	// Decoding into a list reuses its elements, so lists start over
+	if len(req.Tags) > 0 {
+		d.Tags = nil
+	}
+	if len(req.Widgets) > 0 {
+		d.Widgets = nil
+	}
+	fields := []struct {
+		name string
+		raw  json.RawMessage
+		dst  interface{}
+	}{
+		{"rangeDays", req.RangeDays, &d.RangeDays},
+		{"rangeFrom", req.RangeFrom, &d.RangeFrom},
+		{"rangeTo", req.RangeTo, &d.RangeTo},
+		{"tags", req.Tags, &d.Tags},
+		{"widgets", req.Widgets, &d.Widgets},
+	}
+	for _, f := range fields {
+		if len(f.raw) == 0 {
+			continue
+		}
+		if err := json.Unmarshal(f.raw, f.dst); err != nil {
+			c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "Invalid "+f.name))
+			return
+		}
+	}
+	d.Tags = cleanTags(d.Tags)
+	if d.Widgets == nil {
+		d.Widgets = make([]models.DashboardWidget, 0)
+	}
+	if !h.checkDashboard(c, d) {
+		return
+	}
+	if err := h.repo.Update(d); err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
+	updated, err := h.repo.GetByID(d.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, types.NewSuccessResponse(updated))
+}
+
+func (h *DashboardsHandler) Delete(c *gin.Context) {
+	h.setDeleted(c, true)
+}
+
+func (h *DashboardsHandler) Restore(c *gin.Context) {
+	h.setDeleted(c, false)
+}
+
+func (h *DashboardsHandler) setDeleted(c *gin.Context, isDeleted bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "Invalid ID"))
+		return
+	}
+	d, err := h.repo.GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
+	if d == nil || d.IsDeleted == isDeleted {
+		c.JSON(http.StatusNotFound, types.NewErrorResponse(types.ErrorCodeNotFound, "Dashboard not found"))
+		return
+	}
+	if !h.checkAccess(c, d.SpaceID) {
+		return
+	}
+	if err := h.repo.UpdateDeleted(id, isDeleted); err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
+	if isDeleted {
+		c.JSON(http.StatusOK, types.NewSuccessResponse(gin.H{"message": "Dashboard deleted successfully"}))
+		return
+	}
+	c.JSON(http.StatusOK, types.NewSuccessResponse(gin.H{"message": "Dashboard restored successfully"}))
+}
+
+type dashboardData struct {
+	DashboardID int                   `json:"dashboardId"`
+	Widgets     []dashboardWidgetData `json:"widgets"`
+}
+
+// dashboardWidgetData is a widget with its chart's data, or the error that
+// chart failed with.
+type dashboardWidgetData struct {
+	models.DashboardWidget
+	KindID int             `json:"kindId,omitempty"`
+	Name   string          `json:"name,omitempty"`
+	Data   interface{}     `json:"data"`
+	Error  *types.APIError `json:"error,omitempty"`
+}
+
+// Data returns the data of every widget in layout order, computed a few
+// widgets at a time. It takes the query parameters of chart data, applied
+// to every widget; rangeDays, from, to and tags replace the dashboard's
+// shared range and tags. A failing widget carries an error instead of data
+// and does not fail the others.
+func (h *DashboardsHandler) Data(c *gin.Context) {
+	d, ok := h.loadDashboard(c)
+	if !ok {
+		return
+	}
+	q, err := parseChartQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
+		return
+	}
+	zone, _, err := timeSettings(c, h.charts.usersRepo)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
+		return
+	}
+	if q.RangeDays == nil && q.From == "" && q.To == "" {
+		q.RangeDays = d.RangeDays
+		q.From, q.To = stringValue(d.RangeFrom), stringValue(d.RangeTo)
+	}
+	tags := d.Tags
+	if len(q.Tags) > 0 {
+		tags = cleanTags(q.Tags)
+	}
+	q.Tags = nil
+
+	result := dashboardData{DashboardID: d.ID, Widgets: make([]dashboardWidgetData, len(d.Widgets))}
+	sem := make(chan struct{}, maxDashboardQueries)
+	var wg sync.WaitGroup
+	for i, w := range d.Widgets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			result.Widgets[i] = h.widgetData(d, w, q, tags, zone)
+		}()
+	}
+	wg.Wait()
+	c.JSON(http.StatusOK, types.NewSuccessResponse(result))
+}
+
+// widgetData computes the data of one widget's chart with the dashboard's
+// tags added to the chart's own.
+func (h *DashboardsHandler) widgetData(d *models.Dashboard, w models.DashboardWidget, q chartQuery, tags []string, zone models.UserSettings) dashboardWidgetData {
+	out := dashboardWidgetData{DashboardWidget: w}
+	chart, err := h.charts.chartsRepo.GetChartByID(w.ChartID)
+	if err != nil {
+		out.Error = &types.APIError{Code: types.ErrorCodeInternal, Message: err.Error()}
+		return out
+	}
+	if chart == nil || chart.IsDeleted || chart.SpaceID != d.SpaceID {
+		out.Error = &types.APIError{Code: types.ErrorCodeNotFound, Message: "Chart not found"}
+		return out
+	}
+	out.KindID, out.Name = chart.KindID, chart.Name
+	chart.Tags = append(chart.Tags, tags...)
+	// A trend or forecast applies to the line and bar charts of the dashboard
+	if kind := types.GetChartTypeByID(chart.KindID); kind == nil || (kind.Name != "lineChart" && kind.Name != "barChart") {
+		q.Trend = trendQuery{}
+	}
+	if out.Data, err = h.charts.chartData(chart, q, zone); err != nil {
+		out.Error = &types.APIError{Code: types.ErrorCodeInternal, Message: err.Error()}
+		var e *chartDataError
+		if errors.As(err, &e) {
+			out.Error.Code = e.code
+		}
+	}
+	return out
+}
+
+// loadDashboard fetches the live dashboard of the :id parameter and checks
+// that the user is a member of its space. It writes the error response
+// otherwise.
+func (h *DashboardsHandler) loadDashboard(c *gin.Context) (*models.Dashboard, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "Invalid ID"))
+		return nil, false
+	}
+	d, err := h.repo.GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return nil, false
+	}
+	if d == nil || d.IsDeleted {
+		c.JSON(http.StatusNotFound, types.NewErrorResponse(types.ErrorCodeNotFound, "Dashboard not found"))
+		return nil, false
+	}
+	if !h.checkAccess(c, d.SpaceID) {
+		return nil, false
+	}
+	return d, true
+}
+
+func (h *DashboardsHandler) checkAccess(c *gin.Context, spaceID int) bool {
+	roleID, err := h.spacesRepo.GetUserRoleIDInSpace(c.GetInt("userId"), spaceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return false
+	}
+	if roleID == 0 {
+		c.JSON(http.StatusForbidden, types.NewErrorResponse(types.ErrorCodeForbidden, "No access to the space"))
+		return false
+	}
+	return true
+}
+
+// checkDashboard validates the name, range and layout of d and writes a 400
+// when they do not fit. Widgets must show live charts of the dashboard's
+// space and must not overlap.
+func (h *DashboardsHandler) checkDashboard(c *gin.Context, d *models.Dashboard) bool {
+	fail := func(msg string) bool {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, msg))
+		return false
+	}
+	if d.Name == "" {
+		return fail("name is required")
+	}
+	if err := validateChartRange(&models.Chart{RangeDays: d.RangeDays, RangeFrom: d.RangeFrom, RangeTo: d.RangeTo}); err != nil {
+		return fail(err.Error())
+	}
+	if err := validateWidgets(d.Widgets); err != nil {
+		return fail(err.Error())
+	}
+	for i, w := range d.Widgets {
+		chart, err := h.charts.chartsRepo.GetChartByID(w.ChartID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+			return false
+		}
+		if chart == nil || chart.IsDeleted || chart.SpaceID != d.SpaceID {
+			c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeInvalidRequest, "widgets["+strconv.Itoa(i)+"]: invalid chart for this space"))
+			return false
+		}
+	}
+	return true
+}
+
+// validateWidgets checks that the widgets fit the grid and do not overlap.
+func validateWidgets(widgets []models.DashboardWidget) error {
+	if len(widgets) > maxDashboardWidgets {
+		return errors.New("a dashboard has at most " + strconv.Itoa(maxDashboardWidgets) + " widgets")
+	}
+	for i, w := range widgets {
+		prefix := "widgets[" + strconv.Itoa(i) + "]: "
+		if w.X < 0 || w.Y < 0 || w.W < 1 || w.H < 1 {
+			return errors.New(prefix + "x and y must not be negative and w and h must be at least 1")
+		}
+		if w.X+w.W > dashboardGridColumns {
+			return errors.New(prefix + "must fit in " + strconv.Itoa(dashboardGridColumns) + " columns")
+		}
+		for j := 0; j < i; j++ {
+			if w.Overlaps(widgets[j]) {
+				return errors.New(prefix + "overlaps widgets[" + strconv.Itoa(j) + "]")
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func (s *E2ETestSuite) Test99E_Dashboards() {
+	do := s.doJSON
+	spacePath := "/spaces/" + strconv.Itoa(s.createdSpaceID)
+
+	code, out := do("POST", spacePath+"/activity-types", s.ownerToken, map[string]interface{}{
+		"name": "Dashboard minutes", "valueType": "integer", "aggregation": "sum",
+	})
+	s.Equal(http.StatusCreated, code)
+	typeID := int(out["data"].(map[string]interface{})["id"].(float64))
+	for _, tag := range []string{"focus", "meeting"} {
+		code, out = do("POST", "/notes", s.ownerToken, map[string]interface{}{
+			"text": "work", "tags": []string{tag}, "spaceId": s.createdSpaceID, "date": time.Now().Format(time.RFC3339),
+		})
+		s.Equal(http.StatusCreated, code)
+		noteID := int(out["data"].(map[string]interface{})["id"].(float64))
+		code, _ = do("POST", "/activities", s.ownerToken, map[string]interface{}{"typeId": typeID, "value": "45", "note_id": noteID})
+		s.Equal(http.StatusCreated, code)
+	}
+
+	chartIDs := make([]int, 2)
+	for i, kindID := range []int{2, 3} {
+		code, out = do("POST", "/charts", s.ownerToken, map[string]interface{}{
+			"spaceId": s.createdSpaceID, "kindId": kindID, "periodId": 4, "name": "Dashboard chart", "activityTypeId": typeID,
+		})
+		s.Equal(http.StatusCreated, code)
+		chartIDs[i] = int(out["data"].(map[string]interface{})["id"].(float64))
+	}
+
+	widgets := []map[string]interface{}{
+		{"chartId": chartIDs[0], "x": 0, "y": 0, "w": 6, "h": 4},
+		{"chartId": chartIDs[1], "x": 4, "y": 2, "w": 8, "h": 4},
+	}
+	code, _ = do("POST", spacePath+"/dashboards", s.ownerToken, map[string]interface{}{"name": "Work", "widgets": widgets})
+	s.Equal(http.StatusBadRequest, code)
+
+	widgets[1]["x"] = 6
+	code, out = do("POST", spacePath+"/dashboards", s.ownerToken, map[string]interface{}{
+		"name": "Work", "rangeDays": 7, "tags": []string{"focus"}, "widgets": widgets,
+	})
+	s.Equal(http.StatusCreated, code)
+	dashboardPath := "/dashboards/" + strconv.Itoa(int(out["data"].(map[string]interface{})["id"].(float64)))
+	s.Len(out["data"].(map[string]interface{})["widgets"], 2)
+
+	// Every widget comes back in layout order, scoped by the shared tags.
+	code, out = do("GET", dashboardPath+"/data", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	data := out["data"].(map[string]interface{})["widgets"].([]interface{})
+	s.Len(data, 2)
+	bar := data[0].(map[string]interface{})
+	s.Equal(float64(chartIDs[0]), bar["chartId"])
+	s.Nil(bar["error"])
+	s.Equal(45.0, bar["data"].([]interface{})[0].(map[string]interface{})["value"])
+	heatmap := data[1].(map[string]interface{})
+	s.Equal(6.0, heatmap["x"])
+	s.Equal(45.0, heatmap["data"].(map[string]interface{})["max"])
+
+	// tags= replaces the dashboard's tags for one request.
+	code, out = do("GET", dashboardPath+"/data?tags=!nothing", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	bar = out["data"].(map[string]interface{})["widgets"].([]interface{})[0].(map[string]interface{})
+	s.Equal(90.0, bar["data"].([]interface{})[0].(map[string]interface{})["value"])
+
+	// A deleted chart fails only its own widget.
+	code, _ = do("PATCH", "/charts/"+strconv.Itoa(chartIDs[1])+"/delete", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	code, out = do("GET", dashboardPath+"/data", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	data = out["data"].(map[string]interface{})["widgets"].([]interface{})
+	s.Nil(data[0].(map[string]interface{})["error"])
+	s.Equal("NOT_FOUND", data[1].(map[string]interface{})["error"].(map[string]interface{})["code"])
+
+	code, out = do("PATCH", dashboardPath, s.ownerToken, map[string]interface{}{"widgets": widgets[:1], "tags": nil})
+	s.Equal(http.StatusOK, code)
+	s.Len(out["data"].(map[string]interface{})["widgets"], 1)
+	s.Nil(out["data"].(map[string]interface{})["tags"])
+
+	code, _ = do("PATCH", dashboardPath+"/delete", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	code, _ = do("GET", dashboardPath+"/data", s.ownerToken, nil)
+	s.Equal(http.StatusNotFound, code)
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"encoding/json"
+	"focuz-api/models"
+	"focuz-api/pkg/events"
+	"focuz-api/pkg/notify"
+	"focuz-api/repository"
+	"log/slog"
+	"sync"
+)
+
+// FilterCounter computes saved filter counts for a user and pushes them to
+// connected space members when notes of the space change.
+type FilterCounter struct {
+	filtersRepo *repository.FiltersRepository
+	notesRepo   *repository.NotesRepository
+	spacesRepo  *repository.SpacesRepository
+	notifier    notify.Notifier
+
+	mu     sync.Mutex
+	sent   map[[2]int]string // (userID, spaceID) -> last pushed counts
+	queued map[int]bool      // spaceID -> publishing; true when asked again meanwhile
+}
+
+func NewFilterCounter(filtersRepo *repository.FiltersRepository, notesRepo *repository.NotesRepository, spacesRepo *repository.SpacesRepository, notifier notify.Notifier) *FilterCounter {
+	return &FilterCounter{
+		filtersRepo: filtersRepo,
+		notesRepo:   notesRepo,
+		spacesRepo:  spacesRepo,
+		notifier:    notifier,
+		sent:        map[[2]int]string{},
+		queued:      map[int]bool{},
+	}
+}
+
+// Counts returns counts for every filter of the space, evaluating effective
+// (inherited) params. Filters whose stored params are invalid are skipped.
+func (fc *FilterCounter) Counts(userID, spaceID int) ([]models.FilterCount, error) {
+	filters, err := fc.filtersRepo.ListBySpace(spaceID, userID)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int]*models.Filter, len(filters))
+	ids := make([]int, 0, len(filters))
+	for _, f := range filters {
+		byID[f.ID] = f
+		ids = append(ids, f.ID)
+	}
+	viewed, err := fc.filtersRepo.GetLastViewed(userID, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var specs []repository.NoteCountSpec
+	var counted []*models.Filter
+	for _, f := range filters {
+		// Ancestors come from the listing; deleted or invisible parents end the chain
+		var ancestors []*models.Filter
+		seen := map[int]bool{f.ID: true}
+		for p := f.ParentID; p != nil; {
+			a, ok := byID[*p]
+			if !ok || seen[a.ID] {
+				break
+			}
+			seen[a.ID] = true
+			ancestors = append(ancestors, a)
+			p = a.ParentID
+		}
+		params, _, err := models.ResolveFilterParams(f, ancestors)
+		if err != nil {
+			continue
+		}
+		spec := repository.NoteCountSpec{Filters: params.ToNoteFilters(1, 1)}
+		if t, ok := viewed[f.ID]; ok {
+			spec.Since = &t
+		}
+		specs = append(specs, spec)
+		counted = append(counted, f)
+	}
+
+	res, err := fc.notesRepo.CountMatches(spaceID, specs)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]models.FilterCount, 0, len(counted))
+	for i, f := range counted {
+		item := models.FilterCount{FilterID: f.ID, Count: res[i].Total, NewCount: res[i].New}
+		if t, ok := viewed[f.ID]; ok {
+			item.LastViewedAt = &t
+		}
+		out = append(out, item)
+	}
+	return out, nil
+}
+
+// Publish recomputes counts for the connected members of the space in the
+// background and notifies those whose counts changed. Changes made while a
+// space is being published are folded into one more run. Safe to call on a
+// nil receiver.
+func (fc *FilterCounter) Publish(spaceID int) {
+	if fc == nil || fc.notifier == nil {
+		return
+	}
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if _, running := fc.queued[spaceID]; running {
+		fc.queued[spaceID] = true
+		return
+	}
+	fc.queued[spaceID] = false
+	go func() {
+		for {
+			fc.publish(spaceID)
+			fc.mu.Lock()
+			again := fc.queued[spaceID]
+			if again {
+				fc.queued[spaceID] = false
+			} else {
+				delete(fc.queued, spaceID)
+			}
+			fc.mu.Unlock()
+			if !again {
+				return
+			}
+		}
+	}()
+}
+
+// Forget drops the counts last pushed to a user, e.g. once their last
+// WebSocket closed; the next change pushes their counts again.
+func (fc *FilterCounter) Forget(userID int) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	for key := range fc.sent {
+		if key[0] == userID {
+			delete(fc.sent, key)
+		}
+	}
+}
+
+func (fc *FilterCounter) publish(spaceID int) {
+	members, err := fc.spacesRepo.GetUsersInSpace(spaceID)
+	if err != nil {
+		slog.Error("filter counts: list members", "spaceId", spaceID, "err", err)
+		return
+	}
+	presence, _ := fc.notifier.(notify.Presence)
+	for _, m := range members {
+		// Nobody to push to; the member reads the counts on reconnect
+		if presence != nil && !presence.Connected(m.ID) {
+			continue
+		}
+		counts, err := fc.Counts(m.ID, spaceID)
+		if err != nil {
+			slog.Error("filter counts: compute", "spaceId", spaceID, "userId", m.ID, "err", err)
+			return
+		}
+		if len(counts) == 0 {
+			continue
+		}
+		b, _ := json.Marshal(counts)
+		key := [2]int{m.ID, spaceID}
+		fc.mu.Lock()
+		changed := fc.sent[key] != string(b)
+		fc.sent[key] = string(b)
+		fc.mu.Unlock()
+		if changed {
+			fc.notifier.NotifyUser(m.ID, events.FilterCountsUpdated{Type: "FilterCountsUpdated", SpaceID: spaceID, Counts: counts})
+		}
+	}
+}
@@ -2,6 +2,8 @@ package handlers
 
 import (
 	"encoding/json"
+	"focuz-api/models"
+	"focuz-api/pkg/fracindex"
 	"focuz-api/repository"
 	"focuz-api/types"
 	"net/http"
@@ -13,27 +15,53 @@ import (
 type FiltersHandler struct {
 	repo       *repository.FiltersRepository
 	spacesRepo *repository.SpacesRepository
+	notesRepo  *repository.NotesRepository
+	counter    *FilterCounter
 }
 
-func NewFiltersHandler(repo *repository.FiltersRepository, spacesRepo *repository.SpacesRepository) *FiltersHandler {
-	return &FiltersHandler{repo: repo, spacesRepo: spacesRepo}
+func NewFiltersHandler(repo *repository.FiltersRepository, spacesRepo *repository.SpacesRepository, notesRepo *repository.NotesRepository) *FiltersHandler {
+	return &FiltersHandler{
+		repo:       repo,
+		spacesRepo: spacesRepo,
+		notesRepo:  notesRepo,
+		counter:    NewFilterCounter(repo, notesRepo, spacesRepo, nil),
+	}
+}
+
+// WithFilterCounter shares a counter (e.g. one wired to the notifier).
+func (h *FiltersHandler) WithFilterCounter(fc *FilterCounter) *FiltersHandler {
+	h.counter = fc
+	return h
 }
 
 func (h *FiltersHandler) Create(c *gin.Context) {
 	var req struct {
-		SpaceID  int             `json:"spaceId" binding:"required"`
-		ParentID *int            `json:"parentId"`
-		Name     string          `json:"name" binding:"required"`
-		Params   json.RawMessage `json:"params" binding:"required"`
+		SpaceID       int             `json:"spaceId" binding:"required"`
+		ParentID      *int            `json:"parentId"`
+		Name          string          `json:"name" binding:"required"`
+		Params        json.RawMessage `json:"params" binding:"required"`
+		InheritParams bool            `json:"inheritParams"`
+		Visibility    string          `json:"visibility"`
+		Position      string          `json:"position"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
 		return
 	}
-	// Validate JSON shape syntactically: ensure it's valid JSON object/array/string/number; basic parse already done by RawMessage
-	var tmp interface{}
-	if err := json.Unmarshal(req.Params, &tmp); err != nil {
-		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeInvalidRequest, "params must be valid JSON"))
+	// Validate known keys against the typed schema; unknown keys are stored as-is
+	if _, err := models.ParseFilterParams(req.Params); err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
+		return
+	}
+	if req.Visibility == "" {
+		req.Visibility = models.FilterVisibilitySpace
+	}
+	if !models.IsValidFilterVisibility(req.Visibility) {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "visibility must be private or space"))
+		return
+	}
+	if req.Position != "" && !fracindex.Valid(req.Position) {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "Invalid position"))
 		return
 	}
 
@@ -47,12 +75,21 @@ func (h *FiltersHandler) Create(c *gin.Context) {
 		c.JSON(http.StatusForbidden, types.NewErrorResponse(types.ErrorCodeForbidden, "No access to the space"))
 		return
 	}
+	if req.ParentID != nil {
+		if ok := h.checkParent(c, *req.ParentID, req.SpaceID, userID, req.Visibility); !ok {
+			return
+		}
+	} else if req.InheritParams {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "inheritParams requires parentId"))
+		return
+	}
 
-	filter, err := h.repo.CreateFilter(userID, req.SpaceID, req.Name, req.ParentID, req.Params)
+	filter, err := h.repo.CreateFilter(userID, req.SpaceID, req.Name, req.ParentID, req.Params, req.InheritParams, req.Visibility, req.Position)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
 		return
 	}
+	h.counter.Publish(req.SpaceID)
 	c.JSON(http.StatusCreated, types.NewSuccessResponse(filter))
 }
 
@@ -79,28 +116,105 @@ func (h *FiltersHandler) Update(c *gin.Context) {
 		c.JSON(http.StatusForbidden, types.NewErrorResponse(types.ErrorCodeForbidden, "No access to the space"))
 		return
 	}
+	// Other members' private filters do not exist for this user
+	if !existing.VisibleTo(userID) {
+		c.JSON(http.StatusNotFound, types.NewErrorResponse(types.ErrorCodeNotFound, "Filter not found"))
+		return
+	}
 
+	// ParentID stays raw to tell an omitted parent (keep) from null (detach).
+	// Reordering takes either an explicit position or neighbor filter IDs.
 	var req struct {
-		Name     *string          `json:"name"`
-		ParentID *int             `json:"parentId"`
-		Params   *json.RawMessage `json:"params"`
+		Name          *string          `json:"name"`
+		ParentID      json.RawMessage  `json:"parentId"`
+		Params        *json.RawMessage `json:"params"`
+		InheritParams *bool            `json:"inheritParams"`
+		Visibility    *string          `json:"visibility"`
+		Position      *string          `json:"position"`
+		AfterID       *int             `json:"afterId"`
+		BeforeID      *int             `json:"beforeId"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
 		return
 	}
 	if req.Params != nil {
-		var tmp interface{}
-		if err := json.Unmarshal(*req.Params, &tmp); err != nil {
-			c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeInvalidRequest, "params must be valid JSON"))
+		if _, err := models.ParseFilterParams(*req.Params); err != nil {
+			c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
+			return
+		}
+	}
+
+	upd := models.FilterUpdate{
+		Name:          req.Name,
+		Params:        req.Params,
+		InheritParams: req.InheritParams,
+		Visibility:    req.Visibility,
+		SetParent:     req.ParentID != nil,
+	}
+	if req.Visibility != nil && *req.Visibility != existing.Visibility {
+		if !models.IsValidFilterVisibility(*req.Visibility) {
+			c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "visibility must be private or space"))
+			return
+		}
+		if existing.UserID != userID {
+			c.JSON(http.StatusForbidden, types.NewErrorResponse(types.ErrorCodeForbidden, "Only the creator can change visibility"))
+			return
+		}
+	}
+	if req.Position != nil || req.AfterID != nil || req.BeforeID != nil {
+		pos, ok := h.resolvePosition(c, existing, userID, req.Position, req.AfterID, req.BeforeID)
+		if !ok {
+			return
+		}
+		upd.Position = &pos
+	}
+
+	visibility := existing.Visibility
+	if req.Visibility != nil {
+		visibility = *req.Visibility
+	}
+	if upd.SetParent && string(req.ParentID) != "null" {
+		var pid int
+		if err := json.Unmarshal(req.ParentID, &pid); err != nil {
+			c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "parentId must be an integer or null"))
+			return
+		}
+		if ok := h.checkParent(c, pid, existing.SpaceID, userID, visibility); !ok {
+			return
+		}
+		cycle, err := h.repo.WouldCreateCycle(id, pid)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+			return
+		}
+		if cycle {
+			c.JSON(http.StatusConflict, types.NewErrorResponse(types.ErrorCodeConflict, "Reparenting would create a cycle"))
+			return
+		}
+		upd.ParentID = &pid
+	} else if !upd.SetParent && existing.ParentID != nil && visibility != existing.Visibility {
+		if ok := h.checkParent(c, *existing.ParentID, existing.SpaceID, userID, visibility); !ok {
+			return
+		}
+	}
+	if visibility == models.FilterVisibilityPrivate && existing.Visibility != visibility {
+		shared, err := h.repo.HasSharedChildren(id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+			return
+		}
+		if shared {
+			c.JSON(http.StatusConflict, types.NewErrorResponse(types.ErrorCodeConflict, "A filter with shared children cannot be private"))
 			return
 		}
 	}
 
-	if err := h.repo.UpdateFilter(id, req.Name, req.ParentID, req.Params); err != nil {
+	if err := h.repo.UpdateFilter(id, upd); err != nil {
 		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
 		return
 	}
+	h.counter.Publish(existing.SpaceID)
 	c.JSON(http.StatusOK, types.NewSuccessResponse(gin.H{"message": "Filter updated successfully"}))
 }
 
@@ -125,10 +239,16 @@ func (h *FiltersHandler) Delete(c *gin.Context) {
 		c.JSON(http.StatusForbidden, types.NewErrorResponse(types.ErrorCodeForbidden, "No access to the space"))
 		return
 	}
+	// Other members' private filters do not exist for this user
+	if !existing.VisibleTo(userID) {
+		c.JSON(http.StatusNotFound, types.NewErrorResponse(types.ErrorCodeNotFound, "Filter not found"))
+		return
+	}
 	if err := h.repo.SetDeleted(id, true); err != nil {
 		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
 		return
 	}
+	h.counter.Publish(existing.SpaceID)
 	c.JSON(http.StatusOK, types.NewSuccessResponse(gin.H{"message": "Filter deleted successfully"}))
 }
 
@@ -153,10 +273,16 @@ func (h *FiltersHandler) Restore(c *gin.Context) {
 		c.JSON(http.StatusForbidden, types.NewErrorResponse(types.ErrorCodeForbidden, "No access to the space"))
 		return
 	}
+	// Other members' private filters do not exist for this user
+	if !existing.VisibleTo(userID) {
+		c.JSON(http.StatusNotFound, types.NewErrorResponse(types.ErrorCodeNotFound, "Filter not found"))
+		return
+	}
 	if err := h.repo.SetDeleted(id, false); err != nil {
 		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
 		return
 	}
+	h.counter.Publish(existing.SpaceID)
 	c.JSON(http.StatusOK, types.NewSuccessResponse(gin.H{"message": "Filter restored successfully"}))
 }
 
@@ -184,7 +310,7 @@ func (h *FiltersHandler) List(c *gin.Context) {
 	}
 
 	pagination := types.ParsePaginationParams(c)
-	items, total, err := h.repo.List(spaceID, pagination.Page, pagination.PageSize)
+	items, total, err := h.repo.List(spaceID, userID, pagination.Page, pagination.PageSize)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
 		return
@@ -192,3 +318,257 @@ func (h *FiltersHandler) List(c *gin.Context) {
 	response := pagination.BuildResponse(items, total)
 	c.JSON(http.StatusOK, types.NewSuccessResponse(response))
 }
+
+// GET /filters/:id/notes executes the saved filter and returns matching notes.
+func (h *FiltersHandler) Notes(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "Invalid ID"))
+		return
+	}
+	existing, err := h.repo.GetByID(id)
+	if err != nil || existing == nil || existing.IsDeleted {
+		c.JSON(http.StatusNotFound, types.NewErrorResponse(types.ErrorCodeNotFound, "Filter not found"))
+		return
+	}
+	userID := c.GetInt("userId")
+	roleID, err := h.spacesRepo.GetUserRoleIDInSpace(userID, existing.SpaceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
+	if roleID == 0 {
+		c.JSON(http.StatusForbidden, types.NewErrorResponse(types.ErrorCodeForbidden, "No access to the space"))
+		return
+	}
+	// Other members' private filters do not exist for this user
+	if !existing.VisibleTo(userID) {
+		c.JSON(http.StatusNotFound, types.NewErrorResponse(types.ErrorCodeNotFound, "Filter not found"))
+		return
+	}
+
+	params, _, ok := h.resolveParams(c, existing, userID)
+	if !ok {
+		return
+	}
+
+	pagination := types.ParsePaginationParams(c)
+	notes, total, err := h.notesRepo.GetNotes(userID, existing.SpaceID, params.ToNoteFilters(pagination.Page, pagination.PageSize))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
+	response := pagination.BuildResponse(notes, total)
+	c.JSON(http.StatusOK, types.NewSuccessResponse(response))
+}
+
+// GET /filters/:id/effective returns the params the filter actually applies:
+// its own params combined with the inherited chain, plus the chain of filter
+// IDs that contributed (the filter itself first).
+func (h *FiltersHandler) Effective(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "Invalid ID"))
+		return
+	}
+	existing, err := h.repo.GetByID(id)
+	if err != nil || existing == nil || existing.IsDeleted {
+		c.JSON(http.StatusNotFound, types.NewErrorResponse(types.ErrorCodeNotFound, "Filter not found"))
+		return
+	}
+	userID := c.GetInt("userId")
+	roleID, err := h.spacesRepo.GetUserRoleIDInSpace(userID, existing.SpaceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
+	if roleID == 0 {
+		c.JSON(http.StatusForbidden, types.NewErrorResponse(types.ErrorCodeForbidden, "No access to the space"))
+		return
+	}
+	// Other members' private filters do not exist for this user
+	if !existing.VisibleTo(userID) {
+		c.JSON(http.StatusNotFound, types.NewErrorResponse(types.ErrorCodeNotFound, "Filter not found"))
+		return
+	}
+
+	params, chain, ok := h.resolveParams(c, existing, userID)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, types.NewSuccessResponse(gin.H{
+		"filterId": existing.ID,
+		"chain":    chain,
+		"params":   params,
+	}))
+}
+
+// resolveParams returns the effective params of a filter as seen by the
+// user; a parent the user cannot see ends the chain. On failure the error
+// response is already written.
+func (h *FiltersHandler) resolveParams(c *gin.Context, f *models.Filter, userID int) (*models.FilterParams, []int, bool) {
+	var ancestors []*models.Filter
+	if f.InheritParams && f.ParentID != nil {
+		all, err := h.repo.GetAncestors(f.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+			return nil, nil, false
+		}
+		for _, a := range all {
+			if !a.VisibleTo(userID) {
+				break
+			}
+			ancestors = append(ancestors, a)
+		}
+	}
+	// Filters saved before params were validated may not match the schema
+	params, chain, err := models.ResolveFilterParams(f, ancestors)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, types.NewErrorResponse(types.ErrorCodeInvalidRequest, "Stored filter params are invalid: "+err.Error()))
+		return nil, nil, false
+	}
+	return params, chain, true
+}
+
+// checkParent verifies that the parent filter exists in the same space, is
+// visible to the user and may hold a filter of the given visibility.
+func (h *FiltersHandler) checkParent(c *gin.Context, parentID, spaceID, userID int, visibility string) bool {
+	parent, err := h.repo.GetByID(parentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return false
+	}
+	if parent == nil || parent.IsDeleted || parent.SpaceID != spaceID || !parent.VisibleTo(userID) {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "Parent filter not found in this space"))
+		return false
+	}
+	if !parent.CanParent(visibility) {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "A shared filter cannot have a private parent"))
+		return false
+	}
+	return true
+}
+
+// PATCH /filters/:id/viewed records that the current user opened the filter,
+// resetting its new-notes count.
+func (h *FiltersHandler) MarkViewed(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "Invalid ID"))
+		return
+	}
+	existing, err := h.repo.GetByID(id)
+	if err != nil || existing == nil || existing.IsDeleted {
+		c.JSON(http.StatusNotFound, types.NewErrorResponse(types.ErrorCodeNotFound, "Filter not found"))
+		return
+	}
+	userID := c.GetInt("userId")
+	roleID, err := h.spacesRepo.GetUserRoleIDInSpace(userID, existing.SpaceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
+	if roleID == 0 {
+		c.JSON(http.StatusForbidden, types.NewErrorResponse(types.ErrorCodeForbidden, "No access to the space"))
+		return
+	}
+	// Other members' private filters do not exist for this user
+	if !existing.VisibleTo(userID) {
+		c.JSON(http.StatusNotFound, types.NewErrorResponse(types.ErrorCodeNotFound, "Filter not found"))
+		return
+	}
+	viewedAt, err := h.repo.MarkViewed(userID, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, types.NewSuccessResponse(gin.H{"filterId": id, "lastViewedAt": viewedAt}))
+}
+
+// GET /spaces/:spaceId/filters/counts returns match and new-since-last-view
+// counts for all filters of the space, computed in a single query.
+func (h *FiltersHandler) Counts(c *gin.Context) {
+	spaceID, err := strconv.Atoi(c.Param("spaceId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "invalid spaceId"))
+		return
+	}
+	userID := c.GetInt("userId")
+	roleID, err := h.spacesRepo.GetUserRoleIDInSpace(userID, spaceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
+	if roleID == 0 {
+		c.JSON(http.StatusForbidden, types.NewErrorResponse(types.ErrorCodeForbidden, "No access to the space"))
+		return
+	}
+	counts, err := h.counter.Counts(userID, spaceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, types.NewSuccessResponse(counts))
+}
+
+// resolvePosition turns an explicit position or afterId/beforeId neighbors
+// into a new order key for f. On failure the error response is already written.
+func (h *FiltersHandler) resolvePosition(c *gin.Context, f *models.Filter, userID int, position *string, afterID, beforeID *int) (string, bool) {
+	if position != nil {
+		if !fracindex.Valid(*position) {
+			c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "Invalid position"))
+			return "", false
+		}
+		return *position, true
+	}
+	neighbor := func(id int) (*models.Filter, bool) {
+		n, err := h.repo.GetByID(id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+			return nil, false
+		}
+		if n == nil || n.IsDeleted || n.ID == f.ID || n.SpaceID != f.SpaceID || !n.VisibleTo(userID) {
+			c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "Neighbor filter not found in this space"))
+			return nil, false
+		}
+		return n, true
+	}
+	var lo, hi string
+	var err error
+	switch {
+	case afterID != nil && beforeID != nil:
+		a, ok := neighbor(*afterID)
+		if !ok {
+			return "", false
+		}
+		b, ok := neighbor(*beforeID)
+		if !ok {
+			return "", false
+		}
+		lo, hi = a.Position, b.Position
+	case afterID != nil:
+		a, ok := neighbor(*afterID)
+		if !ok {
+			return "", false
+		}
+		lo = a.Position
+		_, hi, err = h.repo.NeighborPositions(f.SpaceID, userID, f.ID, lo)
+	default:
+		b, ok := neighbor(*beforeID)
+		if !ok {
+			return "", false
+		}
+		hi = b.Position
+		lo, _, err = h.repo.NeighborPositions(f.SpaceID, userID, f.ID, hi)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return "", false
+	}
+	pos, err := fracindex.Between(lo, hi)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "afterId must be ordered before beforeId"))
+		return "", false
+	}
+	return pos, true
+}
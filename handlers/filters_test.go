@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 func (s *E2ETestSuite) Test90_CreateFilter() {
@@ -130,3 +131,380 @@ func (s *E2ETestSuite) Test93_UpdateDeleteRestoreFilter() {
 	defer respR.Body.Close()
 	s.Equal(http.StatusOK, respR.StatusCode)
 }
+
+func (s *E2ETestSuite) Test93B_CreateFilterInvalidParams() {
+	cases := []map[string]interface{}{
+		{"tags": "important"},
+		{"notReply": "yes"},
+		{"dateFrom": "01/02/2024"},
+		{"dateFrom": "2024-12-31", "dateTo": "2024-01-01"},
+		{"sortField": "text"},
+		{"sort": "createdAt,SIDEWAYS"},
+	}
+	for _, params := range cases {
+		body := map[string]interface{}{
+			"spaceId": s.createdSpaceID,
+			"name":    "Invalid",
+			"params":  params,
+		}
+		b, _ := json.Marshal(body)
+		req, _ := http.NewRequest("POST", s.baseURL+"/filters", bytes.NewBuffer(b))
+		req.Header.Set("Authorization", "Bearer "+s.ownerToken)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := (&http.Client{}).Do(req)
+		s.NoError(err)
+		resp.Body.Close()
+		s.Equal(http.StatusBadRequest, resp.StatusCode, params)
+	}
+}
+
+func (s *E2ETestSuite) Test93C_ExecuteFilterNotes() {
+	// Note that matches the filter
+	noteBody := map[string]interface{}{
+		"text":    "filter target",
+		"tags":    []string{"filterexec"},
+		"date":    time.Now().Format(time.RFC3339),
+		"spaceId": s.createdSpaceID,
+	}
+	nb, _ := json.Marshal(noteBody)
+	reqN, _ := http.NewRequest("POST", s.baseURL+"/notes", bytes.NewBuffer(nb))
+	reqN.Header.Set("Authorization", "Bearer "+s.ownerToken)
+	reqN.Header.Set("Content-Type", "application/json")
+	respN, err := (&http.Client{}).Do(reqN)
+	s.NoError(err)
+	defer respN.Body.Close()
+	s.Equal(http.StatusCreated, respN.StatusCode)
+
+	body := map[string]interface{}{
+		"spaceId": s.createdSpaceID,
+		"name":    "Exec",
+		"params": map[string]interface{}{
+			"tags":       []string{"filterexec"},
+			"notReply":   true,
+			"sort":       "createdAt,ASC",
+			"futureOnly": map[string]interface{}{"kept": true},
+		},
+	}
+	b, _ := json.Marshal(body)
+	req, _ := http.NewRequest("POST", s.baseURL+"/filters", bytes.NewBuffer(b))
+	req.Header.Set("Authorization", "Bearer "+s.ownerToken)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := (&http.Client{}).Do(req)
+	s.NoError(err)
+	defer resp.Body.Close()
+	s.Equal(http.StatusCreated, resp.StatusCode)
+	var created map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&created)
+	data := created["data"].(map[string]interface{})
+	fid := int(data["id"].(float64))
+	// Unknown keys are preserved
+	s.Contains(data["params"].(map[string]interface{}), "futureOnly")
+
+	reqE, _ := http.NewRequest("GET", s.baseURL+"/filters/"+strconv.Itoa(fid)+"/notes?page=1&pageSize=10", nil)
+	reqE.Header.Set("Authorization", "Bearer "+s.ownerToken)
+	respE, err := (&http.Client{}).Do(reqE)
+	s.NoError(err)
+	defer respE.Body.Close()
+	s.Equal(http.StatusOK, respE.StatusCode)
+	var out map[string]interface{}
+	json.NewDecoder(respE.Body).Decode(&out)
+	paged := out["data"].(map[string]interface{})
+	items := paged["data"].([]interface{})
+	s.Len(items, 1)
+	s.Equal("filter target", items[0].(map[string]interface{})["text"])
+
+	// Unknown filter id
+	reqG, _ := http.NewRequest("GET", s.baseURL+"/filters/999999/notes", nil)
+	reqG.Header.Set("Authorization", "Bearer "+s.ownerToken)
+	respG, err := (&http.Client{}).Do(reqG)
+	s.NoError(err)
+	defer respG.Body.Close()
+	s.Equal(http.StatusNotFound, respG.StatusCode)
+}
+
+func (s *E2ETestSuite) Test93D_FilterInheritanceAndReparenting() {
+	createFilter := func(body map[string]interface{}) int {
+		b, _ := json.Marshal(body)
+		req, _ := http.NewRequest("POST", s.baseURL+"/filters", bytes.NewBuffer(b))
+		req.Header.Set("Authorization", "Bearer "+s.ownerToken)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := (&http.Client{}).Do(req)
+		s.NoError(err)
+		defer resp.Body.Close()
+		s.Equal(http.StatusCreated, resp.StatusCode)
+		var created map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&created)
+		return int(created["data"].(map[string]interface{})["id"].(float64))
+	}
+	patchFilter := func(id int, body map[string]interface{}) int {
+		b, _ := json.Marshal(body)
+		req, _ := http.NewRequest("PATCH", s.baseURL+"/filters/"+strconv.Itoa(id), bytes.NewBuffer(b))
+		req.Header.Set("Authorization", "Bearer "+s.ownerToken)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := (&http.Client{}).Do(req)
+		s.NoError(err)
+		defer resp.Body.Close()
+		return resp.StatusCode
+	}
+	effective := func(id int) map[string]interface{} {
+		req, _ := http.NewRequest("GET", s.baseURL+"/filters/"+strconv.Itoa(id)+"/effective", nil)
+		req.Header.Set("Authorization", "Bearer "+s.ownerToken)
+		resp, err := (&http.Client{}).Do(req)
+		s.NoError(err)
+		defer resp.Body.Close()
+		s.Equal(http.StatusOK, resp.StatusCode)
+		var out map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&out)
+		return out["data"].(map[string]interface{})
+	}
+
+	parentID := createFilter(map[string]interface{}{
+		"spaceId": s.createdSpaceID,
+		"name":    "Inherit parent",
+		"params":  map[string]interface{}{"tags": []string{"inhparent"}, "dateFrom": "2024-01-01"},
+	})
+	childID := createFilter(map[string]interface{}{
+		"spaceId":       s.createdSpaceID,
+		"parentId":      parentID,
+		"name":          "Inherit child",
+		"inheritParams": true,
+		"params":        map[string]interface{}{"tags": []string{"!inhchild"}, "dateFrom": "2024-06-01"},
+	})
+
+	eff := effective(childID)
+	s.Equal([]interface{}{float64(childID), float64(parentID)}, eff["chain"])
+	params := eff["params"].(map[string]interface{})
+	s.ElementsMatch([]interface{}{"inhparent", "!inhchild"}, params["tags"])
+	s.Equal("2024-06-01T00:00:00Z", params["dateFrom"])
+
+	// Parent under its own child would loop
+	s.Equal(http.StatusConflict, patchFilter(parentID, map[string]interface{}{"parentId": childID}))
+	s.Equal(http.StatusConflict, patchFilter(childID, map[string]interface{}{"parentId": childID}))
+
+	// Omitting parentId keeps the parent; null detaches
+	s.Equal(http.StatusOK, patchFilter(childID, map[string]interface{}{"name": "Inherit child 2"}))
+	s.Equal([]interface{}{float64(childID), float64(parentID)}, effective(childID)["chain"])
+	s.Equal(http.StatusOK, patchFilter(childID, map[string]interface{}{"parentId": nil}))
+	s.Equal([]interface{}{float64(childID)}, effective(childID)["chain"])
+
+	// Inheritance without a parent is rejected
+	b, _ := json.Marshal(map[string]interface{}{
+		"spaceId": s.createdSpaceID, "name": "Orphan", "inheritParams": true, "params": map[string]interface{}{},
+	})
+	req, _ := http.NewRequest("POST", s.baseURL+"/filters", bytes.NewBuffer(b))
+	req.Header.Set("Authorization", "Bearer "+s.ownerToken)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := (&http.Client{}).Do(req)
+	s.NoError(err)
+	defer resp.Body.Close()
+	s.Equal(http.StatusBadRequest, resp.StatusCode)
+}
+
+func (s *E2ETestSuite) Test93E_FilterCountsAndLastViewed() {
+	createNote := func() {
+		b, _ := json.Marshal(map[string]interface{}{
+			"text":    "counted note",
+			"tags":    []string{"filtercount"},
+			"date":    time.Now().Format(time.RFC3339),
+			"spaceId": s.createdSpaceID,
+		})
+		req, _ := http.NewRequest("POST", s.baseURL+"/notes", bytes.NewBuffer(b))
+		req.Header.Set("Authorization", "Bearer "+s.ownerToken)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := (&http.Client{}).Do(req)
+		s.NoError(err)
+		defer resp.Body.Close()
+		s.Equal(http.StatusCreated, resp.StatusCode)
+	}
+	countsFor := func(fid int) map[string]interface{} {
+		req, _ := http.NewRequest("GET", s.baseURL+"/spaces/"+strconv.Itoa(s.createdSpaceID)+"/filters/counts", nil)
+		req.Header.Set("Authorization", "Bearer "+s.ownerToken)
+		resp, err := (&http.Client{}).Do(req)
+		s.NoError(err)
+		defer resp.Body.Close()
+		s.Equal(http.StatusOK, resp.StatusCode)
+		var out map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&out)
+		for _, it := range out["data"].([]interface{}) {
+			item := it.(map[string]interface{})
+			if int(item["filterId"].(float64)) == fid {
+				return item
+			}
+		}
+		return nil
+	}
+
+	b, _ := json.Marshal(map[string]interface{}{
+		"spaceId": s.createdSpaceID,
+		"name":    "Counted",
+		"params":  map[string]interface{}{"tags": []string{"filtercount"}},
+	})
+	req, _ := http.NewRequest("POST", s.baseURL+"/filters", bytes.NewBuffer(b))
+	req.Header.Set("Authorization", "Bearer "+s.ownerToken)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := (&http.Client{}).Do(req)
+	s.NoError(err)
+	defer resp.Body.Close()
+	s.Equal(http.StatusCreated, resp.StatusCode)
+	var created map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&created)
+	fid := int(created["data"].(map[string]interface{})["id"].(float64))
+
+	createNote()
+	createNote()
+	// Never viewed: every match is new
+	item := countsFor(fid)
+	if s.NotNil(item) {
+		s.Equal(float64(2), item["count"])
+		s.Equal(float64(2), item["newCount"])
+		s.Nil(item["lastViewedAt"])
+	}
+
+	reqV, _ := http.NewRequest("PATCH", s.baseURL+"/filters/"+strconv.Itoa(fid)+"/viewed", nil)
+	reqV.Header.Set("Authorization", "Bearer "+s.ownerToken)
+	respV, err := (&http.Client{}).Do(reqV)
+	s.NoError(err)
+	defer respV.Body.Close()
+	s.Equal(http.StatusOK, respV.StatusCode)
+
+	createNote()
+	item = countsFor(fid)
+	if s.NotNil(item) {
+		s.Equal(float64(3), item["count"])
+		s.Equal(float64(1), item["newCount"])
+		s.NotNil(item["lastViewedAt"])
+	}
+}
+
+func (s *E2ETestSuite) Test93F_FilterVisibilityAndOrdering() {
+	do := func(method, path, token string, body interface{}) (int, map[string]interface{}) {
+		var buf *bytes.Buffer
+		if body != nil {
+			b, _ := json.Marshal(body)
+			buf = bytes.NewBuffer(b)
+		} else {
+			buf = bytes.NewBuffer(nil)
+		}
+		req, _ := http.NewRequest(method, s.baseURL+path, buf)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := (&http.Client{}).Do(req)
+		s.NoError(err)
+		defer resp.Body.Close()
+		var out map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+	idOf := func(out map[string]interface{}) int {
+		return int(out["data"].(map[string]interface{})["id"].(float64))
+	}
+
+	// Dedicated space shared with the guest
+	code, out := do("POST", "/spaces", s.ownerToken, map[string]interface{}{"name": "Filter visibility"})
+	s.Equal(http.StatusCreated, code)
+	spaceID := idOf(out)
+	code, _ = do("POST", "/spaces/"+strconv.Itoa(spaceID)+"/invite", s.ownerToken, map[string]string{"username": "guest"})
+	s.Equal(http.StatusOK, code)
+	code, _ = do("POST", "/spaces/"+strconv.Itoa(spaceID)+"/invitations/accept", s.guestToken, nil)
+	s.Equal(http.StatusOK, code)
+
+	create := func(name, visibility string) int {
+		code, out := do("POST", "/filters", s.ownerToken, map[string]interface{}{
+			"spaceId": spaceID, "name": name, "visibility": visibility, "params": map[string]interface{}{},
+		})
+		s.Equal(http.StatusCreated, code)
+		return idOf(out)
+	}
+	first := create("First", "space")
+	second := create("Second", "space")
+	private := create("Mine", "private")
+
+	names := func(token string) []string {
+		code, out := do("GET", "/filters?spaceId="+strconv.Itoa(spaceID), token, nil)
+		s.Equal(http.StatusOK, code)
+		var res []string
+		for _, it := range out["data"].(map[string]interface{})["data"].([]interface{}) {
+			res = append(res, it.(map[string]interface{})["name"].(string))
+		}
+		return res
+	}
+	// Creation order is kept; the guest does not see the private filter
+	s.Equal([]string{"First", "Second", "Mine"}, names(s.ownerToken))
+	s.Equal([]string{"First", "Second"}, names(s.guestToken))
+
+	code, _ = do("GET", "/filters/"+strconv.Itoa(private)+"/effective", s.guestToken, nil)
+	s.Equal(http.StatusNotFound, code)
+	code, _ = do("PATCH", "/filters/"+strconv.Itoa(second), s.guestToken, map[string]interface{}{"visibility": "private"})
+	s.Equal(http.StatusForbidden, code)
+
+	// Move Second before First, then Mine between them
+	code, _ = do("PATCH", "/filters/"+strconv.Itoa(second), s.ownerToken, map[string]interface{}{"beforeId": first})
+	s.Equal(http.StatusOK, code)
+	code, _ = do("PATCH", "/filters/"+strconv.Itoa(private), s.ownerToken, map[string]interface{}{"afterId": second, "beforeId": first})
+	s.Equal(http.StatusOK, code)
+	s.Equal([]string{"Second", "Mine", "First"}, names(s.ownerToken))
+	code, _ = do("PATCH", "/filters/"+strconv.Itoa(first), s.ownerToken, map[string]interface{}{"position": "bad!"})
+	s.Equal(http.StatusBadRequest, code)
+
+	// Sync pull sends the private filter to the guest only as a tombstone
+	code, out = do("GET", "/sync?since="+urlQuery("1970-01-01T00:00:00Z")+"&spaceId="+itoa(spaceID), s.guestToken, nil)
+	s.Equal(http.StatusOK, code)
+	found := false
+	for _, it := range out["data"].(map[string]interface{})["filters"].([]interface{}) {
+		f := it.(map[string]interface{})
+		if int(f["id"].(float64)) == private {
+			found = true
+			s.NotNil(f["deleted_at"])
+			s.Equal("", f["name"])
+		}
+	}
+	s.True(found)
+}
+
+func (s *E2ETestSuite) Test93G_SharedFilterNeedsSharedParent() {
+	do := s.doJSON
+	idOf := func(out map[string]interface{}) int {
+		return int(out["data"].(map[string]interface{})["id"].(float64))
+	}
+	create := func(name, visibility string, parentID *int) (int, int) {
+		body := map[string]interface{}{"spaceId": s.createdSpaceID, "name": name, "visibility": visibility, "params": map[string]interface{}{}}
+		if parentID != nil {
+			body["parentId"] = *parentID
+		}
+		code, out := do("POST", "/filters", s.ownerToken, body)
+		if code != http.StatusCreated {
+			return code, 0
+		}
+		return code, idOf(out)
+	}
+
+	_, privateID := create("Private parent", "private", nil)
+	_, sharedID := create("Shared parent", "space", nil)
+	code, _ := create("Shared under private", "space", &privateID)
+	s.Equal(http.StatusBadRequest, code)
+	code, childID := create("Private under private", "private", &privateID)
+	s.Equal(http.StatusCreated, code)
+
+	// Neither sharing the child nor moving a shared filter under the private parent
+	childPath := "/filters/" + strconv.Itoa(childID)
+	code, _ = do("PATCH", childPath, s.ownerToken, map[string]interface{}{"visibility": "space"})
+	s.Equal(http.StatusBadRequest, code)
+	code, _ = do("PATCH", childPath, s.ownerToken, map[string]interface{}{"visibility": "space", "parentId": sharedID})
+	s.Equal(http.StatusOK, code)
+	code, _ = do("PATCH", "/filters/"+strconv.Itoa(sharedID), s.ownerToken, map[string]interface{}{"parentId": privateID})
+	s.Equal(http.StatusBadRequest, code)
+	// A parent with shared children stays shared
+	code, _ = do("PATCH", "/filters/"+strconv.Itoa(sharedID), s.ownerToken, map[string]interface{}{"visibility": "private"})
+	s.Equal(http.StatusConflict, code)
+
+	code, out := do("POST", "/sync", s.ownerToken, map[string]interface{}{"filters": []map[string]interface{}{{
+		"clientId": "shared-under-private", "space_id": s.createdSpaceID, "name": "Synced shared", "visibility": "space",
+		"parent_id": privateID, "params": map[string]interface{}{}, "modified_at": time.Now().Format(time.RFC3339),
+	}}})
+	s.Equal(http.StatusOK, code)
+	data := out["data"].(map[string]interface{})
+	s.Empty(data["mappings"])
+	conflicts := data["conflicts"].([]interface{})
+	s.Len(conflicts, 1)
+	s.Equal("invalid", conflicts[0].(map[string]interface{})["reason"])
+}
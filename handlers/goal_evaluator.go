@@ -0,0 +1,332 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"focuz-api/models"
+	"focuz-api/pkg/events"
+	"focuz-api/pkg/notify"
+	"focuz-api/repository"
+	"focuz-api/types"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	// maxGoalPeriods bounds how far back streaks are computed.
+	maxGoalPeriods = 5000
+	// streakWindow is how many recent periods are read first when only the
+	// current period and streak are needed.
+	streakWindow = 32
+	// atRiskElapsed is the share of the current period after which an unmet
+	// period with a running streak triggers a streak-at-risk notification.
+	atRiskElapsed = 0.75
+)
+
+// GoalEvaluator computes goal progress and sends goal-reached and
+// streak-at-risk notifications, both stored and pushed over the hub.
+type GoalEvaluator struct {
+	goalsRepo         *repository.GoalsRepository
+	activityTypesRepo *repository.ActivityTypesRepository
+	spacesRepo        *repository.SpacesRepository
+	nRepo             *repository.NotificationsRepository
+	usersRepo         *repository.UsersRepository
+	notifier          notify.Notifier
+
+	mu sync.Mutex
+	// queued marks spaces being evaluated; true when another run is due
+	queued map[int]bool
+}
+
+func NewGoalEvaluator(goalsRepo *repository.GoalsRepository, activityTypesRepo *repository.ActivityTypesRepository, spacesRepo *repository.SpacesRepository, nRepo *repository.NotificationsRepository, notifier notify.Notifier) *GoalEvaluator {
+	return &GoalEvaluator{
+		goalsRepo:         goalsRepo,
+		activityTypesRepo: activityTypesRepo,
+		spacesRepo:        spacesRepo,
+		nRepo:             nRepo,
+		notifier:          notifier,
+		queued:            map[int]bool{},
+	}
+}
+
+// WithUserSettings evaluates goals in the time zone and week start of their
+// owner instead of the defaults.
+func (ge *GoalEvaluator) WithUserSettings(r *repository.UsersRepository) *GoalEvaluator {
+	ge.usersRepo = r
+	return ge
+}
+
+// settings returns the time settings of the goal's owner: its user for
+// personal goals and its creator for space goals.
+func (ge *GoalEvaluator) settings(g *models.Goal) (models.UserSettings, *time.Location, error) {
+	settings := models.DefaultUserSettings
+	if ge.usersRepo != nil {
+		owner := g.CreatedBy
+		if g.UserID != nil {
+			owner = *g.UserID
+		}
+		var err error
+		if settings, err = ge.usersRepo.GetSettings(owner); err != nil {
+			return settings, nil, err
+		}
+	}
+	loc, err := settings.Location()
+	return settings, loc, err
+}
+
+// Progress evaluates every period from the goal's first period (its creation
+// or its earliest recorded activity) up to the current one, and returns the
+// last historyLen periods with the streaks. Periods are those of the owner's
+// time zone and week start.
+func (ge *GoalEvaluator) Progress(g *models.Goal, historyLen int, now time.Time) (*models.GoalProgress, error) {
+	p, _, err := ge.progress(g, historyLen, now, 0)
+	return p, err
+}
+
+// currentProgress evaluates the current period and streak from the most
+// recent periods only, reading twice as many while the streak spans all of
+// them. Its longest streak and history cover the periods read.
+func (ge *GoalEvaluator) currentProgress(g *models.Goal, now time.Time) (*models.GoalProgress, error) {
+	for window := streakWindow; ; window *= 2 {
+		p, complete, err := ge.progress(g, 1, now, window)
+		if err != nil || complete || window >= maxGoalPeriods {
+			return p, err
+		}
+		// An unmet current period is not part of the streak before it
+		span := p.CurrentStreak
+		if !p.Current.Met {
+			span++
+		}
+		if span < window {
+			return p, nil
+		}
+	}
+}
+
+// progress is Progress over the last window periods, or the whole history
+// when window is 0. It reports whether the whole history was read.
+func (ge *GoalEvaluator) progress(g *models.Goal, historyLen int, now time.Time, window int) (*models.GoalProgress, bool, error) {
+	periodType := types.GetPeriodTypeByID(g.PeriodID)
+	if periodType == nil {
+		return nil, false, errors.New("invalid period type")
+	}
+	at, err := ge.activityTypesRepo.GetActivityTypeByID(g.ActivityTypeID)
+	if err != nil {
+		return nil, false, err
+	}
+	if at == nil {
+		return nil, false, errors.New("activity type not found")
+	}
+	var field []string
+	if g.FieldPath != nil && *g.FieldPath != "" {
+		if at, field, err = at.ResolveField(*g.FieldPath); err != nil {
+			return nil, false, err
+		}
+	}
+	settings, loc, err := ge.settings(g)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Periods are walked in local wall time and reported as instants in loc
+	period, weekStart := periodType.Name, settings.WeekStart
+	current := models.TruncatePeriod(models.WallTime(now, loc), period, weekStart)
+	start := models.TruncatePeriod(models.WallTime(g.CreatedAt, loc), period, weekStart)
+	var since *time.Time
+	if window > 0 {
+		if from := models.AddPeriods(current, period, 1-window); from.After(start) {
+			since = &from
+		}
+	}
+	values, err := ge.goalsRepo.PeriodValues(g, at, field, period, settings, since)
+	if err != nil {
+		return nil, false, err
+	}
+	if since != nil {
+		start = *since
+	} else if len(values) > 0 && values[0].Start.Before(start) {
+		start = values[0].Start.UTC()
+	}
+	byStart := make(map[time.Time]float64, len(values))
+	for _, v := range values {
+		byStart[v.Start.UTC()] = v.Value
+	}
+
+	var periods []models.GoalPeriod
+	for s := start; !s.After(current); s = models.NextPeriod(s, period) {
+		p := models.GoalPeriod{Period: models.PeriodLabel(s, period, weekStart), Start: models.ZonedTime(s, loc)}
+		if v, ok := byStart[s]; ok {
+			p.Value = &v
+		}
+		p.Met = g.MetPeriod(p.Value)
+		periods = append(periods, p)
+		if len(periods) > maxGoalPeriods {
+			periods = periods[1:]
+		}
+	}
+	if len(periods) == 0 {
+		// Clock skew can put the creation after now; evaluate the current period only
+		p := models.GoalPeriod{Period: models.PeriodLabel(current, period, weekStart), Start: models.ZonedTime(current, loc)}
+		p.Met = g.MetPeriod(nil)
+		periods = append(periods, p)
+	}
+
+	res := &models.GoalProgress{Goal: g, Current: periods[len(periods)-1]}
+	res.CurrentStreak, res.LongestStreak, res.AtRisk = models.Streaks(periods)
+	if historyLen > 0 && len(periods) > historyLen {
+		res.History = periods[len(periods)-historyLen:]
+	} else {
+		res.History = periods
+	}
+	return res, since == nil, nil
+}
+
+// Evaluate checks the goals of a space after its activities changed and
+// notifies recipients of goals whose current period is newly met. It runs in
+// the background; changes made while a space is being evaluated are folded
+// into one more run. Safe to call on a nil receiver.
+func (ge *GoalEvaluator) Evaluate(spaceID int) {
+	if ge == nil {
+		return
+	}
+	ge.mu.Lock()
+	defer ge.mu.Unlock()
+	if _, running := ge.queued[spaceID]; running {
+		ge.queued[spaceID] = true
+		return
+	}
+	ge.queued[spaceID] = false
+	go func() {
+		for {
+			ge.evaluate(spaceID)
+			ge.mu.Lock()
+			again := ge.queued[spaceID]
+			if again {
+				ge.queued[spaceID] = false
+			} else {
+				delete(ge.queued, spaceID)
+			}
+			ge.mu.Unlock()
+			if !again {
+				return
+			}
+		}
+	}()
+}
+
+func (ge *GoalEvaluator) evaluate(spaceID int) {
+	goals, err := ge.goalsRepo.ListActive(spaceID)
+	if err != nil {
+		slog.Error("goals: list", "spaceId", spaceID, "err", err)
+		return
+	}
+	now := time.Now()
+	for _, g := range goals {
+		p, err := ge.currentProgress(g, now)
+		if err != nil {
+			slog.Error("goals: progress", "goalId", g.ID, "err", err)
+			continue
+		}
+		if !p.Current.Met || p.Current.Value == nil {
+			continue
+		}
+		ge.send(g, "GoalReached", p.Current.Start, events.GoalReached{
+			Type:    "GoalReached",
+			GoalID:  g.ID,
+			SpaceID: g.SpaceID,
+			Period:  p.Current.Period,
+			Value:   *p.Current.Value,
+			Streak:  p.CurrentStreak,
+		})
+	}
+}
+
+// CheckAtRisk notifies recipients of goals with a running streak whose
+// current period is mostly over and not yet met.
+func (ge *GoalEvaluator) CheckAtRisk(now time.Time) {
+	goals, err := ge.goalsRepo.ListActive(0)
+	if err != nil {
+		slog.Error("goals: list", "err", err)
+		return
+	}
+	for _, g := range goals {
+		periodType := types.GetPeriodTypeByID(g.PeriodID)
+		if periodType == nil {
+			continue
+		}
+		settings, loc, err := ge.settings(g)
+		if err != nil {
+			slog.Error("goals: settings", "goalId", g.ID, "err", err)
+			continue
+		}
+		// The share of the period elapsed is measured in the owner's zone
+		wall := models.TruncatePeriod(models.WallTime(now, loc), periodType.Name, settings.WeekStart)
+		start := models.ZonedTime(wall, loc)
+		end := models.ZonedTime(models.NextPeriod(wall, periodType.Name), loc)
+		if now.Sub(start).Seconds() < end.Sub(start).Seconds()*atRiskElapsed {
+			continue
+		}
+		p, err := ge.currentProgress(g, now)
+		if err != nil {
+			slog.Error("goals: progress", "goalId", g.ID, "err", err)
+			continue
+		}
+		if !p.AtRisk {
+			continue
+		}
+		ge.send(g, "GoalStreakAtRisk", p.Current.Start, events.GoalStreakAtRisk{
+			Type:    "GoalStreakAtRisk",
+			GoalID:  g.ID,
+			SpaceID: g.SpaceID,
+			Period:  p.Current.Period,
+			Streak:  p.CurrentStreak,
+		})
+	}
+}
+
+// StartAtRiskChecks runs CheckAtRisk every interval until the process exits.
+func (ge *GoalEvaluator) StartAtRiskChecks(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			ge.CheckAtRisk(now)
+		}
+	}()
+}
+
+// send delivers an event to the goal's recipients (its user, or every member
+// for space goals), at most once per event type and period.
+func (ge *GoalEvaluator) send(g *models.Goal, eventType string, periodStart time.Time, event interface{}) {
+	var recipients []int
+	if g.UserID != nil {
+		recipients = []int{*g.UserID}
+	} else {
+		members, err := ge.spacesRepo.GetUsersInSpace(g.SpaceID)
+		if err != nil {
+			slog.Error("goals: list members", "spaceId", g.SpaceID, "err", err)
+			return
+		}
+		for _, m := range members {
+			recipients = append(recipients, m.ID)
+		}
+	}
+	payload, _ := json.Marshal(event)
+	for _, userID := range recipients {
+		fresh, err := ge.goalsRepo.MarkNotified(g.ID, userID, eventType, periodStart)
+		if err != nil {
+			slog.Error("goals: mark notified", "goalId", g.ID, "userId", userID, "err", err)
+			continue
+		}
+		if !fresh {
+			continue
+		}
+		if ge.nRepo != nil {
+			_ = ge.nRepo.Create(userID, eventType, payload, false)
+		}
+		if ge.notifier != nil {
+			ge.notifier.NotifyUser(userID, event)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"focuz-api/globals"
+	"focuz-api/models"
+	"focuz-api/repository"
+	"focuz-api/types"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultGoalHistory = 30
+	maxGoalHistory     = 365
+)
+
+type GoalsHandler struct {
+	repo              *repository.GoalsRepository
+	activityTypesRepo *repository.ActivityTypesRepository
+	spacesRepo        *repository.SpacesRepository
+	evaluator         *GoalEvaluator
+}
+
+func NewGoalsHandler(repo *repository.GoalsRepository, activityTypesRepo *repository.ActivityTypesRepository, spacesRepo *repository.SpacesRepository, evaluator *GoalEvaluator) *GoalsHandler {
+	return &GoalsHandler{
+		repo:              repo,
+		activityTypesRepo: activityTypesRepo,
+		spacesRepo:        spacesRepo,
+		evaluator:         evaluator,
+	}
+}
+
+func (h *GoalsHandler) List(c *gin.Context) {
+	spaceID, err := strconv.Atoi(c.Param("spaceId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "Invalid space ID"))
+		return
+	}
+	userID := c.GetInt("userId")
+	roleID, err := h.spacesRepo.GetUserRoleIDInSpace(userID, spaceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
+	if roleID == 0 {
+		c.JSON(http.StatusForbidden, types.NewErrorResponse(types.ErrorCodeForbidden, "No access to the space"))
+		return
+	}
+	pagination := types.ParsePaginationParams(c)
+	goals, total, err := h.repo.List(spaceID, userID, pagination.Offset, pagination.PageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, types.NewSuccessResponse(pagination.BuildResponse(goals, total)))
+}
+
+func (h *GoalsHandler) Create(c *gin.Context) {
+	spaceID, err := strconv.Atoi(c.Param("spaceId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "Invalid space ID"))
+		return
+	}
+	var req struct {
+		ActivityTypeID int      `json:"activityTypeId" binding:"required"`
+		FieldPath      *string  `json:"fieldPath"`
+		PeriodID       int      `json:"periodId" binding:"required"`
+		Operator       string   `json:"operator" binding:"required"`
+		Target         *float64 `json:"target" binding:"required"`
+		Scope          string   `json:"scope"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
+		return
+	}
+	if req.Scope == "" {
+		req.Scope = "user"
+	}
+	if req.Scope != "user" && req.Scope != "space" {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "scope must be user or space"))
+		return
+	}
+
+	userID := c.GetInt("userId")
+	roleID, err := h.spacesRepo.GetUserRoleIDInSpace(userID, spaceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
+	if roleID == 0 {
+		c.JSON(http.StatusForbidden, types.NewErrorResponse(types.ErrorCodeForbidden, "No access to the space"))
+		return
+	}
+	if req.Scope == "space" && roleID != globals.DefaultOwnerRoleID {
+		c.JSON(http.StatusForbidden, types.NewErrorResponse(types.ErrorCodeForbidden, "Only the owner can create space goals"))
+		return
+	}
+
+	at, err := h.activityTypesRepo.GetActivityTypeByID(req.ActivityTypeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
+	if at == nil || at.IsDeleted || (!at.IsDefault && at.SpaceID != spaceID) {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeInvalidRequest, "Invalid or deleted activity type"))
+		return
+	}
+
+	g := &models.Goal{
+		SpaceID:        spaceID,
+		CreatedBy:      userID,
+		ActivityTypeID: at.ID,
+		FieldPath:      req.FieldPath,
+		PeriodID:       req.PeriodID,
+		Operator:       req.Operator,
+		Target:         *req.Target,
+	}
+	if req.Scope == "user" {
+		g.UserID = &userID
+	}
+	if g.FieldPath != nil && *g.FieldPath == "" {
+		g.FieldPath = nil
+	}
+	if err := validateGoal(g, at); err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
+		return
+	}
+
+	created, err := h.repo.Create(g)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
+	c.JSON(http.StatusCreated, types.NewSuccessResponse(created))
+	// Activities recorded before the goal existed may already meet it
+	h.evaluator.Evaluate(spaceID)
+}
+
+func (h *GoalsHandler) Update(c *gin.Context) {
+	g, ok := h.loadEditableGoal(c)
+	if !ok {
+		return
+	}
+	if g.IsDeleted {
+		c.JSON(http.StatusNotFound, types.NewErrorResponse(types.ErrorCodeNotFound, "Goal not found"))
+		return
+	}
+	var req struct {
+		FieldPath json.RawMessage `json:"fieldPath"`
+		PeriodID  *int            `json:"periodId"`
+		Operator  *string         `json:"operator"`
+		Target    *float64        `json:"target"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
+		return
+	}
+	if req.FieldPath != nil {
+		if err := json.Unmarshal(req.FieldPath, &g.FieldPath); err != nil {
+			c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "fieldPath must be a string or null"))
+			return
+		}
+		if g.FieldPath != nil && *g.FieldPath == "" {
+			g.FieldPath = nil
+		}
+	}
+	if req.PeriodID != nil {
+		g.PeriodID = *req.PeriodID
+	}
+	if req.Operator != nil {
+		g.Operator = *req.Operator
+	}
+	if req.Target != nil {
+		g.Target = *req.Target
+	}
+
+	at, err := h.activityTypesRepo.GetActivityTypeByID(g.ActivityTypeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
+	if at == nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeInvalidRequest, "Invalid or deleted activity type"))
+		return
+	}
+	if err := validateGoal(g, at); err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
+		return
+	}
+	if err := h.repo.Update(g); err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
+	updated, err := h.repo.GetByID(g.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, types.NewSuccessResponse(updated))
+	h.evaluator.Evaluate(g.SpaceID)
+}
+
+func (h *GoalsHandler) Delete(c *gin.Context) {
+	h.setDeleted(c, true)
+}
+
+func (h *GoalsHandler) Restore(c *gin.Context) {
+	h.setDeleted(c, false)
+}
+
+func (h *GoalsHandler) setDeleted(c *gin.Context, isDeleted bool) {
+	g, ok := h.loadEditableGoal(c)
+	if !ok {
+		return
+	}
+	if g.IsDeleted == isDeleted {
+		c.JSON(http.StatusNotFound, types.NewErrorResponse(types.ErrorCodeNotFound, "Goal not found"))
+		return
+	}
+	if err := h.repo.UpdateDeleted(g.ID, isDeleted); err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
+	if isDeleted {
+		c.JSON(http.StatusOK, types.NewSuccessResponse(gin.H{"message": "Goal deleted successfully"}))
+		return
+	}
+	c.JSON(http.StatusOK, types.NewSuccessResponse(gin.H{"message": "Goal restored successfully"}))
+}
+
+// Progress evaluates the goal for the current period and the last
+// ?periods=N periods (default 30, at most 365), with its streaks.
+func (h *GoalsHandler) Progress(c *gin.Context) {
+	g, _, ok := h.loadGoal(c)
+	if !ok {
+		return
+	}
+	if g.IsDeleted {
+		c.JSON(http.StatusNotFound, types.NewErrorResponse(types.ErrorCodeNotFound, "Goal not found"))
+		return
+	}
+	historyLen := defaultGoalHistory
+	if raw := c.Query("periods"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxGoalHistory {
+			c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "periods must be between 1 and 365"))
+			return
+		}
+		historyLen = n
+	}
+	progress, err := h.evaluator.Progress(g, historyLen, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, types.NewSuccessResponse(progress))
+}
+
+// loadGoal fetches the goal of the :id parameter and checks that the user is
+// a member of its space and sees it. It writes the error response otherwise.
+func (h *GoalsHandler) loadGoal(c *gin.Context) (*models.Goal, int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "Invalid ID"))
+		return nil, 0, false
+	}
+	g, err := h.repo.GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return nil, 0, false
+	}
+	if g == nil {
+		c.JSON(http.StatusNotFound, types.NewErrorResponse(types.ErrorCodeNotFound, "Goal not found"))
+		return nil, 0, false
+	}
+	userID := c.GetInt("userId")
+	roleID, err := h.spacesRepo.GetUserRoleIDInSpace(userID, g.SpaceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return nil, 0, false
+	}
+	if roleID == 0 {
+		c.JSON(http.StatusForbidden, types.NewErrorResponse(types.ErrorCodeForbidden, "No access to the space"))
+		return nil, 0, false
+	}
+	// Other members' personal goals do not exist for this user
+	if !g.VisibleTo(userID) {
+		c.JSON(http.StatusNotFound, types.NewErrorResponse(types.ErrorCodeNotFound, "Goal not found"))
+		return nil, 0, false
+	}
+	return g, roleID, true
+}
+
+// loadEditableGoal is loadGoal for changes: personal goals are edited by
+// their user, space goals by the owner.
+func (h *GoalsHandler) loadEditableGoal(c *gin.Context) (*models.Goal, bool) {
+	g, roleID, ok := h.loadGoal(c)
+	if !ok {
+		return nil, false
+	}
+	if g.UserID == nil && roleID != globals.DefaultOwnerRoleID {
+		c.JSON(http.StatusForbidden, types.NewErrorResponse(types.ErrorCodeForbidden, "Only the owner can edit space goals"))
+		return nil, false
+	}
+	return g, true
+}
+
+// validateGoal checks the period, operator and field path of g against its
+// activity type, whose aggregation must produce a number.
+func validateGoal(g *models.Goal, at *models.ActivityType) error {
+	if types.GetPeriodTypeByID(g.PeriodID) == nil {
+		return errors.New("Invalid period type")
+	}
+	if !models.IsValidGoalOperator(g.Operator) {
+		return errors.New("operator must be one of >=, >, <=, <, =")
+	}
+	target := at
+	if g.FieldPath != nil {
+		resolved, _, err := at.ResolveField(*g.FieldPath)
+		if err != nil {
+			return err
+		}
+		target = resolved
+	}
+	if target.ValueType == "enum" && target.Aggregation == "mode" {
+		return errors.New("goals need a numeric aggregation; the mode of an enum is not a number")
+	}
+	return nil
+}
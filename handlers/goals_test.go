@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func (s *E2ETestSuite) Test64B_GoalsProgressAndStreaks() {
+	do := s.doJSON
+	spacePath := "/spaces/" + strconv.Itoa(s.createdSpaceID)
+
+	code, out := do("POST", spacePath+"/activity-types", s.ownerToken, map[string]interface{}{
+		"name": "Goal steps", "valueType": "integer", "aggregation": "sum",
+	})
+	s.Equal(http.StatusCreated, code)
+	typeID := int(out["data"].(map[string]interface{})["id"].(float64))
+
+	code, out = do("POST", "/notes", s.ownerToken, map[string]interface{}{
+		"text": "walk", "tags": []string{"walk"}, "spaceId": s.createdSpaceID,
+		"date": time.Now().Format(time.RFC3339),
+	})
+	s.Equal(http.StatusCreated, code)
+	noteID := int(out["data"].(map[string]interface{})["id"].(float64))
+	code, _ = do("POST", "/activities", s.ownerToken, map[string]interface{}{"typeId": typeID, "value": "12000", "note_id": noteID})
+	s.Equal(http.StatusCreated, code)
+
+	goal := map[string]interface{}{"activityTypeId": typeID, "periodId": 1, "operator": "=>", "target": 10000}
+	code, _ = do("POST", spacePath+"/goals", s.ownerToken, goal)
+	s.Equal(http.StatusBadRequest, code)
+
+	goal["operator"] = ">="
+	code, out = do("POST", spacePath+"/goals", s.ownerToken, goal)
+	s.Equal(http.StatusCreated, code)
+	goalID := int(out["data"].(map[string]interface{})["id"].(float64))
+	goalPath := "/goals/" + strconv.Itoa(goalID)
+
+	code, out = do("GET", goalPath+"/progress?periods=7", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	progress := out["data"].(map[string]interface{})
+	current := progress["current"].(map[string]interface{})
+	s.Equal(12000.0, current["value"])
+	s.Equal(true, current["met"])
+	s.Equal(1.0, progress["currentStreak"])
+	s.Equal(1.0, progress["longestStreak"])
+	s.Equal(false, progress["atRisk"])
+
+	// Goal-reached notifications are sent in the background.
+	found := false
+	for i := 0; i < 20 && !found; i++ {
+		_, out = do("GET", "/notifications/unread", s.ownerToken, nil)
+		for _, n := range out["data"].([]interface{}) {
+			if n.(map[string]interface{})["type"] == "GoalReached" {
+				found = true
+			}
+		}
+		if !found {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+	s.True(found)
+
+	code, out = do("PATCH", goalPath, s.ownerToken, map[string]interface{}{"target": 15000})
+	s.Equal(http.StatusOK, code)
+	code, out = do("GET", goalPath+"/progress", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	progress = out["data"].(map[string]interface{})
+	s.Equal(false, progress["current"].(map[string]interface{})["met"])
+	s.Equal(0.0, progress["currentStreak"])
+
+	code, _ = do("PATCH", goalPath+"/delete", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	code, _ = do("GET", goalPath+"/progress", s.ownerToken, nil)
+	s.Equal(http.StatusNotFound, code)
+	code, _ = do("PATCH", goalPath+"/restore", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+}
+
+func (s *E2ETestSuite) Test64C_GoalsFollowOwnerTimeSettings() {
+	do := s.doJSON
+	spacePath := "/spaces/" + strconv.Itoa(s.createdSpaceID)
+
+	code, _ := do("PATCH", "/me/settings", s.ownerToken, map[string]interface{}{"timezone": "Pacific/Kiritimati", "weekStart": "sunday"})
+	s.Equal(http.StatusOK, code)
+	defer do("PATCH", "/me/settings", s.ownerToken, map[string]interface{}{"timezone": "UTC", "weekStart": "monday"})
+	loc, err := time.LoadLocation("Pacific/Kiritimati")
+	s.Require().NoError(err)
+
+	code, out := do("POST", spacePath+"/activity-types", s.ownerToken, map[string]interface{}{
+		"name": "Goal zone steps", "valueType": "integer", "aggregation": "sum",
+	})
+	s.Equal(http.StatusCreated, code)
+	typeID := int(out["data"].(map[string]interface{})["id"].(float64))
+
+	code, out = do("POST", spacePath+"/goals", s.ownerToken, map[string]interface{}{"activityTypeId": typeID, "periodId": 1, "operator": ">=", "target": 1})
+	s.Equal(http.StatusCreated, code)
+	dayGoal := int(out["data"].(map[string]interface{})["id"].(float64))
+	code, out = do("GET", "/goals/"+strconv.Itoa(dayGoal)+"/progress", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	current := out["data"].(map[string]interface{})["current"].(map[string]interface{})
+	s.Equal(time.Now().In(loc).Format("2006-01-02"), current["period"])
+
+	// Sunday weeks are labelled with the ISO week of their Monday
+	code, out = do("POST", spacePath+"/goals", s.ownerToken, map[string]interface{}{"activityTypeId": typeID, "periodId": 2, "operator": ">=", "target": 1})
+	s.Equal(http.StatusCreated, code)
+	weekGoal := int(out["data"].(map[string]interface{})["id"].(float64))
+	code, out = do("GET", "/goals/"+strconv.Itoa(weekGoal)+"/progress", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	current = out["data"].(map[string]interface{})["current"].(map[string]interface{})
+	local := time.Now().In(loc)
+	sunday := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc).AddDate(0, 0, -int(local.Weekday()))
+	y, w := sunday.AddDate(0, 0, 1).ISOWeek()
+	s.Equal(fmt.Sprintf("%04d-W%02d", y, w), current["period"])
+	start, err := time.Parse(time.RFC3339, current["start"].(string))
+	s.Require().NoError(err)
+	s.True(start.Equal(sunday))
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"focuz-api/globals"
 	"focuz-api/pkg/appenv"
+	"focuz-api/pkg/query"
 	"focuz-api/repository"
 	"focuz-api/types"
 	"net/http"
@@ -22,14 +23,21 @@ import (
 )
 
 type NotesHandler struct {
-	repo       *repository.NotesRepository
-	spacesRepo *repository.SpacesRepository
+	repo          *repository.NotesRepository
+	spacesRepo    *repository.SpacesRepository
+	filterCounter *FilterCounter
 }
 
 func NewNotesHandler(repo *repository.NotesRepository, spacesRepo *repository.SpacesRepository) *NotesHandler {
 	return &NotesHandler{repo: repo, spacesRepo: spacesRepo}
 }
 
+// WithFilterCounter enables pushing saved filter counts after changes. It is optional.
+func (h *NotesHandler) WithFilterCounter(fc *FilterCounter) *NotesHandler {
+	h.filterCounter = fc
+	return h
+}
+
 func AuthMiddleware(secret string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
@@ -185,6 +193,7 @@ func (h *NotesHandler) CreateNote(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusCreated, types.NewSuccessResponse(note))
+	h.filterCounter.Publish(req.SpaceID)
 }
 
 func (h *NotesHandler) DeleteNote(c *gin.Context) {
@@ -221,6 +230,7 @@ func (h *NotesHandler) DeleteNote(c *gin.Context) {
 		return
 	}
 	c.JSON(http.StatusOK, types.NewSuccessResponse(gin.H{"message": "Note deleted successfully"}))
+	h.filterCounter.Publish(note.SpaceID)
 }
 
 func (h *NotesHandler) RestoreNote(c *gin.Context) {
@@ -257,6 +267,7 @@ func (h *NotesHandler) RestoreNote(c *gin.Context) {
 		return
 	}
 	c.JSON(http.StatusOK, types.NewSuccessResponse(gin.H{"message": "Note restored successfully"}))
+	h.filterCounter.Publish(note.SpaceID)
 }
 
 func (h *NotesHandler) GetNote(c *gin.Context) {
@@ -328,6 +339,15 @@ func (h *NotesHandler) GetNotes(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "search is not supported on this endpoint; use client-side search"))
 		return
 	}
+	var q query.Expr
+	if raw := strings.TrimSpace(c.Query("q")); raw != "" {
+		expr, err := query.Parse(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, "invalid q: "+err.Error()))
+			return
+		}
+		q = expr
+	}
 	parentIDParam := c.Query("parentId")
 	var parentID *int
 	if parentIDParam != "" {
@@ -384,6 +404,7 @@ func (h *NotesHandler) GetNotes(c *gin.Context) {
 		SortOrder:   sortOrder,
 		DateFrom:    dateFrom,
 		DateTo:      dateTo,
+		Query:       q,
 	}
 	notes, total, err := h.repo.GetNotes(userID, spaceID, filters)
 	if err != nil {
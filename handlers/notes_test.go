@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 )
@@ -362,6 +363,64 @@ func (s *E2ETestSuite) Test65_TagFiltering_StrictIncludeAndExclude() {
 	s.False(texts4["note D"])
 }
 
+func (s *E2ETestSuite) Test65B_QueryLanguage() {
+	create := func(text string, tags []string) {
+		reqBody := map[string]interface{}{
+			"text":    text,
+			"tags":    tags,
+			"date":    time.Now().Format(time.RFC3339),
+			"spaceId": s.createdSpaceID,
+		}
+		b, _ := json.Marshal(reqBody)
+		req, _ := http.NewRequest("POST", s.baseURL+"/notes", bytes.NewBuffer(b))
+		req.Header.Set("Authorization", "Bearer "+s.ownerToken)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := (&http.Client{}).Do(req)
+		s.NoError(err)
+		defer resp.Body.Close()
+		s.Equal(http.StatusCreated, resp.StatusCode)
+	}
+	create("qlang work", []string{"qwork"})
+	create("qlang meeting", []string{"qmeeting"})
+	create("qlang work draft", []string{"qwork", "qdraft"})
+
+	get := func(q string) (int, map[string]bool) {
+		u := s.baseURL + "/notes?spaceId=" + strconv.Itoa(s.createdSpaceID) + "&q=" + url.QueryEscape(q)
+		req, _ := http.NewRequest("GET", u, nil)
+		req.Header.Set("Authorization", "Bearer "+s.ownerToken)
+		resp, err := (&http.Client{}).Do(req)
+		s.NoError(err)
+		defer resp.Body.Close()
+		texts := map[string]bool{}
+		if resp.StatusCode != http.StatusOK {
+			return resp.StatusCode, texts
+		}
+		var body map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&body)
+		data := body["data"].(map[string]interface{})
+		for _, it := range data["data"].([]interface{}) {
+			texts[it.(map[string]interface{})["text"].(string)] = true
+		}
+		return resp.StatusCode, texts
+	}
+
+	code, texts := get("(#qwork OR #qmeeting) AND NOT #qdraft")
+	s.Equal(http.StatusOK, code)
+	s.True(texts["qlang work"])
+	s.True(texts["qlang meeting"])
+	s.False(texts["qlang work draft"])
+
+	code, texts = get(`"work draft" date>=-1d`)
+	s.Equal(http.StatusOK, code)
+	s.True(texts["qlang work draft"])
+	s.False(texts["qlang work"])
+
+	code, _ = get("(#qwork OR")
+	s.Equal(http.StatusBadRequest, code)
+	code, _ = get("foo:bar")
+	s.Equal(http.StatusBadRequest, code)
+}
+
 func (s *E2ETestSuite) Test93_CreateFilterWithComplexParams() {
 	params := map[string]interface{}{
 		"tags":     []string{"important", "!archived"},
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"focuz-api/repository"
+	"log/slog"
+	"time"
+)
+
+// RollupZones keeps the rollup zones of the spaces in line with their
+// members' time zones in the background, so that no request builds them.
+type RollupZones struct {
+	repo *repository.RollupsRepository
+	kick chan struct{}
+}
+
+func NewRollupZones(repo *repository.RollupsRepository) *RollupZones {
+	return &RollupZones{repo: repo, kick: make(chan struct{}, 1)}
+}
+
+// Kick asks for a sync soon, e.g. after a user changed time zone. It never
+// blocks and is safe to call on a nil receiver.
+func (rz *RollupZones) Kick() {
+	if rz == nil {
+		return
+	}
+	select {
+	case rz.kick <- struct{}{}:
+	default:
+	}
+}
+
+// Start syncs the zones now, every interval and on Kick until the process exits.
+func (rz *RollupZones) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			added, removed, err := rz.repo.SyncZones()
+			if err != nil {
+				slog.Error("rollups: sync zones", "err", err)
+			} else if added > 0 || removed > 0 {
+				slog.Info("rollups: synced zones", "added", added, "removed", removed)
+			}
+			select {
+			case <-ticker.C:
+			case <-rz.kick:
+			}
+		}
+	}()
+}
@@ -16,11 +16,14 @@ import (
 )
 
 type SyncHandler struct {
-	syncRepo    *repository.SyncRepository
-	spacesRepo  *repository.SpacesRepository
-	tagsRepo    *repository.TagsRepository
-	filtersRepo *repository.FiltersRepository
-	notifier    notify.Notifier
+	syncRepo      *repository.SyncRepository
+	spacesRepo    *repository.SpacesRepository
+	tagsRepo      *repository.TagsRepository
+	filtersRepo   *repository.FiltersRepository
+	notifier      notify.Notifier
+	filterCounter *FilterCounter
+	goals         *GoalEvaluator
+	charts        *ChartsHandler
 
 	// Limits are intentionally large by default, but still enforced as a contract
 	// to avoid unbounded memory/CPU on the server.
@@ -45,6 +48,24 @@ func (h *SyncHandler) WithNotifier(n notify.Notifier) *SyncHandler {
 	return h
 }
 
+// WithFilterCounter pushes saved filter counts for spaces touched by a push.
+func (h *SyncHandler) WithFilterCounter(fc *FilterCounter) *SyncHandler {
+	h.filterCounter = fc
+	return h
+}
+
+// WithGoalEvaluator re-evaluates the goals of spaces touched by a push.
+func (h *SyncHandler) WithGoalEvaluator(ge *GoalEvaluator) *SyncHandler {
+	h.goals = ge
+	return h
+}
+
+// WithCharts validates the charts of a push as the chart endpoints do.
+func (h *SyncHandler) WithCharts(ch *ChartsHandler) *SyncHandler {
+	h.charts = ch
+	return h
+}
+
 func (h *SyncHandler) WithLimits(maxBodyBytes int64, maxBatchItems int) *SyncHandler {
 	if maxBodyBytes > 0 {
 		h.maxBodyBytes = maxBodyBytes
@@ -140,15 +161,100 @@ func (h *SyncHandler) Push(c *gin.Context) {
 	}
 
 	userID := c.GetInt("userId")
+	invalid, err := h.checkCharts(userID, &req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
 	res, err := h.syncRepo.ApplyChanges(userID, req)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
 		return
 	}
+	res.Conflicts = append(res.Conflicts, invalid...)
 	c.JSON(http.StatusOK, types.NewSuccessResponse(res))
 	if h.notifier != nil && res.Applied > 0 {
 		h.notifier.NotifyUser(userID, events.SyncPushed{Type: "SyncPushed"})
 	}
+	if res.Applied > 0 {
+		// Filter counts of every space the push touched; goals of those
+		// whose activities may have changed
+		counted, evaluated := map[int]bool{}, map[int]bool{}
+		for _, n := range req.Notes {
+			counted[n.SpaceID], evaluated[n.SpaceID] = true, true
+		}
+		for _, t := range req.Tags {
+			counted[t.SpaceID] = true
+		}
+		for _, f := range req.Filters {
+			counted[f.SpaceID] = true
+		}
+		spaceless := false
+		for _, a := range req.Activities {
+			if a.SpaceID != nil {
+				counted[*a.SpaceID], evaluated[*a.SpaceID] = true, true
+			} else {
+				spaceless = true
+			}
+		}
+		for spaceID := range counted {
+			if spaceID > 0 {
+				h.filterCounter.Publish(spaceID)
+			}
+		}
+		for spaceID := range evaluated {
+			if spaceID > 0 {
+				h.goals.Evaluate(spaceID)
+			}
+		}
+		// Top-level activities without a space may be in any space of the user
+		if spaceless && h.goals != nil {
+			if userSpaces, err := h.spacesRepo.GetSpacesForUser(userID); err == nil {
+				for _, sp := range userSpaces {
+					if !evaluated[sp.ID] {
+						evaluated[sp.ID] = true
+						h.goals.Evaluate(sp.ID)
+					}
+				}
+			}
+		}
+	}
+}
+
+// checkCharts drops the chart changes of notes that would leave a chart
+// invalid and returns them as conflicts. Charts the push would skip anyway
+// (unknown, or not on the pushed note) are left to ApplyChanges.
+func (h *SyncHandler) checkCharts(userID int, req *types.SyncPushRequest) ([]types.Conflict, error) {
+	var conflicts []types.Conflict
+	if h.charts == nil {
+		return conflicts, nil
+	}
+	for i := range req.Notes {
+		n := &req.Notes[i]
+		if n.ID == nil || len(n.Charts) == 0 {
+			continue
+		}
+		kept := n.Charts[:0]
+		for _, ch := range n.Charts {
+			current, err := h.charts.chartsRepo.GetChartByID(ch.ID)
+			if err != nil {
+				return nil, err
+			}
+			if current != nil && current.NoteID != nil && *current.NoteID == *n.ID {
+				ok, err := h.charts.checkChartChange(userID, current, &ch)
+				if err != nil {
+					return nil, err
+				}
+				if !ok {
+					conflicts = append(conflicts, types.Conflict{Resource: "chart", ID: ch.ID, Reason: "invalid"})
+					continue
+				}
+			}
+			kept = append(kept, ch)
+		}
+		n.Charts = kept
+	}
+	return conflicts, nil
 }
 
 func countSyncPushItems(req types.SyncPushRequest) (int, map[string]int) {
@@ -222,7 +328,7 @@ func (h *SyncHandler) GetFiltersBySpace(c *gin.Context) {
 		return
 	}
 	// Reuse filters repo list with default pagination
-	items, total, err := h.filtersRepo.List(spaceID, 1, 1000)
+	items, total, err := h.filtersRepo.List(spaceID, userID, 1, 1000)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
 		return
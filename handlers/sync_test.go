@@ -109,3 +109,218 @@ func (s *E2ETestSuite) Test202_Sync_PullIncludesActivityTypesAndAttachments() {
 // helpers
 func urlQuery(s string) string { return s }
 func itoa(n int) string        { return strconv.Itoa(n) }
+
+// doJSON sends an authorized JSON request and decodes the response envelope.
+func (s *E2ETestSuite) doJSON(method, path, token string, body interface{}) (int, map[string]interface{}) {
+	buf := bytes.NewBuffer(nil)
+	if body != nil {
+		b, _ := json.Marshal(body)
+		buf = bytes.NewBuffer(b)
+	}
+	req, _ := http.NewRequest(method, s.baseURL+path, buf)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := (&http.Client{}).Do(req)
+	s.NoError(err)
+	defer resp.Body.Close()
+	var out map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&out)
+	return resp.StatusCode, out
+}
+
+func (s *E2ETestSuite) Test203_Sync_PushRejectsInvalidCharts() {
+	do := s.doJSON
+	code, out := do("POST", "/notes", s.ownerToken, map[string]interface{}{
+		"text": "chart note", "spaceId": s.createdSpaceID, "date": time.Now().Format(time.RFC3339),
+	})
+	s.Equal(http.StatusCreated, code)
+	noteID := int(out["data"].(map[string]interface{})["id"].(float64))
+	code, out = do("POST", "/spaces/"+strconv.Itoa(s.createdSpaceID)+"/activity-types", s.ownerToken, map[string]interface{}{
+		"name": "Synced steps", "valueType": "integer", "aggregation": "sum",
+	})
+	s.Equal(http.StatusCreated, code)
+	typeID := int(out["data"].(map[string]interface{})["id"].(float64))
+	code, out = do("POST", "/charts", s.ownerToken, map[string]interface{}{
+		"spaceId": s.createdSpaceID, "kindId": 1, "periodId": 1, "name": "Synced", "activityTypeId": typeID, "noteId": noteID,
+	})
+	s.Equal(http.StatusCreated, code)
+	chartID := int(out["data"].(map[string]interface{})["id"].(float64))
+
+	push := func(chart map[string]interface{}) map[string]interface{} {
+		later := time.Now().Add(time.Minute).Format(time.RFC3339)
+		chart["id"], chart["name"], chart["modified_at"] = chartID, "Synced", later
+		code, out := do("POST", "/sync", s.ownerToken, map[string]interface{}{
+			"notes": []map[string]interface{}{{
+				"id": noteID, "space_id": s.createdSpaceID, "text": "chart note", "modified_at": later,
+				"charts": []map[string]interface{}{chart},
+			}},
+		})
+		s.Equal(http.StatusOK, code)
+		return out["data"].(map[string]interface{})
+	}
+	invalid := func(data map[string]interface{}) bool {
+		conflicts, _ := data["conflicts"].([]interface{})
+		for _, c := range conflicts {
+			c := c.(map[string]interface{})
+			if c["resource"] == "chart" && c["id"] == float64(chartID) && c["reason"] == "invalid" {
+				return true
+			}
+		}
+		return false
+	}
+
+	s.True(invalid(push(map[string]interface{}{"kind_id": 1, "period_id": 1, "activity_type_id": typeID, "series": "x"})))
+	s.True(invalid(push(map[string]interface{}{"kind_id": 99, "period_id": 1, "activity_type_id": typeID})))
+	s.True(invalid(push(map[string]interface{}{"kind_id": 1, "period_id": 1, "activity_type_id": typeID + 1000})))
+	s.True(invalid(push(map[string]interface{}{
+		"kind_id": 1, "period_id": 1, "activity_type_id": typeID, "series": []map[string]interface{}{{"activityTypeId": 1}},
+	})))
+	s.True(invalid(push(map[string]interface{}{"kind_id": 6, "period_id": 1, "activity_type_id": typeID, "options": map[string]interface{}{"bins": 1000}})))
+	code, _ = do("GET", "/charts?spaceId="+strconv.Itoa(s.createdSpaceID), s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+
+	s.False(invalid(push(map[string]interface{}{
+		"kind_id": 2, "period_id": 1, "activity_type_id": typeID, "series": []map[string]interface{}{{"activityTypeId": typeID, "aggregation": "SUM"}},
+	})))
+	code, out = do("GET", "/charts?spaceId="+strconv.Itoa(s.createdSpaceID)+"&pageSize=100", s.ownerToken, nil)
+	s.Equal(http.StatusOK, code)
+	for _, it := range out["data"].(map[string]interface{})["data"].([]interface{}) {
+		m := it.(map[string]interface{})
+		if m["id"] == float64(chartID) {
+			s.Equal(float64(2), m["kindId"])
+			s.Equal("sum", m["series"].([]interface{})[0].(map[string]interface{})["aggregation"])
+		}
+	}
+}
+
+func (s *E2ETestSuite) Test204_Sync_PushChartScope() {
+	do := s.doJSON
+	idOf := func(out map[string]interface{}) int {
+		return int(out["data"].(map[string]interface{})["id"].(float64))
+	}
+	code, out := do("POST", "/notes", s.ownerToken, map[string]interface{}{
+		"text": "scoped chart note", "spaceId": s.createdSpaceID, "date": time.Now().Format(time.RFC3339),
+	})
+	s.Equal(http.StatusCreated, code)
+	noteID := idOf(out)
+	code, out = do("POST", "/filters", s.ownerToken, map[string]interface{}{
+		"spaceId": s.createdSpaceID, "name": "Sync scope", "params": map[string]interface{}{},
+	})
+	s.Equal(http.StatusCreated, code)
+	filterID := idOf(out)
+	code, out = do("POST", "/spaces", s.ownerToken, map[string]interface{}{"name": "Other sync scope"})
+	s.Equal(http.StatusCreated, code)
+	code, out = do("POST", "/filters", s.ownerToken, map[string]interface{}{
+		"spaceId": idOf(out), "name": "Elsewhere", "params": map[string]interface{}{},
+	})
+	s.Equal(http.StatusCreated, code)
+	foreignFilterID := idOf(out)
+	code, out = do("POST", "/charts", s.ownerToken, map[string]interface{}{
+		"spaceId": s.createdSpaceID, "kindId": 1, "periodId": 1, "name": "Scoped", "activityTypeId": 1,
+		"noteId": noteID, "tags": []string{"work"}, "filterId": filterID,
+	})
+	s.Equal(http.StatusCreated, code)
+	chartID := idOf(out)
+
+	push := func(fields map[string]interface{}) []interface{} {
+		later := time.Now().Add(time.Minute).Format(time.RFC3339)
+		chart := map[string]interface{}{
+			"id": chartID, "name": "Scoped", "kind_id": 1, "period_id": 1, "activity_type_id": 1, "modified_at": later,
+		}
+		for k, v := range fields {
+			chart[k] = v
+		}
+		code, out := do("POST", "/sync", s.ownerToken, map[string]interface{}{
+			"notes": []map[string]interface{}{{
+				"id": noteID, "space_id": s.createdSpaceID, "text": "scoped chart note", "modified_at": later,
+				"charts": []map[string]interface{}{chart},
+			}},
+		})
+		s.Equal(http.StatusOK, code)
+		conflicts, _ := out["data"].(map[string]interface{})["conflicts"].([]interface{})
+		return conflicts
+	}
+	stored := func() map[string]interface{} {
+		code, out := do("GET", "/charts?spaceId="+strconv.Itoa(s.createdSpaceID)+"&pageSize=100", s.ownerToken, nil)
+		s.Equal(http.StatusOK, code)
+		for _, it := range out["data"].(map[string]interface{})["data"].([]interface{}) {
+			if m := it.(map[string]interface{}); m["id"] == float64(chartID) {
+				return m
+			}
+		}
+		return nil
+	}
+
+	conflicts := push(map[string]interface{}{"filter_id": foreignFilterID})
+	s.Len(conflicts, 1)
+	s.Equal("invalid", conflicts[0].(map[string]interface{})["reason"])
+	s.Equal(float64(filterID), stored()["filterId"])
+
+	// Omitted fields keep their value, null clears them
+	s.Empty(push(map[string]interface{}{}))
+	s.Equal(float64(filterID), stored()["filterId"])
+	s.Empty(push(map[string]interface{}{"tags": nil, "filter_id": nil}))
+	chart := stored()
+	s.Nil(chart["filterId"])
+	s.Nil(chart["tags"])
+}
+
+func (s *E2ETestSuite) Test205_Sync_PushFilterChecks() {
+	do := s.doJSON
+	idOf := func(out map[string]interface{}) int {
+		return int(out["data"].(map[string]interface{})["id"].(float64))
+	}
+	code, out := do("POST", "/filters", s.ownerToken, map[string]interface{}{
+		"spaceId": s.createdSpaceID, "name": "Sync parent", "params": map[string]interface{}{"tags": []string{"work"}},
+	})
+	s.Equal(http.StatusCreated, code)
+	parentID := idOf(out)
+	code, out = do("POST", "/filters", s.ownerToken, map[string]interface{}{
+		"spaceId": s.createdSpaceID, "name": "Sync child", "parentId": parentID, "inheritParams": true, "params": map[string]interface{}{},
+	})
+	s.Equal(http.StatusCreated, code)
+	childID := idOf(out)
+	code, out = do("POST", "/spaces", s.ownerToken, map[string]interface{}{"name": "Other sync filters"})
+	s.Equal(http.StatusCreated, code)
+	code, out = do("POST", "/filters", s.ownerToken, map[string]interface{}{
+		"spaceId": idOf(out), "name": "Elsewhere", "params": map[string]interface{}{},
+	})
+	s.Equal(http.StatusCreated, code)
+	foreignID := idOf(out)
+
+	push := func(filter map[string]interface{}) []interface{} {
+		filter["modified_at"] = time.Now().Add(time.Minute).Format(time.RFC3339)
+		code, out := do("POST", "/sync", s.ownerToken, map[string]interface{}{"filters": []map[string]interface{}{filter}})
+		s.Equal(http.StatusOK, code)
+		conflicts, _ := out["data"].(map[string]interface{})["conflicts"].([]interface{})
+		return conflicts
+	}
+	stored := func() map[string]interface{} {
+		code, out := do("GET", "/spaces/"+strconv.Itoa(s.createdSpaceID)+"/filters", s.ownerToken, nil)
+		s.Equal(http.StatusOK, code)
+		for _, it := range out["data"].([]interface{}) {
+			if m := it.(map[string]interface{}); m["id"] == float64(childID) {
+				return m
+			}
+		}
+		return nil
+	}
+
+	// Leaving inherit_params out keeps the inheritance
+	s.Empty(push(map[string]interface{}{
+		"id": childID, "space_id": s.createdSpaceID, "name": "Sync child 2", "parent_id": parentID, "params": map[string]interface{}{},
+	}))
+	s.Equal(true, stored()["inheritParams"])
+
+	for _, bad := range []map[string]interface{}{
+		{"id": childID, "space_id": s.createdSpaceID, "name": "Moved", "parent_id": foreignID, "params": map[string]interface{}{}},
+		{"id": childID, "space_id": s.createdSpaceID, "name": "Bad params", "parent_id": parentID, "params": map[string]interface{}{"tags": "work"}},
+		{"clientId": "tmp-bad", "space_id": s.createdSpaceID, "name": "Bad parent", "parent_id": foreignID, "params": map[string]interface{}{}},
+	} {
+		conflicts := push(bad)
+		s.Len(conflicts, 1)
+		s.Equal("invalid", conflicts[0].(map[string]interface{})["reason"])
+	}
+	s.Equal("Sync child 2", stored()["name"])
+	s.Equal(float64(parentID), stored()["parentId"])
+}
@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"focuz-api/models"
+	"focuz-api/pkg/stats"
+	"focuz-api/types"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxForecast bounds the periods a forecast projects.
+const maxForecast = 60
+
+// ewmaAlpha is the weight of each new period in an ewma trend.
+const ewmaAlpha = 0.3
+
+// trendQuery asks for a trend fitted to the periods (trend=) and for Forecast
+// periods projected after them (forecast=, with forecastMethod=).
+type trendQuery struct {
+	Trend          string
+	Forecast       int
+	ForecastMethod string
+}
+
+func parseTrendQuery(c *gin.Context) (trendQuery, error) {
+	q := trendQuery{Trend: c.Query("trend"), ForecastMethod: c.DefaultQuery("forecastMethod", "holt")}
+	if q.Trend != "" && !types.IsTrendMethod(q.Trend) {
+		return q, errors.New("trend must be linear or ewma")
+	}
+	if s := c.Query("forecast"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxForecast {
+			return q, fmt.Errorf("forecast must be between 1 and %d", maxForecast)
+		}
+		q.Forecast = n
+	}
+	if !types.IsForecastMethod(q.ForecastMethod) {
+		return q, errors.New("forecastMethod must be ses or holt")
+	}
+	return q, nil
+}
+
+func (q trendQuery) isSet() bool {
+	return q.Trend != "" || q.Forecast > 0
+}
+
+// fitTrend fits the trend method to the values y at period offsets x, nil
+// where a period has no value. It returns the fitted value of each period
+// (every period for a line, those with a value for ewma) and the slope per
+// period at the end of the series.
+func fitTrend(method string, x []float64, y []*float64) ([]*float64, models.TrendFit) {
+	fit := models.TrendFit{Method: method}
+	var xs, ys []float64
+	for i, v := range y {
+		if v != nil {
+			xs = append(xs, x[i])
+			ys = append(ys, *v)
+		}
+	}
+	fitted := make([]*float64, len(y))
+	switch method {
+	case "linear":
+		intercept, slope, ok := stats.LinearFit(xs, ys)
+		if !ok {
+			return fitted, fit
+		}
+		for i := range y {
+			v := intercept + slope*x[i]
+			fitted[i] = &v
+		}
+		fit.Slope = &slope
+	case "ewma":
+		smoothed := stats.EWMA(ys, ewmaAlpha)
+		k := 0
+		for i, v := range y {
+			if v != nil {
+				fitted[i] = &smoothed[k]
+				k++
+			}
+		}
+		if n := len(smoothed); n > 1 {
+			slope := (smoothed[n-1] - smoothed[n-2]) / (xs[n-1] - xs[n-2])
+			fit.Slope = &slope
+		}
+	}
+	return fitted, fit
+}
+
+// forecastValues projects n periods after the last of the periods at offsets
+// x from their values y, nil where a period has no value, or returns nil when
+// there are too few values. Smoothing assumes consecutive periods, so the
+// gaps between values are interpolated first, and periods after the last
+// value are forecast like the n that follow.
+func forecastValues(method string, x []float64, y []*float64, n int) []models.ForecastValue {
+	ys, lastX := fillPeriods(x, y)
+	skip := 0
+	if len(ys) > 0 {
+		skip = int(x[len(x)-1] - lastX)
+	}
+	var points []stats.ForecastPoint
+	if method == "ses" {
+		points = stats.SimpleSmoothing(ys, skip+n)
+	} else {
+		points = stats.Holt(ys, skip+n)
+	}
+	if points == nil {
+		return nil
+	}
+	values := make([]models.ForecastValue, n)
+	for i, p := range points[skip:] {
+		values[i] = models.ForecastValue{Value: p.Value, Lower: p.Lower, Upper: p.Upper}
+	}
+	return values
+}
+
+// fillPeriods returns a value for every period from the first to the last
+// with a value among y at offsets x, interpolating linearly over the periods
+// in between that have none, and the offset of the last.
+func fillPeriods(x []float64, y []*float64) ([]float64, float64) {
+	var filled []float64
+	var prevX, prevY float64
+	for i, v := range y {
+		if v == nil {
+			continue
+		}
+		if filled != nil {
+			gap := int(x[i] - prevX)
+			for k := 1; k < gap; k++ {
+				filled = append(filled, prevY+(*v-prevY)*float64(k)/float64(gap))
+			}
+		}
+		filled = append(filled, *v)
+		prevX, prevY = x[i], *v
+	}
+	return filled, prevX
+}
+
+// periodOffset counts the periods from the bucket starting at from to the
+// one starting at t.
+func periodOffset(period string, from, t time.Time) float64 {
+	switch period {
+	case "week":
+		return math.Round(t.Sub(from).Hours() / (24 * 7))
+	case "month":
+		return float64((t.Year()-from.Year())*12 + int(t.Month()) - int(from.Month()))
+	case "year":
+		return float64(t.Year() - from.Year())
+	default:
+		return math.Round(t.Sub(from).Hours() / 24)
+	}
+}
+
+// analysisTrend adds the trend and forecast asked for by q to the periods of
+// an analysis. Periods whose value is not a number are left out of the fit.
+func analysisTrend(results []map[string]any, period string, q trendQuery) models.AnalysisTrend {
+	out := models.AnalysisTrend{Periods: results}
+	if out.Periods == nil {
+		out.Periods = []map[string]any{}
+	}
+	x := make([]float64, len(results))
+	y := make([]*float64, len(results))
+	var first, last time.Time
+	for i, item := range results {
+		label, _ := item["period"].(string)
+		start, err := models.ParsePeriodLabel(label, period)
+		if err != nil {
+			continue
+		}
+		if first.IsZero() {
+			first = start
+		}
+		last = start
+		x[i] = periodOffset(period, first, start)
+		if v, ok := item["value"].(float64); ok {
+			y[i] = &v
+		}
+	}
+	if q.Trend != "" {
+		fitted, fit := fitTrend(q.Trend, x, y)
+		for i, item := range results {
+			item["trend"] = fitted[i]
+		}
+		out.Trend = &fit
+	}
+	if q.Forecast > 0 && !last.IsZero() {
+		for i, v := range forecastValues(q.ForecastMethod, x, y, q.Forecast) {
+			out.Forecast = append(out.Forecast, models.AnalysisForecast{
+				Period:        models.PeriodLabel(models.AddPeriods(last, period, i+1), period, "monday"),
+				ForecastValue: v,
+			})
+		}
+	}
+	return out
+}
+
+// chartTrend adds the trend and forecast asked for by q to each series of
+// the points of a line or bar chart.
+func chartTrend(points []models.ChartDataPoint, series int, period string, q trendQuery) models.ChartTrend {
+	out := models.ChartTrend{Points: points}
+	if out.Points == nil {
+		out.Points = []models.ChartDataPoint{}
+	}
+	x := make([]float64, len(points))
+	for i, p := range points {
+		x[i] = periodOffset(period, points[0].Date, p.Date)
+	}
+	if q.Trend != "" {
+		for i := range points {
+			points[i].Trend = make([]*float64, series)
+		}
+	}
+	var forecasts [][]models.ForecastValue
+	for s := 0; s < series; s++ {
+		y := make([]*float64, len(points))
+		for i, p := range points {
+			if s < len(p.Values) {
+				y[i] = p.Values[s]
+			}
+		}
+		if q.Trend != "" {
+			fitted, fit := fitTrend(q.Trend, x, y)
+			for i := range points {
+				points[i].Trend[s] = fitted[i]
+			}
+			out.Trends = append(out.Trends, fit)
+		}
+		if q.Forecast > 0 {
+			forecasts = append(forecasts, forecastValues(q.ForecastMethod, x, y, q.Forecast))
+		}
+	}
+	if q.Forecast > 0 && len(points) > 0 {
+		last := points[len(points)-1].Date
+		for h := 0; h < q.Forecast; h++ {
+			f := models.ChartForecast{Date: models.AddPeriods(last, period, h+1), Values: make([]*models.ForecastValue, series)}
+			for s, values := range forecasts {
+				if values != nil {
+					f.Values[s] = &values[h]
+				}
+			}
+			out.Forecast = append(out.Forecast, f)
+		}
+	}
+	return out
+}
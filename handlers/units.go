@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"errors"
+	"focuz-api/models"
+	"focuz-api/pkg/units"
+	"focuz-api/types"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetUnits lists the units values can be entered and displayed in.
+func GetUnits(c *gin.Context) {
+	c.JSON(http.StatusOK, types.NewSuccessResponse(units.All()))
+}
+
+// typeUnit returns the registered unit of a numeric activity type (or field).
+func typeUnit(t *models.ActivityType) (units.Unit, bool) {
+	if t.Unit == nil || (t.ValueType != "integer" && t.ValueType != "float") {
+		return units.Unit{}, false
+	}
+	return units.Lookup(*t.Unit)
+}
+
+// convertEnteredValue converts a value entered in unit to the unit of type t,
+// where values are stored. Integer types are rounded.
+func convertEnteredValue(t *models.ActivityType, raw, unit string) (string, units.Unit, error) {
+	canonical, ok := typeUnit(t)
+	if !ok {
+		return "", units.Unit{}, errors.New("activity type has no convertible unit")
+	}
+	entered, ok := units.Lookup(unit)
+	if !ok {
+		return "", units.Unit{}, errors.New("unknown unit " + unit)
+	}
+	if entered.Dimension != canonical.Dimension {
+		return "", units.Unit{}, errors.New("unit " + entered.Symbol + " cannot be converted to " + canonical.Symbol)
+	}
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return "", units.Unit{}, errors.New("value must be a number")
+	}
+	v, _ = units.Convert(v, entered.Symbol, canonical.Symbol)
+	if t.ValueType == "integer" {
+		v = math.Round(v)
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64), entered, nil
+}
+
+// displayFactor returns the multiplier turning aggregated values of type t
+// into values in unit. Variance is in squared units; aggregations that are not
+// measured in the type's unit (counts, percentages) keep a factor of 1.
+func displayFactor(t *models.ActivityType, unit string) (float64, error) {
+	if unit == "" {
+		return 1, nil
+	}
+	canonical, ok := typeUnit(t)
+	if !ok {
+		return 0, errors.New("activity type has no convertible unit")
+	}
+	k, err := units.Factor(canonical.Symbol, unit)
+	if errors.Is(err, units.ErrUnknownUnit) {
+		return 0, errors.New("unknown unit " + unit)
+	}
+	if err != nil {
+		return 0, errors.New("unit " + unit + " cannot be converted from " + canonical.Symbol)
+	}
+	switch t.Aggregation {
+	case "sum", "avg", "min", "max", "median", "stddev":
+		return k, nil
+	case "variance":
+		return k * k, nil
+	}
+	if _, ok := types.ParsePercentile(t.Aggregation); ok {
+		return k, nil
+	}
+	return 1, nil
+}
+
+// displayUnit returns the unit aggregated values of type t are displayed in:
+// unit when given, the type's own otherwise, squared for a variance and none
+// for aggregations that are not measured in a unit.
+func displayUnit(t *models.ActivityType, unit string) string {
+	if unit == "" {
+		if t.Unit == nil {
+			return ""
+		}
+		unit = *t.Unit
+	}
+	switch t.Aggregation {
+	case "sum", "avg", "min", "max", "median", "stddev":
+		return unit
+	case "variance":
+		return unit + "²"
+	}
+	if _, ok := types.ParsePercentile(t.Aggregation); ok {
+		return unit
+	}
+	return ""
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"errors"
+	"focuz-api/models"
+	"focuz-api/repository"
+	"focuz-api/types"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type UsersHandler struct {
+	repo        *repository.UsersRepository
+	rollupZones *RollupZones
+}
+
+func NewUsersHandler(r *repository.UsersRepository) *UsersHandler {
+	return &UsersHandler{repo: r}
+}
+
+// WithRollupZones rolls spaces up in a user's new time zone once they set it.
+func (h *UsersHandler) WithRollupZones(rz *RollupZones) *UsersHandler {
+	h.rollupZones = rz
+	return h
+}
+
+func (h *UsersHandler) GetSettings(c *gin.Context) {
+	settings, err := h.repo.GetSettings(c.GetInt("userId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, types.NewSuccessResponse(settings))
+}
+
+func (h *UsersHandler) UpdateSettings(c *gin.Context) {
+	var req struct {
+		Timezone  *string `json:"timezone"`
+		WeekStart *string `json:"weekStart"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
+		return
+	}
+	userID := c.GetInt("userId")
+	settings, err := h.repo.GetSettings(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
+	if req.Timezone != nil {
+		settings.Timezone = *req.Timezone
+	}
+	if req.WeekStart != nil {
+		settings.WeekStart = strings.ToLower(*req.WeekStart)
+	}
+	if err := validateTimeSettings(&settings); err != nil {
+		c.JSON(http.StatusBadRequest, types.NewErrorResponse(types.ErrorCodeValidation, err.Error()))
+		return
+	}
+	if err := h.repo.UpdateSettings(userID, settings); err != nil {
+		c.JSON(http.StatusInternalServerError, types.NewErrorResponse(types.ErrorCodeInternal, err.Error()))
+		return
+	}
+	h.rollupZones.Kick()
+	c.JSON(http.StatusOK, types.NewSuccessResponse(settings))
+}
+
+// validateTimeSettings checks the time zone is a known IANA zone and the week
+// start is monday or sunday. The zone is stored by its canonical name.
+func validateTimeSettings(s *models.UserSettings) error {
+	if s.Timezone == "" || strings.EqualFold(s.Timezone, "local") {
+		return errors.New("timezone must be an IANA time zone such as Europe/Moscow")
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return errors.New("unknown timezone " + s.Timezone)
+	}
+	s.Timezone = loc.String()
+	if s.WeekStart != "monday" && s.WeekStart != "sunday" {
+		return errors.New("weekStart must be monday or sunday")
+	}
+	return nil
+}
+
+// timeSettings returns the zone and week start analyses are bucketed by: the
+// user's settings, overridden by the tz and weekStart query parameters.
+// Without a users repository the defaults (UTC, Monday) apply.
+func timeSettings(c *gin.Context, repo *repository.UsersRepository) (models.UserSettings, *time.Location, error) {
+	settings := models.DefaultUserSettings
+	if repo != nil {
+		var err error
+		if settings, err = repo.GetSettings(c.GetInt("userId")); err != nil {
+			return settings, nil, err
+		}
+	}
+	if tz := c.Query("tz"); tz != "" {
+		settings.Timezone = tz
+	}
+	if ws := c.Query("weekStart"); ws != "" {
+		settings.WeekStart = strings.ToLower(ws)
+	}
+	if err := validateTimeSettings(&settings); err != nil {
+		return settings, nil, err
+	}
+	loc, err := settings.Location()
+	return settings, loc, err
+}
+
+// parseRangeDate parses a range bound as RFC3339 or as a date (2006-01-02) in
+// loc, and returns it as wall time in loc. A date used as end bound covers the
+// whole day.
+func parseRangeDate(s string, loc *time.Location, end bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return models.WallTime(t, loc), nil
+	}
+	d, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if end {
+		d = d.AddDate(0, 0, 1).Add(-time.Microsecond)
+	}
+	return d, nil
+}
@@ -57,7 +57,7 @@ func ensureRole(db *sql.DB, name string) (int, error) {
 
 func ensureCategory(db *sql.DB, name string) (int, error) {
 	var id int
-	err := db.QueryRow("SELECT id FROM activity_type_category WHERE name = $1", name).Scan(&id)
+	err := db.QueryRow("SELECT id FROM activity_type_category WHERE name = $1 AND space_id IS NULL", name).Scan(&id)
 	if err == sql.ErrNoRows {
 		err = db.QueryRow("INSERT INTO activity_type_category (name) VALUES ($1) RETURNING id", name).Scan(&id)
 		if err != nil {
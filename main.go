@@ -14,6 +14,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	// Embedded zone database for time zone settings on images without tzdata
+	_ "time/tzdata"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-migrate/migrate/v4"
@@ -63,6 +65,13 @@ func main() {
 		log.Fatal("Migration failed:", err)
 	}
 
+	// focuz-api rebuild-rollups [spaceID] recomputes the daily activity
+	// rollups and reports any day that still differs from the activities
+	if len(os.Args) > 1 && os.Args[1] == "rebuild-rollups" {
+		rebuildRollups(db, os.Args[2:])
+		return
+	}
+
 	if err := initializers.InitDefaults(db); err != nil {
 		log.Fatal("Failed to initialize default data:", err)
 	}
@@ -75,11 +84,16 @@ func main() {
 	notesRepo := repository.NewNotesRepository(db)
 	rolesRepo := repository.NewRolesRepository(db)
 	activityTypesRepo := repository.NewActivityTypesRepository(db)
+	categoriesRepo := repository.NewCategoriesRepository(db)
 	activitiesRepo := repository.NewActivitiesRepository(db)
 	attachmentsRepo := repository.NewAttachmentsRepository(db)
 	chartsRepo := repository.NewChartsRepository(db)
+	chartAnnotationsRepo := repository.NewChartAnnotationsRepository(db)
 	notificationsRepo := repository.NewNotificationsRepository(db)
 	filtersRepo := repository.NewFiltersRepository(db)
+	dashboardsRepo := repository.NewDashboardsRepository(db)
+	goalsRepo := repository.NewGoalsRepository(db)
+	usersRepo := repository.NewUsersRepository(db)
 
 	// New repos for sync and tags
 	syncRepo := repository.NewSyncRepository(db)
@@ -120,21 +134,34 @@ func main() {
 	r.GET("/ws", websocket.ServeWS(hub))
 
 	// Handlers
-	notesHandler := handlers.NewNotesHandler(notesRepo, spacesRepo)
+	filterCounter := handlers.NewFilterCounter(filtersRepo, notesRepo, spacesRepo, notifier)
+	hub.OnDisconnect(filterCounter.Forget)
+	goalEvaluator := handlers.NewGoalEvaluator(goalsRepo, activityTypesRepo, spacesRepo, notificationsRepo, notifier).WithUserSettings(usersRepo)
+	goalEvaluator.StartAtRiskChecks(15 * time.Minute)
+	rollupZones := handlers.NewRollupZones(repository.NewRollupsRepository(db))
+	rollupZones.Start(10 * time.Minute)
+	notesHandler := handlers.NewNotesHandler(notesRepo, spacesRepo).WithFilterCounter(filterCounter)
 	spacesHandler := handlers.NewSpacesHandler(spacesRepo, rolesRepo).WithNotifier(notifier).WithNotificationsRepo(notificationsRepo)
-	activityTypesHandler := handlers.NewActivityTypesHandler(activityTypesRepo, spacesRepo)
+	activityTypesHandler := handlers.NewActivityTypesHandler(activityTypesRepo, spacesRepo).WithCategories(categoriesRepo)
+	categoriesHandler := handlers.NewCategoriesHandler(categoriesRepo, spacesRepo)
 	activitiesHandler := handlers.NewActivitiesHandler(
 		activitiesRepo,
 		spacesRepo,
 		notesRepo,
 		activityTypesRepo,
-	)
-	attachmentsHandler := handlers.NewAttachmentsHandler(attachmentsRepo, notesRepo, spacesRepo)
-	chartsHandler := handlers.NewChartsHandler(chartsRepo, spacesRepo, activityTypesRepo, notesRepo)
+	).WithFilterCounter(filterCounter).WithGoalEvaluator(goalEvaluator).WithUserSettings(usersRepo)
+	attachmentsHandler := handlers.NewAttachmentsHandler(attachmentsRepo, notesRepo, spacesRepo).WithFilterCounter(filterCounter)
+	chartsHandler := handlers.NewChartsHandler(chartsRepo, spacesRepo, activityTypesRepo, notesRepo).WithUserSettings(usersRepo).WithFilters(filtersRepo).WithAnnotations(chartAnnotationsRepo)
+	usersHandler := handlers.NewUsersHandler(usersRepo).WithRollupZones(rollupZones)
 	notificationsHandler := handlers.NewNotificationsHandler(notificationsRepo)
-	filtersHandler := handlers.NewFiltersHandler(filtersRepo, spacesRepo)
+	dashboardsHandler := handlers.NewDashboardsHandler(dashboardsRepo, chartsHandler, spacesRepo)
+	filtersHandler := handlers.NewFiltersHandler(filtersRepo, spacesRepo, notesRepo).WithFilterCounter(filterCounter)
+	goalsHandler := handlers.NewGoalsHandler(goalsRepo, activityTypesRepo, spacesRepo, goalEvaluator)
 	syncHandler := handlers.NewSyncHandler(syncRepo, spacesRepo, tagsRepo, filtersRepo).
 		WithNotifier(notifier).
+		WithFilterCounter(filterCounter).
+		WithGoalEvaluator(goalEvaluator).
+		WithCharts(chartsHandler).
 		WithLimits(
 			parseInt64Env("SYNC_MAX_BODY_BYTES", 25*1024*1024),
 			parseIntEnv("SYNC_MAX_BATCH_ITEMS", 10000),
@@ -155,6 +182,9 @@ func main() {
 
 	auth := r.Group("/", handlers.AuthMiddleware(jwtSecret))
 	{
+		auth.GET("/me/settings", usersHandler.GetSettings)
+		auth.PATCH("/me/settings", usersHandler.UpdateSettings)
+
 		auth.GET("/spaces", spacesHandler.GetAccessibleSpaces)
 		auth.DELETE("/spaces/:spaceId/users/:userId", spacesHandler.RemoveUser)
 		auth.GET("/spaces/:spaceId/users", spacesHandler.GetUsersInSpace)
@@ -182,19 +212,36 @@ func main() {
 		auth.GET("/charts", chartsHandler.GetCharts)
 		auth.GET("/chart-types", chartsHandler.GetChartTypes)
 		auth.GET("/period-types", chartsHandler.GetPeriodTypes)
+		auth.GET("/units", handlers.GetUnits)
 		auth.GET("/charts/:id/data", chartsHandler.GetChartData)
+		auth.GET("/charts/:id/render", chartsHandler.RenderChart)
+		auth.GET("/charts/:id/annotations", chartsHandler.GetChartAnnotations)
+		auth.POST("/charts/:id/annotations", chartsHandler.CreateChartAnnotation)
+		auth.PATCH("/chart-annotations/:id", chartsHandler.UpdateChartAnnotation)
+		auth.PATCH("/chart-annotations/:id/delete", chartsHandler.DeleteChartAnnotation)
+		auth.PATCH("/chart-annotations/:id/restore", chartsHandler.RestoreChartAnnotation)
 
 		auth.GET("/spaces/:spaceId/activity-types", activityTypesHandler.GetActivityTypesBySpace)
 		auth.POST("/spaces/:spaceId/activity-types", activityTypesHandler.CreateActivityType)
+		auth.PATCH("/spaces/:spaceId/activity-types/:typeId", activityTypesHandler.UpdateActivityType)
 		auth.PATCH("/spaces/:spaceId/activity-types/:typeId/delete", activityTypesHandler.DeleteActivityType)
 		auth.PATCH("/spaces/:spaceId/activity-types/:typeId/restore", activityTypesHandler.RestoreActivityType)
 
+		auth.GET("/spaces/:spaceId/activity-type-categories", categoriesHandler.GetCategories)
+		auth.POST("/spaces/:spaceId/activity-type-categories", categoriesHandler.CreateCategory)
+		auth.PATCH("/spaces/:spaceId/activity-type-categories/:categoryId", categoriesHandler.UpdateCategory)
+		auth.PATCH("/spaces/:spaceId/activity-type-categories/:categoryId/delete", categoriesHandler.DeleteCategory)
+		auth.PATCH("/spaces/:spaceId/activity-type-categories/:categoryId/restore", categoriesHandler.RestoreCategory)
+
 		auth.POST("/activities", activitiesHandler.CreateActivity)
 		auth.PATCH("/activities/:activityId/delete", activitiesHandler.DeleteActivity)
 		auth.PATCH("/activities/:activityId/restore", activitiesHandler.RestoreActivity)
 		auth.PATCH("/activities/:activityId", activitiesHandler.UpdateActivity)
+		auth.POST("/spaces/:spaceId/quick-log", activitiesHandler.QuickLog)
+		auth.POST("/spaces/:spaceId/quick-log/batch", activitiesHandler.QuickLogBatch)
 
 		auth.GET("/activities", activitiesHandler.GetActivitiesAnalysis)
+		auth.GET("/activities/correlation", activitiesHandler.GetCorrelation)
 
 		auth.POST("/upload", attachmentsHandler.UploadFile)
 		auth.GET("/files/:id", attachmentsHandler.GetFile)
@@ -207,12 +254,33 @@ func main() {
 		auth.PATCH("/filters/:id", filtersHandler.Update)
 		auth.PATCH("/filters/:id/delete", filtersHandler.Delete)
 		auth.PATCH("/filters/:id/restore", filtersHandler.Restore)
+		auth.GET("/filters/:id/notes", filtersHandler.Notes)
+		auth.GET("/filters/:id/effective", filtersHandler.Effective)
+		auth.PATCH("/filters/:id/viewed", filtersHandler.MarkViewed)
+
+		// goals
+		auth.GET("/spaces/:spaceId/goals", goalsHandler.List)
+		auth.POST("/spaces/:spaceId/goals", goalsHandler.Create)
+		auth.PATCH("/goals/:id", goalsHandler.Update)
+		auth.PATCH("/goals/:id/delete", goalsHandler.Delete)
+		auth.PATCH("/goals/:id/restore", goalsHandler.Restore)
+		auth.GET("/goals/:id/progress", goalsHandler.Progress)
+
+		// dashboards
+		auth.GET("/spaces/:spaceId/dashboards", dashboardsHandler.List)
+		auth.POST("/spaces/:spaceId/dashboards", dashboardsHandler.Create)
+		auth.GET("/dashboards/:id", dashboardsHandler.Get)
+		auth.PATCH("/dashboards/:id", dashboardsHandler.Update)
+		auth.PATCH("/dashboards/:id/delete", dashboardsHandler.Delete)
+		auth.PATCH("/dashboards/:id/restore", dashboardsHandler.Restore)
+		auth.GET("/dashboards/:id/data", dashboardsHandler.Data)
 
 		// New sync and utility endpoints
 		auth.GET("/sync", syncHandler.Pull)
 		auth.POST("/sync", syncHandler.Push)
 		auth.GET("/spaces/:spaceId/tags", syncHandler.GetTagsBySpace)
 		auth.GET("/spaces/:spaceId/filters", syncHandler.GetFiltersBySpace)
+		auth.GET("/spaces/:spaceId/filters/counts", filtersHandler.Counts)
 	}
 
 	r.Run(":8080")
@@ -241,3 +309,40 @@ func parseInt64Env(name string, def int64) int64 {
 	}
 	return v
 }
+
+func rebuildRollups(db *sql.DB, args []string) {
+	spaceID := 0
+	if len(args) > 0 {
+		id, err := strconv.Atoi(args[0])
+		if err != nil || id <= 0 {
+			log.Fatalf("Invalid space ID %q", args[0])
+		}
+		spaceID = id
+	}
+	rollupsRepo := repository.NewRollupsRepository(db)
+	if _, _, err := rollupsRepo.SyncZones(); err != nil {
+		log.Fatal("Failed to sync rollup zones:", err)
+	}
+	zones, err := rollupsRepo.Zones(spaceID)
+	if err != nil {
+		log.Fatal("Failed to list rollup zones:", err)
+	}
+	failed := false
+	for _, z := range zones {
+		if err := rollupsRepo.Rebuild(z); err != nil {
+			log.Fatalf("Failed to rebuild rollups of space %d in %s: %v", z.SpaceID, z.Timezone, err)
+		}
+		mismatches, err := rollupsRepo.Check(z)
+		if err != nil {
+			log.Fatalf("Failed to check rollups of space %d in %s: %v", z.SpaceID, z.Timezone, err)
+		}
+		for _, m := range mismatches {
+			log.Printf("Rollup mismatch: space %d, %s, type %d, %s (missing: %t)", z.SpaceID, m.Timezone, m.TypeID, m.Day, m.Missing)
+		}
+		failed = failed || len(mismatches) > 0
+		log.Printf("Rebuilt rollups of space %d in %s", z.SpaceID, z.Timezone)
+	}
+	if failed {
+		log.Fatal("Rollups differ from activities")
+	}
+}
@@ -0,0 +1 @@
+ALTER TABLE filters ADD COLUMN IF NOT EXISTS inherit_params BOOLEAN NOT NULL DEFAULT FALSE;
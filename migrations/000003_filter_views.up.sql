@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS filter_views (
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    filter_id INTEGER NOT NULL REFERENCES filters(id),
+    last_viewed_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, filter_id)
+);
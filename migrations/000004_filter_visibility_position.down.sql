@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_filters_space_position;
+
+ALTER TABLE filters DROP COLUMN IF EXISTS position;
+ALTER TABLE filters DROP CONSTRAINT IF EXISTS filters_visibility_check;
+ALTER TABLE filters DROP COLUMN IF EXISTS visibility;
@@ -0,0 +1,15 @@
+ALTER TABLE filters ADD COLUMN IF NOT EXISTS visibility VARCHAR(16) NOT NULL DEFAULT 'space';
+ALTER TABLE filters DROP CONSTRAINT IF EXISTS filters_visibility_check;
+ALTER TABLE filters ADD CONSTRAINT filters_visibility_check CHECK (visibility IN ('private', 'space'));
+
+-- Fractional order key (see pkg/fracindex); compared bytewise
+ALTER TABLE filters ADD COLUMN IF NOT EXISTS position VARCHAR(128) COLLATE "C";
+
+-- Existing filters keep their id order; keys must not end with '0'
+UPDATE filters f SET position = 'a' || lpad(o.rn::text, 6, '0') || 'V'
+FROM (SELECT id, ROW_NUMBER() OVER (PARTITION BY space_id ORDER BY id) AS rn FROM filters) o
+WHERE f.id = o.id;
+
+ALTER TABLE filters ALTER COLUMN position SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_filters_space_position ON filters(space_id, position);
@@ -0,0 +1 @@
+ALTER TABLE activity_types DROP COLUMN IF EXISTS options;
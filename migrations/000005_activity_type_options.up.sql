@@ -0,0 +1,2 @@
+-- Allowed values for enum types and value labels for rating types
+ALTER TABLE activity_types ADD COLUMN IF NOT EXISTS options JSONB;
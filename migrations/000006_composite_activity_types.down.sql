@@ -0,0 +1,2 @@
+ALTER TABLE chart DROP COLUMN IF EXISTS field_path;
+ALTER TABLE activity_types DROP COLUMN IF EXISTS fields;
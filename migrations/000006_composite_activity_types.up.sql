@@ -0,0 +1,5 @@
+-- Field schema of composite activity types
+ALTER TABLE activity_types ADD COLUMN IF NOT EXISTS fields JSONB;
+
+-- Dotted path of the composite field a chart aggregates
+ALTER TABLE chart ADD COLUMN IF NOT EXISTS field_path VARCHAR(255);
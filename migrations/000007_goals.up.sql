@@ -0,0 +1,28 @@
+-- Targets for the aggregated value of an activity type per period.
+-- user_id NULL makes a space-wide goal; otherwise the goal is personal.
+CREATE TABLE IF NOT EXISTS goals (
+    id SERIAL PRIMARY KEY,
+    space_id INTEGER NOT NULL REFERENCES space(id),
+    user_id INTEGER REFERENCES users(id),
+    created_by INTEGER NOT NULL REFERENCES users(id),
+    activity_type_id INTEGER NOT NULL REFERENCES activity_types(id),
+    field_path VARCHAR(255),
+    period INTEGER NOT NULL,
+    operator VARCHAR(2) NOT NULL CHECK (operator IN ('>=', '>', '<=', '<', '=')),
+    target DOUBLE PRECISION NOT NULL,
+    is_deleted BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    modified_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_goals_space_id ON goals(space_id);
+
+-- One notification per goal, user, event type and period
+CREATE TABLE IF NOT EXISTS goal_notifications (
+    goal_id INTEGER NOT NULL REFERENCES goals(id),
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    kind VARCHAR(32) NOT NULL,
+    period_start TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (goal_id, user_id, kind, period_start)
+);
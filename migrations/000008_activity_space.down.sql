@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_activities_space_type;
+ALTER TABLE activities DROP COLUMN IF EXISTS occurred_at;
+ALTER TABLE activities DROP COLUMN IF EXISTS space_id;
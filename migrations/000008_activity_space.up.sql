@@ -0,0 +1,14 @@
+-- Activities carry their own space so note-less activities belong somewhere,
+-- and an optional time they occurred at (defaults to the note date, then created_at)
+ALTER TABLE activities ADD COLUMN IF NOT EXISTS space_id INTEGER REFERENCES space(id);
+ALTER TABLE activities ADD COLUMN IF NOT EXISTS occurred_at TIMESTAMP;
+
+UPDATE activities a SET space_id = n.space_id
+FROM note n
+WHERE a.note_id = n.id AND a.space_id IS NULL;
+
+UPDATE activities a SET space_id = t.space_id
+FROM activity_types t
+WHERE a.type_id = t.id AND a.note_id IS NULL AND a.space_id IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_activities_space_type ON activities(space_id, type_id);
@@ -0,0 +1,25 @@
+DROP INDEX IF EXISTS idx_activity_type_category_space_name;
+
+-- Names become globally unique again: keep one category per name, global
+-- ones first, and move the activity types of the others onto it
+WITH ranked AS (
+    SELECT id, FIRST_VALUE(id) OVER (PARTITION BY name ORDER BY space_id IS NOT NULL, is_deleted, id) AS keep_id
+    FROM activity_type_category
+)
+UPDATE activity_types t SET category_id = r.keep_id
+FROM ranked r
+WHERE t.category_id = r.id AND r.id <> r.keep_id;
+
+DELETE FROM activity_type_category c
+USING activity_type_category k
+WHERE k.name = c.name
+  AND (k.space_id IS NOT NULL, k.is_deleted, k.id) < (c.space_id IS NOT NULL, c.is_deleted, c.id);
+
+ALTER TABLE activity_type_category ADD CONSTRAINT activity_type_category_name_key UNIQUE (name);
+
+ALTER TABLE activity_type_category DROP COLUMN IF EXISTS modified_at;
+ALTER TABLE activity_type_category DROP COLUMN IF EXISTS created_at;
+ALTER TABLE activity_type_category DROP COLUMN IF EXISTS is_deleted;
+ALTER TABLE activity_type_category DROP COLUMN IF EXISTS sort_order;
+ALTER TABLE activity_type_category DROP COLUMN IF EXISTS icon;
+ALTER TABLE activity_type_category DROP COLUMN IF EXISTS space_id;
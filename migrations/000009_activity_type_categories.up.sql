@@ -0,0 +1,13 @@
+-- Categories are global (space_id NULL, seeded) or custom to one space
+ALTER TABLE activity_type_category ADD COLUMN IF NOT EXISTS space_id INTEGER REFERENCES space(id);
+ALTER TABLE activity_type_category ADD COLUMN IF NOT EXISTS icon VARCHAR(64);
+ALTER TABLE activity_type_category ADD COLUMN IF NOT EXISTS sort_order INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE activity_type_category ADD COLUMN IF NOT EXISTS is_deleted BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE activity_type_category ADD COLUMN IF NOT EXISTS created_at TIMESTAMP NOT NULL DEFAULT NOW();
+ALTER TABLE activity_type_category ADD COLUMN IF NOT EXISTS modified_at TIMESTAMP NOT NULL DEFAULT NOW();
+
+-- Names are unique per space (global categories share space 0) among live categories
+ALTER TABLE activity_type_category DROP CONSTRAINT IF EXISTS activity_type_category_name_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_activity_type_category_space_name
+    ON activity_type_category (COALESCE(space_id, 0), lower(name))
+    WHERE is_deleted = FALSE;
@@ -0,0 +1,2 @@
+ALTER TABLE chart DROP COLUMN IF EXISTS transform;
+ALTER TABLE chart DROP COLUMN IF EXISTS aggregation;
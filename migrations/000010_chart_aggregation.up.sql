@@ -0,0 +1,3 @@
+-- Per-chart aggregation override and derived series; NULL uses the activity type's aggregation
+ALTER TABLE chart ADD COLUMN IF NOT EXISTS aggregation VARCHAR(32);
+ALTER TABLE chart ADD COLUMN IF NOT EXISTS transform VARCHAR(16);
@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN IF EXISTS week_start;
+ALTER TABLE users DROP COLUMN IF EXISTS timezone;
@@ -0,0 +1,4 @@
+-- Time zone (IANA name) and first day of the week used to cut analysis periods
+ALTER TABLE users ADD COLUMN IF NOT EXISTS timezone VARCHAR(64) NOT NULL DEFAULT 'UTC';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS week_start VARCHAR(8) NOT NULL DEFAULT 'monday'
+    CHECK (week_start IN ('monday', 'sunday'));
@@ -0,0 +1,4 @@
+ALTER TABLE chart DROP COLUMN IF EXISTS fill;
+ALTER TABLE chart DROP COLUMN IF EXISTS range_to;
+ALTER TABLE chart DROP COLUMN IF EXISTS range_from;
+ALTER TABLE chart DROP COLUMN IF EXISTS range_days;
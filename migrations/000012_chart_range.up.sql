@@ -0,0 +1,6 @@
+-- Lookback range of a chart, separate from its bucket period: the last N days
+-- or explicit local dates. fill controls empty buckets (none, zero or null).
+ALTER TABLE chart ADD COLUMN IF NOT EXISTS range_days INTEGER;
+ALTER TABLE chart ADD COLUMN IF NOT EXISTS range_from DATE;
+ALTER TABLE chart ADD COLUMN IF NOT EXISTS range_to DATE;
+ALTER TABLE chart ADD COLUMN IF NOT EXISTS fill VARCHAR(8);
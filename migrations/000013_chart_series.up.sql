@@ -0,0 +1,3 @@
+-- Ordered series of a chart. The chart's activity_type_id, field_path and
+-- aggregation describe the first series; NULL means that is the only series.
+ALTER TABLE chart ADD COLUMN IF NOT EXISTS series JSONB;
@@ -0,0 +1 @@
+ALTER TABLE chart DROP COLUMN IF EXISTS options;
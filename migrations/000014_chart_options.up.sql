@@ -0,0 +1,2 @@
+-- Kind-specific chart settings such as histogram bins and the grouping of pie charts
+ALTER TABLE chart ADD COLUMN IF NOT EXISTS options JSONB;
@@ -0,0 +1,2 @@
+ALTER TABLE chart DROP COLUMN IF EXISTS filter_id;
+ALTER TABLE chart DROP COLUMN IF EXISTS tags;
@@ -0,0 +1,4 @@
+-- Scope a chart to the activities whose note has (or lacks, with "!") the given tags
+ALTER TABLE chart ADD COLUMN IF NOT EXISTS tags TEXT[];
+-- or to the notes matching a saved filter
+ALTER TABLE chart ADD COLUMN IF NOT EXISTS filter_id INTEGER REFERENCES filters(id) ON DELETE SET NULL;
@@ -0,0 +1,29 @@
+-- Dashboards group charts of a space in a grid. Their range and tags apply
+-- to every widget.
+CREATE TABLE IF NOT EXISTS dashboards (
+    id SERIAL PRIMARY KEY,
+    space_id INTEGER NOT NULL REFERENCES space(id),
+    created_by INTEGER NOT NULL REFERENCES users(id),
+    name VARCHAR(255) NOT NULL,
+    range_days INTEGER,
+    range_from DATE,
+    range_to DATE,
+    tags TEXT[],
+    is_deleted BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    modified_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_dashboards_space_id ON dashboards(space_id);
+
+-- Widgets in dashboard order; x, y, w and h place a chart on the grid
+CREATE TABLE IF NOT EXISTS dashboard_widgets (
+    dashboard_id INTEGER NOT NULL REFERENCES dashboards(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    chart_id INTEGER NOT NULL REFERENCES chart(id),
+    x INTEGER NOT NULL,
+    y INTEGER NOT NULL,
+    w INTEGER NOT NULL,
+    h INTEGER NOT NULL,
+    PRIMARY KEY (dashboard_id, position)
+);
@@ -0,0 +1,9 @@
+DROP TRIGGER IF EXISTS note_rollups ON note;
+DROP TRIGGER IF EXISTS activities_rollups ON activities;
+DROP FUNCTION IF EXISTS note_rollups_trigger();
+DROP FUNCTION IF EXISTS activities_rollups_trigger();
+DROP FUNCTION IF EXISTS refresh_activity_rollups(INTEGER, INTEGER, TIMESTAMP);
+DROP FUNCTION IF EXISTS build_activity_rollups(INTEGER, TEXT, INTEGER, DATE);
+DROP FUNCTION IF EXISTS activity_rollup_value(JSONB);
+DROP TABLE IF EXISTS activity_daily_rollups;
+DROP TABLE IF EXISTS activity_rollup_zones;
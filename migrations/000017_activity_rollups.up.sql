@@ -0,0 +1,119 @@
+-- Daily aggregates of numeric activities per space, type and local day, so
+-- that analyses need not scan and cast every activity. A space is rolled up
+-- for each time zone it is analysed in, registered in activity_rollup_zones.
+-- As in analyses, an activity counts on the local day of its occurred_at,
+-- else its note's date, else its creation time; deleted activities and the
+-- activities of deleted notes are left out.
+CREATE TABLE IF NOT EXISTS activity_rollup_zones (
+    space_id INTEGER NOT NULL REFERENCES space(id),
+    timezone TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (space_id, timezone)
+);
+
+CREATE TABLE IF NOT EXISTS activity_daily_rollups (
+    space_id INTEGER NOT NULL,
+    timezone TEXT NOT NULL,
+    type_id INTEGER NOT NULL REFERENCES activity_types(id),
+    day DATE NOT NULL,
+    -- count includes activities whose value is not a number; the value
+    -- aggregates cover value_count values
+    count INTEGER NOT NULL,
+    value_count INTEGER NOT NULL,
+    sum DOUBLE PRECISION,
+    sum_squares DOUBLE PRECISION,
+    min DOUBLE PRECISION,
+    max DOUBLE PRECISION,
+    PRIMARY KEY (space_id, timezone, type_id, day),
+    FOREIGN KEY (space_id, timezone) REFERENCES activity_rollup_zones(space_id, timezone) ON DELETE CASCADE
+);
+
+-- activity_rollup_value is the number stored in an activity value, NULL when
+-- it is not one.
+CREATE OR REPLACE FUNCTION activity_rollup_value(v JSONB) RETURNS DOUBLE PRECISION AS $$
+    SELECT CASE WHEN v->>'data' ~ '^\s*[-+]?([0-9]+\.?[0-9]*|\.[0-9]+)([eE][-+]?[0-9]+)?\s*$'
+        THEN (v->>'data')::float END
+$$ LANGUAGE sql IMMUTABLE;
+
+-- build_activity_rollups inserts the rollups of a space in a zone, only for
+-- one type and day when they are given.
+CREATE OR REPLACE FUNCTION build_activity_rollups(p_space INTEGER, p_timezone TEXT, p_type INTEGER, p_day DATE) RETURNS void AS $$
+    INSERT INTO activity_daily_rollups (space_id, timezone, type_id, day, count, value_count, sum, sum_squares, min, max)
+    SELECT p_space, p_timezone, a.type_id, l.day, COUNT(*), COUNT(l.v), SUM(l.v), SUM(l.v * l.v), MIN(l.v), MAX(l.v)
+    FROM activities a
+    JOIN activity_types aty ON aty.id = a.type_id AND aty.value_type IN ('integer', 'float')
+    LEFT JOIN note n ON n.id = a.note_id
+    CROSS JOIN LATERAL (
+        SELECT (COALESCE(a.occurred_at, n.date, a.created_at) AT TIME ZONE 'UTC' AT TIME ZONE p_timezone)::date AS day,
+               activity_rollup_value(a.value) AS v
+    ) l
+    WHERE a.space_id = p_space
+      AND a.is_deleted = FALSE
+      AND (n.id IS NULL OR n.is_deleted = FALSE)
+      AND (p_type IS NULL OR a.type_id = p_type)
+      AND (p_day IS NULL OR l.day = p_day)
+    GROUP BY a.type_id, l.day
+$$ LANGUAGE sql;
+
+-- refresh_activity_rollups recomputes, in every zone of the space, the day
+-- of the type the UTC time p_at falls on. Writers of a space take its lock
+-- until they commit, so they see each other's activities and those of a zone
+-- being built.
+CREATE OR REPLACE FUNCTION refresh_activity_rollups(p_space INTEGER, p_type INTEGER, p_at TIMESTAMP) RETURNS void AS $$
+DECLARE
+    z TEXT;
+    d DATE;
+BEGIN
+    IF p_space IS NULL OR p_at IS NULL THEN
+        RETURN;
+    END IF;
+    PERFORM pg_advisory_xact_lock(hashtext('activity_rollups'), p_space);
+    FOR z IN SELECT timezone FROM activity_rollup_zones WHERE space_id = p_space LOOP
+        d := (p_at AT TIME ZONE 'UTC' AT TIME ZONE z)::date;
+        DELETE FROM activity_daily_rollups
+        WHERE space_id = p_space AND timezone = z AND type_id = p_type AND day = d;
+        PERFORM build_activity_rollups(p_space, z, p_type, d);
+    END LOOP;
+END
+$$ LANGUAGE plpgsql;
+
+-- Every change of an activity refreshes the day it left and the day it is on,
+-- whichever code path (API or sync) made it.
+CREATE OR REPLACE FUNCTION activities_rollups_trigger() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP <> 'INSERT' THEN
+        PERFORM refresh_activity_rollups(OLD.space_id, OLD.type_id,
+            COALESCE(OLD.occurred_at, (SELECT date FROM note WHERE id = OLD.note_id), OLD.created_at));
+    END IF;
+    IF TG_OP <> 'DELETE' THEN
+        PERFORM refresh_activity_rollups(NEW.space_id, NEW.type_id,
+            COALESCE(NEW.occurred_at, (SELECT date FROM note WHERE id = NEW.note_id), NEW.created_at));
+    END IF;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS activities_rollups ON activities;
+CREATE TRIGGER activities_rollups
+    AFTER INSERT OR DELETE OR UPDATE OF type_id, value, note_id, space_id, occurred_at, is_deleted ON activities
+    FOR EACH ROW EXECUTE PROCEDURE activities_rollups_trigger();
+
+-- Moving or deleting a note moves or drops its activities.
+CREATE OR REPLACE FUNCTION note_rollups_trigger() RETURNS trigger AS $$
+DECLARE
+    a RECORD;
+BEGIN
+    FOR a IN SELECT space_id, type_id, occurred_at, created_at FROM activities WHERE note_id = NEW.id LOOP
+        PERFORM refresh_activity_rollups(a.space_id, a.type_id, COALESCE(a.occurred_at, OLD.date, a.created_at));
+        PERFORM refresh_activity_rollups(a.space_id, a.type_id, COALESCE(a.occurred_at, NEW.date, a.created_at));
+    END LOOP;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS note_rollups ON note;
+CREATE TRIGGER note_rollups
+    AFTER UPDATE OF date, is_deleted ON note
+    FOR EACH ROW
+    WHEN (OLD.date IS DISTINCT FROM NEW.date OR OLD.is_deleted IS DISTINCT FROM NEW.is_deleted)
+    EXECUTE PROCEDURE note_rollups_trigger();
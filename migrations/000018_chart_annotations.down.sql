@@ -0,0 +1,2 @@
+ALTER TABLE chart DROP COLUMN IF EXISTS annotation_tag;
+DROP TABLE IF EXISTS chart_annotations;
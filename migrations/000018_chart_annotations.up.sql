@@ -0,0 +1,19 @@
+-- Markers on a chart's timeline: a local date or date range with a label,
+-- optionally pointing at a note
+CREATE TABLE IF NOT EXISTS chart_annotations (
+    id SERIAL PRIMARY KEY,
+    chart_id INTEGER NOT NULL REFERENCES chart(id),
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    date DATE NOT NULL,
+    end_date DATE CHECK (end_date >= date),
+    label VARCHAR(255) NOT NULL,
+    note_id INTEGER REFERENCES note(id),
+    is_deleted BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    modified_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_chart_annotations_chart_id ON chart_annotations(chart_id);
+
+-- Notes of the chart's space with this tag are annotations too
+ALTER TABLE chart ADD COLUMN IF NOT EXISTS annotation_tag TEXT;
@@ -0,0 +1,2 @@
+-- The backfilled spaces are kept: they cannot be told apart from spaces set
+-- on creation, and activities with a space are valid before 000019 too.
@@ -0,0 +1,28 @@
+-- 000008 left note-less activities of default types (activity_types.space_id
+-- NULL) without a space. They go to their user's only space, else to the only
+-- space the user owns.
+UPDATE activities a SET space_id = s.space_id
+FROM (
+    SELECT uts.user_id, MIN(uts.space_id) AS space_id
+    FROM user_to_space uts
+    JOIN space sp ON sp.id = uts.space_id AND sp.is_deleted = FALSE
+    WHERE uts.is_pending = FALSE
+    GROUP BY uts.user_id
+    HAVING COUNT(*) = 1
+) s
+WHERE a.user_id = s.user_id AND a.note_id IS NULL AND a.space_id IS NULL;
+
+UPDATE activities a SET space_id = s.space_id
+FROM (
+    SELECT owner_id, MIN(id) AS space_id
+    FROM space
+    WHERE is_deleted = FALSE AND owner_id IS NOT NULL
+    GROUP BY owner_id
+    HAVING COUNT(*) = 1
+) s
+WHERE a.user_id = s.owner_id AND a.note_id IS NULL AND a.space_id IS NULL;
+
+-- Activities still without a space (users in several spaces, owning none or
+-- several of them) are kept as they are. No space lists, syncs or analyses
+-- them; their user can move one into a space by attaching it to a note with
+-- PATCH /activities/{id}.
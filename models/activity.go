@@ -3,12 +3,14 @@ package models
 import "time"
 
 type Activity struct {
-	ID         int       `json:"id"`
-	UserID     int       `json:"userId"`
-	TypeID     int       `json:"typeId"`
-	Value      any       `json:"value"`
-	NoteID     *int      `json:"noteId,omitempty"`
-	IsDeleted  bool      `json:"-"`
-	CreatedAt  time.Time `json:"createdAt"`
-	ModifiedAt time.Time `json:"modifiedAt"`
+	ID         int        `json:"id"`
+	UserID     int        `json:"userId"`
+	TypeID     int        `json:"typeId"`
+	Value      any        `json:"value"`
+	NoteID     *int       `json:"noteId,omitempty"`
+	SpaceID    int        `json:"spaceId"`
+	OccurredAt *time.Time `json:"occurredAt,omitempty"`
+	IsDeleted  bool       `json:"-"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ModifiedAt time.Time  `json:"modifiedAt"`
 }
@@ -1,19 +1,121 @@
 package models
 
-import "time"
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
 
 type ActivityType struct {
-	ID          int       `json:"id"`
-	Name        string    `json:"name"`
-	ValueType   string    `json:"valueType"`
-	MinValue    *float64  `json:"minValue,omitempty"`
-	MaxValue    *float64  `json:"maxValue,omitempty"`
-	Aggregation string    `json:"aggregation"`
-	SpaceID     int       `json:"spaceId,omitempty"`
-	IsDefault   bool      `json:"isDefault"`
-	IsDeleted   bool      `json:"-"`
-	Unit        *string   `json:"unit,omitempty"`
-	CategoryID  int       `json:"categoryId,omitempty"`
-	CreatedAt   time.Time `json:"createdAt"`
-	ModifiedAt  time.Time `json:"modifiedAt"`
+	ID          int                  `json:"id"`
+	Name        string               `json:"name"`
+	ValueType   string               `json:"valueType"`
+	MinValue    *float64             `json:"minValue,omitempty"`
+	MaxValue    *float64             `json:"maxValue,omitempty"`
+	Aggregation string               `json:"aggregation"`
+	SpaceID     int                  `json:"spaceId,omitempty"`
+	IsDefault   bool                 `json:"isDefault"`
+	IsDeleted   bool                 `json:"-"`
+	Unit        *string              `json:"unit,omitempty"`
+	CategoryID  int                  `json:"categoryId,omitempty"`
+	Options     []ActivityTypeOption `json:"options,omitempty"`
+	Fields      []ActivityField      `json:"fields,omitempty"`
+	CreatedAt   time.Time            `json:"createdAt"`
+	ModifiedAt  time.Time            `json:"modifiedAt"`
+}
+
+// ActivityTypeOption is one allowed value of an enum type, or the label of
+// one point on a rating scale (Value is then the integer as a string).
+type ActivityTypeOption struct {
+	Value string `json:"value"`
+	Label string `json:"label,omitempty"`
+}
+
+// OptionValues lists the values an enum or rating type can take, in order.
+// Other value types have no fixed set and return nil.
+func (t *ActivityType) OptionValues() []string {
+	switch t.ValueType {
+	case "enum":
+		values := make([]string, 0, len(t.Options))
+		for _, o := range t.Options {
+			values = append(values, o.Value)
+		}
+		return values
+	case "rating":
+		if t.MinValue == nil || t.MaxValue == nil {
+			return nil
+		}
+		var values []string
+		for v := int(*t.MinValue); v <= int(*t.MaxValue); v++ {
+			values = append(values, strconv.Itoa(v))
+		}
+		return values
+	}
+	return nil
+}
+
+// ActivityField is one field of a composite activity type. Fields are typed
+// like activity types themselves and may be composite again, so a value of
+// a blood pressure field "bp" holds {"systolic": 120, "diastolic": 80} and
+// its parts are addressed by paths such as "bp.systolic".
+type ActivityField struct {
+	Key         string               `json:"key"`
+	Name        string               `json:"name,omitempty"`
+	ValueType   string               `json:"valueType"`
+	MinValue    *float64             `json:"minValue,omitempty"`
+	MaxValue    *float64             `json:"maxValue,omitempty"`
+	Aggregation string               `json:"aggregation"`
+	Unit        *string              `json:"unit,omitempty"`
+	Options     []ActivityTypeOption `json:"options,omitempty"`
+	Fields      []ActivityField      `json:"fields,omitempty"`
+}
+
+// AsType returns the field as a standalone activity type so the rules and
+// aggregations of its value type apply to it.
+func (f *ActivityField) AsType() *ActivityType {
+	return &ActivityType{
+		Name:        f.Name,
+		ValueType:   f.ValueType,
+		MinValue:    f.MinValue,
+		MaxValue:    f.MaxValue,
+		Aggregation: f.Aggregation,
+		Unit:        f.Unit,
+		Options:     f.Options,
+		Fields:      f.Fields,
+	}
+}
+
+// Field finds the field with the given key among the direct fields of t.
+func (t *ActivityType) Field(key string) *ActivityField {
+	for i := range t.Fields {
+		if t.Fields[i].Key == key {
+			return &t.Fields[i]
+		}
+	}
+	return nil
+}
+
+// ResolveField follows a dotted field path through a composite type and
+// returns the addressed field as a type carrying the ID of t, together with
+// the path split into keys. The path must end at a non-composite field.
+func (t *ActivityType) ResolveField(path string) (*ActivityType, []string, error) {
+	if t.ValueType != "composite" {
+		return nil, nil, errors.New("field paths are supported only for composite types")
+	}
+	keys := strings.Split(path, ".")
+	cur := t
+	for _, key := range keys {
+		f := cur.Field(key)
+		if f == nil {
+			return nil, nil, errors.New("unknown field path")
+		}
+		cur = f.AsType()
+	}
+	if cur.ValueType == "composite" {
+		return nil, nil, errors.New("field path must address a non-composite field")
+	}
+	cur.ID = t.ID
+	cur.SpaceID = t.SpaceID
+	return cur, keys, nil
 }
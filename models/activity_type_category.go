@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// ActivityTypeCategory groups activity types. Default categories are global
+// (no SpaceID) and read-only; custom categories belong to one space.
+type ActivityTypeCategory struct {
+	ID         int       `json:"id"`
+	SpaceID    *int      `json:"spaceId,omitempty"`
+	Name       string    `json:"name"`
+	Icon       *string   `json:"icon,omitempty"`
+	SortOrder  int       `json:"sortOrder"`
+	IsDefault  bool      `json:"isDefault"`
+	IsDeleted  bool      `json:"-"`
+	CreatedAt  time.Time `json:"createdAt"`
+	ModifiedAt time.Time `json:"modifiedAt"`
+}
+
+// AvailableIn reports whether types of the space may use the category.
+func (c *ActivityTypeCategory) AvailableIn(spaceID int) bool {
+	return !c.IsDeleted && (c.SpaceID == nil || *c.SpaceID == spaceID)
+}
+
+// ActivityTypeGroup is one category with its activity types. Category is nil
+// for the group of uncategorized types.
+type ActivityTypeGroup struct {
+	Category      *ActivityTypeCategory `json:"category"`
+	ActivityTypes []*ActivityType       `json:"activityTypes"`
+}
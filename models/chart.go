@@ -2,24 +2,117 @@ package models
 
 import "time"
 
+// Chart plots one or more series per period. ActivityTypeID, FieldPath and
+// Aggregation mirror the first series, for clients that know only one.
+// Aggregation overrides the type's aggregation and Transform (ma7, ma30,
+// cumsum) derives the plotted values of every series.
+// The plotted range is the last RangeDays days or the local dates RangeFrom to
+// RangeTo (2006-01-02); without either it is the last period. Fill says how
+// buckets without activities are returned (none, zero, null).
+// Tags scope every series to activities whose note has all of them and none
+// of those prefixed with "!", and FilterID to the notes of a saved filter.
+// Notes with AnnotationTag annotate the chart on their date.
 type Chart struct {
-	ID             int       `json:"id"`
-	UserID         int       `json:"userId"`
-	SpaceID        int       `json:"spaceId"`
-	KindID         int       `json:"kindId"`
-	ActivityTypeID int       `json:"activityTypeId"`
-	PeriodID       int       `json:"periodId"`
-	Name           string    `json:"name"`
-	Description    *string   `json:"description,omitempty"`
-	NoteID         *int      `json:"noteId,omitempty"`
-	IsDeleted      bool      `json:"-"`
-	CreatedAt      time.Time `json:"createdAt"`
-	ModifiedAt     time.Time `json:"modifiedAt"`
+	ID             int           `json:"id"`
+	UserID         int           `json:"userId"`
+	SpaceID        int           `json:"spaceId"`
+	KindID         int           `json:"kindId"`
+	ActivityTypeID int           `json:"activityTypeId"`
+	FieldPath      *string       `json:"fieldPath,omitempty"`
+	Aggregation    *string       `json:"aggregation,omitempty"`
+	Transform      *string       `json:"transform,omitempty"`
+	RangeDays      *int          `json:"rangeDays,omitempty"`
+	RangeFrom      *string       `json:"rangeFrom,omitempty"`
+	RangeTo        *string       `json:"rangeTo,omitempty"`
+	Fill           *string       `json:"fill,omitempty"`
+	Series         []ChartSeries `json:"series"`
+	Options        *ChartOptions `json:"options,omitempty"`
+	Tags           []string      `json:"tags,omitempty"`
+	FilterID       *int          `json:"filterId,omitempty"`
+	AnnotationTag  *string       `json:"annotationTag,omitempty"`
+	PeriodID       int           `json:"periodId"`
+	Name           string        `json:"name"`
+	Description    *string       `json:"description,omitempty"`
+	NoteID         *int          `json:"noteId,omitempty"`
+	IsDeleted      bool          `json:"-"`
+	CreatedAt      time.Time     `json:"createdAt"`
+	ModifiedAt     time.Time     `json:"modifiedAt"`
+	// Scope holds the resolved conditions of the saved filter, if any.
+	Scope *NoteFilters `json:"-"`
 }
 
+// ChartSeries is one series of a chart. Tags filter its activities by the tags
+// of their note ("!" excludes a tag) and Axis is left or right.
+type ChartSeries struct {
+	ActivityTypeID int      `json:"activityTypeId"`
+	FieldPath      *string  `json:"fieldPath,omitempty"`
+	Aggregation    *string  `json:"aggregation,omitempty"`
+	Tags           []string `json:"tags,omitempty"`
+	Color          *string  `json:"color,omitempty"`
+	Axis           string   `json:"axis"`
+}
+
+// ChartDataPoint is one bucket of chart data. Values holds the value of each
+// series in chart order, null where a series has no data for the bucket;
+// Value and BaseValue are those of the first series.
 type ChartDataPoint struct {
-	Date  time.Time `json:"date"`
-	Value float64   `json:"value"`
+	Date   time.Time  `json:"date"`
+	Value  *float64   `json:"value"`
+	Values []*float64 `json:"values"`
+	// BaseValue is the aggregated value a transform was derived from.
+	BaseValue  *float64   `json:"baseValue,omitempty"`
+	BaseValues []*float64 `json:"baseValues,omitempty"`
+	// Compare compares each series with the compared range (compare=).
+	Compare []ComparisonValue `json:"compare,omitempty"`
+	// Trend holds the fitted trend of each series (trend=), null where a
+	// series has none.
+	Trend []*float64 `json:"trend,omitempty"`
+}
+
+// ChartOptions holds settings of particular chart kinds: the number of
+// histogram bins and what a pie chart groups by (value or tag).
+type ChartOptions struct {
+	Bins    int    `json:"bins,omitempty"`
+	GroupBy string `json:"groupBy,omitempty"`
+}
+
+// HeatmapData is the data of a calendar heatmap: one value per local day with
+// activities between From and To, and the extremes for scaling colors.
+type HeatmapData struct {
+	From string       `json:"from"`
+	To   string       `json:"to"`
+	Min  *float64     `json:"min"`
+	Max  *float64     `json:"max"`
+	Days []HeatmapDay `json:"days"`
+}
+
+type HeatmapDay struct {
+	Date  string  `json:"date"`
+	Value float64 `json:"value"`
+}
+
+// PieSlice is one slice of a pie chart: a value of the activity type, or a
+// tag (empty key for activities without tags). Share is its part of the total.
+type PieSlice struct {
+	Key   string  `json:"key"`
+	Label string  `json:"label"`
+	Value float64 `json:"value"`
+	Share float64 `json:"share"`
+}
+
+// ScatterPoint pairs the daily values of the two series of a scatter chart.
+type ScatterPoint struct {
+	Date string  `json:"date"`
+	X    float64 `json:"x"`
+	Y    float64 `json:"y"`
+}
+
+// HistogramBin counts the activities with a value in [From, To); the last bin
+// includes To.
+type HistogramBin struct {
+	From  float64 `json:"from"`
+	To    float64 `json:"to"`
+	Count int     `json:"count"`
 }
 
 type ChartFilters struct {
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// ChartAnnotation marks a local date, or the dates Date to EndDate, on the
+// timeline of a chart with a label and optionally the note it is about.
+// Source is manual for stored annotations and tag for those derived from the
+// notes carrying the chart's AnnotationTag, which have no ID.
+type ChartAnnotation struct {
+	ID         int       `json:"id,omitempty"`
+	ChartID    int       `json:"chartId"`
+	UserID     int       `json:"userId"`
+	Date       string    `json:"date"`
+	EndDate    *string   `json:"endDate,omitempty"`
+	Label      string    `json:"label"`
+	NoteID     *int      `json:"noteId,omitempty"`
+	Source     string    `json:"source"`
+	IsDeleted  bool      `json:"-"`
+	CreatedAt  time.Time `json:"createdAt"`
+	ModifiedAt time.Time `json:"modifiedAt"`
+}
+
+// AnnotatedChartData is the data of a chart, in the shape of its kind, with
+// the annotations of its range (annotations=true).
+type AnnotatedChartData struct {
+	Data        interface{}       `json:"data"`
+	Annotations []ChartAnnotation `json:"annotations"`
+}
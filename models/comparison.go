@@ -0,0 +1,75 @@
+package models
+
+import "math"
+
+// ComparisonValue is a value next to the value it is compared with. Delta is
+// Value minus CompareValue and DeltaPercent that change relative to
+// CompareValue; both are null unless both values are known, and the percent
+// also when CompareValue is zero.
+type ComparisonValue struct {
+	Value        *float64 `json:"value"`
+	CompareValue *float64 `json:"compareValue"`
+	Delta        *float64 `json:"delta"`
+	DeltaPercent *float64 `json:"deltaPercent"`
+}
+
+// Compare builds the comparison of value with compareValue.
+func Compare(value, compareValue *float64) ComparisonValue {
+	c := ComparisonValue{Value: copyFloat(value), CompareValue: copyFloat(compareValue)}
+	if value == nil || compareValue == nil {
+		return c
+	}
+	delta := *value - *compareValue
+	c.Delta = &delta
+	if *compareValue != 0 {
+		percent := delta * 100 / math.Abs(*compareValue)
+		c.DeltaPercent = &percent
+	}
+	return c
+}
+
+// Scale converts the values and delta by factor; the percent is unchanged.
+func (c *ComparisonValue) Scale(factor float64) {
+	for _, v := range []*float64{c.Value, c.CompareValue, c.Delta} {
+		if v != nil {
+			*v *= factor
+		}
+	}
+}
+
+// ChartComparison is the data of a line or bar chart compared with an
+// earlier range of the same length. Points carry, per series, the value of
+// the bucket and of the aligned bucket of the compared range; Summary
+// compares the series aggregated over each whole range. Ranges are local
+// dates (2006-01-02).
+type ChartComparison struct {
+	Compare     string            `json:"compare"`
+	From        string            `json:"from"`
+	To          string            `json:"to"`
+	CompareFrom string            `json:"compareFrom"`
+	CompareTo   string            `json:"compareTo"`
+	Points      []ChartDataPoint  `json:"points"`
+	Summary     []ComparisonValue `json:"summary"`
+}
+
+// AnalysisComparison is an activity analysis compared with an earlier range:
+// each period holds compareValue, delta and deltaPercent next to its value,
+// and Summary compares the aggregates over the whole ranges. The dates are
+// set when the range is bounded.
+type AnalysisComparison struct {
+	Compare     string           `json:"compare"`
+	From        *string          `json:"from,omitempty"`
+	To          string           `json:"to"`
+	CompareFrom *string          `json:"compareFrom,omitempty"`
+	CompareTo   string           `json:"compareTo"`
+	Periods     []map[string]any `json:"periods"`
+	Summary     ComparisonValue  `json:"summary"`
+}
+
+func copyFloat(v *float64) *float64 {
+	if v == nil {
+		return nil
+	}
+	c := *v
+	return &c
+}
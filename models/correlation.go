@@ -0,0 +1,23 @@
+package models
+
+// Correlation relates the per-period aggregates of two activity types. With
+// a lag of k, the value of A in a period is paired with the value of B k
+// periods later. Coefficients are nil when they are undefined (fewer than
+// three pairs or a constant series).
+type Correlation struct {
+	TypeAID  int                `json:"typeA"`
+	TypeBID  int                `json:"typeB"`
+	PeriodID int                `json:"periodId"`
+	Lag      int                `json:"lag"`
+	N        int                `json:"n"`
+	Pearson  *float64           `json:"pearson"`
+	Spearman *float64           `json:"spearman"`
+	Points   []CorrelationPoint `json:"points"`
+}
+
+type CorrelationPoint struct {
+	PeriodA string  `json:"periodA"`
+	PeriodB string  `json:"periodB"`
+	A       float64 `json:"a"`
+	B       float64 `json:"b"`
+}
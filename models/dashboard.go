@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// Dashboard groups charts of a space in a grid of widgets. Its shared range
+// (the last RangeDays days, or the local dates RangeFrom to RangeTo) replaces
+// the range of every widget's chart when set, and its Tags are added to the
+// charts' own tag scopes.
+type Dashboard struct {
+	ID         int               `json:"id"`
+	SpaceID    int               `json:"spaceId"`
+	CreatedBy  int               `json:"createdBy"`
+	Name       string            `json:"name"`
+	RangeDays  *int              `json:"rangeDays,omitempty"`
+	RangeFrom  *string           `json:"rangeFrom,omitempty"`
+	RangeTo    *string           `json:"rangeTo,omitempty"`
+	Tags       []string          `json:"tags,omitempty"`
+	Widgets    []DashboardWidget `json:"widgets"`
+	IsDeleted  bool              `json:"-"`
+	CreatedAt  time.Time         `json:"createdAt"`
+	ModifiedAt time.Time         `json:"modifiedAt"`
+}
+
+// DashboardWidget places a chart on a dashboard grid: X and Y are the column
+// and row of its top-left cell, W and H its width and height in cells.
+type DashboardWidget struct {
+	ChartID int `json:"chartId"`
+	X       int `json:"x"`
+	Y       int `json:"y"`
+	W       int `json:"w"`
+	H       int `json:"h"`
+}
+
+// Overlaps reports whether two widgets share a cell.
+func (w DashboardWidget) Overlaps(o DashboardWidget) bool {
+	return w.X < o.X+o.W && o.X < w.X+w.W && w.Y < o.Y+o.H && o.Y < w.Y+w.H
+}
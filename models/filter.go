@@ -2,28 +2,72 @@ package models
 
 import (
 	"encoding/json"
+	"errors"
+	"focuz-api/pkg/query"
+	"strconv"
+	"strings"
 	"time"
 )
 
 // Filter represents a saved set of note filters within a space.
-// Nesting is represented by parentId only (no inheritance of params).
-// Params is stored as raw JSON to allow the frontend to control the schema
-// (validated only as syntactically valid JSON by the handler).
-// Examples of params align with NoteFilters fields.
+// Filters are ordered by Position, a fractional index key (pkg/fracindex),
+// so moving one filter never rewrites its siblings.
+// Nesting is represented by parentId. When InheritParams is set, the
+// effective params are the filter's own params ANDed with its parent's
+// effective params (see FilterParams.Inherit).
+// Params is stored as raw JSON so that keys unknown to the server are kept
+// as-is for forward compatibility. Known keys follow FilterParams and are
+// validated by the handler on create/update.
 // { "tags": ["a", "!b"], "notReply": true, "parentId": null, ... }
-//
-// We intentionally do not embed NoteFilters here to keep storage flexible.
 
 type Filter struct {
-	ID         int             `json:"id"`
-	UserID     int             `json:"userId"`
-	SpaceID    int             `json:"spaceId"`
-	ParentID   *int            `json:"parentId"`
-	Name       string          `json:"name"`
-	Params     json.RawMessage `json:"params"`
-	IsDeleted  bool            `json:"-"`
-	CreatedAt  time.Time       `json:"createdAt"`
-	ModifiedAt time.Time       `json:"modifiedAt"`
+	ID            int             `json:"id"`
+	UserID        int             `json:"userId"`
+	SpaceID       int             `json:"spaceId"`
+	ParentID      *int            `json:"parentId"`
+	Name          string          `json:"name"`
+	Params        json.RawMessage `json:"params"`
+	InheritParams bool            `json:"inheritParams"`
+	Visibility    string          `json:"visibility"`
+	Position      string          `json:"position"`
+	IsDeleted     bool            `json:"-"`
+	CreatedAt     time.Time       `json:"createdAt"`
+	ModifiedAt    time.Time       `json:"modifiedAt"`
+}
+
+// Filter visibility: private filters are seen only by their creator.
+const (
+	FilterVisibilityPrivate = "private"
+	FilterVisibilitySpace   = "space"
+)
+
+// IsValidFilterVisibility reports whether v is a known visibility value.
+func IsValidFilterVisibility(v string) bool {
+	return v == FilterVisibilityPrivate || v == FilterVisibilitySpace
+}
+
+// VisibleTo reports whether the user may see the filter (space access aside).
+func (f *Filter) VisibleTo(userID int) bool {
+	return f.Visibility != FilterVisibilityPrivate || f.UserID == userID
+}
+
+// CanParent reports whether a filter with the given visibility may sit under
+// f. Shared filters need shared parents, so whoever sees a filter sees the
+// params it inherits.
+func (f *Filter) CanParent(visibility string) bool {
+	return visibility != FilterVisibilitySpace || f.Visibility != FilterVisibilityPrivate
+}
+
+// FilterUpdate lists the fields of a partial filter update; nil fields are
+// kept. The parent changes only when SetParent is true (nil ParentID detaches).
+type FilterUpdate struct {
+	Name          *string
+	SetParent     bool
+	ParentID      *int
+	Params        *json.RawMessage
+	InheritParams *bool
+	Visibility    *string
+	Position      *string
 }
 
 // FilterListFilters supports pagination for filters listing.
@@ -32,3 +76,304 @@ type FilterListFilters struct {
 	Page     int `json:"page"`
 	PageSize int `json:"pageSize"`
 }
+
+// FilterParams is the typed view of Filter.Params. It mirrors NoteFilters
+// (without pagination, which belongs to the request executing the filter).
+// Sorting may be given either as sortField/sortOrder or as the combined
+// "sort" form used by GET /notes ("modifiedAt,ASC").
+// Any other key is kept in Extra and written back untouched.
+type FilterParams struct {
+	Tags      []string
+	NotReply  bool
+	ParentID  *int
+	DateFrom  *time.Time
+	DateTo    *time.Time
+	SortField string
+	SortOrder string
+	// Q is the raw query language expression and Query its parsed form.
+	Q     string
+	Query query.Expr
+	Extra map[string]json.RawMessage
+}
+
+var filterParamsKnownKeys = map[string]bool{
+	"tags": true, "notReply": true, "parentId": true,
+	"dateFrom": true, "dateTo": true,
+	"sortField": true, "sortOrder": true, "sort": true,
+	"q": true,
+}
+
+// ParseFilterParams decodes and validates raw filter params.
+// Returned errors are meant to be shown to API clients.
+func ParseFilterParams(raw json.RawMessage) (*FilterParams, error) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &obj); err != nil || obj == nil {
+		return nil, errors.New("params must be a JSON object")
+	}
+	p := &FilterParams{Extra: map[string]json.RawMessage{}}
+	for k, v := range obj {
+		if !filterParamsKnownKeys[k] {
+			p.Extra[k] = v
+		}
+	}
+	if v, ok := obj["tags"]; ok && !isJSONNull(v) {
+		if err := json.Unmarshal(v, &p.Tags); err != nil {
+			return nil, errors.New("params.tags must be an array of strings")
+		}
+		for _, t := range p.Tags {
+			if strings.TrimSpace(strings.TrimPrefix(t, "!")) == "" {
+				return nil, errors.New("params.tags must not contain empty tags")
+			}
+		}
+	}
+	if v, ok := obj["notReply"]; ok && !isJSONNull(v) {
+		if err := json.Unmarshal(v, &p.NotReply); err != nil {
+			return nil, errors.New("params.notReply must be a boolean")
+		}
+	}
+	if v, ok := obj["parentId"]; ok && !isJSONNull(v) {
+		var id int
+		if err := json.Unmarshal(v, &id); err != nil || id <= 0 {
+			return nil, errors.New("params.parentId must be a positive integer")
+		}
+		p.ParentID = &id
+	}
+	var err error
+	if p.DateFrom, err = parseFilterDate(obj, "dateFrom"); err != nil {
+		return nil, err
+	}
+	if p.DateTo, err = parseFilterDate(obj, "dateTo"); err != nil {
+		return nil, err
+	}
+	if p.DateFrom != nil && p.DateTo != nil && p.DateFrom.After(*p.DateTo) {
+		return nil, errors.New("params.dateFrom cannot be after params.dateTo")
+	}
+
+	var field, order string
+	if v, ok := obj["sort"]; ok && !isJSONNull(v) {
+		var s string
+		if err := json.Unmarshal(v, &s); err != nil {
+			return nil, errors.New("params.sort must be a string like \"createdAt,DESC\"")
+		}
+		parts := strings.Split(s, ",")
+		if len(parts) != 2 {
+			return nil, errors.New("params.sort must be a string like \"createdAt,DESC\"")
+		}
+		field, order = parts[0], parts[1]
+	}
+	if v, ok := obj["sortField"]; ok && !isJSONNull(v) {
+		if err := json.Unmarshal(v, &field); err != nil {
+			return nil, errors.New("params.sortField must be a string")
+		}
+	}
+	if v, ok := obj["sortOrder"]; ok && !isJSONNull(v) {
+		if err := json.Unmarshal(v, &order); err != nil {
+			return nil, errors.New("params.sortOrder must be a string")
+		}
+	}
+	if field != "" {
+		switch strings.ToLower(strings.TrimSpace(field)) {
+		case "createdat", "created_at":
+			p.SortField = "created_at"
+		case "modifiedat", "modified_at":
+			p.SortField = "modified_at"
+		default:
+			return nil, errors.New("params.sortField must be createdAt or modifiedAt")
+		}
+	}
+	if order != "" {
+		o := strings.ToUpper(strings.TrimSpace(order))
+		if o != "ASC" && o != "DESC" {
+			return nil, errors.New("params.sortOrder must be ASC or DESC")
+		}
+		p.SortOrder = o
+	}
+	if v, ok := obj["q"]; ok && !isJSONNull(v) {
+		if err := json.Unmarshal(v, &p.Q); err != nil {
+			return nil, errors.New("params.q must be a string")
+		}
+		if strings.TrimSpace(p.Q) != "" {
+			expr, err := query.Parse(p.Q)
+			if err != nil {
+				return nil, errors.New("params.q: " + err.Error())
+			}
+			p.Query = expr
+		}
+	}
+	return p, nil
+}
+
+// ToNoteFilters converts params into NoteFilters for the given page.
+func (p *FilterParams) ToNoteFilters(page, pageSize int) NoteFilters {
+	f := NoteFilters{
+		Tags:      p.Tags,
+		NotReply:  p.NotReply,
+		Page:      page,
+		PageSize:  pageSize,
+		ParentID:  p.ParentID,
+		SortField: p.SortField,
+		SortOrder: p.SortOrder,
+		DateFrom:  p.DateFrom,
+		DateTo:    p.DateTo,
+		Query:     p.Query,
+	}
+	if f.SortField == "" {
+		f.SortField = "created_at"
+	}
+	if f.SortOrder == "" {
+		f.SortOrder = "DESC"
+	}
+	return f
+}
+
+// Inherit returns p combined with the parent's params using AND semantics:
+// tags and query conditions accumulate, the date range is intersected and
+// notReply is kept if either side sets it. Sorting, parentId and unknown
+// keys are taken from the child when present.
+func (p *FilterParams) Inherit(parent *FilterParams) *FilterParams {
+	out := &FilterParams{
+		NotReply:  p.NotReply || parent.NotReply,
+		ParentID:  parent.ParentID,
+		DateFrom:  parent.DateFrom,
+		DateTo:    parent.DateTo,
+		SortField: parent.SortField,
+		SortOrder: parent.SortOrder,
+		Query:     parent.Query,
+		Extra:     map[string]json.RawMessage{},
+	}
+	if parent.Query != nil {
+		out.Q = parent.Q
+	}
+	seen := map[string]bool{}
+	for _, t := range append(append([]string{}, parent.Tags...), p.Tags...) {
+		if !seen[t] {
+			seen[t] = true
+			out.Tags = append(out.Tags, t)
+		}
+	}
+	if p.ParentID != nil {
+		out.ParentID = p.ParentID
+	}
+	if p.DateFrom != nil && (out.DateFrom == nil || p.DateFrom.After(*out.DateFrom)) {
+		out.DateFrom = p.DateFrom
+	}
+	if p.DateTo != nil && (out.DateTo == nil || p.DateTo.Before(*out.DateTo)) {
+		out.DateTo = p.DateTo
+	}
+	if p.SortField != "" {
+		out.SortField = p.SortField
+	}
+	if p.SortOrder != "" {
+		out.SortOrder = p.SortOrder
+	}
+	if p.Query != nil {
+		if out.Query != nil {
+			out.Q = "(" + out.Q + ") AND (" + p.Q + ")"
+			out.Query = query.And{Left: out.Query, Right: p.Query}
+		} else {
+			out.Q = p.Q
+			out.Query = p.Query
+		}
+	}
+	for k, v := range parent.Extra {
+		out.Extra[k] = v
+	}
+	for k, v := range p.Extra {
+		out.Extra[k] = v
+	}
+	return out
+}
+
+// MarshalJSON writes params back in the stored format (sortField/sortOrder
+// form, RFC3339 dates), including unknown keys.
+func (p *FilterParams) MarshalJSON() ([]byte, error) {
+	obj := map[string]interface{}{}
+	for k, v := range p.Extra {
+		obj[k] = v
+	}
+	if len(p.Tags) > 0 {
+		obj["tags"] = p.Tags
+	}
+	if p.NotReply {
+		obj["notReply"] = true
+	}
+	if p.ParentID != nil {
+		obj["parentId"] = *p.ParentID
+	}
+	if p.DateFrom != nil {
+		obj["dateFrom"] = p.DateFrom.Format(time.RFC3339)
+	}
+	if p.DateTo != nil {
+		obj["dateTo"] = p.DateTo.Format(time.RFC3339)
+	}
+	switch p.SortField {
+	case "created_at":
+		obj["sortField"] = "createdAt"
+	case "modified_at":
+		obj["sortField"] = "modifiedAt"
+	}
+	if p.SortOrder != "" {
+		obj["sortOrder"] = p.SortOrder
+	}
+	if p.Query != nil {
+		obj["q"] = p.Q
+	}
+	return json.Marshal(obj)
+}
+
+// FilterCount is the number of notes a filter matches and how many of them
+// were created since the user last viewed it (all of them if never viewed).
+type FilterCount struct {
+	FilterID     int        `json:"filterId"`
+	Count        int        `json:"count"`
+	NewCount     int        `json:"newCount"`
+	LastViewedAt *time.Time `json:"lastViewedAt"`
+}
+
+// ResolveFilterParams returns the effective params of f given its ancestors
+// (nearest parent first) and the IDs of the filters that contributed, f first.
+// The walk stops at the first filter that does not inherit, at a deleted
+// parent, or where the ancestors slice no longer follows parentId.
+func ResolveFilterParams(f *Filter, ancestors []*Filter) (*FilterParams, []int, error) {
+	params, err := ParseFilterParams(f.Params)
+	if err != nil {
+		return nil, nil, err
+	}
+	chain := []int{f.ID}
+	cur := f
+	for _, a := range ancestors {
+		if !cur.InheritParams || cur.ParentID == nil || *cur.ParentID != a.ID || a.IsDeleted {
+			break
+		}
+		ap, err := ParseFilterParams(a.Params)
+		if err != nil {
+			return nil, nil, errors.New("parent filter " + strconv.Itoa(a.ID) + ": " + err.Error())
+		}
+		params = params.Inherit(ap)
+		chain = append(chain, a.ID)
+		cur = a
+	}
+	return params, chain, nil
+}
+
+func parseFilterDate(obj map[string]json.RawMessage, key string) (*time.Time, error) {
+	v, ok := obj[key]
+	if !ok || isJSONNull(v) {
+		return nil, nil
+	}
+	var s string
+	if err := json.Unmarshal(v, &s); err != nil {
+		return nil, errors.New("params." + key + " must be a date string")
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return &t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return &t, nil
+	}
+	return nil, errors.New("params." + key + " must be YYYY-MM-DD or RFC3339")
+}
+
+func isJSONNull(v json.RawMessage) bool {
+	return strings.TrimSpace(string(v)) == "null"
+}
@@ -0,0 +1,191 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Goal is a target for the aggregated value of an activity type per period,
+// such as "steps sum >= 10000 per day". A goal with a UserID is personal and
+// counts only that user's activities; without one it covers the whole space.
+type Goal struct {
+	ID             int       `json:"id"`
+	SpaceID        int       `json:"spaceId"`
+	UserID         *int      `json:"userId,omitempty"`
+	CreatedBy      int       `json:"createdBy"`
+	ActivityTypeID int       `json:"activityTypeId"`
+	FieldPath      *string   `json:"fieldPath,omitempty"`
+	PeriodID       int       `json:"periodId"`
+	Operator       string    `json:"operator"`
+	Target         float64   `json:"target"`
+	IsDeleted      bool      `json:"-"`
+	CreatedAt      time.Time `json:"createdAt"`
+	ModifiedAt     time.Time `json:"modifiedAt"`
+}
+
+var goalOperators = map[string]func(v, target float64) bool{
+	">=": func(v, t float64) bool { return v >= t },
+	">":  func(v, t float64) bool { return v > t },
+	"<=": func(v, t float64) bool { return v <= t },
+	"<":  func(v, t float64) bool { return v < t },
+	"=":  func(v, t float64) bool { return v == t },
+}
+
+func IsValidGoalOperator(op string) bool {
+	_, ok := goalOperators[op]
+	return ok
+}
+
+// Met reports whether an aggregated period value reaches the goal.
+func (g *Goal) Met(v float64) bool {
+	cmp, ok := goalOperators[g.Operator]
+	return ok && cmp(v, g.Target)
+}
+
+// MetPeriod evaluates a period value; a period without records counts as 0
+// for upper-bound goals ("<", "<=") and as missed otherwise.
+func (g *Goal) MetPeriod(v *float64) bool {
+	if v == nil {
+		return (g.Operator == "<" || g.Operator == "<=") && g.Met(0)
+	}
+	return g.Met(*v)
+}
+
+// VisibleTo reports whether the user sees the goal: space goals are visible
+// to every member, personal goals only to their user.
+func (g *Goal) VisibleTo(userID int) bool {
+	return g.UserID == nil || *g.UserID == userID
+}
+
+// GoalPeriod is the evaluation of a goal in one period. Value is nil when
+// nothing was recorded in the period.
+type GoalPeriod struct {
+	Period string    `json:"period"`
+	Start  time.Time `json:"start"`
+	Value  *float64  `json:"value"`
+	Met    bool      `json:"met"`
+}
+
+// GoalProgress summarizes a goal over its history. Streaks count consecutive
+// met periods; the current streak ends with the current period when it is
+// already met and with the previous period otherwise, in which case AtRisk
+// tells that the streak breaks unless the current period is met.
+type GoalProgress struct {
+	Goal          *Goal        `json:"goal"`
+	Current       GoalPeriod   `json:"current"`
+	History       []GoalPeriod `json:"history"`
+	CurrentStreak int          `json:"currentStreak"`
+	LongestStreak int          `json:"longestStreak"`
+	AtRisk        bool         `json:"atRisk"`
+}
+
+// TruncatePeriod returns the start of the period containing t, matching the
+// activity analysis buckets for "day", "week" (starting on weekStart, monday
+// or sunday), "month" and "year".
+func TruncatePeriod(t time.Time, period, weekStart string) time.Time {
+	y, m, d := t.Date()
+	switch period {
+	case "week":
+		day := time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+		offset := (int(day.Weekday()) + 6) % 7
+		if weekStart == "sunday" {
+			offset = int(day.Weekday())
+		}
+		return day.AddDate(0, 0, -offset)
+	case "month":
+		return time.Date(y, m, 1, 0, 0, 0, 0, t.Location())
+	case "year":
+		return time.Date(y, 1, 1, 0, 0, 0, 0, t.Location())
+	default:
+		return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+	}
+}
+
+// PeriodLabel formats a period start like the to_char formats of the
+// activity analysis: 2006-01-02, 2006-W01 (ISO week), 2006-01 and 2006.
+// Sunday weeks take the ISO week of their Monday.
+func PeriodLabel(start time.Time, period, weekStart string) string {
+	switch period {
+	case "week":
+		if weekStart == "sunday" {
+			start = start.AddDate(0, 0, 1)
+		}
+		y, w := start.ISOWeek()
+		return fmt.Sprintf("%04d-W%02d", y, w)
+	case "month":
+		return start.Format("2006-01")
+	case "year":
+		return start.Format("2006")
+	default:
+		return start.Format("2006-01-02")
+	}
+}
+
+// ParsePeriodLabel returns the start of the period labelled as by
+// PeriodLabel; weeks start on their ISO Monday.
+func ParsePeriodLabel(label, period string) (time.Time, error) {
+	switch period {
+	case "week":
+		var year, week int
+		if _, err := fmt.Sscanf(label, "%d-W%d", &year, &week); err != nil {
+			return time.Time{}, errors.New("invalid week period " + label)
+		}
+		// ISO week 1 contains January 4th
+		jan4 := time.Date(year, time.January, 4, 0, 0, 0, 0, time.UTC)
+		monday := jan4.AddDate(0, 0, -((int(jan4.Weekday()) + 6) % 7))
+		return monday.AddDate(0, 0, 7*(week-1)), nil
+	case "month":
+		return time.Parse("2006-01", label)
+	case "year":
+		return time.Parse("2006", label)
+	default:
+		return time.Parse("2006-01-02", label)
+	}
+}
+
+// NextPeriod returns the start of the period following the one starting at start.
+func NextPeriod(start time.Time, period string) time.Time {
+	return AddPeriods(start, period, 1)
+}
+
+// AddPeriods moves t by n periods.
+func AddPeriods(t time.Time, period string, n int) time.Time {
+	switch period {
+	case "week":
+		return t.AddDate(0, 0, 7*n)
+	case "month":
+		return t.AddDate(0, n, 0)
+	case "year":
+		return t.AddDate(n, 0, 0)
+	default:
+		return t.AddDate(0, 0, n)
+	}
+}
+
+// Streaks computes current and longest streaks over consecutive periods in
+// chronological order, the last one being the current period.
+func Streaks(periods []GoalPeriod) (current, longest int, atRisk bool) {
+	run := 0
+	for _, p := range periods {
+		if p.Met {
+			run++
+			if run > longest {
+				longest = run
+			}
+		} else {
+			run = 0
+		}
+	}
+	if len(periods) == 0 {
+		return 0, 0, false
+	}
+	last := len(periods) - 1
+	if periods[last].Met {
+		return run, longest, false
+	}
+	for i := last - 1; i >= 0 && periods[i].Met; i-- {
+		current++
+	}
+	return current, longest, current > 0
+}
@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"focuz-api/pkg/query"
+	"time"
+)
 
 type Note struct {
 	ID          int            `json:"id"`
@@ -48,4 +51,6 @@ type NoteFilters struct {
 	SortOrder   string     `json:"sortOrder"`
 	DateFrom    *time.Time `json:"dateFrom"`
 	DateTo      *time.Time `json:"dateTo"`
+	// Query is the parsed q= expression; nil when not provided.
+	Query query.Expr `json:"-"`
 }
@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// TrendFit describes the trend fitted to a series (trend=): Slope is its
+// change per period, null when too few periods have data.
+type TrendFit struct {
+	Method string   `json:"method"`
+	Slope  *float64 `json:"slope"`
+}
+
+// ForecastValue is a forecast value with its 95% prediction interval.
+type ForecastValue struct {
+	Value float64 `json:"value"`
+	Lower float64 `json:"lower"`
+	Upper float64 `json:"upper"`
+}
+
+// AnalysisForecast is a forecast period of an activity analysis.
+type AnalysisForecast struct {
+	Period string `json:"period"`
+	ForecastValue
+}
+
+// AnalysisTrend is an activity analysis with a trend or forecast: each period
+// holds trend, the fitted value, next to its value when a trend is asked for,
+// and Forecast holds the periods after the last one.
+type AnalysisTrend struct {
+	Periods  []map[string]any   `json:"periods"`
+	Trend    *TrendFit          `json:"trend,omitempty"`
+	Forecast []AnalysisForecast `json:"forecast,omitempty"`
+}
+
+// ChartForecast is a forecast bucket of a chart, with a value per series,
+// null for series that cannot be forecast.
+type ChartForecast struct {
+	Date   time.Time        `json:"date"`
+	Values []*ForecastValue `json:"values"`
+}
+
+// ChartTrend is the data of a line or bar chart with a trend or forecast per
+// series: points carry the fitted values in Trend, Trends describes the fit
+// of each series and Forecast holds the buckets after the last one.
+type ChartTrend struct {
+	Points   []ChartDataPoint `json:"points"`
+	Trends   []TrendFit       `json:"trends,omitempty"`
+	Forecast []ChartForecast  `json:"forecast,omitempty"`
+}
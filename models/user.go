@@ -8,3 +8,28 @@ type User struct {
 	PasswordHash string    `json:"-"`
 	CreatedAt    time.Time `json:"createdAt"`
 }
+
+// UserSettings are per-user preferences. Timezone is the IANA zone analysis
+// periods are cut in and WeekStart is "monday" or "sunday".
+type UserSettings struct {
+	Timezone  string `json:"timezone"`
+	WeekStart string `json:"weekStart"`
+}
+
+var DefaultUserSettings = UserSettings{Timezone: "UTC", WeekStart: "monday"}
+
+func (s UserSettings) Location() (*time.Location, error) {
+	return time.LoadLocation(s.Timezone)
+}
+
+// WallTime returns the wall clock time of t in loc as a UTC time, the form
+// local activity dates are compared in SQL.
+func WallTime(t time.Time, loc *time.Location) time.Time {
+	l := t.In(loc)
+	return time.Date(l.Year(), l.Month(), l.Day(), l.Hour(), l.Minute(), l.Second(), l.Nanosecond(), time.UTC)
+}
+
+// ZonedTime interprets the wall time w, as scanned from SQL, in loc.
+func ZonedTime(w time.Time, loc *time.Location) time.Time {
+	return time.Date(w.Year(), w.Month(), w.Day(), w.Hour(), w.Minute(), w.Second(), w.Nanosecond(), loc)
+}
@@ -0,0 +1,443 @@
+// Package chartrender draws line and bar charts as SVG or PNG images, for
+// emails and chat embeds where a client cannot run a charting library. Both
+// formats share one layout drawn on a canvas; PNG text uses a fixed 7x13
+// bitmap font, so SVG measures text with the same metrics.
+package chartrender
+
+import (
+	"errors"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Kind string
+
+const (
+	Line Kind = "line"
+	Bar  Kind = "bar"
+)
+
+type Theme string
+
+const (
+	Light Theme = "light"
+	Dark  Theme = "dark"
+)
+
+// Series is one plotted series. Color is #rrggbb, a palette color when empty;
+// Axis is left or right and Unit labels that axis.
+type Series struct {
+	Name  string
+	Color string
+	Axis  string
+	Unit  string
+}
+
+// Point is one bucket with a value per series, nil where a series has none.
+type Point struct {
+	Date   time.Time
+	Values []*float64
+}
+
+// Chart is what is drawn. Period (day, week, month, year) formats the dates
+// on the x axis.
+type Chart struct {
+	Title  string
+	Kind   Kind
+	Period string
+	Series []Series
+	Points []Point
+}
+
+type Options struct {
+	Width  int
+	Height int
+	Theme  Theme
+}
+
+// Image size bounds, in pixels.
+const (
+	MinWidth  = 200
+	MaxWidth  = 2000
+	MinHeight = 150
+	MaxHeight = 1200
+)
+
+var (
+	ErrSize  = errors.New("width must be 200 to 2000 and height 150 to 1200")
+	ErrTheme = errors.New("theme must be light or dark")
+	ErrKind  = errors.New("only line and bar charts can be rendered")
+)
+
+// Validate checks the size and theme.
+func (o Options) Validate() error {
+	if o.Width < MinWidth || o.Width > MaxWidth || o.Height < MinHeight || o.Height > MaxHeight {
+		return ErrSize
+	}
+	if o.Theme != Light && o.Theme != Dark {
+		return ErrTheme
+	}
+	return nil
+}
+
+// Font metrics of the 7x13 face, in pixels.
+const (
+	charWidth  = 7
+	lineHeight = 13
+	ascent     = 11
+)
+
+func textWidth(s string) float64 {
+	return float64(len([]rune(s)) * charWidth)
+}
+
+type anchor int
+
+const (
+	anchorStart anchor = iota
+	anchorMiddle
+	anchorEnd
+)
+
+// canvas is drawn on in pixels from the top left corner. Text is placed by
+// its baseline.
+type canvas interface {
+	rect(x, y, w, h float64, c color.RGBA)
+	line(x1, y1, x2, y2, width float64, c color.RGBA)
+	polyline(points [][2]float64, width float64, c color.RGBA)
+	dot(x, y, r float64, c color.RGBA)
+	text(x, y float64, s string, a anchor, c color.RGBA)
+}
+
+type theme struct {
+	background, text, muted, grid, axis color.RGBA
+}
+
+var themes = map[Theme]theme{
+	Light: {
+		background: rgb(0xffffff),
+		text:       rgb(0x333333),
+		muted:      rgb(0x777777),
+		grid:       rgb(0xe6e6e6),
+		axis:       rgb(0x999999),
+	},
+	Dark: {
+		background: rgb(0x1e1e1e),
+		text:       rgb(0xdddddd),
+		muted:      rgb(0x999999),
+		grid:       rgb(0x363636),
+		axis:       rgb(0x6b6b6b),
+	},
+}
+
+// palette colors series without a color of their own.
+var palette = []uint32{0x4e79a7, 0xf28e2b, 0xe15759, 0x76b7b2, 0x59a14f, 0xedc948, 0xb07aa1, 0xff9da7}
+
+func rgb(v uint32) color.RGBA {
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}
+}
+
+func seriesColor(s Series, i int) color.RGBA {
+	if len(s.Color) == 7 && s.Color[0] == '#' {
+		if v, err := strconv.ParseUint(s.Color[1:], 16, 32); err == nil {
+			return rgb(uint32(v))
+		}
+	}
+	return rgb(palette[i%len(palette)])
+}
+
+const (
+	padding   = 12
+	tickSize  = 4
+	yTicks    = 5
+	lineWidth = 2
+)
+
+// axisScale maps values of one y axis to pixels.
+type axisScale struct {
+	used         bool
+	unit         string
+	includesZero bool
+	// the extremes of the values on the axis, if it has any
+	hasValues     bool
+	lowest, upper float64
+	// ticks from min to max every step, and the width of their labels
+	min, max, step float64
+	labels         []string
+	width          float64
+	top, bottom    float64
+}
+
+func (s *axisScale) y(v float64) float64 {
+	return s.bottom - (v-s.min)/(s.max-s.min)*(s.bottom-s.top)
+}
+
+// fit picks round tick values covering the values of the axis.
+func (s *axisScale) fit() {
+	lo, hi := s.lowest, s.upper
+	if !s.hasValues {
+		lo, hi = 0, 1
+	}
+	if s.includesZero {
+		lo, hi = math.Min(lo, 0), math.Max(hi, 0)
+	}
+	if lo == hi {
+		if lo == 0 {
+			hi = 1
+		} else {
+			lo, hi = lo-math.Abs(lo)/2, hi+math.Abs(hi)/2
+		}
+	}
+	s.step = niceStep((hi - lo) / yTicks)
+	s.min = math.Floor(lo/s.step) * s.step
+	s.max = math.Ceil(hi/s.step) * s.step
+	s.labels = nil
+	for v := s.min; v <= s.max+s.step/2; v += s.step {
+		s.labels = append(s.labels, formatValue(v, s.step))
+	}
+	for _, l := range append(s.labels, s.unit) {
+		s.width = math.Max(s.width, textWidth(l))
+	}
+}
+
+// niceStep rounds a raw tick step up to 1, 2 or 5 times a power of ten.
+func niceStep(raw float64) float64 {
+	p := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if raw <= m*p {
+			return m * p
+		}
+	}
+	return 10 * p
+}
+
+// formatValue prints a tick value with the decimals its step needs, with k
+// and M suffixes for large values.
+func formatValue(v, step float64) string {
+	if math.Abs(v) < step/1e6 {
+		v = 0
+	}
+	switch a := math.Abs(v); {
+	case a >= 1e6 && step >= 1e5:
+		return formatValue(v/1e6, step/1e6) + "M"
+	case a >= 1e4 && step >= 1e3:
+		return formatValue(v/1e3, step/1e3) + "k"
+	}
+	decimals := 0
+	if step < 1 {
+		decimals = int(math.Ceil(-math.Log10(step)))
+	}
+	return strconv.FormatFloat(v, 'f', decimals, 64)
+}
+
+func formatDate(t time.Time, period string) string {
+	switch period {
+	case "month":
+		return t.Format("Jan 2006")
+	case "year":
+		return t.Format("2006")
+	}
+	return t.Format("Jan 2")
+}
+
+// truncate shortens s to at most width pixels.
+func truncate(s string, width float64) string {
+	r := []rune(s)
+	max := int(width / charWidth)
+	if len(r) <= max {
+		return s
+	}
+	if max <= 1 {
+		return ""
+	}
+	return string(r[:max-1]) + "…"
+}
+
+// layout lays out and draws the chart on cv.
+func layout(cv canvas, ch Chart, o Options) {
+	th := themes[o.Theme]
+	w, h := float64(o.Width), float64(o.Height)
+	cv.rect(0, 0, w, h, th.background)
+
+	top := float64(padding)
+	if ch.Title != "" {
+		cv.text(padding, top+ascent, truncate(ch.Title, w-2*padding), anchorStart, th.text)
+		top += lineHeight + 6
+	}
+	if len(ch.Series) > 1 {
+		x := float64(padding)
+		for i, s := range ch.Series {
+			label := truncate(s.Name, w-x-padding-16)
+			if label == "" {
+				break
+			}
+			cv.rect(x, top+2, 10, 10, seriesColor(s, i))
+			cv.text(x+14, top+ascent, label, anchorStart, th.text)
+			x += 14 + textWidth(label) + 12
+		}
+		top += lineHeight + 6
+	}
+
+	// Each axis scales to the values of its series
+	left, right := &axisScale{includesZero: ch.Kind == Bar}, &axisScale{includesZero: ch.Kind == Bar}
+	axes := make([]*axisScale, len(ch.Series))
+	// Right-axis series are drawn on the left when no series is there
+	anyLeft := false
+	for _, s := range ch.Series {
+		anyLeft = anyLeft || s.Axis != "right"
+	}
+	for i, s := range ch.Series {
+		ax := left
+		if s.Axis == "right" && anyLeft {
+			ax = right
+		}
+		axes[i] = ax
+		if !ax.used {
+			ax.used, ax.unit = true, s.Unit
+		} else if ax.unit != s.Unit {
+			ax.unit = ""
+		}
+		for _, p := range ch.Points {
+			if i >= len(p.Values) || p.Values[i] == nil {
+				continue
+			}
+			v := *p.Values[i]
+			if !ax.hasValues {
+				ax.lowest, ax.upper, ax.hasValues = v, v, true
+			}
+			ax.lowest, ax.upper = math.Min(ax.lowest, v), math.Max(ax.upper, v)
+		}
+	}
+	left.used = true
+	for _, ax := range []*axisScale{left, right} {
+		if ax.used {
+			ax.fit()
+		}
+	}
+
+	// The units sit above the axes
+	if left.unit != "" || right.unit != "" {
+		top += lineHeight + 4
+	}
+	plotLeft := padding + left.width + tickSize + 4
+	plotRight := w - padding
+	if right.used {
+		plotRight -= right.width + tickSize + 4
+	}
+	plotTop, plotBottom := top+ascent/2, h-padding-lineHeight-tickSize-2
+	if plotRight-plotLeft < 20 || plotBottom-plotTop < 20 {
+		return
+	}
+	left.top, left.bottom = plotTop, plotBottom
+	right.top, right.bottom = plotTop, plotBottom
+	if left.unit != "" {
+		cv.text(padding, top-4, left.unit, anchorStart, th.muted)
+	}
+	if right.used && right.unit != "" {
+		cv.text(w-padding, top-4, right.unit, anchorEnd, th.muted)
+	}
+
+	// Grid lines follow the left axis; the right axis only has ticks
+	for i, label := range left.labels {
+		y := math.Round(left.y(left.min+float64(i)*left.step)) + 0.5
+		cv.line(plotLeft, y, plotRight, y, 1, th.grid)
+		cv.text(plotLeft-tickSize-4, y+4, label, anchorEnd, th.muted)
+	}
+	if right.used {
+		for i, label := range right.labels {
+			y := math.Round(right.y(right.min+float64(i)*right.step)) + 0.5
+			cv.line(plotRight, y, plotRight+tickSize, y, 1, th.axis)
+			cv.text(plotRight+tickSize+4, y+4, label, anchorStart, th.muted)
+		}
+	}
+	cv.line(plotLeft, plotBottom+0.5, plotRight, plotBottom+0.5, 1, th.axis)
+
+	n := len(ch.Points)
+	if n == 0 || !(left.hasValues || right.hasValues) {
+		cv.text((plotLeft+plotRight)/2, (plotTop+plotBottom)/2+4, "No data", anchorMiddle, th.muted)
+		return
+	}
+	band := (plotRight - plotLeft) / float64(n)
+	center := func(i int) float64 { return plotLeft + band*(float64(i)+0.5) }
+
+	// Date labels skip buckets so that they do not overlap
+	labelWidth := textWidth(formatDate(ch.Points[0].Date, ch.Period)) + 12
+	every := int(math.Ceil(labelWidth / band))
+	for i := 0; i < n; i += every {
+		x := center(i)
+		cv.line(x, plotBottom, x, plotBottom+tickSize, 1, th.axis)
+		cv.text(x, plotBottom+tickSize+2+ascent, formatDate(ch.Points[i].Date, ch.Period), anchorMiddle, th.muted)
+	}
+
+	switch ch.Kind {
+	case Bar:
+		group := band * 0.8
+		bar := group / float64(len(ch.Series))
+		for s := range ch.Series {
+			ax, c := axes[s], seriesColor(ch.Series[s], s)
+			zero := ax.y(math.Max(ax.min, math.Min(ax.max, 0)))
+			for i, p := range ch.Points {
+				if s >= len(p.Values) || p.Values[s] == nil {
+					continue
+				}
+				x := center(i) - group/2 + float64(s)*bar
+				y := ax.y(*p.Values[s])
+				cv.rect(x, math.Min(y, zero), math.Max(bar-1, 1), math.Abs(zero-y), c)
+			}
+		}
+	default:
+		// Lines break at buckets without a value; lone values become dots
+		for s := range ch.Series {
+			ax, c := axes[s], seriesColor(ch.Series[s], s)
+			var run [][2]float64
+			flush := func() {
+				if len(run) == 1 {
+					cv.dot(run[0][0], run[0][1], lineWidth+1, c)
+				} else if len(run) > 1 {
+					cv.polyline(run, lineWidth, c)
+				}
+				run = nil
+			}
+			for i, p := range ch.Points {
+				if s >= len(p.Values) || p.Values[s] == nil {
+					flush()
+					continue
+				}
+				run = append(run, [2]float64{center(i), ax.y(*p.Values[s])})
+			}
+			flush()
+		}
+	}
+}
+
+// Render checks the chart and options and draws the chart on cv.
+func render(cv canvas, ch Chart, o Options) error {
+	if ch.Kind != Line && ch.Kind != Bar {
+		return ErrKind
+	}
+	if err := o.Validate(); err != nil {
+		return err
+	}
+	ch.Title = singleLine(ch.Title)
+	series := make([]Series, len(ch.Series))
+	for i, s := range ch.Series {
+		s.Name, s.Unit = singleLine(s.Name), singleLine(s.Unit)
+		series[i] = s
+	}
+	ch.Series = series
+	layout(cv, ch, o)
+	return nil
+}
+
+// singleLine replaces control characters with spaces.
+func singleLine(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < ' ' || r == 0x7f {
+			return ' '
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,241 @@
+package chartrender
+
+import (
+	"bytes"
+	"encoding/xml"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func f(v float64) *float64 { return &v }
+
+func days(values ...[]*float64) []Point {
+	start := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	points := make([]Point, len(values))
+	for i, v := range values {
+		points[i] = Point{Date: start.AddDate(0, 0, i), Values: v}
+	}
+	return points
+}
+
+var testCharts = map[string]Chart{
+	"no points": {Title: "Empty", Period: "day", Series: []Series{{Name: "Steps"}}},
+	"no series": {Period: "day", Points: days(nil, nil)},
+	"all nil":   {Period: "day", Series: []Series{{Name: "Steps"}}, Points: days([]*float64{nil}, []*float64{nil})},
+	"one point": {Period: "day", Series: []Series{{Name: "Steps"}}, Points: days([]*float64{f(42)})},
+	"zero only": {Period: "day", Series: []Series{{Name: "Steps"}}, Points: days([]*float64{f(0)}, []*float64{f(0)})},
+	"constant":  {Period: "month", Series: []Series{{Name: "Weight", Unit: "kg"}}, Points: days([]*float64{f(-3.5)}, []*float64{f(-3.5)}, []*float64{f(-3.5)})},
+	"gaps": {Period: "day", Series: []Series{{Name: "Sleep", Color: "#123456"}}, Points: days(
+		[]*float64{f(7)}, []*float64{nil}, []*float64{f(6.5)}, []*float64{f(8)}, []*float64{nil}, []*float64{f(5)},
+	)},
+	"two axes": {Title: `Mood & <sleep> "weekly"`, Period: "week", Series: []Series{
+		{Name: "Mood", Axis: "left", Unit: "pts"},
+		{Name: "Sleep\nhours", Axis: "right", Unit: "h"},
+	}, Points: days(
+		[]*float64{f(3), f(7.5)}, []*float64{f(-2), nil}, []*float64{f(4)}, []*float64{nil, f(12000)},
+	)},
+	"large values": {Period: "year", Series: []Series{{Name: "Steps"}, {Name: "Bad color", Color: "#zzzzzz"}}, Points: days(
+		[]*float64{f(2.5e6), f(1e-7)}, []*float64{f(4e6), f(3e-7)},
+	)},
+}
+
+func sizes() []Options {
+	return []Options{
+		{Width: MinWidth, Height: MinHeight, Theme: Light},
+		{Width: 640, Height: 360, Theme: Dark},
+		{Width: MaxWidth, Height: MaxHeight, Theme: Light},
+	}
+}
+
+func TestSVGIsWellFormed(t *testing.T) {
+	for name, ch := range testCharts {
+		for _, kind := range []Kind{Line, Bar} {
+			for _, o := range sizes() {
+				ch.Kind = kind
+				out, err := SVG(ch, o)
+				if err != nil {
+					t.Fatalf("%s %s %dx%d: %v", name, kind, o.Width, o.Height, err)
+				}
+				checkXML(t, name, out)
+				if s := string(out); strings.Contains(s, "NaN") || strings.Contains(s, "Inf") {
+					t.Errorf("%s %s %dx%d: non-finite coordinates in %s", name, kind, o.Width, o.Height, s)
+				}
+			}
+		}
+	}
+}
+
+func checkXML(t *testing.T, name string, out []byte) {
+	t.Helper()
+	d := xml.NewDecoder(bytes.NewReader(out))
+	root := ""
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("%s: invalid SVG: %v\n%s", name, err, out)
+		}
+		if el, ok := tok.(xml.StartElement); ok && root == "" {
+			root = el.Name.Local
+		}
+	}
+	if root != "svg" {
+		t.Errorf("%s: root element %q, want svg", name, root)
+	}
+}
+
+func TestSVGContent(t *testing.T) {
+	o := Options{Width: 640, Height: 360, Theme: Light}
+
+	ch := testCharts["one point"]
+	ch.Kind = Line
+	out, _ := SVG(ch, o)
+	if !bytes.Contains(out, []byte("<circle")) || bytes.Contains(out, []byte("<polyline")) {
+		t.Errorf("a single value is not drawn as a dot:\n%s", out)
+	}
+
+	ch = testCharts["gaps"]
+	ch.Kind = Line
+	out, _ = SVG(ch, o)
+	// 7 | gap | 6.5, 8 | gap | 5: one line and two dots
+	if n := bytes.Count(out, []byte("<polyline")); n != 1 {
+		t.Errorf("gaps: %d polylines, want 1", n)
+	}
+	if n := bytes.Count(out, []byte(`fill="#123456"`)); n != 2 {
+		t.Errorf("gaps: %d dots, want 2", n)
+	}
+
+	ch = testCharts["no points"]
+	ch.Kind = Bar
+	out, _ = SVG(ch, o)
+	if !bytes.Contains(out, []byte("No data")) {
+		t.Errorf("an empty chart does not say so:\n%s", out)
+	}
+
+	ch = testCharts["two axes"]
+	ch.Kind = Bar
+	out, _ = SVG(ch, o)
+	if !bytes.Contains(out, []byte("Mood &amp; &lt;sleep&gt;")) {
+		t.Errorf("title is not escaped:\n%s", out)
+	}
+	if !bytes.Contains(out, []byte(`width="640" height="360"`)) {
+		t.Errorf("size is not set:\n%s", out)
+	}
+}
+
+func TestPNGDecodes(t *testing.T) {
+	for name, ch := range testCharts {
+		for _, kind := range []Kind{Line, Bar} {
+			for _, o := range sizes() {
+				ch.Kind = kind
+				out, err := PNG(ch, o)
+				if err != nil {
+					t.Fatalf("%s %s %dx%d: %v", name, kind, o.Width, o.Height, err)
+				}
+				img, err := png.Decode(bytes.NewReader(out))
+				if err != nil {
+					t.Fatalf("%s %s %dx%d: invalid PNG: %v", name, kind, o.Width, o.Height, err)
+				}
+				if b := img.Bounds(); b != image.Rect(0, 0, o.Width, o.Height) {
+					t.Errorf("%s %s: bounds %v, want %dx%d", name, kind, b, o.Width, o.Height)
+				}
+				// The corner is never drawn over, so it shows the theme
+				want := themes[o.Theme].background
+				if got := color.RGBAModel.Convert(img.At(0, 0)).(color.RGBA); got != want {
+					t.Errorf("%s %s %s: background %v, want %v", name, kind, o.Theme, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	ch := testCharts["one point"]
+	ch.Kind = Line
+	tests := []struct {
+		kind Kind
+		o    Options
+		want error
+	}{
+		{Line, Options{Width: MinWidth - 1, Height: 300, Theme: Light}, ErrSize},
+		{Line, Options{Width: 400, Height: MaxHeight + 1, Theme: Light}, ErrSize},
+		{Line, Options{Width: 400, Height: 300}, ErrTheme},
+		{Line, Options{Width: 400, Height: 300, Theme: "sepia"}, ErrTheme},
+		{"pie", Options{Width: 400, Height: 300, Theme: Light}, ErrKind},
+	}
+	for _, tt := range tests {
+		ch.Kind = tt.kind
+		if _, err := SVG(ch, tt.o); err != tt.want {
+			t.Errorf("SVG(%s, %+v) error = %v, want %v", tt.kind, tt.o, err, tt.want)
+		}
+		if _, err := PNG(ch, tt.o); err != tt.want {
+			t.Errorf("PNG(%s, %+v) error = %v, want %v", tt.kind, tt.o, err, tt.want)
+		}
+	}
+}
+
+func TestNiceStep(t *testing.T) {
+	tests := []struct{ raw, want float64 }{
+		{0.7, 1},
+		{1, 1},
+		{1.2, 2},
+		{3, 5},
+		{7, 10},
+		{18, 20},
+		{0.03, 0.05},
+		{450, 500},
+	}
+	for _, tt := range tests {
+		if got := niceStep(tt.raw); got != tt.want {
+			t.Errorf("niceStep(%v) = %v, want %v", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	tests := []struct {
+		v, step float64
+		want    string
+	}{
+		{0, 1, "0"},
+		{5, 1, "5"},
+		{0.5, 0.1, "0.5"},
+		{0.25, 0.05, "0.25"},
+		{1e-9, 0.5, "0.0"},
+		{-20, 10, "-20"},
+		{20000, 5000, "20k"},
+		{2500000, 500000, "2.5M"},
+		{12000, 100, "12000"},
+	}
+	for _, tt := range tests {
+		if got := formatValue(tt.v, tt.step); got != tt.want {
+			t.Errorf("formatValue(%v, %v) = %q, want %q", tt.v, tt.step, got, tt.want)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		s     string
+		width float64
+		want  string
+	}{
+		{"Steps", 100, "Steps"},
+		{"Steps", 35, "Steps"},
+		{"Steps", 34, "Ste…"},
+		{"Steps", 13, ""},
+		{"Шаги в день", 28, "Шаг…"},
+	}
+	for _, tt := range tests {
+		if got := truncate(tt.s, tt.width); got != tt.want {
+			t.Errorf("truncate(%q, %v) = %q, want %q", tt.s, tt.width, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package chartrender
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+)
+
+// PNG renders the chart as a PNG image. Characters the bitmap font lacks are
+// drawn as "?".
+func PNG(ch Chart, o Options) ([]byte, error) {
+	cv := &pngCanvas{img: image.NewRGBA(image.Rect(0, 0, o.Width, o.Height))}
+	if err := render(cv, ch, o); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, cv.img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type pngCanvas struct {
+	img *image.RGBA
+	ras *vector.Rasterizer
+}
+
+func (cv *pngCanvas) rect(x, y, w, h float64, c color.RGBA) {
+	x0, y0 := int(math.Round(x)), int(math.Round(y))
+	x1, y1 := int(math.Round(x+w)), int(math.Round(y+h))
+	// Thin shapes keep at least one pixel
+	if x1 == x0 && w > 0 {
+		x1++
+	}
+	if y1 == y0 && h > 0 {
+		y1++
+	}
+	draw.Draw(cv.img, image.Rect(x0, y0, x1, y1), image.NewUniform(c), image.Point{}, draw.Over)
+}
+
+func (cv *pngCanvas) line(x1, y1, x2, y2, width float64, c color.RGBA) {
+	switch {
+	case y1 == y2:
+		cv.rect(math.Min(x1, x2), y1-width/2, math.Abs(x2-x1), width, c)
+	case x1 == x2:
+		cv.rect(x1-width/2, math.Min(y1, y2), width, math.Abs(y2-y1), c)
+	default:
+		cv.polyline([][2]float64{{x1, y1}, {x2, y2}}, width, c)
+	}
+}
+
+// The rasterizer fills the union of shapes that wind the same way, so every
+// segment and joint is added clockwise and drawn in one pass.
+
+func (cv *pngCanvas) rasterizer() *vector.Rasterizer {
+	b := cv.img.Bounds()
+	if cv.ras == nil {
+		cv.ras = vector.NewRasterizer(b.Dx(), b.Dy())
+	} else {
+		cv.ras.Reset(b.Dx(), b.Dy())
+	}
+	return cv.ras
+}
+
+func (cv *pngCanvas) fill(ras *vector.Rasterizer, c color.RGBA) {
+	ras.Draw(cv.img, cv.img.Bounds(), image.NewUniform(c), image.Point{})
+}
+
+func addDisc(ras *vector.Rasterizer, x, y, r float64) {
+	const steps = 16
+	for i := 0; i <= steps; i++ {
+		a := -2 * math.Pi * float64(i) / steps
+		px, py := float32(x+r*math.Cos(a)), float32(y+r*math.Sin(a))
+		if i == 0 {
+			ras.MoveTo(px, py)
+		} else {
+			ras.LineTo(px, py)
+		}
+	}
+	ras.ClosePath()
+}
+
+func (cv *pngCanvas) polyline(points [][2]float64, width float64, c color.RGBA) {
+	ras := cv.rasterizer()
+	hw := width / 2
+	for i := 1; i < len(points); i++ {
+		p, q := points[i-1], points[i]
+		dx, dy := q[0]-p[0], q[1]-p[1]
+		l := math.Hypot(dx, dy)
+		if l == 0 {
+			continue
+		}
+		nx, ny := -dy/l*hw, dx/l*hw
+		ras.MoveTo(float32(p[0]+nx), float32(p[1]+ny))
+		ras.LineTo(float32(q[0]+nx), float32(q[1]+ny))
+		ras.LineTo(float32(q[0]-nx), float32(q[1]-ny))
+		ras.LineTo(float32(p[0]-nx), float32(p[1]-ny))
+		ras.ClosePath()
+	}
+	for _, p := range points {
+		addDisc(ras, p[0], p[1], hw)
+	}
+	cv.fill(ras, c)
+}
+
+func (cv *pngCanvas) dot(x, y, r float64, c color.RGBA) {
+	ras := cv.rasterizer()
+	addDisc(ras, x, y, r)
+	cv.fill(ras, c)
+}
+
+func (cv *pngCanvas) text(x, y float64, s string, a anchor, c color.RGBA) {
+	face := basicfont.Face7x13
+	runes := []rune(s)
+	for i, r := range runes {
+		if _, ok := face.GlyphAdvance(r); !ok {
+			runes[i] = '?'
+		}
+	}
+	s = string(runes)
+	switch a {
+	case anchorMiddle:
+		x -= textWidth(s) / 2
+	case anchorEnd:
+		x -= textWidth(s)
+	}
+	d := font.Drawer{
+		Dst:  cv.img,
+		Src:  image.NewUniform(c),
+		Face: face,
+		Dot:  fixed.P(int(math.Round(x)), int(math.Round(y))),
+	}
+	d.DrawString(s)
+}
@@ -0,0 +1,64 @@
+package chartrender
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image/color"
+	"strconv"
+)
+
+// SVG renders the chart as an SVG document.
+func SVG(ch Chart, o Options) ([]byte, error) {
+	cv := &svgCanvas{}
+	fmt.Fprintf(&cv.buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="DejaVu Sans Mono, Menlo, Consolas, monospace" font-size="12">`,
+		o.Width, o.Height, o.Width, o.Height)
+	if err := render(cv, ch, o); err != nil {
+		return nil, err
+	}
+	cv.buf.WriteString("</svg>\n")
+	return cv.buf.Bytes(), nil
+}
+
+type svgCanvas struct {
+	buf bytes.Buffer
+}
+
+func num(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 32)
+}
+
+func hex(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+func (cv *svgCanvas) rect(x, y, w, h float64, c color.RGBA) {
+	fmt.Fprintf(&cv.buf, `<rect x="%s" y="%s" width="%s" height="%s" fill="%s"/>`, num(x), num(y), num(w), num(h), hex(c))
+}
+
+func (cv *svgCanvas) line(x1, y1, x2, y2, width float64, c color.RGBA) {
+	fmt.Fprintf(&cv.buf, `<line x1="%s" y1="%s" x2="%s" y2="%s" stroke="%s" stroke-width="%s"/>`,
+		num(x1), num(y1), num(x2), num(y2), hex(c), num(width))
+}
+
+func (cv *svgCanvas) polyline(points [][2]float64, width float64, c color.RGBA) {
+	cv.buf.WriteString(`<polyline points="`)
+	for i, p := range points {
+		if i > 0 {
+			cv.buf.WriteByte(' ')
+		}
+		cv.buf.WriteString(num(p[0]) + "," + num(p[1]))
+	}
+	fmt.Fprintf(&cv.buf, `" fill="none" stroke="%s" stroke-width="%s" stroke-linejoin="round" stroke-linecap="round"/>`, hex(c), num(width))
+}
+
+func (cv *svgCanvas) dot(x, y, r float64, c color.RGBA) {
+	fmt.Fprintf(&cv.buf, `<circle cx="%s" cy="%s" r="%s" fill="%s"/>`, num(x), num(y), num(r), hex(c))
+}
+
+func (cv *svgCanvas) text(x, y float64, s string, a anchor, c color.RGBA) {
+	anchors := [...]string{"start", "middle", "end"}
+	fmt.Fprintf(&cv.buf, `<text x="%s" y="%s" text-anchor="%s" fill="%s">`, num(x), num(y), anchors[a], hex(c))
+	xml.EscapeText(&cv.buf, []byte(s))
+	cv.buf.WriteString("</text>")
+}
@@ -13,3 +13,31 @@ type InvitationCreated struct {
 type SyncPushed struct {
 	Type string `json:"type"`
 }
+
+// FilterCountsUpdated carries fresh saved filter counts for one space.
+// It is sent only when a user's counts actually changed.
+type FilterCountsUpdated struct {
+	Type    string      `json:"type"`
+	SpaceID int         `json:"spaceId"`
+	Counts  interface{} `json:"counts"`
+}
+
+// GoalReached is sent once per period when a goal's current period is met.
+type GoalReached struct {
+	Type    string  `json:"type"`
+	GoalID  int     `json:"goalId"`
+	SpaceID int     `json:"spaceId"`
+	Period  string  `json:"period"`
+	Value   float64 `json:"value"`
+	Streak  int     `json:"streak"`
+}
+
+// GoalStreakAtRisk is sent once per period when a running streak breaks
+// unless the current, mostly elapsed period is met.
+type GoalStreakAtRisk struct {
+	Type    string `json:"type"`
+	GoalID  int    `json:"goalId"`
+	SpaceID int    `json:"spaceId"`
+	Period  string `json:"period"`
+	Streak  int    `json:"streak"`
+}
@@ -0,0 +1,168 @@
+package fracindex
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"V", true},
+		{"a0V", true},
+		{"z", true},
+		{"", false},
+		{"0", false},
+		{"a0", false},
+		{"a-b", false},
+		{"a b", false},
+		{strings.Repeat("V", MaxLength), true},
+		{strings.Repeat("V", MaxLength+1), false},
+	}
+	for _, tt := range tests {
+		if got := Valid(tt.key); got != tt.want {
+			t.Errorf("Valid(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestBetween(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want string
+	}{
+		{"", "", "V"},
+		// Appends step the first digit that can grow
+		{"V", "", "W"},
+		{"y", "", "z"},
+		{"z", "", "zV"},
+		{"zz", "", "zzV"},
+		{"zy", "", "zz"},
+		{"Vz", "", "W"},
+		// Prepends mirror them
+		{"", "V", "U"},
+		{"", "2", "1"},
+		{"", "1", "0V"},
+		{"", "01", "00V"},
+		{"", "0V", "0U"},
+		// Midpoints
+		{"A", "a", "N"},
+		{"a", "c", "b"},
+		{"a", "b", "aV"},
+		{"a", "aV", "aF"},
+		{"aV", "b", "ak"},
+		{"a1", "a2", "a1V"},
+		{"y", "z", "yV"},
+		{"z", "zV", "zF"},
+		{"zy", "zz", "zyV"},
+		{"a", "b1", "b"},
+		{"a", "a01", "a00V"},
+		{"1", "2", "1V"},
+	}
+	for _, tt := range tests {
+		got, err := Between(tt.a, tt.b)
+		if err != nil {
+			t.Errorf("Between(%q, %q): %v", tt.a, tt.b, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Between(%q, %q) = %q, want %q", tt.a, tt.b, got, tt.want)
+		}
+		checkBetween(t, tt.a, tt.b, got)
+	}
+}
+
+func TestBetweenErrors(t *testing.T) {
+	tests := []struct{ a, b string }{
+		{"b", "a"},
+		{"a", "a"},
+		{"a0", ""},
+		{"", "a0"},
+		{"a!", ""},
+		{"", "0"},
+	}
+	for _, tt := range tests {
+		if got, err := Between(tt.a, tt.b); err == nil {
+			t.Errorf("Between(%q, %q) = %q, want an error", tt.a, tt.b, got)
+		}
+	}
+}
+
+// checkBetween asserts that key is a valid key strictly between a and b.
+func checkBetween(t *testing.T, a, b, key string) {
+	t.Helper()
+	if !Valid(key) {
+		t.Errorf("Between(%q, %q) = %q is not a valid key", a, b, key)
+	}
+	if a != "" && key <= a || b != "" && key >= b {
+		t.Errorf("Between(%q, %q) = %q is not between them", a, b, key)
+	}
+}
+
+// TestBetweenRandomInserts inserts keys at random spots, ends included, and
+// checks every new key against its neighbours and the list order.
+func TestBetweenRandomInserts(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	keys := []string{}
+	for i := 0; i < 2000; i++ {
+		at := rng.Intn(len(keys) + 1)
+		var a, b string
+		if at > 0 {
+			a = keys[at-1]
+		}
+		if at < len(keys) {
+			b = keys[at]
+		}
+		key, err := Between(a, b)
+		if err != nil {
+			t.Fatalf("Between(%q, %q): %v", a, b, err)
+		}
+		checkBetween(t, a, b, key)
+		keys = append(keys[:at], append([]string{key}, keys[at:]...)...)
+	}
+	if !sort.StringsAreSorted(keys) {
+		t.Error("keys are not in insertion order")
+	}
+}
+
+// TestBetweenRepeatedSpot keeps inserting right after the same key and right
+// before the same key, the worst cases for key growth.
+func TestBetweenRepeatedSpot(t *testing.T) {
+	lo, hi := "a", "b"
+	for i := 0; i < 300; i++ {
+		key, err := Between(lo, hi)
+		if err != nil {
+			t.Fatalf("Between(%q, %q): %v", lo, hi, err)
+		}
+		checkBetween(t, lo, hi, key)
+		if i%2 == 0 {
+			hi = key
+		} else {
+			lo = key
+		}
+	}
+	for _, start := range []string{"V", "z", "1"} {
+		last := start
+		for i := 0; i < 500; i++ {
+			key, err := Between(last, "")
+			if err != nil {
+				t.Fatalf("Between(%q, \"\"): %v", last, err)
+			}
+			checkBetween(t, last, "", key)
+			last = key
+		}
+		first := start
+		for i := 0; i < 500; i++ {
+			key, err := Between("", first)
+			if err != nil {
+				t.Fatalf("Between(\"\", %q): %v", first, err)
+			}
+			checkBetween(t, "", first, key)
+			first = key
+		}
+	}
+}
@@ -12,6 +12,12 @@ type Notifier interface {
 	NotifyUser(userID int, event interface{})
 }
 
+// Presence is implemented by notifiers that know whether a user can receive
+// notifications right now.
+type Presence interface {
+	Connected(userID int) bool
+}
+
 // WSNotifier implements Notifier using a WebSocket Hub.
 type WSNotifier struct {
 	Hub *websocket.Hub
@@ -29,3 +35,8 @@ func (n *WSNotifier) NotifyUser(userID int, event interface{}) {
 	}
 	n.Hub.NotifyUser(userID, payload)
 }
+
+// Connected reports whether the user has an open WebSocket.
+func (n *WSNotifier) Connected(userID int) bool {
+	return n != nil && n.Hub.Connected(userID)
+}
@@ -0,0 +1,99 @@
+// Package query implements the note query language accepted by GET /notes?q=
+// and by saved filter params.
+//
+//	(work OR meeting) AND NOT #draft date>=-7d has:attachment
+//
+// Terms:
+//   - #name or tag:name          note has the tag
+//   - word or "quoted phrase"    note text contains the value (case-insensitive)
+//   - date>=V, date>V, date<=V, date<V, date:V, date:V1..V2
+//     where V is YYYY-MM-DD, today, yesterday or a relative offset like -7d, -2w, -1m, -1y
+//   - has:attachment             note has at least one attachment
+//   - has:activity:<type>        note has a live activity of the named type
+//   - is:reply                   note has a parent
+//
+// Terms are combined with AND, OR and NOT (or a leading "-", also before a
+// group), grouped with parentheses. Adjacent terms are joined with AND, which
+// binds tighter than OR. Bare words are always text: tags need "#" or "tag:".
+package query
+
+import "time"
+
+// Expr is a node of a parsed query.
+type Expr interface {
+	isExpr()
+}
+
+type And struct {
+	Left, Right Expr
+}
+
+type Or struct {
+	Left, Right Expr
+}
+
+type Not struct {
+	X Expr
+}
+
+// Tag matches notes carrying the tag with the exact name.
+type Tag struct {
+	Name string
+}
+
+// Text matches notes whose text contains Value.
+type Text struct {
+	Value string
+}
+
+// DateCmp compares the note date against a day-granular value.
+// Op is one of ">=", ">", "<=", "<", "=".
+type DateCmp struct {
+	Op    string
+	Value DateValue
+}
+
+// DateRange matches notes dated within [From, To], both days inclusive.
+type DateRange struct {
+	From, To DateValue
+}
+
+type HasAttachment struct{}
+
+// HasActivity matches notes with a non-deleted activity of the named type.
+type HasActivity struct {
+	TypeName string
+}
+
+type IsReply struct{}
+
+func (And) isExpr()           {}
+func (Or) isExpr()            {}
+func (Not) isExpr()           {}
+func (Tag) isExpr()           {}
+func (Text) isExpr()          {}
+func (DateCmp) isExpr()       {}
+func (DateRange) isExpr()     {}
+func (HasAttachment) isExpr() {}
+func (HasActivity) isExpr()   {}
+func (IsReply) isExpr()       {}
+
+// DateValue is either an absolute day or an offset from today.
+// Relative values are resolved when the query is compiled so that saved
+// filters such as "date>=-7d" keep moving with time.
+type DateValue struct {
+	Day    time.Time
+	Rel    bool
+	Days   int
+	Months int
+}
+
+// Resolve returns the start of the day the value refers to.
+func (v DateValue) Resolve(now time.Time) time.Time {
+	if !v.Rel {
+		return v.Day
+	}
+	y, m, d := now.Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	return today.AddDate(0, v.Months, v.Days)
+}
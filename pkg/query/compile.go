@@ -0,0 +1,74 @@
+package query
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Compile turns the expression into a parameterized SQL condition over the
+// note table aliased as "n". Placeholders start at $firstIdx and the returned
+// args are in placeholder order. Relative dates are resolved against now.
+func Compile(e Expr, firstIdx int, now time.Time) (string, []interface{}) {
+	c := &compiler{idx: firstIdx, now: now}
+	return c.expr(e), c.args
+}
+
+type compiler struct {
+	idx  int
+	args []interface{}
+	now  time.Time
+}
+
+func (c *compiler) param(v interface{}) string {
+	c.args = append(c.args, v)
+	p := "$" + strconv.Itoa(c.idx)
+	c.idx++
+	return p
+}
+
+func (c *compiler) expr(e Expr) string {
+	switch x := e.(type) {
+	case And:
+		return "(" + c.expr(x.Left) + " AND " + c.expr(x.Right) + ")"
+	case Or:
+		return "(" + c.expr(x.Left) + " OR " + c.expr(x.Right) + ")"
+	case Not:
+		return "NOT (" + c.expr(x.X) + ")"
+	case Tag:
+		return "EXISTS (SELECT 1 FROM note_to_tag qnt JOIN tag qt ON qt.id = qnt.tag_id WHERE qnt.note_id = n.id AND qt.name = " + c.param(x.Name) + ")"
+	case Text:
+		return "n.text ILIKE " + c.param("%"+escapeLike(x.Value)+"%") + " ESCAPE '\\'"
+	case DateCmp:
+		day := x.Value.Resolve(c.now)
+		next := day.AddDate(0, 0, 1)
+		switch x.Op {
+		case ">=":
+			return "n.date >= " + c.param(day)
+		case ">":
+			return "n.date >= " + c.param(next)
+		case "<=":
+			return "n.date < " + c.param(next)
+		case "<":
+			return "n.date < " + c.param(day)
+		default:
+			return "(n.date >= " + c.param(day) + " AND n.date < " + c.param(next) + ")"
+		}
+	case DateRange:
+		from := x.From.Resolve(c.now)
+		to := x.To.Resolve(c.now).AddDate(0, 0, 1)
+		return "(n.date >= " + c.param(from) + " AND n.date < " + c.param(to) + ")"
+	case HasAttachment:
+		return "EXISTS (SELECT 1 FROM attachments qatt WHERE qatt.note_id = n.id)"
+	case HasActivity:
+		return "EXISTS (SELECT 1 FROM activities qa JOIN activity_types qat ON qat.id = qa.type_id WHERE qa.note_id = n.id AND qa.is_deleted = FALSE AND LOWER(qat.name) = LOWER(" + c.param(x.TypeName) + "))"
+	case IsReply:
+		return "n.parent_id IS NOT NULL"
+	}
+	return "TRUE"
+}
+
+func escapeLike(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(s)
+}
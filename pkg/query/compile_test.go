@@ -0,0 +1,50 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCompile(t *testing.T) {
+	now := time.Date(2024, 3, 10, 15, 30, 0, 0, time.UTC)
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.UTC) }
+	const tag = "EXISTS (SELECT 1 FROM note_to_tag qnt JOIN tag qt ON qt.id = qnt.tag_id WHERE qnt.note_id = n.id AND qt.name = "
+	tests := []struct {
+		input string
+		first int
+		want  string
+		args  []interface{}
+	}{
+		{`#work`, 1, tag + "$1)", []interface{}{"work"}},
+		{`coffee`, 4, `n.text ILIKE $4 ESCAPE '\'`, []interface{}{"%coffee%"}},
+		{`"50%_off\"`, 1, `n.text ILIKE $1 ESCAPE '\'`, []interface{}{`%50\%\_off\\%`}},
+		{`#a OR b c`, 2,
+			"(" + tag + "$2) OR (n.text ILIKE $3 ESCAPE '\\' AND n.text ILIKE $4 ESCAPE '\\'))",
+			[]interface{}{"a", "%b%", "%c%"}},
+		{`-(#a OR #b)`, 1, "NOT ((" + tag + "$1) OR " + tag + "$2)))", []interface{}{"a", "b"}},
+		{`date>=-7d`, 1, "n.date >= $1", []interface{}{day(2024, 3, 3)}},
+		{`date>2024-01-31`, 1, "n.date >= $1", []interface{}{day(2024, 2, 1)}},
+		{`date<=yesterday`, 1, "n.date < $1", []interface{}{day(2024, 3, 10)}},
+		{`date<-1m`, 1, "n.date < $1", []interface{}{day(2024, 2, 10)}},
+		{`date:today`, 1, "(n.date >= $1 AND n.date < $2)", []interface{}{day(2024, 3, 10), day(2024, 3, 11)}},
+		{`date:2024-01-01..2024-01-31`, 1, "(n.date >= $1 AND n.date < $2)", []interface{}{day(2024, 1, 1), day(2024, 2, 1)}},
+		{`has:attachment`, 1, "EXISTS (SELECT 1 FROM attachments qatt WHERE qatt.note_id = n.id)", nil},
+		{`has:activity:Run`, 1, "EXISTS (SELECT 1 FROM activities qa JOIN activity_types qat ON qat.id = qa.type_id WHERE qa.note_id = n.id AND qa.is_deleted = FALSE AND LOWER(qat.name) = LOWER($1))", []interface{}{"Run"}},
+		{`is:reply -is:reply`, 1, "(n.parent_id IS NOT NULL AND NOT (n.parent_id IS NOT NULL))", nil},
+	}
+	for _, tt := range tests {
+		e, err := Parse(tt.input)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.input, err)
+			continue
+		}
+		sql, args := Compile(e, tt.first, now)
+		if sql != tt.want {
+			t.Errorf("Compile(%q) = %s, want %s", tt.input, sql, tt.want)
+		}
+		if !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("Compile(%q) args = %v, want %v", tt.input, args, tt.args)
+		}
+	}
+}
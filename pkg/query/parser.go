@@ -0,0 +1,317 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxLength bounds the accepted query size to keep generated SQL small.
+const MaxLength = 1000
+
+type tokenKind int
+
+const (
+	tokWord tokenKind = iota
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind   tokenKind
+	text   string
+	quoted bool
+	// phrase is set when the whole token is a quoted string ("a b")
+	phrase bool
+	pos    int
+}
+
+// Parse parses a query string. Errors are suitable for API clients.
+func Parse(input string) (Expr, error) {
+	if len(input) > MaxLength {
+		return nil, fmt.Errorf("query is too long (max %d characters)", MaxLength)
+	}
+	toks, err := tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+	if len(toks) == 0 {
+		return nil, fmt.Errorf("query is empty")
+	}
+	p := &parser{toks: toks}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.toks) {
+		t := p.toks[p.pos]
+		return nil, fmt.Errorf("unexpected %q at position %d", t.text, t.pos+1)
+	}
+	return e, nil
+}
+
+func tokenize(s string) ([]token, error) {
+	var toks []token
+	i := 0
+	for i < len(s) {
+		ch := s[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			i++
+		case ch == '(':
+			toks = append(toks, token{kind: tokLParen, text: "(", pos: i})
+			i++
+		case ch == ')':
+			toks = append(toks, token{kind: tokRParen, text: ")", pos: i})
+			i++
+		default:
+			start := i
+			var b strings.Builder
+			quoted := false
+			for i < len(s) {
+				c := s[i]
+				if c == '"' {
+					end := strings.IndexByte(s[i+1:], '"')
+					if end < 0 {
+						return nil, fmt.Errorf("unterminated quote at position %d", i+1)
+					}
+					b.WriteString(s[i+1 : i+1+end])
+					i += end + 2
+					quoted = true
+					continue
+				}
+				if c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '(' || c == ')' {
+					break
+				}
+				b.WriteByte(c)
+				i++
+			}
+			toks = append(toks, token{kind: tokWord, text: b.String(), quoted: quoted, phrase: s[start] == '"', pos: start})
+		}
+	}
+	return toks, nil
+}
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) peek() *token {
+	if p.pos < len(p.toks) {
+		return &p.toks[p.pos]
+	}
+	return nil
+}
+
+func (p *parser) isKeyword(t *token, kw string) bool {
+	return t != nil && t.kind == tokWord && !t.quoted && strings.EqualFold(t.text, kw)
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword(p.peek(), "OR") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = Or{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t == nil || t.kind == tokRParen || p.isKeyword(t, "OR") {
+			return left, nil
+		}
+		if p.isKeyword(t, "AND") {
+			p.pos++
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = And{Left: left, Right: right}
+	}
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	t := p.peek()
+	if t == nil {
+		return nil, fmt.Errorf("unexpected end of query")
+	}
+	if p.isKeyword(t, "NOT") {
+		p.pos++
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return Not{X: x}, nil
+	}
+	if t.kind == tokWord && !t.quoted && t.text == "-" && p.pos+1 < len(p.toks) {
+		// "-(...)" negates a group
+		if next := p.toks[p.pos+1]; next.kind == tokLParen && next.pos == t.pos+1 {
+			p.pos++
+			x, err := p.parseUnary()
+			if err != nil {
+				return nil, err
+			}
+			return Not{X: x}, nil
+		}
+	}
+	if t.kind == tokWord && !t.quoted && len(t.text) > 1 && t.text[0] == '-' {
+		// "-term" is shorthand for NOT term
+		p.toks[p.pos].text = t.text[1:]
+		p.toks[p.pos].pos++
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return Not{X: x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Expr, error) {
+	t := p.peek()
+	if t == nil {
+		return nil, fmt.Errorf("unexpected end of query")
+	}
+	switch t.kind {
+	case tokLParen:
+		p.pos++
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		closing := p.peek()
+		if closing == nil || closing.kind != tokRParen {
+			return nil, fmt.Errorf("missing ')' for '(' at position %d", t.pos+1)
+		}
+		p.pos++
+		return e, nil
+	case tokRParen:
+		return nil, fmt.Errorf("unexpected ')' at position %d", t.pos+1)
+	}
+	if p.isKeyword(t, "AND") || p.isKeyword(t, "OR") {
+		return nil, fmt.Errorf("unexpected %s at position %d", strings.ToUpper(t.text), t.pos+1)
+	}
+	p.pos++
+	return parseTerm(*t)
+}
+
+func parseTerm(t token) (Expr, error) {
+	text := t.text
+	if t.phrase {
+		if text == "" {
+			return nil, fmt.Errorf("empty phrase at position %d", t.pos+1)
+		}
+		return Text{Value: text}, nil
+	}
+	lower := strings.ToLower(text)
+	switch {
+	case strings.HasPrefix(text, "#"):
+		name := text[1:]
+		if name == "" {
+			return nil, fmt.Errorf("empty tag at position %d", t.pos+1)
+		}
+		return Tag{Name: name}, nil
+	case strings.HasPrefix(lower, "tag:"):
+		name := text[4:]
+		if name == "" {
+			return nil, fmt.Errorf("empty tag at position %d", t.pos+1)
+		}
+		return Tag{Name: name}, nil
+	case lower == "has:attachment":
+		return HasAttachment{}, nil
+	case strings.HasPrefix(lower, "has:activity:"):
+		name := text[len("has:activity:"):]
+		if name == "" {
+			return nil, fmt.Errorf("missing activity type at position %d", t.pos+1)
+		}
+		return HasActivity{TypeName: name}, nil
+	case lower == "is:reply":
+		return IsReply{}, nil
+	case strings.HasPrefix(lower, "date"):
+		if e, ok, err := parseDateTerm(text[4:], t.pos); ok || err != nil {
+			return e, err
+		}
+	}
+	if i := strings.IndexByte(text, ':'); i > 0 && !t.quoted {
+		return nil, fmt.Errorf("unknown operator %q at position %d", text[:i+1], t.pos+1)
+	}
+	return Text{Value: text}, nil
+}
+
+// parseDateTerm parses the part after "date". ok is false when the word
+// merely starts with "date" and should be treated as text.
+func parseDateTerm(rest string, pos int) (Expr, bool, error) {
+	for _, op := range []string{">=", "<=", ">", "<", ":", "="} {
+		if !strings.HasPrefix(rest, op) {
+			continue
+		}
+		val := rest[len(op):]
+		if op == ":" {
+			if from, to, found := strings.Cut(val, ".."); found {
+				f, err := parseDateValue(from, pos)
+				if err != nil {
+					return nil, true, err
+				}
+				tv, err := parseDateValue(to, pos)
+				if err != nil {
+					return nil, true, err
+				}
+				return DateRange{From: f, To: tv}, true, nil
+			}
+			op = "="
+		}
+		v, err := parseDateValue(val, pos)
+		if err != nil {
+			return nil, true, err
+		}
+		return DateCmp{Op: op, Value: v}, true, nil
+	}
+	return nil, false, nil
+}
+
+func parseDateValue(s string, pos int) (DateValue, error) {
+	switch strings.ToLower(s) {
+	case "today":
+		return DateValue{Rel: true}, nil
+	case "yesterday":
+		return DateValue{Rel: true, Days: -1}, nil
+	}
+	if d, err := time.Parse("2006-01-02", s); err == nil {
+		return DateValue{Day: d}, nil
+	}
+	if len(s) >= 3 && (s[0] == '-' || s[0] == '+') {
+		n, err := strconv.Atoi(s[1 : len(s)-1])
+		if err == nil && n >= 0 && n <= 36500 {
+			if s[0] == '-' {
+				n = -n
+			}
+			switch s[len(s)-1] {
+			case 'd':
+				return DateValue{Rel: true, Days: n}, nil
+			case 'w':
+				return DateValue{Rel: true, Days: 7 * n}, nil
+			case 'm':
+				return DateValue{Rel: true, Months: n}, nil
+			case 'y':
+				return DateValue{Rel: true, Months: 12 * n}, nil
+			}
+		}
+	}
+	return DateValue{}, fmt.Errorf("invalid date %q at position %d (use YYYY-MM-DD, today, yesterday or -7d/-2w/-1m/-1y)", s, pos+1)
+}
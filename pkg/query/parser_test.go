@@ -0,0 +1,153 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// show prints an expression as nested prefix forms, e.g. (or #a (and b c)).
+func show(e Expr) string {
+	switch x := e.(type) {
+	case And:
+		return "(and " + show(x.Left) + " " + show(x.Right) + ")"
+	case Or:
+		return "(or " + show(x.Left) + " " + show(x.Right) + ")"
+	case Not:
+		return "(not " + show(x.X) + ")"
+	case Tag:
+		return "#" + x.Name
+	case Text:
+		return fmt.Sprintf("%q", x.Value)
+	case DateCmp:
+		return "date" + x.Op + showDate(x.Value)
+	case DateRange:
+		return "date:" + showDate(x.From) + ".." + showDate(x.To)
+	case HasAttachment:
+		return "has:attachment"
+	case HasActivity:
+		return "has:activity:" + x.TypeName
+	case IsReply:
+		return "is:reply"
+	}
+	return fmt.Sprintf("%#v", e)
+}
+
+func showDate(v DateValue) string {
+	if !v.Rel {
+		return v.Day.Format("2006-01-02")
+	}
+	return fmt.Sprintf("%+dd%+dm", v.Days, v.Months)
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`work`, `"work"`},
+		{`a b`, `(and "a" "b")`},
+		{`a AND b`, `(and "a" "b")`},
+		{`a and b`, `(and "a" "b")`},
+		{`a OR b c`, `(or "a" (and "b" "c"))`},
+		{`a b OR c`, `(or (and "a" "b") "c")`},
+		{`a OR b AND c`, `(or "a" (and "b" "c"))`},
+		{`a OR b OR c`, `(or (or "a" "b") "c")`},
+		{`(a OR b) c`, `(and (or "a" "b") "c")`},
+		{`((a))`, `"a"`},
+		{`NOT a b`, `(and (not "a") "b")`},
+		{`NOT (a OR b)`, `(not (or "a" "b"))`},
+		{`NOT NOT a`, `(not (not "a"))`},
+		{`-a`, `(not "a")`},
+		{`-#draft`, `(not #draft)`},
+		{`a -b`, `(and "a" (not "b"))`},
+		{`--a`, `(not (not "a"))`},
+		{`-(a OR b)`, `(not (or "a" "b"))`},
+		{`#x -(a OR b) c`, `(and (and #x (not (or "a" "b"))) "c")`},
+		{`(work OR meeting) AND NOT draft`, `(and (or "work" "meeting") (not "draft"))`},
+		{`(#work OR #meeting) AND NOT #draft`, `(and (or #work #meeting) (not #draft))`},
+		{`#work`, `#work`},
+		{`tag:work`, `#work`},
+		{`TAG:Work`, `#Work`},
+		{`tag:"my tag"`, `#my tag`},
+		{`"a b"`, `"a b"`},
+		{`"-a"`, `"-a"`},
+		{`"OR"`, `"OR"`},
+		{`"NOT" a`, `(and "NOT" "a")`},
+		{`"a:b"`, `"a:b"`},
+		{`x"y z"`, `"xy z"`},
+		{`has:attachment`, `has:attachment`},
+		{`HAS:ATTACHMENT`, `has:attachment`},
+		{`has:activity:Running`, `has:activity:Running`},
+		{`is:reply`, `is:reply`},
+		{`date>=2024-01-31`, `date>=2024-01-31`},
+		{`date>2024-01-31`, `date>2024-01-31`},
+		{`date<=today`, `date<=+0d+0m`},
+		{`date<yesterday`, `date<-1d+0m`},
+		{`date:2024-01-31`, `date=2024-01-31`},
+		{`date=-2w`, `date=-14d+0m`},
+		{`date>=-1m`, `date>=+0d-1m`},
+		{`date>=-1y`, `date>=+0d-12m`},
+		{`date:2024-01-01..today`, `date:2024-01-01..+0d+0m`},
+		{`dates`, `"dates"`},
+	}
+	for _, tt := range tests {
+		e, err := Parse(tt.input)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.input, err)
+			continue
+		}
+		if got := show(e); got != tt.want {
+			t.Errorf("Parse(%q) = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{``, `query is empty`},
+		{`   `, `query is empty`},
+		{`a OR`, `unexpected end of query`},
+		{`NOT`, `unexpected end of query`},
+		{`a )`, `unexpected ")" at position 3`},
+		{`)`, `unexpected ')' at position 1`},
+		{`(a`, `missing ')' for '(' at position 1`},
+		{`a (b OR (c)`, `missing ')' for '(' at position 3`},
+		{`()`, `unexpected ')' at position 2`},
+		{`a AND OR b`, `unexpected OR at position 7`},
+		{`OR a`, `unexpected OR at position 1`},
+		{`a "b`, `unterminated quote at position 3`},
+		{`""`, `empty phrase at position 1`},
+		{`#`, `empty tag at position 1`},
+		{`a tag:`, `empty tag at position 3`},
+		{`has:activity:`, `missing activity type at position 1`},
+		{`a foo:bar`, `unknown operator "foo:" at position 3`},
+		{`-foo:bar`, `unknown operator "foo:" at position 2`},
+		{`a date>=2024-13-01`, `invalid date "2024-13-01" at position 3`},
+		{`date:2024-01-01..soon`, `invalid date "soon" at position 1`},
+		{`date>=-7x`, `invalid date "-7x" at position 1`},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.input)
+		if err == nil {
+			t.Errorf("Parse(%q) succeeded, want error %q", tt.input, tt.want)
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), tt.want) {
+			t.Errorf("Parse(%q) error = %q, want %q", tt.input, err, tt.want)
+		}
+	}
+}
+
+func TestParseMaxLength(t *testing.T) {
+	if _, err := Parse(strings.Repeat("a", MaxLength)); err != nil {
+		t.Errorf("query of %d characters: %v", MaxLength, err)
+	}
+	_, err := Parse(strings.Repeat("a", MaxLength+1))
+	if err == nil || err.Error() != fmt.Sprintf("query is too long (max %d characters)", MaxLength) {
+		t.Errorf("query of %d characters: error = %v", MaxLength+1, err)
+	}
+}
@@ -0,0 +1,133 @@
+package stats
+
+import "math"
+
+// LinearFit fits y = intercept + slope*x by least squares. It is undefined
+// (false) for fewer than two points or when every x is the same.
+func LinearFit(x, y []float64) (intercept, slope float64, ok bool) {
+	n := len(x)
+	if n < 2 || n != len(y) {
+		return 0, 0, false
+	}
+	var mx, my float64
+	for i := range x {
+		mx += x[i]
+		my += y[i]
+	}
+	mx /= float64(n)
+	my /= float64(n)
+	var sxy, sxx float64
+	for i := range x {
+		dx := x[i] - mx
+		sxy += dx * (y[i] - my)
+		sxx += dx * dx
+	}
+	if sxx == 0 {
+		return 0, 0, false
+	}
+	slope = sxy / sxx
+	return my - slope*mx, slope, true
+}
+
+// EWMA returns the exponentially weighted moving average of y: each value
+// weighs alpha and the average before it 1-alpha, starting from the first.
+func EWMA(y []float64, alpha float64) []float64 {
+	s := make([]float64, len(y))
+	for i, v := range y {
+		if i == 0 {
+			s[i] = v
+			continue
+		}
+		s[i] = alpha*v + (1-alpha)*s[i-1]
+	}
+	return s
+}
+
+// ForecastPoint is a forecast value with its prediction interval.
+type ForecastPoint struct {
+	Value float64
+	Lower float64
+	Upper float64
+}
+
+// z95 is the normal quantile of a two-sided 95% interval.
+const z95 = 1.959964
+
+// smoothingGrid holds the smoothing parameters tried when fitting.
+var smoothingGrid = func() []float64 {
+	g := make([]float64, 19)
+	for i := range g {
+		g[i] = float64(i+1) * 0.05
+	}
+	return g
+}()
+
+// SimpleSmoothing forecasts the next n values of y by simple exponential
+// smoothing: a flat forecast at the last smoothed level. The smoothing
+// parameter minimizes the squared one-step errors, whose spread gives the 95%
+// interval, widening with each step. It needs at least two values.
+func SimpleSmoothing(y []float64, n int) []ForecastPoint {
+	if len(y) < 2 || n < 1 {
+		return nil
+	}
+	var best struct{ alpha, level, sse float64 }
+	best.sse = math.Inf(1)
+	for _, alpha := range smoothingGrid {
+		level, sse := y[0], 0.0
+		for _, v := range y[1:] {
+			e := v - level
+			sse += e * e
+			level += alpha * e
+		}
+		if sse < best.sse {
+			best.alpha, best.level, best.sse = alpha, level, sse
+		}
+	}
+	sigma := math.Sqrt(best.sse / float64(len(y)-1))
+	points := make([]ForecastPoint, n)
+	for h := 1; h <= n; h++ {
+		spread := z95 * sigma * math.Sqrt(1+float64(h-1)*best.alpha*best.alpha)
+		points[h-1] = ForecastPoint{Value: best.level, Lower: best.level - spread, Upper: best.level + spread}
+	}
+	return points
+}
+
+// Holt forecasts the next n values of y by Holt's linear method, smoothing a
+// level and a trend; the forecast continues the last trend. Parameters and
+// the 95% interval are fitted as in SimpleSmoothing. It needs at least three
+// values.
+func Holt(y []float64, n int) []ForecastPoint {
+	if len(y) < 3 || n < 1 {
+		return nil
+	}
+	var best struct{ alpha, beta, level, trend, sse float64 }
+	best.sse = math.Inf(1)
+	for _, alpha := range smoothingGrid {
+		for _, beta := range smoothingGrid {
+			level, trend, sse := y[1], y[1]-y[0], 0.0
+			for _, v := range y[2:] {
+				e := v - (level + trend)
+				sse += e * e
+				prev := level
+				level = level + trend + alpha*e
+				trend += beta * (level - prev - trend)
+			}
+			if sse < best.sse {
+				best.alpha, best.beta, best.level, best.trend, best.sse = alpha, beta, level, trend, sse
+			}
+		}
+	}
+	sigma := math.Sqrt(best.sse / float64(len(y)-2))
+	points := make([]ForecastPoint, n)
+	variance := 1.0
+	for h := 1; h <= n; h++ {
+		if h > 1 {
+			c := best.alpha * (1 + float64(h-1)*best.beta)
+			variance += c * c
+		}
+		value := best.level + float64(h)*best.trend
+		spread := z95 * sigma * math.Sqrt(variance)
+		points[h-1] = ForecastPoint{Value: value, Lower: value - spread, Upper: value + spread}
+	}
+	return points
+}
@@ -0,0 +1,144 @@
+package stats
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLinearFit(t *testing.T) {
+	tests := []struct {
+		name             string
+		x, y             []float64
+		intercept, slope float64
+		ok               bool
+	}{
+		{"exact line", []float64{0, 1, 2, 3}, []float64{1, 3, 5, 7}, 1, 2, true},
+		{"falling", []float64{1, 2, 3}, []float64{9, 6, 3}, 12, -3, true},
+		{"flat", []float64{1, 2, 3, 4}, []float64{5, 5, 5, 5}, 5, 0, true},
+		{"least squares", []float64{1, 2, 3, 4, 5}, []float64{2, 4, 5, 4, 5}, 2.2, 0.6, true},
+		{"gapped x", []float64{0, 1, 4, 5}, []float64{0, 2, 8, 10}, 0, 2, true},
+		{"two points", []float64{2, 4}, []float64{1, 2}, 0, 0.5, true},
+		{"one point", []float64{1}, []float64{1}, 0, 0, false},
+		{"empty", nil, nil, 0, 0, false},
+		{"same x", []float64{3, 3, 3}, []float64{1, 2, 3}, 0, 0, false},
+		{"length mismatch", []float64{1, 2, 3}, []float64{1, 2}, 0, 0, false},
+	}
+	for _, tt := range tests {
+		intercept, slope, ok := LinearFit(tt.x, tt.y)
+		if ok != tt.ok || math.Abs(intercept-tt.intercept) > eps || math.Abs(slope-tt.slope) > eps {
+			t.Errorf("%s: LinearFit = %v, %v, %v, want %v, %v, %v", tt.name, intercept, slope, ok, tt.intercept, tt.slope, tt.ok)
+		}
+	}
+}
+
+func TestEWMA(t *testing.T) {
+	tests := []struct {
+		y     []float64
+		alpha float64
+		want  []float64
+	}{
+		{[]float64{}, 0.5, []float64{}},
+		{[]float64{7}, 0.3, []float64{7}},
+		{[]float64{10, 20, 30}, 0.5, []float64{10, 15, 22.5}},
+		{[]float64{10, 20, 30}, 1, []float64{10, 20, 30}},
+		{[]float64{4, 0, 8}, 0.25, []float64{4, 3, 4.25}},
+	}
+	for _, tt := range tests {
+		got := EWMA(tt.y, tt.alpha)
+		if len(got) != len(tt.want) {
+			t.Errorf("EWMA(%v, %v) = %v, want %v", tt.y, tt.alpha, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if math.Abs(got[i]-tt.want[i]) > eps {
+				t.Errorf("EWMA(%v, %v) = %v, want %v", tt.y, tt.alpha, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestSimpleSmoothing(t *testing.T) {
+	tests := []struct {
+		name string
+		y    []float64
+		n    int
+		want []ForecastPoint
+	}{
+		{"constant", []float64{4, 4, 4, 4}, 3, []ForecastPoint{{4, 4, 4}, {4, 4, 4}, {4, 4, 4}}},
+		// Every alpha fits equally; the first (0.05) wins with one error of 1
+		{"two values", []float64{1, 2}, 2, []ForecastPoint{
+			{1.05, 1.05 - z95, 1.05 + z95},
+			{1.05, 1.05 - z95*math.Sqrt(1.0025), 1.05 + z95*math.Sqrt(1.0025)},
+		}},
+		{"one value", []float64{3}, 2, nil},
+		{"no steps", []float64{1, 2, 3}, 0, nil},
+	}
+	for _, tt := range tests {
+		checkForecast(t, tt.name, SimpleSmoothing(tt.y, tt.n), tt.want)
+	}
+}
+
+func TestHolt(t *testing.T) {
+	tests := []struct {
+		name string
+		y    []float64
+		n    int
+		want []ForecastPoint
+	}{
+		{"exact line", []float64{1, 3, 5, 7, 9}, 3, []ForecastPoint{{11, 11, 11}, {13, 13, 13}, {15, 15, 15}}},
+		{"three values", []float64{1, 3, 5}, 1, []ForecastPoint{{7, 7, 7}}},
+		{"flat", []float64{2, 2, 2, 2}, 2, []ForecastPoint{{2, 2, 2}, {2, 2, 2}}},
+		{"two values", []float64{1, 2}, 2, nil},
+		{"no steps", []float64{1, 2, 3}, 0, nil},
+	}
+	for _, tt := range tests {
+		checkForecast(t, tt.name, Holt(tt.y, tt.n), tt.want)
+	}
+}
+
+func TestForecastBandsWiden(t *testing.T) {
+	y := []float64{10, 12, 9, 14, 13, 17, 15, 19, 18, 22, 20, 25}
+	for name, points := range map[string][]ForecastPoint{
+		"SimpleSmoothing": SimpleSmoothing(y, 6),
+		"Holt":            Holt(y, 6),
+	} {
+		if len(points) != 6 {
+			t.Fatalf("%s: %d points, want 6", name, len(points))
+		}
+		prev := 0.0
+		for h, p := range points {
+			half := p.Upper - p.Value
+			if math.Abs((p.Value-p.Lower)-half) > eps {
+				t.Errorf("%s: step %d band %v..%v is not centered on %v", name, h+1, p.Lower, p.Upper, p.Value)
+			}
+			if half <= 0 || half < prev {
+				t.Errorf("%s: step %d half width %v after %v", name, h+1, half, prev)
+			}
+			prev = half
+		}
+	}
+	// Holt follows the upward trend, simple smoothing stays flat
+	holt, flat := Holt(y, 6), SimpleSmoothing(y, 6)
+	if holt[5].Value <= holt[0].Value {
+		t.Errorf("Holt forecast %v does not rise", holt)
+	}
+	if flat[5].Value != flat[0].Value {
+		t.Errorf("SimpleSmoothing forecast %v is not flat", flat)
+	}
+}
+
+func checkForecast(t *testing.T, name string, got, want []ForecastPoint) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("%s: forecast = %v, want %v", name, got, want)
+		return
+	}
+	for i := range got {
+		g, w := got[i], want[i]
+		if math.Abs(g.Value-w.Value) > eps || math.Abs(g.Lower-w.Lower) > eps || math.Abs(g.Upper-w.Upper) > eps {
+			t.Errorf("%s: forecast = %v, want %v", name, got, want)
+			return
+		}
+	}
+}
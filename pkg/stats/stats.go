@@ -0,0 +1,108 @@
+// Package stats holds the statistics computed over aggregated activity series.
+package stats
+
+import (
+	"math"
+	"sort"
+)
+
+// Pearson returns the Pearson correlation coefficient of the paired samples.
+// It is undefined (false) for fewer than two pairs or when either sample is
+// constant.
+func Pearson(x, y []float64) (float64, bool) {
+	n := len(x)
+	if n < 2 || n != len(y) {
+		return 0, false
+	}
+	var mx, my float64
+	for i := range x {
+		mx += x[i]
+		my += y[i]
+	}
+	mx /= float64(n)
+	my /= float64(n)
+	var sxy, sxx, syy float64
+	for i := range x {
+		dx, dy := x[i]-mx, y[i]-my
+		sxy += dx * dy
+		sxx += dx * dx
+		syy += dy * dy
+	}
+	if sxx == 0 || syy == 0 {
+		return 0, false
+	}
+	r := sxy / math.Sqrt(sxx*syy)
+	// Clamp rounding noise
+	return math.Max(-1, math.Min(1, r)), true
+}
+
+// Spearman returns the Spearman rank correlation coefficient: the Pearson
+// coefficient of the ranks, with ties sharing their average rank.
+func Spearman(x, y []float64) (float64, bool) {
+	if len(x) != len(y) {
+		return 0, false
+	}
+	return Pearson(Ranks(x), Ranks(y))
+}
+
+// Ranks returns the 1-based rank of each value; tied values get the average
+// of the ranks they span.
+func Ranks(v []float64) []float64 {
+	idx := make([]int, len(v))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool { return v[idx[a]] < v[idx[b]] })
+	ranks := make([]float64, len(v))
+	for i := 0; i < len(idx); {
+		j := i
+		for j+1 < len(idx) && v[idx[j+1]] == v[idx[i]] {
+			j++
+		}
+		avg := float64(i+j)/2 + 1
+		for k := i; k <= j; k++ {
+			ranks[idx[k]] = avg
+		}
+		i = j + 1
+	}
+	return ranks
+}
+
+// Bin is one bin of a histogram: the values in [From, To), the last bin
+// including To.
+type Bin struct {
+	From  float64
+	To    float64
+	Count int
+}
+
+// Histogram counts the values in n bins of equal width spanning their range.
+// All equal values fall in a single bin of width 1 around them.
+func Histogram(xs []float64, n int) []Bin {
+	if len(xs) == 0 || n < 1 {
+		return nil
+	}
+	lo, hi := xs[0], xs[0]
+	for _, x := range xs {
+		lo = math.Min(lo, x)
+		hi = math.Max(hi, x)
+	}
+	if lo == hi {
+		return []Bin{{From: lo - 0.5, To: hi + 0.5, Count: len(xs)}}
+	}
+	width := (hi - lo) / float64(n)
+	bins := make([]Bin, n)
+	for i := range bins {
+		bins[i].From = lo + float64(i)*width
+		bins[i].To = lo + float64(i+1)*width
+	}
+	bins[n-1].To = hi
+	for _, x := range xs {
+		i := int((x - lo) / width)
+		if i >= n {
+			i = n - 1
+		}
+		bins[i].Count++
+	}
+	return bins
+}
@@ -0,0 +1,149 @@
+package stats
+
+import (
+	"math"
+	"testing"
+)
+
+const eps = 1e-9
+
+func TestPearson(t *testing.T) {
+	tests := []struct {
+		name string
+		x, y []float64
+		want float64
+		ok   bool
+	}{
+		{"perfect", []float64{1, 2, 3, 4, 5}, []float64{2, 4, 6, 8, 10}, 1, true},
+		{"inverse", []float64{1, 2, 3, 4, 5}, []float64{10, 8, 6, 4, 2}, -1, true},
+		{"partial", []float64{1, 2, 3, 4, 5}, []float64{2, 4, 5, 4, 5}, 6 / math.Sqrt(60), true},
+		{"uncorrelated", []float64{1, 2, 3}, []float64{1, 3, 1}, 0, true},
+		{"two pairs", []float64{1, 2}, []float64{5, 3}, -1, true},
+		{"one pair", []float64{1}, []float64{1}, 0, false},
+		{"empty", nil, nil, 0, false},
+		{"length mismatch", []float64{1, 2, 3}, []float64{1, 2}, 0, false},
+		{"constant x", []float64{3, 3, 3}, []float64{1, 2, 3}, 0, false},
+		{"constant y", []float64{1, 2, 3}, []float64{7, 7, 7}, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := Pearson(tt.x, tt.y)
+		if ok != tt.ok || math.Abs(got-tt.want) > eps {
+			t.Errorf("%s: Pearson = %v, %v, want %v, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestPearsonStaysInRange(t *testing.T) {
+	// Nearly collinear large values must not round past ±1
+	x := []float64{1e8, 1e8 + 1, 1e8 + 2, 1e8 + 3}
+	y := []float64{3e8, 3e8 + 3, 3e8 + 6, 3e8 + 9}
+	r, ok := Pearson(x, y)
+	if !ok || r > 1 || r < 1-eps {
+		t.Errorf("Pearson = %v, %v, want 1", r, ok)
+	}
+}
+
+func TestSpearman(t *testing.T) {
+	tests := []struct {
+		name string
+		x, y []float64
+		want float64
+		ok   bool
+	}{
+		{"monotonic", []float64{1, 2, 3, 4}, []float64{1, 8, 27, 64}, 1, true},
+		{"reversed", []float64{1, 2, 3, 4}, []float64{0.4, 0.3, 0.2, -5}, -1, true},
+		// y ranks 1, 2.5, 4.5, 2.5, 4.5
+		{"ties", []float64{1, 2, 3, 4, 5}, []float64{2, 4, 5, 4, 5}, 7 / math.Sqrt(90), true},
+		{"outlier", []float64{1, 2, 3, 4, 5}, []float64{1, 2, 3, 4, 1000}, 1, true},
+		{"all tied", []float64{1, 2, 3}, []float64{4, 4, 4}, 0, false},
+		{"one pair", []float64{1}, []float64{2}, 0, false},
+		{"length mismatch", []float64{1, 2}, []float64{1, 2, 3}, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := Spearman(tt.x, tt.y)
+		if ok != tt.ok || math.Abs(got-tt.want) > eps {
+			t.Errorf("%s: Spearman = %v, %v, want %v, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRanks(t *testing.T) {
+	tests := []struct {
+		in, want []float64
+	}{
+		{[]float64{}, []float64{}},
+		{[]float64{7}, []float64{1}},
+		{[]float64{3, 1, 2}, []float64{3, 1, 2}},
+		{[]float64{10, 20, 20, 30}, []float64{1, 2.5, 2.5, 4}},
+		{[]float64{5, 5, 5}, []float64{2, 2, 2}},
+		{[]float64{2, 1, 2, 1, 3}, []float64{3.5, 1.5, 3.5, 1.5, 5}},
+		{[]float64{-1, -3, 0}, []float64{2, 1, 3}},
+	}
+	for _, tt := range tests {
+		got := Ranks(tt.in)
+		if len(got) != len(tt.want) {
+			t.Errorf("Ranks(%v) = %v, want %v", tt.in, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("Ranks(%v) = %v, want %v", tt.in, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	tests := []struct {
+		name string
+		xs   []float64
+		n    int
+		want []Bin
+	}{
+		{"spread", []float64{0, 1, 2, 3, 4, 10}, 5, []Bin{
+			{0, 2, 2}, {2, 4, 2}, {4, 6, 1}, {6, 8, 0}, {8, 10, 1},
+		}},
+		// The maximum falls in the last bin, which includes its upper edge
+		{"edges", []float64{1, 2, 3}, 2, []Bin{{1, 2, 1}, {2, 3, 2}}},
+		{"one bin", []float64{4, -2, 1}, 1, []Bin{{-2, 4, 3}}},
+		{"equal values", []float64{3, 3, 3}, 4, []Bin{{2.5, 3.5, 3}}},
+		{"single value", []float64{-1}, 10, []Bin{{-1.5, -0.5, 1}}},
+		{"empty", nil, 3, nil},
+		{"no bins", []float64{1, 2}, 0, nil},
+	}
+	for _, tt := range tests {
+		got := Histogram(tt.xs, tt.n)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: Histogram = %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			g, w := got[i], tt.want[i]
+			if g.Count != w.Count || math.Abs(g.From-w.From) > eps || math.Abs(g.To-w.To) > eps {
+				t.Errorf("%s: Histogram = %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestHistogramCountsEveryValue(t *testing.T) {
+	xs := make([]float64, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		xs = append(xs, math.Sin(float64(i))*0.1+float64(i%7)*0.3)
+	}
+	for n := 1; n <= 40; n++ {
+		total := 0
+		bins := Histogram(xs, n)
+		for i, b := range bins {
+			total += b.Count
+			if i > 0 && b.From != bins[i-1].To {
+				t.Fatalf("n=%d: bin %d starts at %v, previous ends at %v", n, i, b.From, bins[i-1].To)
+			}
+		}
+		if total != len(xs) {
+			t.Errorf("n=%d: counted %d of %d values", n, total, len(xs))
+		}
+	}
+}
@@ -0,0 +1,164 @@
+// Package units is the registry of measurement units activity values can be
+// entered and displayed in. Units are grouped by dimension and converted
+// through the dimension's base unit; every conversion is a plain factor.
+package units
+
+import (
+	"errors"
+	"strings"
+)
+
+type Dimension string
+
+const (
+	Mass     Dimension = "mass"
+	Distance Dimension = "distance"
+	Duration Dimension = "duration"
+	Volume   Dimension = "volume"
+	Energy   Dimension = "energy"
+)
+
+// Unit is a registered unit. Factor is the size of the unit in the base unit
+// of its dimension (kg, m, s, l and kJ).
+type Unit struct {
+	Symbol    string    `json:"symbol"`
+	Name      string    `json:"name"`
+	Dimension Dimension `json:"dimension"`
+	Factor    float64   `json:"-"`
+}
+
+var (
+	ErrUnknownUnit  = errors.New("unknown unit")
+	ErrIncompatible = errors.New("incompatible units")
+)
+
+var registry = []Unit{
+	{"mg", "milligram", Mass, 1e-6},
+	{"g", "gram", Mass, 1e-3},
+	{"kg", "kilogram", Mass, 1},
+	{"t", "tonne", Mass, 1000},
+	{"oz", "ounce", Mass, 0.028349523125},
+	{"lb", "pound", Mass, 0.45359237},
+	{"st", "stone", Mass, 6.35029318},
+
+	{"mm", "millimetre", Distance, 0.001},
+	{"cm", "centimetre", Distance, 0.01},
+	{"m", "metre", Distance, 1},
+	{"km", "kilometre", Distance, 1000},
+	{"in", "inch", Distance, 0.0254},
+	{"ft", "foot", Distance, 0.3048},
+	{"yd", "yard", Distance, 0.9144},
+	{"mi", "mile", Distance, 1609.344},
+
+	{"ms", "millisecond", Duration, 0.001},
+	{"s", "second", Duration, 1},
+	{"min", "minute", Duration, 60},
+	{"h", "hour", Duration, 3600},
+	{"d", "day", Duration, 86400},
+
+	{"ml", "millilitre", Volume, 0.001},
+	{"cl", "centilitre", Volume, 0.01},
+	{"dl", "decilitre", Volume, 0.1},
+	{"l", "litre", Volume, 1},
+	{"tsp", "teaspoon (US)", Volume, 0.00492892159375},
+	{"tbsp", "tablespoon (US)", Volume, 0.01478676478125},
+	{"fl_oz", "fluid ounce (US)", Volume, 0.0295735295625},
+	{"cup", "cup (US)", Volume, 0.2365882365},
+	{"pt", "pint (US)", Volume, 0.473176473},
+	{"qt", "quart (US)", Volume, 0.946352946},
+	{"gal", "gallon (US)", Volume, 3.785411784},
+
+	{"J", "joule", Energy, 0.001},
+	{"kJ", "kilojoule", Energy, 1},
+	{"cal", "calorie", Energy, 0.004184},
+	{"kcal", "kilocalorie", Energy, 4.184},
+	{"Wh", "watt-hour", Energy, 3.6},
+	{"kWh", "kilowatt-hour", Energy, 3600},
+}
+
+// aliases maps common spellings (lower case) to registry symbols.
+var aliases = map[string]string{
+	"milligram": "mg", "milligrams": "mg",
+	"gram": "g", "grams": "g", "gr": "g",
+	"kilogram": "kg", "kilograms": "kg", "kgs": "kg", "kilo": "kg", "kilos": "kg",
+	"tonne": "t", "tonnes": "t",
+	"ounce": "oz", "ounces": "oz",
+	"pound": "lb", "pounds": "lb", "lbs": "lb",
+	"stone": "st", "stones": "st",
+	"millimetre": "mm", "millimeter": "mm", "millimetres": "mm", "millimeters": "mm",
+	"centimetre": "cm", "centimeter": "cm", "centimetres": "cm", "centimeters": "cm",
+	"metre": "m", "meter": "m", "metres": "m", "meters": "m",
+	"kilometre": "km", "kilometer": "km", "kilometres": "km", "kilometers": "km",
+	"inch": "in", "inches": "in",
+	"foot": "ft", "feet": "ft",
+	"yard": "yd", "yards": "yd",
+	"mile": "mi", "miles": "mi",
+	"millisecond": "ms", "milliseconds": "ms",
+	"sec": "s", "secs": "s", "second": "s", "seconds": "s",
+	"mins": "min", "minute": "min", "minutes": "min",
+	"hr": "h", "hrs": "h", "hour": "h", "hours": "h",
+	"day": "d", "days": "d",
+	"millilitre": "ml", "milliliter": "ml", "millilitres": "ml", "milliliters": "ml",
+	"litre": "l", "liter": "l", "litres": "l", "liters": "l",
+	"fl oz": "fl_oz", "floz": "fl_oz",
+	"cups": "cup",
+	"pint": "pt", "pints": "pt",
+	"quart": "qt", "quarts": "qt",
+	"gallon": "gal", "gallons": "gal",
+	"joule": "J", "joules": "J",
+	"kilojoule": "kJ", "kilojoules": "kJ",
+	"kilocalorie": "kcal", "kilocalories": "kcal", "kcals": "kcal",
+}
+
+var bySymbol = func() map[string]Unit {
+	m := make(map[string]Unit, len(registry))
+	for _, u := range registry {
+		m[strings.ToLower(u.Symbol)] = u
+	}
+	return m
+}()
+
+// All returns the registered units grouped by dimension.
+func All() []Unit {
+	out := make([]Unit, len(registry))
+	copy(out, registry)
+	return out
+}
+
+// Lookup finds a unit by symbol or common name, ignoring case.
+func Lookup(s string) (Unit, bool) {
+	key := strings.ToLower(strings.TrimSpace(s))
+	if sym, ok := aliases[key]; ok {
+		key = strings.ToLower(sym)
+	}
+	u, ok := bySymbol[key]
+	return u, ok
+}
+
+// Factor returns the multiplier converting values in from to values in to.
+func Factor(from, to string) (float64, error) {
+	f, ok := Lookup(from)
+	if !ok {
+		return 0, ErrUnknownUnit
+	}
+	t, ok := Lookup(to)
+	if !ok {
+		return 0, ErrUnknownUnit
+	}
+	if f.Dimension != t.Dimension {
+		return 0, ErrIncompatible
+	}
+	if f.Symbol == t.Symbol {
+		return 1, nil
+	}
+	return f.Factor / t.Factor, nil
+}
+
+// Convert converts v from one unit to another of the same dimension.
+func Convert(v float64, from, to string) (float64, error) {
+	k, err := Factor(from, to)
+	if err != nil {
+		return 0, err
+	}
+	return v * k, nil
+}
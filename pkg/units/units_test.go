@@ -0,0 +1,159 @@
+package units
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{"kg", "kg", true},
+		{"KG", "kg", true},
+		{" kg ", "kg", true},
+		{"lbs", "lb", true},
+		{"Pounds", "lb", true},
+		{"kilo", "kg", true},
+		{"meters", "m", true},
+		{"Kilometre", "km", true},
+		{"hrs", "h", true},
+		{"mins", "min", true},
+		{"mi", "mi", true},
+		{"fl oz", "fl_oz", true},
+		{"FL_OZ", "fl_oz", true},
+		{"kj", "kJ", true},
+		{"KWH", "kWh", true},
+		{"j", "J", true},
+		{"", "", false},
+		{"parsec", "", false},
+		{"kg/m", "", false},
+	}
+	for _, tt := range tests {
+		u, ok := Lookup(tt.in)
+		if ok != tt.ok || u.Symbol != tt.want {
+			t.Errorf("Lookup(%q) = %q, %v, want %q, %v", tt.in, u.Symbol, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	seen := map[string]bool{}
+	for _, u := range All() {
+		key := strings.ToLower(u.Symbol)
+		if seen[key] {
+			t.Errorf("symbol %q is registered twice", u.Symbol)
+		}
+		seen[key] = true
+		if u.Factor <= 0 {
+			t.Errorf("%s: factor %v", u.Symbol, u.Factor)
+		}
+		if got, ok := Lookup(u.Symbol); !ok || got != u {
+			t.Errorf("Lookup(%q) = %+v, %v", u.Symbol, got, ok)
+		}
+	}
+	for alias, sym := range aliases {
+		if alias != strings.ToLower(alias) {
+			t.Errorf("alias %q is not lower case", alias)
+		}
+		if !seen[strings.ToLower(sym)] {
+			t.Errorf("alias %q points at unknown unit %q", alias, sym)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		v        float64
+		from, to string
+		want     float64
+	}{
+		{1, "kg", "kg", 1},
+		{1, "kg", "g", 1000},
+		{1500, "mg", "g", 1.5},
+		{1, "lb", "kg", 0.45359237},
+		{1, "st", "lb", 14},
+		{16, "oz", "lb", 1},
+		{2, "t", "kg", 2000},
+		{1, "km", "m", 1000},
+		{1, "mi", "km", 1.609344},
+		{12, "in", "ft", 1},
+		{3, "ft", "yd", 1},
+		{250, "cm", "m", 2.5},
+		{90, "min", "h", 1.5},
+		{1, "d", "min", 1440},
+		{1500, "ms", "s", 1.5},
+		{1, "l", "ml", 1000},
+		{1, "gal", "qt", 4},
+		{2, "pt", "cup", 4},
+		{3, "tsp", "tbsp", 1},
+		{1, "cup", "fl_oz", 8},
+		{1, "kcal", "kJ", 4.184},
+		{1000, "cal", "kcal", 1},
+		{1, "kWh", "Wh", 1000},
+		{1, "Wh", "J", 3600},
+		{-5, "kg", "g", -5000},
+		{0, "mi", "m", 0},
+		// Aliases and case are resolved on both sides
+		{2, "Pounds", "KILOGRAMS", 0.90718474},
+	}
+	for _, tt := range tests {
+		got, err := Convert(tt.v, tt.from, tt.to)
+		if err != nil {
+			t.Errorf("Convert(%v, %q, %q): %v", tt.v, tt.from, tt.to, err)
+			continue
+		}
+		if math.Abs(got-tt.want) > 1e-9*math.Max(1, math.Abs(tt.want)) {
+			t.Errorf("Convert(%v, %q, %q) = %v, want %v", tt.v, tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestFactorRoundTrip(t *testing.T) {
+	all := All()
+	for _, a := range all {
+		for _, b := range all {
+			if a.Dimension != b.Dimension {
+				continue
+			}
+			ab, err := Factor(a.Symbol, b.Symbol)
+			if err != nil {
+				t.Fatalf("Factor(%q, %q): %v", a.Symbol, b.Symbol, err)
+			}
+			ba, _ := Factor(b.Symbol, a.Symbol)
+			if math.Abs(ab*ba-1) > 1e-12 {
+				t.Errorf("Factor(%q, %q) * Factor(%q, %q) = %v", a.Symbol, b.Symbol, b.Symbol, a.Symbol, ab*ba)
+			}
+		}
+	}
+}
+
+func TestFactorErrors(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     error
+	}{
+		{"kg", "km", ErrIncompatible},
+		{"min", "m", ErrIncompatible},
+		{"l", "kg", ErrIncompatible},
+		{"kcal", "h", ErrIncompatible},
+		{"kg", "parsec", ErrUnknownUnit},
+		{"parsec", "kg", ErrUnknownUnit},
+		{"", "kg", ErrUnknownUnit},
+	}
+	for _, tt := range tests {
+		k, err := Factor(tt.from, tt.to)
+		if err != tt.want {
+			t.Errorf("Factor(%q, %q) error = %v, want %v", tt.from, tt.to, err, tt.want)
+		}
+		if k != 0 {
+			t.Errorf("Factor(%q, %q) = %v on error", tt.from, tt.to, k)
+		}
+		if _, err := Convert(1, tt.from, tt.to); err != tt.want {
+			t.Errorf("Convert(1, %q, %q) error = %v, want %v", tt.from, tt.to, err, tt.want)
+		}
+	}
+}
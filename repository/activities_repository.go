@@ -5,6 +5,8 @@ import (
 	"errors"
 	"focuz-api/models"
 	"focuz-api/types"
+	"math"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -20,7 +22,9 @@ func NewActivitiesRepository(db *sql.DB) *ActivitiesRepository {
 	return &ActivitiesRepository{db: db}
 }
 
-func (r *ActivitiesRepository) CreateActivity(userID, typeID int, value []byte, noteID *int) (*models.Activity, error) {
+// CreateActivity stores an activity in a space, optionally attached to a note.
+// occurredAt may be nil to use the note date (or the creation time).
+func (r *ActivitiesRepository) CreateActivity(userID, typeID int, value []byte, noteID *int, spaceID int, occurredAt *time.Time) (*models.Activity, error) {
 	if noteID != nil {
 		var exists int
 		err := r.db.QueryRow(`
@@ -40,37 +44,82 @@ func (r *ActivitiesRepository) CreateActivity(userID, typeID int, value []byte,
 	var newID int
 	now := time.Now()
 	err := r.db.QueryRow(`
-		INSERT INTO activities (user_id, type_id, value, note_id, created_at, modified_at, is_deleted)
-		VALUES ($1, $2, $3, $4, $5, $5, FALSE)
+		INSERT INTO activities (user_id, type_id, value, note_id, space_id, occurred_at, created_at, modified_at, is_deleted)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7, FALSE)
 		RETURNING id
-	`, userID, typeID, value, noteID, now).Scan(&newID)
+	`, userID, typeID, value, noteID, spaceID, occurredAt, now).Scan(&newID)
 	if err != nil {
 		return nil, err
 	}
 	return r.GetActivityByID(newID)
 }
 
+// NewActivity is one item of a CreateActivities batch.
+type NewActivity struct {
+	TypeID     int
+	Value      []byte
+	OccurredAt *time.Time
+}
+
+// CreateActivities stores note-less activities of one user in a space in a
+// single transaction, returning them in order.
+func (r *ActivitiesRepository) CreateActivities(userID, spaceID int, items []NewActivity) ([]*models.Activity, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	now := time.Now()
+	result := make([]*models.Activity, 0, len(items))
+	for _, it := range items {
+		a, err := scanActivity(tx.QueryRow(`
+			INSERT INTO activities (user_id, type_id, value, space_id, occurred_at, created_at, modified_at, is_deleted)
+			VALUES ($1, $2, $3, $4, $5, $6, $6, FALSE)
+			RETURNING `+activityColumns,
+			userID, it.TypeID, it.Value, spaceID, it.OccurredAt, now))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, a)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 func (r *ActivitiesRepository) GetActivityByID(id int) (*models.Activity, error) {
+	a, err := scanActivity(r.db.QueryRow(`
+		SELECT `+activityColumns+`
+		FROM activities
+		WHERE id = $1
+	`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return a, err
+}
+
+const activityColumns = `id, user_id, type_id, value, note_id, space_id, occurred_at, is_deleted, created_at, modified_at`
+
+func scanActivity(row rowScanner) (*models.Activity, error) {
 	var a models.Activity
 	var rawValue []byte
 	var dbNoteID sql.NullInt64
-	err := r.db.QueryRow(`
-		SELECT id, user_id, type_id, value, note_id, is_deleted, created_at, modified_at
-		FROM activities
-		WHERE id = $1
-	`, id).Scan(
+	var spaceID sql.NullInt64
+	var occurredAt sql.NullTime
+	err := row.Scan(
 		&a.ID,
 		&a.UserID,
 		&a.TypeID,
 		&rawValue,
 		&dbNoteID,
+		&spaceID,
+		&occurredAt,
 		&a.IsDeleted,
 		&a.CreatedAt,
 		&a.ModifiedAt,
 	)
-	if err == sql.ErrNoRows {
-		return nil, nil
-	}
 	if err != nil {
 		return nil, err
 	}
@@ -78,19 +127,28 @@ func (r *ActivitiesRepository) GetActivityByID(id int) (*models.Activity, error)
 		nid := int(dbNoteID.Int64)
 		a.NoteID = &nid
 	}
+	if spaceID.Valid {
+		a.SpaceID = int(spaceID.Int64)
+	}
+	if occurredAt.Valid {
+		t := occurredAt.Time
+		a.OccurredAt = &t
+	}
 	// Value is stored as JSONB; keep raw bytes so handlers can decode appropriately
 	a.Value = rawValue
 	return &a, nil
 }
 
-func (r *ActivitiesRepository) UpdateActivity(id int, newValue []byte, newNoteID *int) error {
+func (r *ActivitiesRepository) UpdateActivity(id int, newValue []byte, newNoteID *int, spaceID int, occurredAt *time.Time) error {
 	_, err := r.db.Exec(`
 		UPDATE activities
 		SET value = $1,
 		    note_id = $2,
+		    space_id = NULLIF($3, 0),
+		    occurred_at = $4,
 		    modified_at = NOW()
-		WHERE id = $3
-	`, newValue, newNoteID, id)
+		WHERE id = $5
+	`, newValue, newNoteID, spaceID, occurredAt, id)
 	return err
 }
 
@@ -104,12 +162,34 @@ func (r *ActivitiesRepository) SetActivityDeleted(id int, isDeleted bool) error
 	return err
 }
 
+// GetActivitiesAnalysis aggregates an activity type per period. Periods are
+// cut in zone, and startDate and endDate are wall times there.
 func (r *ActivitiesRepository) GetActivitiesAnalysis(
 	spaceID int,
 	startDate, endDate *time.Time,
 	tags []string,
 	at *models.ActivityType,
+	field []string,
+	periodID int,
+	transform string,
+	zone models.UserSettings,
+) ([]map[string]any, error) {
+	return r.analysis(spaceID, startDate, endDate, tags, at, field, periodID, transform, nil, zone)
+}
+
+// analysis is GetActivitiesAnalysis with the activities moved forward by
+// shift, when given, so that they are bucketed as the periods they are
+// compared with.
+func (r *ActivitiesRepository) analysis(
+	spaceID int,
+	startDate, endDate *time.Time,
+	tags []string,
+	at *models.ActivityType,
+	field []string,
 	periodID int,
+	transform string,
+	shift *comparisonShift,
+	zone models.UserSettings,
 ) ([]map[string]any, error) {
 
 	periodType := types.GetPeriodTypeByID(periodID)
@@ -117,43 +197,425 @@ func (r *ActivitiesRepository) GetActivitiesAnalysis(
 		return nil, errors.New("invalid period type")
 	}
 
-	groupExpr, dateFormat := buildGroupExpression(periodType.Name)
-	aggExpr, err := buildAggregatorExpression(at.ValueType, at.Aggregation)
+	// $1 is the time zone; dates are compared and bucketed as wall time there
+	src, err := r.analysisSource(spaceID, startDate, endDate, tags, at, field, shift, zone)
+	if err != nil {
+		return nil, err
+	}
+	groupExpr, labelExpr := buildGroupExpression(periodType.Name, src.local, zone.WeekStart)
+	valueExpr := activityValueExpression(field)
+	// The mode of an enum is one of its options; every other aggregate is numeric
+	textValue := strings.EqualFold(at.ValueType, "enum") && strings.EqualFold(at.Aggregation, "mode")
+	var windowExpr string
+	if transform != "" {
+		if textValue {
+			return nil, errors.New("transforms need a numeric aggregation")
+		}
+		if windowExpr, err = windowExpression(transform, periodType.Name); err != nil {
+			return nil, err
+		}
+	}
+
+	from, params := src.from, src.params
+
+	sqlStr := `
+SELECT
+  ` + labelExpr + ` AS period,
+  ` + groupExpr + ` AS bucket,
+  ` + src.aggregate + ` AS value
+` + from + "\n"
+	sqlStr += "GROUP BY " + groupExpr
+	if windowExpr != "" {
+		// The aggregate is kept as baseValue next to the derived value
+		sqlStr = "SELECT period, " + windowExpr + " AS value, value AS base FROM (" + sqlStr + ") s ORDER BY bucket"
+	} else {
+		sqlStr = "SELECT period, value, NULL AS base FROM (" + sqlStr + ") s ORDER BY bucket"
+	}
+
+	rows, err := r.db.Query(sqlStr, params...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
+	// Ensure non-nil slice so JSON encodes as [] instead of null
+	results := make([]map[string]any, 0)
+	byPeriod := make(map[string]map[string]any)
+	for rows.Next() {
+		var periodStr string
+		var raw sql.NullString
+		var base sql.NullFloat64
+		if err := rows.Scan(&periodStr, &raw, &base); err != nil {
+			return nil, err
+		}
+		var val any = raw.String
+		if !textValue {
+			f, _ := strconv.ParseFloat(raw.String, 64)
+			val = f
+		}
+		item := map[string]any{
+			"period": periodStr,
+			"value":  val,
+		}
+		if base.Valid {
+			item["baseValue"] = base.Float64
+		}
+		results = append(results, item)
+		byPeriod[periodStr] = item
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	options := at.OptionValues()
+	if options == nil {
+		return results, nil
+	}
+
+	// Per-option counts for enum and rating types, zero-filled over all options
+	countSQL := `
+SELECT
+  ` + labelExpr + ` AS period,
+  ` + valueExpr + ` AS option,
+  COUNT(*)
+` + from + "\n"
+	countSQL += "GROUP BY " + groupExpr + ", " + valueExpr
+
+	countRows, err := r.db.Query(countSQL, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer countRows.Close()
+	for _, item := range results {
+		counts := make(map[string]int, len(options))
+		for _, o := range options {
+			counts[o] = 0
+		}
+		item["counts"] = counts
+	}
+	for countRows.Next() {
+		var periodStr string
+		var option sql.NullString
+		var n int
+		if err := countRows.Scan(&periodStr, &option, &n); err != nil {
+			return nil, err
+		}
+		if item, ok := byPeriod[periodStr]; ok {
+			item["counts"].(map[string]int)[option.String] += n
+		}
+	}
+	if err := countRows.Err(); err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(at.Aggregation, "distribution") {
+		for _, item := range results {
+			counts := item["counts"].(map[string]int)
+			total := 0
+			for _, n := range counts {
+				total += n
+			}
+			shares := make(map[string]float64, len(counts))
+			for o, n := range counts {
+				if total > 0 {
+					shares[o] = float64(n) * 100 / float64(total)
+				} else {
+					shares[o] = 0
+				}
+			}
+			item["distribution"] = shares
+		}
+	}
+	return results, nil
+}
+
+// GetAnalysisComparison runs GetActivitiesAnalysis and the same analysis of
+// the range compare (previous or year_ago) points back to, and aligns their
+// periods. An open range ends now. Periods only the compared range has data
+// for are included with a null value.
+func (r *ActivitiesRepository) GetAnalysisComparison(
+	spaceID int,
+	startDate, endDate *time.Time,
+	tags []string,
+	at *models.ActivityType,
+	field []string,
+	periodID int,
+	transform string,
+	compare string,
+	zone models.UserSettings,
+) (*models.AnalysisComparison, error) {
+	if strings.EqualFold(at.ValueType, "enum") && strings.EqualFold(at.Aggregation, "mode") {
+		return nil, errors.New("comparisons need a numeric aggregation")
+	}
+	periodType := types.GetPeriodTypeByID(periodID)
+	if periodType == nil {
+		return nil, errors.New("invalid period type")
+	}
+	loc, err := zone.Location()
+	if err != nil {
+		return nil, err
+	}
+	end := models.WallTime(time.Now(), loc)
+	if endDate != nil {
+		end = *endDate
+	}
+	shift, err := newComparisonShift(compare, periodType.Name, startDate, end)
+	if err != nil {
+		return nil, err
+	}
+	current, err := r.analysis(spaceID, startDate, &end, tags, at, field, periodID, transform, nil, zone)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := r.analysis(spaceID, startDate, &end, tags, at, field, periodID, transform, &shift, zone)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.AnalysisComparison{
+		Compare:   compare,
+		To:        end.Format("2006-01-02"),
+		CompareTo: shift.back(end).Format("2006-01-02"),
+		Periods:   current,
+	}
+	if startDate != nil {
+		from, compareFrom := startDate.Format("2006-01-02"), shift.back(*startDate).Format("2006-01-02")
+		result.From, result.CompareFrom = &from, &compareFrom
+	}
+	byPeriod := make(map[string]map[string]any, len(current))
+	for _, item := range current {
+		byPeriod[item["period"].(string)] = item
+	}
+	for _, p := range previous {
+		item, ok := byPeriod[p["period"].(string)]
+		if !ok {
+			item = map[string]any{"period": p["period"], "value": nil}
+			result.Periods = append(result.Periods, item)
+		}
+		item["compareValue"] = p["value"]
+	}
+	// Labels of one period kind sort chronologically
+	sort.Slice(result.Periods, func(i, j int) bool {
+		return result.Periods[i]["period"].(string) < result.Periods[j]["period"].(string)
+	})
+	for _, item := range result.Periods {
+		c := models.Compare(floatValue(item["value"]), floatValue(item["compareValue"]))
+		item["compareValue"], item["delta"], item["deltaPercent"] = anyFloat(c.CompareValue), anyFloat(c.Delta), anyFloat(c.DeltaPercent)
+	}
+
+	// The summary compares the aggregates over the whole ranges
+	var totals [2]*float64
+	for i, s := range []*comparisonShift{nil, &shift} {
+		src, err := r.analysisSource(spaceID, startDate, &end, tags, at, field, s, zone)
+		if err != nil {
+			return nil, err
+		}
+		var total sql.NullFloat64
+		if err := r.db.QueryRow(`SELECT (`+src.aggregate+`)::float `+src.from, src.params...).Scan(&total); err != nil {
+			return nil, err
+		}
+		if total.Valid {
+			totals[i] = &total.Float64
+		}
+	}
+	result.Summary = models.Compare(totals[0], totals[1])
+	return result, nil
+}
+
+// floatValue and anyFloat convert between analysis item values, a float64
+// or nil, and optional numbers.
+func floatValue(v any) *float64 {
+	f, ok := v.(float64)
+	if !ok {
+		return nil
+	}
+	return &f
+}
+
+func anyFloat(v *float64) any {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
+
+// activitySource is what an analysis aggregates: the FROM and WHERE clauses
+// with their parameters (the time zone first), the local wall time to bucket
+// by and the aggregate of the values.
+type activitySource struct {
+	from      string
+	params    []interface{}
+	local     string
+	aggregate string
+}
+
+// analysisSource selects the activities of an analysis (see
+// analysisActivities), or their daily rollups when those apply.
+func (r *ActivitiesRepository) analysisSource(
+	spaceID int,
+	startDate, endDate *time.Time,
+	tags []string,
+	at *models.ActivityType,
+	field []string,
+	shift *comparisonShift,
+	zone models.UserSettings,
+) (activitySource, error) {
+	if rollupsApply(at, field, len(tags) > 0, startDate, endDate) {
+		ok, err := rollupZoneReady(r.db, spaceID, zone.Timezone)
+		if err != nil {
+			return activitySource{}, err
+		}
+		if ok {
+			src := activitySource{local: shift.apply(rollupDayExpr), params: []interface{}{zone.Timezone, spaceID, at.ID}}
+			src.aggregate, _ = rollupAggregate(at.Aggregation)
+			var start, end string
+			if startDate != nil {
+				src.params = append(src.params, *startDate)
+				start = "$" + strconv.Itoa(len(src.params))
+			}
+			if endDate != nil {
+				src.params = append(src.params, *endDate)
+				end = "$" + strconv.Itoa(len(src.params))
+			}
+			src.from = rollupActivities(src.local, "$2", "$3", start, end, true)
+			return src, nil
+		}
+	}
+	aggregate, err := buildAggregatorExpression(at.ValueType, at.Aggregation, activityValueExpression(field))
+	if err != nil {
+		return activitySource{}, err
+	}
+	from, params := analysisActivities(spaceID, startDate, endDate, tags, at, field, shift, zone)
+	return activitySource{from: from, params: params, local: shift.dateExpr("$1"), aggregate: aggregate}, nil
+}
+
+// analysisActivities returns the FROM and WHERE clauses selecting the
+// activities of an analysis (type at joined as aty, note as n) and their
+// parameters, the time zone first. With a shift the range applies to the
+// shifted dates.
+func analysisActivities(
+	spaceID int,
+	startDate, endDate *time.Time,
+	tags []string,
+	at *models.ActivityType,
+	field []string,
+	shift *comparisonShift,
+	zone models.UserSettings,
+) (string, []interface{}) {
+	localExpr := shift.dateExpr("$1")
 	var joins []string
 	var conds []string
-	var params []interface{}
-	idx := 1
+	params := []interface{}{zone.Timezone}
+	idx := 2
 
 	joins = append(joins, "JOIN activity_types aty ON a.type_id = aty.id")
-	joins = append(joins, "JOIN note n ON a.note_id = n.id")
+	// Activities without a note are included; they belong to their own space
+	joins = append(joins, "LEFT JOIN note n ON a.note_id = n.id")
 
 	conds = append(conds, "a.is_deleted = FALSE")
 	conds = append(conds, "aty.is_deleted = FALSE")
-	conds = append(conds, "n.is_deleted = FALSE")
-	conds = append(conds, "n.space_id = $"+strconv.Itoa(idx))
+	conds = append(conds, "(n.id IS NULL OR n.is_deleted = FALSE)")
+	conds = append(conds, "a.space_id = $"+strconv.Itoa(idx))
 	params = append(params, spaceID)
 	idx++
 
 	conds = append(conds, "a.type_id = $"+strconv.Itoa(idx))
 	params = append(params, at.ID)
 	idx++
+	if len(field) > 0 {
+		conds = append(conds, activityValueExpression(field)+" IS NOT NULL")
+	}
 
 	if startDate != nil {
-		conds = append(conds, "n.date >= $"+strconv.Itoa(idx))
+		conds = append(conds, localExpr+" >= $"+strconv.Itoa(idx))
 		params = append(params, *startDate)
 		idx++
 	}
 	if endDate != nil {
-		conds = append(conds, "n.date <= $"+strconv.Itoa(idx))
+		conds = append(conds, localExpr+" <= $"+strconv.Itoa(idx))
 		params = append(params, *endDate)
 		idx++
 	}
 
-	// Secure tag filtering: include must contain ALL tags, exclude must contain NONE
+	tagConds, tagParams := tagConditions(tags, idx)
+	conds = append(conds, tagConds...)
+	params = append(params, tagParams...)
+
+	return "FROM activities a\n" + strings.Join(joins, "\n") + "\nWHERE " + strings.Join(conds, " AND "), params
+}
+
+// activityDateExpr is when an activity happened: its own occurred_at, else
+// the date of its note, else its creation time. Queries using it must
+// LEFT JOIN note n.
+const activityDateExpr = "COALESCE(a.occurred_at, n.date, a.created_at)"
+
+// localDateExpr is activityDateExpr as wall time in the time zone given by
+// the SQL expression tz (a parameter placeholder or a quoted literal). Stored
+// timestamps are UTC; converting row by row keeps DST changes correct.
+func localDateExpr(tz string) string {
+	return "((" + activityDateExpr + ") AT TIME ZONE 'UTC' AT TIME ZONE " + tz + ")"
+}
+
+// comparisonShift is how far a compared range lies before the range it is
+// compared with. Activities of the compared range are moved forward by it, so
+// they land in the buckets of the current range.
+type comparisonShift struct {
+	years, months, days int
+}
+
+// newComparisonShift resolves compare (previous or year_ago) for the local
+// range startDate to endDate. previous goes back by the length of the range
+// in days, or by one period when the range has no start.
+func newComparisonShift(compare, period string, startDate *time.Time, endDate time.Time) (comparisonShift, error) {
+	switch compare {
+	case "year_ago":
+		return comparisonShift{years: 1}, nil
+	case "previous":
+		if startDate != nil {
+			days := int(math.Round(endDate.Sub(*startDate).Hours() / 24))
+			if days < 1 {
+				days = 1
+			}
+			return comparisonShift{days: days}, nil
+		}
+		switch period {
+		case "week":
+			return comparisonShift{days: 7}, nil
+		case "month":
+			return comparisonShift{months: 1}, nil
+		case "year":
+			return comparisonShift{years: 1}, nil
+		default:
+			return comparisonShift{days: 1}, nil
+		}
+	}
+	return comparisonShift{}, errors.New("compare must be previous or year_ago")
+}
+
+// back moves the local time t into the compared range.
+func (s comparisonShift) back(t time.Time) time.Time {
+	return t.AddDate(-s.years, -s.months, -s.days)
+}
+
+// dateExpr is localDateExpr moved forward by the shift; a nil shift leaves it
+// as is.
+func (s *comparisonShift) dateExpr(tz string) string {
+	return s.apply(localDateExpr(tz))
+}
+
+// apply moves the local wall time expression local forward by the shift.
+func (s *comparisonShift) apply(local string) string {
+	if s == nil {
+		return local
+	}
+	return "(" + local + " + interval '" + strconv.Itoa(s.years) + " years " + strconv.Itoa(s.months) + " months " + strconv.Itoa(s.days) + " days')"
+}
+
+// tagConditions filters activities (joined to their note as n) by note tags,
+// with placeholders numbered from idx: the note must have all tags and none of
+// the tags prefixed with "!".
+func tagConditions(tags []string, idx int) ([]string, []interface{}) {
+	var conds []string
+	var params []interface{}
 	var includeTags []string
 	var excludeTags []string
 	for _, tag := range tags {
@@ -178,106 +640,178 @@ func (r *ActivitiesRepository) GetActivitiesAnalysis(
 			"NOT EXISTS (SELECT 1 FROM tag xt JOIN note_to_tag xnt ON xnt.tag_id = xt.id WHERE xnt.note_id = n.id AND xt.name = ANY($"+strconv.Itoa(idx)+"))",
 		)
 		params = append(params, pq.Array(excludeTags))
-		idx++
-	}
-
-	sqlStr := `
-SELECT
-  to_char(` + groupExpr + `, '` + dateFormat + `') AS period,
-  ` + aggExpr + ` AS value
-FROM activities a
-`
-	for _, j := range joins {
-		sqlStr += j + "\n"
 	}
-	if len(conds) > 0 {
-		sqlStr += "WHERE " + strings.Join(conds, " AND ") + "\n"
-	}
-	sqlStr += "GROUP BY " + groupExpr + " ORDER BY " + groupExpr
-
-	rows, err := r.db.Query(sqlStr, params...)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+	return conds, params
+}
 
-	// Ensure non-nil slice so JSON encodes as [] instead of null
-	results := make([]map[string]any, 0)
-	for rows.Next() {
-		var periodStr string
-		var val float64
-		if err := rows.Scan(&periodStr, &val); err != nil {
-			return nil, err
+// buildGroupExpression returns the period bucket of the local wall time
+// expression local (see localDateExpr), and its label. Weeks start on Monday unless weekStart is
+// "sunday"; Sunday weeks are labelled with the ISO week of their Monday.
+func buildGroupExpression(period, local, weekStart string) (string, string) {
+	bucket := bucketExpression(period, local, weekStart)
+	switch period {
+	case "week":
+		if weekStart == "sunday" {
+			return bucket, "to_char(" + bucket + " + interval '1 day', 'IYYY-\"W\"IW')"
 		}
-		results = append(results, map[string]any{
-			"period": periodStr,
-			"value":  val,
-		})
+		return bucket, "to_char(" + bucket + ", 'IYYY-\"W\"IW')"
+	case "month":
+		return bucket, "to_char(" + bucket + ", 'YYYY-MM')"
+	case "year":
+		return bucket, "to_char(" + bucket + ", 'YYYY')"
+	default:
+		return bucket, "to_char(" + bucket + ", 'YYYY-MM-DD')"
 	}
-	return results, nil
 }
 
-func buildGroupExpression(period string) (string, string) {
+// bucketExpression truncates the local timestamp expression local to the start
+// of its period. Sunday weeks are shifted by a day around the ISO truncation.
+func bucketExpression(period, local, weekStart string) string {
 	switch period {
 	case "week":
-		return "date_trunc('week', n.date)", "IYYY-\"W\"IW"
-	case "month":
-		return "date_trunc('month', n.date)", "YYYY-MM"
-	case "year":
-		return "date_trunc('year', n.date)", "YYYY"
+		if weekStart == "sunday" {
+			return "(date_trunc('week', " + local + " + interval '1 day') - interval '1 day')"
+		}
+		return "date_trunc('week', " + local + ")"
+	case "month", "year":
+		return "date_trunc('" + period + "', " + local + ")"
 	default:
-		return "date_trunc('day', n.date)", "YYYY-MM-DD"
+		return "date_trunc('day', " + local + ")"
+	}
+}
+
+// activityValueExpression selects the stored value, or with a field path the
+// value of that field of a composite activity. Field keys are validated to
+// [a-z0-9_] when the type is defined, so they are safe to inline.
+func activityValueExpression(field []string) string {
+	if len(field) == 0 {
+		return "a.value->>'data'"
 	}
+	return "a.value #>> '{data," + strings.Join(field, ",") + "}'"
 }
 
-func buildAggregatorExpression(valueType, agg string) (string, error) {
+func buildAggregatorExpression(valueType, agg, valueExpr string) (string, error) {
 	v := strings.ToLower(valueType)
 	a := strings.ToLower(agg)
 	switch v {
 	case "integer", "float":
+		if expr, ok := statisticalAggregate(a, "("+valueExpr+")::float"); ok {
+			return expr, nil
+		}
 		switch a {
 		case "sum":
-			return "SUM((a.value->>'data')::float)", nil
+			return "SUM((" + valueExpr + ")::float)", nil
 		case "avg":
-			return "AVG((a.value->>'data')::float)", nil
+			return "AVG((" + valueExpr + ")::float)", nil
 		case "count":
 			return "COUNT(*)::float", nil
 		case "min":
-			return "MIN((a.value->>'data')::float)", nil
+			return "MIN((" + valueExpr + ")::float)", nil
 		case "max":
-			return "MAX((a.value->>'data')::float)", nil
+			return "MAX((" + valueExpr + ")::float)", nil
 		}
 	case "boolean":
 		switch a {
 		case "and":
-			return "CASE WHEN bool_and((a.value->>'data')::boolean) THEN 1.0 ELSE 0.0 END", nil
+			return "CASE WHEN bool_and((" + valueExpr + ")::boolean) THEN 1.0 ELSE 0.0 END", nil
 		case "or":
-			return "CASE WHEN bool_or((a.value->>'data')::boolean) THEN 1.0 ELSE 0.0 END", nil
+			return "CASE WHEN bool_or((" + valueExpr + ")::boolean) THEN 1.0 ELSE 0.0 END", nil
 		case "count_true":
-			return "SUM(CASE WHEN (a.value->>'data')::boolean THEN 1 ELSE 0 END)::float", nil
+			return "SUM(CASE WHEN (" + valueExpr + ")::boolean THEN 1 ELSE 0 END)::float", nil
 		case "count_false":
-			return "SUM(CASE WHEN NOT (a.value->>'data')::boolean THEN 1 ELSE 0 END)::float", nil
+			return "SUM(CASE WHEN NOT (" + valueExpr + ")::boolean THEN 1 ELSE 0 END)::float", nil
 		case "percentage_true":
-			return "AVG(CASE WHEN (a.value->>'data')::boolean THEN 1.0 ELSE 0.0 END)*100", nil
+			return "AVG(CASE WHEN (" + valueExpr + ")::boolean THEN 1.0 ELSE 0.0 END)*100", nil
 		case "percentage_false":
-			return "AVG(CASE WHEN NOT (a.value->>'data')::boolean THEN 1.0 ELSE 0.0 END)*100", nil
+			return "AVG(CASE WHEN NOT (" + valueExpr + ")::boolean THEN 1.0 ELSE 0.0 END)*100", nil
 		}
 	case "text":
 		if a == "count" {
 			return "COUNT(*)::float", nil
 		}
+	case "enum":
+		switch a {
+		case "count", "distribution":
+			return "COUNT(*)::float", nil
+		case "mode":
+			return "mode() WITHIN GROUP (ORDER BY " + valueExpr + ")", nil
+		}
+	case "composite":
+		if a == "count" {
+			return "COUNT(*)::float", nil
+		}
+	case "rating":
+		if expr, ok := statisticalAggregate(a, "("+valueExpr+")::float"); ok {
+			return expr, nil
+		}
+		switch a {
+		case "count", "distribution":
+			return "COUNT(*)::float", nil
+		case "avg":
+			return "AVG((" + valueExpr + ")::float)", nil
+		case "min":
+			return "MIN((" + valueExpr + ")::float)", nil
+		case "max":
+			return "MAX((" + valueExpr + ")::float)", nil
+		case "mode":
+			return "mode() WITHIN GROUP (ORDER BY (" + valueExpr + ")::int)::float", nil
+		}
 	case "time":
+		if expr, ok := statisticalAggregate(a, "EXTRACT(EPOCH FROM ("+valueExpr+")::interval)"); ok {
+			return expr, nil
+		}
 		if a == "sum" {
-			return "EXTRACT(EPOCH FROM SUM((a.value->>'data')::interval))", nil
+			return "EXTRACT(EPOCH FROM SUM((" + valueExpr + ")::interval))", nil
 		} else if a == "avg" {
-			return "EXTRACT(EPOCH FROM AVG((a.value->>'data')::interval))", nil
+			return "EXTRACT(EPOCH FROM AVG((" + valueExpr + ")::interval))", nil
 		} else if a == "count" {
 			return "COUNT(*)::float", nil
 		} else if a == "min" {
-			return "EXTRACT(EPOCH FROM MIN((a.value->>'data')::interval))", nil
+			return "EXTRACT(EPOCH FROM MIN((" + valueExpr + ")::interval))", nil
 		} else if a == "max" {
-			return "EXTRACT(EPOCH FROM MAX((a.value->>'data')::interval))", nil
+			return "EXTRACT(EPOCH FROM MAX((" + valueExpr + ")::interval))", nil
 		}
 	}
 	return "", errors.New("unsupported aggregator for this value type")
 }
+
+// AggregationSupported reports whether agg can aggregate values of valueType.
+func AggregationSupported(valueType, agg string) bool {
+	_, err := buildAggregatorExpression(valueType, agg, "a.value->>'data'")
+	return err == nil
+}
+
+// statisticalAggregate builds the order statistics and dispersion measures of
+// numeric values: median, pNN percentiles, stddev and variance. numExpr must
+// be a float expression. Dispersion of a single value is 0.
+func statisticalAggregate(agg, numExpr string) (string, bool) {
+	switch agg {
+	case "median":
+		return "percentile_cont(0.5) WITHIN GROUP (ORDER BY " + numExpr + ")", true
+	case "stddev":
+		return "COALESCE(stddev_samp(" + numExpr + "), 0)", true
+	case "variance":
+		return "COALESCE(var_samp(" + numExpr + "), 0)", true
+	}
+	if p, ok := types.ParsePercentile(agg); ok {
+		return "percentile_cont(" + strconv.FormatFloat(float64(p)/100, 'f', -1, 64) + ") WITHIN GROUP (ORDER BY " + numExpr + ")", true
+	}
+	return "", false
+}
+
+// windowExpression derives the transformed value from the per-period values
+// of a subquery with columns bucket and value, bucket being the start of a
+// period. Moving averages span the last 7 or 30 periods by date, so periods
+// without data shorten the average instead of pulling older ones in; filled
+// periods count with their value.
+func windowExpression(transform, period string) (string, error) {
+	switch transform {
+	case "ma7":
+		return "AVG(value) OVER (ORDER BY bucket RANGE BETWEEN interval '6 " + period + "' PRECEDING AND CURRENT ROW)", nil
+	case "ma30":
+		return "AVG(value) OVER (ORDER BY bucket RANGE BETWEEN interval '29 " + period + "' PRECEDING AND CURRENT ROW)", nil
+	case "cumsum":
+		return "SUM(value) OVER (ORDER BY bucket ROWS UNBOUNDED PRECEDING)", nil
+	}
+	return "", errors.New("unsupported transform")
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"focuz-api/models"
 	"strings"
@@ -16,14 +17,22 @@ func NewActivityTypesRepository(db *sql.DB) *ActivityTypesRepository {
 	return &ActivityTypesRepository{db: db}
 }
 
-func (r *ActivityTypesRepository) CreateActivityType(name, valueType string, minValue, maxValue *float64, aggregation string, spaceID *int, categoryID *int, unit *string) (*models.ActivityType, error) {
+func (r *ActivityTypesRepository) CreateActivityType(name, valueType string, minValue, maxValue *float64, aggregation string, spaceID *int, categoryID *int, unit *string, options []models.ActivityTypeOption, fields []models.ActivityField) (*models.ActivityType, error) {
+	opts, err := jsonbParam(len(options), options)
+	if err != nil {
+		return nil, err
+	}
+	flds, err := jsonbParam(len(fields), fields)
+	if err != nil {
+		return nil, err
+	}
 	var id int
 	now := time.Now()
-	err := r.db.QueryRow(`
-		INSERT INTO activity_types (name, value_type, min_value, max_value, aggregation, space_id, category_id, unit, created_at, modified_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $9)
+	err = r.db.QueryRow(`
+		INSERT INTO activity_types (name, value_type, min_value, max_value, aggregation, space_id, category_id, unit, options, fields, created_at, modified_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $11)
 		RETURNING id
-	`, name, valueType, minValue, maxValue, aggregation, spaceID, categoryID, unit, now).Scan(&id)
+	`, name, valueType, minValue, maxValue, aggregation, spaceID, categoryID, unit, opts, flds, now).Scan(&id)
 	if err != nil {
 		if strings.Contains(strings.ToLower(err.Error()), "duplicate key") {
 			return nil, errors.New("name conflict in this space")
@@ -34,56 +43,107 @@ func (r *ActivityTypesRepository) CreateActivityType(name, valueType string, min
 }
 
 func (r *ActivityTypesRepository) GetActivityTypeByID(id int) (*models.ActivityType, error) {
-	var a models.ActivityType
-	var spaceID sql.NullInt64
-	var categoryID sql.NullInt64
-	var minVal sql.NullFloat64
-	var maxVal sql.NullFloat64
-	var unit sql.NullString
-	err := r.db.QueryRow(`
-		SELECT id, name, value_type, min_value, max_value, aggregation, space_id, is_default, is_deleted, unit, category_id, created_at, modified_at
+	a, err := scanActivityType(r.db.QueryRow(`
+		SELECT id, name, value_type, min_value, max_value, aggregation, space_id, is_default, is_deleted, unit, category_id, options, fields, created_at, modified_at
 		FROM activity_types
 		WHERE id = $1
-	`, id).Scan(
-		&a.ID,
-		&a.Name,
-		&a.ValueType,
-		&minVal,
-		&maxVal,
-		&a.Aggregation,
-		&spaceID,
-		&a.IsDefault,
-		&a.IsDeleted,
-		&unit,
-		&categoryID,
-		&a.CreatedAt,
-		&a.ModifiedAt,
-	)
+	`, id))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, err
 	}
-	if spaceID.Valid {
-		a.SpaceID = int(spaceID.Int64)
+	return a, nil
+}
+
+// UpdateActivityType rewrites the editable fields of t and, when values is
+// non-nil, the stored values of its activities in the same transaction.
+func (r *ActivityTypesRepository) UpdateActivityType(t *models.ActivityType, values map[int][]byte) error {
+	opts, err := jsonbParam(len(t.Options), t.Options)
+	if err != nil {
+		return err
 	}
-	if categoryID.Valid {
-		a.CategoryID = int(categoryID.Int64)
+	flds, err := jsonbParam(len(t.Fields), t.Fields)
+	if err != nil {
+		return err
 	}
-	if minVal.Valid {
-		f := minVal.Float64
-		a.MinValue = &f
+	var categoryID *int
+	if t.CategoryID != 0 {
+		categoryID = &t.CategoryID
 	}
-	if maxVal.Valid {
-		f := maxVal.Float64
-		a.MaxValue = &f
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
 	}
-	if unit.Valid {
-		u := unit.String
-		a.Unit = &u
+	defer tx.Rollback()
+	_, err = tx.Exec(`
+		UPDATE activity_types
+		SET name = $1, value_type = $2, min_value = $3, max_value = $4, aggregation = $5,
+			category_id = $6, unit = $7, options = $8, fields = $9, modified_at = NOW()
+		WHERE id = $10
+	`, t.Name, t.ValueType, t.MinValue, t.MaxValue, t.Aggregation, categoryID, t.Unit, opts, flds, t.ID)
+	if err != nil {
+		if strings.Contains(strings.ToLower(err.Error()), "duplicate key") {
+			return errors.New("name conflict in this space")
+		}
+		return err
 	}
-	return &a, nil
+	for activityID, value := range values {
+		_, err = tx.Exec(`
+			UPDATE activities
+			SET value = $1, modified_at = NOW()
+			WHERE id = $2 AND type_id = $3
+		`, value, activityID, t.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetActivityValuesByType returns the raw stored value of every activity of a
+// type, including deleted ones, keyed by activity ID.
+func (r *ActivityTypesRepository) GetActivityValuesByType(typeID int) (map[int]string, error) {
+	rows, err := r.db.Query(`
+		SELECT id, COALESCE(value->>'data', '')
+		FROM activities
+		WHERE type_id = $1
+	`, typeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var raw string
+		if err := rows.Scan(&id, &raw); err != nil {
+			return nil, err
+		}
+		result[id] = raw
+	}
+	return result, rows.Err()
+}
+
+// GetStoredActivityValuesByType returns the stored JSON value of every
+// activity of a type, including deleted ones, keyed by activity ID.
+func (r *ActivityTypesRepository) GetStoredActivityValuesByType(typeID int) (map[int][]byte, error) {
+	rows, err := r.db.Query(`SELECT id, value FROM activities WHERE type_id = $1`, typeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := make(map[int][]byte)
+	for rows.Next() {
+		var id int
+		var value []byte
+		if err := rows.Scan(&id, &value); err != nil {
+			return nil, err
+		}
+		result[id] = value
+	}
+	return result, rows.Err()
 }
 
 func (r *ActivityTypesRepository) UpdateActivityTypeDeleted(id int, isDeleted bool) error {
@@ -98,7 +158,7 @@ func (r *ActivityTypesRepository) UpdateActivityTypeDeleted(id int, isDeleted bo
 // New method
 func (r *ActivityTypesRepository) GetActivityTypesBySpace(spaceID int) ([]*models.ActivityType, error) {
 	rows, err := r.db.Query(`
-		SELECT id, name, value_type, min_value, max_value, aggregation, space_id, is_default, is_deleted, unit, category_id, created_at, modified_at
+		SELECT id, name, value_type, min_value, max_value, aggregation, space_id, is_default, is_deleted, unit, category_id, options, fields, created_at, modified_at
 		FROM activity_types
 		WHERE 
 			is_deleted = false
@@ -115,50 +175,11 @@ func (r *ActivityTypesRepository) GetActivityTypesBySpace(spaceID int) ([]*model
 
 	var result []*models.ActivityType
 	for rows.Next() {
-		var a models.ActivityType
-		var dbSpaceID sql.NullInt64
-		var categoryID sql.NullInt64
-		var minVal sql.NullFloat64
-		var maxVal sql.NullFloat64
-		var unit sql.NullString
-
-		err := rows.Scan(
-			&a.ID,
-			&a.Name,
-			&a.ValueType,
-			&minVal,
-			&maxVal,
-			&a.Aggregation,
-			&dbSpaceID,
-			&a.IsDefault,
-			&a.IsDeleted,
-			&unit,
-			&categoryID,
-			&a.CreatedAt,
-			&a.ModifiedAt,
-		)
+		a, err := scanActivityType(rows)
 		if err != nil {
 			return nil, err
 		}
-		if dbSpaceID.Valid {
-			a.SpaceID = int(dbSpaceID.Int64)
-		}
-		if categoryID.Valid {
-			a.CategoryID = int(categoryID.Int64)
-		}
-		if minVal.Valid {
-			f := minVal.Float64
-			a.MinValue = &f
-		}
-		if maxVal.Valid {
-			f := maxVal.Float64
-			a.MaxValue = &f
-		}
-		if unit.Valid {
-			u := unit.String
-			a.Unit = &u
-		}
-		result = append(result, &a)
+		result = append(result, a)
 	}
 	return result, nil
 }
@@ -182,7 +203,7 @@ func (r *ActivityTypesRepository) GetActivityTypesBySpacePaginated(spaceID, offs
 
 	// Get data with pagination
 	rows, err := r.db.Query(`
-		SELECT id, name, value_type, min_value, max_value, aggregation, space_id, is_default, is_deleted, unit, category_id, created_at, modified_at
+		SELECT id, name, value_type, min_value, max_value, aggregation, space_id, is_default, is_deleted, unit, category_id, options, fields, created_at, modified_at
 		FROM activity_types
 		WHERE 
 			is_deleted = false
@@ -200,50 +221,83 @@ func (r *ActivityTypesRepository) GetActivityTypesBySpacePaginated(spaceID, offs
 
 	var result []*models.ActivityType
 	for rows.Next() {
-		var a models.ActivityType
-		var dbSpaceID sql.NullInt64
-		var categoryID sql.NullInt64
-		var minVal sql.NullFloat64
-		var maxVal sql.NullFloat64
-		var unit sql.NullString
-
-		err := rows.Scan(
-			&a.ID,
-			&a.Name,
-			&a.ValueType,
-			&minVal,
-			&maxVal,
-			&a.Aggregation,
-			&dbSpaceID,
-			&a.IsDefault,
-			&a.IsDeleted,
-			&unit,
-			&categoryID,
-			&a.CreatedAt,
-			&a.ModifiedAt,
-		)
+		a, err := scanActivityType(rows)
 		if err != nil {
 			return nil, 0, err
 		}
-		if dbSpaceID.Valid {
-			a.SpaceID = int(dbSpaceID.Int64)
-		}
-		if categoryID.Valid {
-			a.CategoryID = int(categoryID.Int64)
-		}
-		if minVal.Valid {
-			f := minVal.Float64
-			a.MinValue = &f
-		}
-		if maxVal.Valid {
-			f := maxVal.Float64
-			a.MaxValue = &f
+		result = append(result, a)
+	}
+	return result, total, nil
+}
+
+func scanActivityType(row rowScanner) (*models.ActivityType, error) {
+	var a models.ActivityType
+	var spaceID sql.NullInt64
+	var categoryID sql.NullInt64
+	var minVal sql.NullFloat64
+	var maxVal sql.NullFloat64
+	var unit sql.NullString
+	var options []byte
+	var fields []byte
+	err := row.Scan(
+		&a.ID,
+		&a.Name,
+		&a.ValueType,
+		&minVal,
+		&maxVal,
+		&a.Aggregation,
+		&spaceID,
+		&a.IsDefault,
+		&a.IsDeleted,
+		&unit,
+		&categoryID,
+		&options,
+		&fields,
+		&a.CreatedAt,
+		&a.ModifiedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if spaceID.Valid {
+		a.SpaceID = int(spaceID.Int64)
+	}
+	if categoryID.Valid {
+		a.CategoryID = int(categoryID.Int64)
+	}
+	if minVal.Valid {
+		f := minVal.Float64
+		a.MinValue = &f
+	}
+	if maxVal.Valid {
+		f := maxVal.Float64
+		a.MaxValue = &f
+	}
+	if unit.Valid {
+		u := unit.String
+		a.Unit = &u
+	}
+	if len(options) > 0 {
+		if err := json.Unmarshal(options, &a.Options); err != nil {
+			return nil, err
 		}
-		if unit.Valid {
-			u := unit.String
-			a.Unit = &u
+	}
+	if len(fields) > 0 {
+		if err := json.Unmarshal(fields, &a.Fields); err != nil {
+			return nil, err
 		}
-		result = append(result, &a)
 	}
-	return result, total, nil
+	return &a, nil
+}
+
+// jsonbParam encodes a list of n items for a JSONB column; an empty list is NULL.
+func jsonbParam(n int, v interface{}) (interface{}, error) {
+	if n == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
 }
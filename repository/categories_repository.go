@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"focuz-api/models"
+	"strings"
+)
+
+type CategoriesRepository struct {
+	db *sql.DB
+}
+
+func NewCategoriesRepository(db *sql.DB) *CategoriesRepository {
+	return &CategoriesRepository{db: db}
+}
+
+const categoryColumns = `id, space_id, name, icon, sort_order, is_deleted, created_at, modified_at`
+
+func scanCategory(row rowScanner) (*models.ActivityTypeCategory, error) {
+	var c models.ActivityTypeCategory
+	var spaceID sql.NullInt64
+	var icon sql.NullString
+	if err := row.Scan(&c.ID, &spaceID, &c.Name, &icon, &c.SortOrder, &c.IsDeleted, &c.CreatedAt, &c.ModifiedAt); err != nil {
+		return nil, err
+	}
+	if spaceID.Valid {
+		id := int(spaceID.Int64)
+		c.SpaceID = &id
+	}
+	c.IsDefault = c.SpaceID == nil
+	if icon.Valid {
+		i := icon.String
+		c.Icon = &i
+	}
+	return &c, nil
+}
+
+// categoryNameError maps unique violations of the per-space name index.
+func categoryNameError(err error) error {
+	if err != nil && strings.Contains(strings.ToLower(err.Error()), "duplicate key") {
+		return errors.New("name conflict in this space")
+	}
+	return err
+}
+
+// nameTakenByDefault reports whether a live default category has the name;
+// custom categories may not shadow it.
+func (r *CategoriesRepository) nameTakenByDefault(name string) (bool, error) {
+	var exists bool
+	err := r.db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM activity_type_category
+			WHERE space_id IS NULL AND is_deleted = FALSE AND lower(name) = lower($1)
+		)
+	`, name).Scan(&exists)
+	return exists, err
+}
+
+func (r *CategoriesRepository) Create(c *models.ActivityTypeCategory) (*models.ActivityTypeCategory, error) {
+	taken, err := r.nameTakenByDefault(c.Name)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, errors.New("name conflict in this space")
+	}
+	created, err := scanCategory(r.db.QueryRow(`
+		INSERT INTO activity_type_category (space_id, name, icon, sort_order, created_at, modified_at)
+		VALUES ($1, $2, $3, $4, NOW(), NOW())
+		RETURNING `+categoryColumns,
+		c.SpaceID, c.Name, c.Icon, c.SortOrder))
+	return created, categoryNameError(err)
+}
+
+func (r *CategoriesRepository) GetByID(id int) (*models.ActivityTypeCategory, error) {
+	c, err := scanCategory(r.db.QueryRow(`SELECT `+categoryColumns+` FROM activity_type_category WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return c, err
+}
+
+func (r *CategoriesRepository) Update(c *models.ActivityTypeCategory) error {
+	taken, err := r.nameTakenByDefault(c.Name)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return errors.New("name conflict in this space")
+	}
+	_, err = r.db.Exec(`
+		UPDATE activity_type_category
+		SET name = $1, icon = $2, sort_order = $3, modified_at = NOW()
+		WHERE id = $4
+	`, c.Name, c.Icon, c.SortOrder, c.ID)
+	return categoryNameError(err)
+}
+
+// SetDeleted soft deletes or restores a category. Its activity types keep
+// their category_id and are listed as uncategorized while it is deleted.
+func (r *CategoriesRepository) SetDeleted(id int, isDeleted bool) error {
+	_, err := r.db.Exec(`
+		UPDATE activity_type_category
+		SET is_deleted = $1, modified_at = NOW()
+		WHERE id = $2
+	`, isDeleted, id)
+	return categoryNameError(err)
+}
+
+// ListBySpace returns the default categories and the space's custom ones,
+// ordered by sort order and name.
+func (r *CategoriesRepository) ListBySpace(spaceID int) ([]*models.ActivityTypeCategory, error) {
+	rows, err := r.db.Query(`
+		SELECT `+categoryColumns+`
+		FROM activity_type_category
+		WHERE is_deleted = FALSE AND (space_id IS NULL OR space_id = $1)
+		ORDER BY sort_order, lower(name), id
+	`, spaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := make([]*models.ActivityTypeCategory, 0)
+	for rows.Next() {
+		c, err := scanCategory(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, c)
+	}
+	return result, rows.Err()
+}
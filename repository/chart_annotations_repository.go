@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"database/sql"
+	"focuz-api/models"
+	"focuz-api/types"
+	"sort"
+	"time"
+)
+
+// maxTagAnnotations bounds the annotations derived from tagged notes that a
+// chart returns; the latest notes are kept.
+const maxTagAnnotations = 500
+
+type ChartAnnotationsRepository struct {
+	db *sql.DB
+}
+
+func NewChartAnnotationsRepository(db *sql.DB) *ChartAnnotationsRepository {
+	return &ChartAnnotationsRepository{db: db}
+}
+
+const chartAnnotationColumns = `id, chart_id, user_id, to_char(date, 'YYYY-MM-DD'), to_char(end_date, 'YYYY-MM-DD'), label, note_id, is_deleted, created_at, modified_at`
+
+func scanChartAnnotation(row rowScanner) (*models.ChartAnnotation, error) {
+	a := models.ChartAnnotation{Source: "manual"}
+	err := row.Scan(&a.ID, &a.ChartID, &a.UserID, &a.Date, &a.EndDate, &a.Label, &a.NoteID, &a.IsDeleted, &a.CreatedAt, &a.ModifiedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (r *ChartAnnotationsRepository) Create(a *models.ChartAnnotation) (*models.ChartAnnotation, error) {
+	return scanChartAnnotation(r.db.QueryRow(`
+		INSERT INTO chart_annotations (chart_id, user_id, date, end_date, label, note_id, created_at, modified_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW())
+		RETURNING `+chartAnnotationColumns,
+		a.ChartID, a.UserID, a.Date, a.EndDate, a.Label, a.NoteID))
+}
+
+func (r *ChartAnnotationsRepository) GetByID(id int) (*models.ChartAnnotation, error) {
+	a, err := scanChartAnnotation(r.db.QueryRow(`SELECT `+chartAnnotationColumns+` FROM chart_annotations WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (r *ChartAnnotationsRepository) Update(a *models.ChartAnnotation) error {
+	_, err := r.db.Exec(`
+		UPDATE chart_annotations
+		SET date = $1, end_date = $2, label = $3, note_id = $4, modified_at = NOW()
+		WHERE id = $5
+	`, a.Date, a.EndDate, a.Label, a.NoteID, a.ID)
+	return err
+}
+
+func (r *ChartAnnotationsRepository) UpdateDeleted(id int, isDeleted bool) error {
+	_, err := r.db.Exec(`
+		UPDATE chart_annotations
+		SET is_deleted = $1, modified_at = NOW()
+		WHERE id = $2
+	`, isDeleted, id)
+	return err
+}
+
+// List returns the live annotations of the chart by date: its own, then
+// one for each note of its space carrying its annotation tag, on the note's
+// local date in zone and labelled with the note's first line. With inRange
+// only annotations overlapping the chart's range are returned, when it has
+// one.
+func (r *ChartAnnotationsRepository) List(chart *models.Chart, zone models.UserSettings, inRange bool) ([]models.ChartAnnotation, error) {
+	var from, to *string
+	if inRange && (chart.RangeDays != nil || chart.RangeFrom != nil) {
+		loc, err := zone.Location()
+		if err != nil {
+			return nil, err
+		}
+		period := "day"
+		if p := types.GetPeriodTypeByID(chart.PeriodID); p != nil {
+			period = p.Name
+		}
+		start, end, err := chartRange(chart, period, models.WallTime(time.Now(), loc))
+		if err != nil {
+			return nil, err
+		}
+		f, t := start.Format("2006-01-02"), end.Format("2006-01-02")
+		from, to = &f, &t
+	}
+
+	rows, err := r.db.Query(`
+		SELECT `+chartAnnotationColumns+`
+		FROM chart_annotations
+		WHERE chart_id = $1 AND is_deleted = FALSE
+		  AND ($2::date IS NULL OR COALESCE(end_date, date) >= $2::date)
+		  AND ($3::date IS NULL OR date <= $3::date)
+		ORDER BY date, id
+	`, chart.ID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	annotations := make([]models.ChartAnnotation, 0)
+	for rows.Next() {
+		a, err := scanChartAnnotation(rows)
+		if err != nil {
+			return nil, err
+		}
+		annotations = append(annotations, *a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if chart.AnnotationTag == nil {
+		return annotations, nil
+	}
+
+	local := "(n.date AT TIME ZONE 'UTC' AT TIME ZONE $3)::date"
+	tagged, err := r.db.Query(`
+		SELECT n.id, n.user_id, to_char(`+local+`, 'YYYY-MM-DD'), left(split_part(btrim(n.text), E'\n', 1), 255), n.created_at, n.modified_at
+		FROM note n
+		WHERE n.space_id = $1 AND n.is_deleted = FALSE
+		  AND EXISTS (SELECT 1 FROM note_to_tag nt JOIN tag t ON t.id = nt.tag_id WHERE nt.note_id = n.id AND t.name = $2)
+		  AND ($4::date IS NULL OR `+local+` >= $4::date)
+		  AND ($5::date IS NULL OR `+local+` <= $5::date)
+		ORDER BY n.date DESC, n.id DESC
+		LIMIT $6
+	`, chart.SpaceID, *chart.AnnotationTag, zone.Timezone, from, to, maxTagAnnotations)
+	if err != nil {
+		return nil, err
+	}
+	defer tagged.Close()
+	for tagged.Next() {
+		a := models.ChartAnnotation{ChartID: chart.ID, Source: "tag"}
+		var noteID int
+		if err := tagged.Scan(&noteID, &a.UserID, &a.Date, &a.Label, &a.CreatedAt, &a.ModifiedAt); err != nil {
+			return nil, err
+		}
+		a.NoteID = &noteID
+		annotations = append(annotations, a)
+	}
+	if err := tagged.Err(); err != nil {
+		return nil, err
+	}
+	// Stored annotations stay first on their day
+	sort.SliceStable(annotations, func(i, j int) bool { return annotations[i].Date < annotations[j].Date })
+	return annotations, nil
+}
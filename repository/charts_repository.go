@@ -2,10 +2,17 @@ package repository
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"focuz-api/models"
+	"focuz-api/pkg/stats"
 	"focuz-api/types"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 type ChartsRepository struct {
@@ -16,58 +23,101 @@ func NewChartsRepository(db *sql.DB) *ChartsRepository {
 	return &ChartsRepository{db: db}
 }
 
-func (r *ChartsRepository) CreateChart(userID, spaceID, kindID, activityTypeID, periodID int, name string, description *string, noteID *int) (*models.Chart, error) {
+const chartColumns = `id, user_id, space_id, kind, activity_type_id, field_path, aggregation, transform, range_days, to_char(range_from, 'YYYY-MM-DD'), to_char(range_to, 'YYYY-MM-DD'), fill, series, options, tags, filter_id, annotation_tag, period, name, description, note_id, is_deleted, created_at, modified_at`
+
+func scanChart(row rowScanner) (*models.Chart, error) {
 	var chart models.Chart
-	err := r.db.QueryRow(`
-		INSERT INTO chart (user_id, space_id, kind, activity_type_id, period, name, description, note_id, created_at, modified_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW(), NOW())
-		RETURNING id, user_id, space_id, kind, activity_type_id, period, name, description, note_id, created_at, modified_at
-	`, userID, spaceID, kindID, activityTypeID, periodID, name, description, noteID).Scan(
+	var series, options []byte
+	err := row.Scan(
 		&chart.ID,
 		&chart.UserID,
 		&chart.SpaceID,
 		&chart.KindID,
 		&chart.ActivityTypeID,
+		&chart.FieldPath,
+		&chart.Aggregation,
+		&chart.Transform,
+		&chart.RangeDays,
+		&chart.RangeFrom,
+		&chart.RangeTo,
+		&chart.Fill,
+		&series,
+		&options,
+		pq.Array(&chart.Tags),
+		&chart.FilterID,
+		&chart.AnnotationTag,
 		&chart.PeriodID,
 		&chart.Name,
 		&chart.Description,
 		&chart.NoteID,
+		&chart.IsDeleted,
 		&chart.CreatedAt,
 		&chart.ModifiedAt,
 	)
 	if err != nil {
 		return nil, err
 	}
+	if len(series) > 0 {
+		if err := json.Unmarshal(series, &chart.Series); err != nil {
+			return nil, err
+		}
+	}
+	if len(options) > 0 {
+		if err := json.Unmarshal(options, &chart.Options); err != nil {
+			return nil, err
+		}
+	}
+	// The chart's own columns describe the first series
+	first := models.ChartSeries{Axis: "left"}
+	if len(chart.Series) > 0 {
+		first = chart.Series[0]
+	} else {
+		chart.Series = make([]models.ChartSeries, 1)
+	}
+	first.ActivityTypeID, first.FieldPath, first.Aggregation = chart.ActivityTypeID, chart.FieldPath, chart.Aggregation
+	chart.Series[0] = first
 	return &chart, nil
 }
 
+func (r *ChartsRepository) CreateChart(c *models.Chart) (*models.Chart, error) {
+	series, options, err := chartJSON(c)
+	if err != nil {
+		return nil, err
+	}
+	return scanChart(r.db.QueryRow(`
+		INSERT INTO chart (user_id, space_id, kind, activity_type_id, period, name, description, note_id, field_path, aggregation, transform, range_days, range_from, range_to, fill, series, options, tags, filter_id, annotation_tag, created_at, modified_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, NOW(), NOW())
+		RETURNING `+chartColumns,
+		c.UserID, c.SpaceID, c.KindID, c.ActivityTypeID, c.PeriodID, c.Name, c.Description, c.NoteID, c.FieldPath, c.Aggregation, c.Transform, c.RangeDays, c.RangeFrom, c.RangeTo, c.Fill, series, options, pq.Array(c.Tags), c.FilterID, c.AnnotationTag))
+}
+
+// chartJSON encodes the series and options of a chart for their JSONB
+// columns; a chart without them stores NULL.
+func chartJSON(c *models.Chart) (interface{}, interface{}, error) {
+	series, err := jsonbParam(len(c.Series), c.Series)
+	if err != nil {
+		return nil, nil, err
+	}
+	var options interface{}
+	if c.Options != nil {
+		b, err := json.Marshal(c.Options)
+		if err != nil {
+			return nil, nil, err
+		}
+		options = string(b)
+	}
+	return series, options, nil
+}
+
 func (r *ChartsRepository) GetChartByID(id int) (*models.Chart, error) {
-	var chart models.Chart
-	err := r.db.QueryRow(`
-		SELECT id, user_id, space_id, kind, activity_type_id, period, name, description, note_id, is_deleted, created_at, modified_at
-		FROM chart
-		WHERE id = $1
-	`, id).Scan(
-		&chart.ID,
-		&chart.UserID,
-		&chart.SpaceID,
-		&chart.KindID,
-		&chart.ActivityTypeID,
-		&chart.PeriodID,
-		&chart.Name,
-		&chart.Description,
-		&chart.NoteID,
-		&chart.IsDeleted,
-		&chart.CreatedAt,
-		&chart.ModifiedAt,
-	)
+	chart, err := scanChart(r.db.QueryRow(`SELECT `+chartColumns+` FROM chart WHERE id = $1`, id))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, err
 	}
-	return &chart, nil
+	return chart, nil
 }
 
 func (r *ChartsRepository) UpdateChartDeleted(id int, isDeleted bool) error {
@@ -79,12 +129,18 @@ func (r *ChartsRepository) UpdateChartDeleted(id int, isDeleted bool) error {
 	return err
 }
 
-func (r *ChartsRepository) UpdateChart(id int, kindID, activityTypeID, periodID int, name string, description *string, noteID *int) error {
-	_, err := r.db.Exec(`
+func (r *ChartsRepository) UpdateChart(c *models.Chart) error {
+	series, options, err := chartJSON(c)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(`
 		UPDATE chart
-		SET kind = $1, activity_type_id = $2, period = $3, name = $4, description = $5, note_id = $6, modified_at = NOW()
-		WHERE id = $7
-	`, kindID, activityTypeID, periodID, name, description, noteID, id)
+		SET kind = $1, activity_type_id = $2, period = $3, name = $4, description = $5, note_id = $6, field_path = $7, aggregation = $8, transform = $9,
+		    range_days = $10, range_from = $11, range_to = $12, fill = $13, series = $14, options = $15,
+		    tags = $16, filter_id = $17, annotation_tag = $18, modified_at = NOW()
+		WHERE id = $19
+	`, c.KindID, c.ActivityTypeID, c.PeriodID, c.Name, c.Description, c.NoteID, c.FieldPath, c.Aggregation, c.Transform, c.RangeDays, c.RangeFrom, c.RangeTo, c.Fill, series, options, pq.Array(c.Tags), c.FilterID, c.AnnotationTag, c.ID)
 	return err
 }
 
@@ -100,7 +156,7 @@ func (r *ChartsRepository) GetCharts(spaceID int, filters models.ChartFilters) (
 	idx++
 
 	query := `
-		SELECT c.id, c.user_id, c.space_id, c.kind, c.activity_type_id, c.period, c.name, c.description, c.note_id, c.created_at, c.modified_at
+		SELECT ` + chartColumns + `
 		FROM chart c
 	`
 
@@ -120,24 +176,11 @@ func (r *ChartsRepository) GetCharts(spaceID int, filters models.ChartFilters) (
 
 	var charts []*models.Chart
 	for rows.Next() {
-		var chart models.Chart
-		err := rows.Scan(
-			&chart.ID,
-			&chart.UserID,
-			&chart.SpaceID,
-			&chart.KindID,
-			&chart.ActivityTypeID,
-			&chart.PeriodID,
-			&chart.Name,
-			&chart.Description,
-			&chart.NoteID,
-			&chart.CreatedAt,
-			&chart.ModifiedAt,
-		)
+		chart, err := scanChart(rows)
 		if err != nil {
 			return nil, 0, err
 		}
-		charts = append(charts, &chart)
+		charts = append(charts, chart)
 	}
 
 	var total int
@@ -156,82 +199,633 @@ func (r *ChartsRepository) GetCharts(spaceID int, filters models.ChartFilters) (
 	return charts, total, nil
 }
 
-func (r *ChartsRepository) GetChartData(chart *models.Chart) ([]models.ChartDataPoint, error) {
-	var startDate time.Time
-	var endDate = time.Now()
-
+// GetChartData aggregates each series of the chart over its range, bucketed
+// by its period in zone, and aligns them by bucket. Points are dated with the
+// start of their bucket in that zone. With fill zero or null every bucket of
+// the range is returned, so transforms count empty buckets too.
+func (r *ChartsRepository) GetChartData(chart *models.Chart, zone models.UserSettings) ([]models.ChartDataPoint, error) {
+	loc, err := zone.Location()
+	if err != nil {
+		return nil, err
+	}
 	periodType := types.GetPeriodTypeByID(chart.PeriodID)
 	if periodType == nil {
 		return nil, nil
 	}
-
-	switch periodType.Name {
-	case "day":
-		startDate = endDate.AddDate(0, 0, -1)
-	case "week":
-		startDate = endDate.AddDate(0, 0, -7)
-	case "month":
-		startDate = endDate.AddDate(0, -1, 0)
-	case "year":
-		startDate = endDate.AddDate(-1, 0, 0)
-	default:
-		startDate = endDate.AddDate(0, 0, -7) // Default to week
+	startDate, endDate, err := chartRange(chart, periodType.Name, models.WallTime(time.Now(), loc))
+	if err != nil {
+		return nil, err
 	}
+	return r.chartPoints(chart, periodType.Name, startDate, endDate, nil, zone)
+}
 
-	// Сначала получаем тип агрегации
-	var aggregation string
+// GetDataVersion returns a value that changes whenever the chart's data may
+// have: when the chart, the activity types of its series, their activities in
+// the space or the notes of those activities (whose date and deletion move or
+// drop them) change, and for charts scoped by tags or a saved filter when any
+// note or filter of the space does. It does not account for time passing.
+func (r *ChartsRepository) GetDataVersion(chart *models.Chart) (string, error) {
+	typeIDs := make([]int64, len(chart.Series))
+	byTags := len(chart.Tags) > 0
+	for i, s := range chart.Series {
+		typeIDs[i] = int64(s.ActivityTypeID)
+		byTags = byTags || len(s.Tags) > 0
+	}
+	var version string
 	err := r.db.QueryRow(`
-		SELECT aggregation
+		SELECT concat_ws('/',
+			(SELECT COUNT(*) || ':' || COALESCE(MAX(modified_at)::text, '') FROM activities WHERE space_id = $1 AND type_id = ANY($2)),
+			(SELECT COALESCE(MAX(modified_at)::text, '') FROM activity_types WHERE id = ANY($2)),
+			(SELECT COALESCE(MAX(n.modified_at)::text, '') FROM activities a JOIN note n ON n.id = a.note_id WHERE a.space_id = $1 AND a.type_id = ANY($2)),
+			CASE WHEN $3 THEN (SELECT COUNT(*) || ':' || COALESCE(MAX(modified_at)::text, '') FROM note WHERE space_id = $1) END,
+			CASE WHEN $4 THEN (SELECT COALESCE(MAX(modified_at)::text, '') FROM filters WHERE space_id = $1) END)
+	`, chart.SpaceID, pq.Array(typeIDs), byTags || chart.FilterID != nil, chart.FilterID != nil).Scan(&version)
+	if err != nil {
+		return "", err
+	}
+	return chart.ModifiedAt.Format(time.RFC3339Nano) + "/" + version, nil
+}
+
+// chartPoints aggregates and aligns the series of the chart between the local
+// wall times startDate and endDate, with the activities moved forward by
+// shift when given.
+func (r *ChartsRepository) chartPoints(chart *models.Chart, period string, startDate, endDate time.Time, shift *comparisonShift, zone models.UserSettings) ([]models.ChartDataPoint, error) {
+	loc, err := zone.Location()
+	if err != nil {
+		return nil, err
+	}
+	series := chart.Series
+	if len(series) == 0 {
+		series = []models.ChartSeries{{ActivityTypeID: chart.ActivityTypeID, FieldPath: chart.FieldPath, Aggregation: chart.Aggregation}}
+	}
+	transform := chart.Transform != nil && *chart.Transform != ""
+
+	byBucket := make(map[int64]*models.ChartDataPoint)
+	var buckets []time.Time
+	for i, s := range series {
+		values, err := r.getSeriesData(chart, s, period, startDate, endDate, shift, zone)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range values {
+			point, ok := byBucket[v.bucket.Unix()]
+			if !ok {
+				point = &models.ChartDataPoint{
+					Date:   models.ZonedTime(v.bucket, loc),
+					Values: make([]*float64, len(series)),
+				}
+				if transform {
+					point.BaseValues = make([]*float64, len(series))
+				}
+				byBucket[v.bucket.Unix()] = point
+				buckets = append(buckets, v.bucket)
+			}
+			point.Values[i] = v.value
+			if transform {
+				point.BaseValues[i] = v.base
+			}
+		}
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Before(buckets[j]) })
+
+	var dataPoints []models.ChartDataPoint
+	for _, b := range buckets {
+		point := byBucket[b.Unix()]
+		point.Value = point.Values[0]
+		if transform {
+			point.BaseValue = point.BaseValues[0]
+		}
+		dataPoints = append(dataPoints, *point)
+	}
+	return dataPoints, nil
+}
+
+// GetChartComparison returns the chart data of its range next to that of the
+// range compare (previous or year_ago) points back to. Compared buckets are
+// aligned with the buckets they fall into once moved forward, so the last
+// week lines up with this one and last October with this October.
+func (r *ChartsRepository) GetChartComparison(chart *models.Chart, compare string, zone models.UserSettings) (*models.ChartComparison, error) {
+	loc, err := zone.Location()
+	if err != nil {
+		return nil, err
+	}
+	periodType := types.GetPeriodTypeByID(chart.PeriodID)
+	if periodType == nil {
+		return nil, errors.New("invalid period type")
+	}
+	startDate, endDate, err := chartRange(chart, periodType.Name, models.WallTime(time.Now(), loc))
+	if err != nil {
+		return nil, err
+	}
+	shift, err := newComparisonShift(compare, periodType.Name, &startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	current, err := r.chartPoints(chart, periodType.Name, startDate, endDate, nil, zone)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := r.chartPoints(chart, periodType.Name, startDate, endDate, &shift, zone)
+	if err != nil {
+		return nil, err
+	}
+
+	n := len(chart.Series)
+	byBucket := make(map[int64]*models.ChartDataPoint, len(current))
+	points := current
+	for i := range points {
+		byBucket[points[i].Date.Unix()] = &points[i]
+	}
+	compared := make(map[int64][]*float64, len(previous))
+	for _, p := range previous {
+		compared[p.Date.Unix()] = p.Values
+		if _, ok := byBucket[p.Date.Unix()]; !ok {
+			points = append(points, models.ChartDataPoint{Date: p.Date, Values: make([]*float64, n)})
+		}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Date.Before(points[j].Date) })
+	for i := range points {
+		point := &points[i]
+		point.Compare = make([]models.ComparisonValue, n)
+		before := compared[point.Date.Unix()]
+		for j := 0; j < n; j++ {
+			var b *float64
+			if before != nil {
+				b = before[j]
+			}
+			point.Compare[j] = models.Compare(point.Values[j], b)
+		}
+	}
+
+	summary := make([]models.ComparisonValue, n)
+	for i, s := range chart.Series {
+		now, err := r.seriesTotal(chart, s, startDate, endDate, nil, zone)
+		if err != nil {
+			return nil, err
+		}
+		before, err := r.seriesTotal(chart, s, startDate, endDate, &shift, zone)
+		if err != nil {
+			return nil, err
+		}
+		summary[i] = models.Compare(now, before)
+	}
+	if points == nil {
+		points = []models.ChartDataPoint{}
+	}
+	return &models.ChartComparison{
+		Compare:     compare,
+		From:        startDate.Format("2006-01-02"),
+		To:          endDate.Format("2006-01-02"),
+		CompareFrom: shift.back(startDate).Format("2006-01-02"),
+		CompareTo:   shift.back(endDate).Format("2006-01-02"),
+		Points:      points,
+		Summary:     summary,
+	}, nil
+}
+
+// seriesTotal aggregates a series over the whole range, without transform;
+// nil when it has no activities there.
+func (r *ChartsRepository) seriesTotal(chart *models.Chart, series models.ChartSeries, startDate, endDate time.Time, shift *comparisonShift, zone models.UserSettings) (*float64, error) {
+	at, field, err := r.seriesType(series)
+	if err != nil {
+		return nil, err
+	}
+	src, err := r.seriesSource(chart, series, at, field, startDate, endDate, shift, zone)
+	if err != nil {
+		return nil, err
+	}
+	var total sql.NullFloat64
+	if err := r.db.QueryRow(`SELECT (`+src.aggregate+`)::float `+src.from, src.params...).Scan(&total); err != nil {
+		return nil, err
+	}
+	if !total.Valid {
+		return nil, nil
+	}
+	return &total.Float64, nil
+}
+
+type seriesValue struct {
+	bucket      time.Time
+	value, base *float64
+}
+
+// seriesType loads the activity type of a series, resolved to its field and
+// with its aggregation override applied.
+func (r *ChartsRepository) seriesType(series models.ChartSeries) (*models.ActivityType, []string, error) {
+	// Сначала получаем тип активности (и поле составного типа)
+	at, err := scanActivityType(r.db.QueryRow(`
+		SELECT id, name, value_type, min_value, max_value, aggregation, space_id, is_default, is_deleted, unit, category_id, options, fields, created_at, modified_at
 		FROM activity_types
 		WHERE id = $1
-	`, chart.ActivityTypeID).Scan(&aggregation)
+	`, series.ActivityTypeID))
+	if err != nil {
+		return nil, nil, err
+	}
+	var field []string
+	if series.FieldPath != nil && *series.FieldPath != "" {
+		at, field, err = at.ResolveField(*series.FieldPath)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if series.Aggregation != nil && *series.Aggregation != "" {
+		at.Aggregation = *series.Aggregation
+	}
+	return at, field, nil
+}
+
+// seriesActivities returns the FROM and WHERE clauses selecting the
+// activities of a series, with join added after the note, and their
+// parameters: the time zone ($1), type ($2), space ($3), the local wall times
+// startDate and endDate ($4, $5; matched against dates moved by shift), then the tags of the chart and the series
+// and the conditions of the chart's saved filter, which only notes can match.
+func seriesActivities(chart *models.Chart, series models.ChartSeries, field []string, join string, startDate, endDate time.Time, shift *comparisonShift, zone models.UserSettings) (string, []interface{}) {
+	conds := []string{
+		"a.type_id = $2",
+		"a.is_deleted = FALSE",
+		"(n.id IS NULL OR n.is_deleted = FALSE)",
+		"a.space_id = $3",
+		shift.dateExpr("$1") + " BETWEEN $4 AND $5",
+	}
+	if len(field) > 0 {
+		conds = append(conds, activityValueExpression(field)+" IS NOT NULL")
+	}
+	tags := append(append([]string{}, chart.Tags...), series.Tags...)
+	tagConds, tagParams := tagConditions(tags, 6)
+	conds = append(conds, tagConds...)
+	params := append([]interface{}{zone.Timezone, series.ActivityTypeID, chart.SpaceID, startDate, endDate}, tagParams...)
+	if chart.Scope != nil {
+		scopeConds, scopeParams, _ := noteFilterConditions(*chart.Scope, len(params)+1)
+		conds = append(conds, "n.id IS NOT NULL")
+		conds = append(conds, scopeConds...)
+		params = append(params, scopeParams...)
+	}
+	return `FROM activities a
+			LEFT JOIN note n ON a.note_id = n.id
+			` + join + `
+			WHERE ` + strings.Join(conds, " AND "), params
+}
+
+// seriesSource selects the activities of a series (see seriesActivities), or
+// their daily rollups when those apply. Aggregates that are not numbers are 0.
+// $4 and $5 are the bounds of the range either way.
+func (r *ChartsRepository) seriesSource(chart *models.Chart, series models.ChartSeries, at *models.ActivityType, field []string, startDate, endDate time.Time, shift *comparisonShift, zone models.UserSettings) (activitySource, error) {
+	filtered := len(chart.Tags) > 0 || len(series.Tags) > 0 || chart.Scope != nil
+	if rollupsApply(at, field, filtered, &startDate, &endDate) {
+		ok, err := rollupZoneReady(r.db, chart.SpaceID, zone.Timezone)
+		if err != nil {
+			return activitySource{}, err
+		}
+		if ok {
+			src := activitySource{
+				local:  shift.apply(rollupDayExpr),
+				params: []interface{}{zone.Timezone, series.ActivityTypeID, chart.SpaceID, startDate, endDate},
+			}
+			src.aggregate, _ = rollupAggregate(at.Aggregation)
+			src.from = rollupActivities(src.local, "$3", "$2", "$4", "$5", false)
+			return src, nil
+		}
+	}
+	aggregate, err := buildAggregatorExpression(at.ValueType, at.Aggregation, activityValueExpression(field))
+	if err != nil || (at.ValueType == "enum" && at.Aggregation == "mode") {
+		aggregate = "0"
+	}
+	from, params := seriesActivities(chart, series, field, "", startDate, endDate, shift, zone)
+	return activitySource{from: from, params: params, local: shift.dateExpr("$1"), aggregate: aggregate}, nil
+}
+
+// getSeriesData aggregates one series of the chart between the local wall
+// times startDate and endDate, with the activities moved forward by shift when
+// given.
+func (r *ChartsRepository) getSeriesData(chart *models.Chart, series models.ChartSeries, period string, startDate, endDate time.Time, shift *comparisonShift, zone models.UserSettings) ([]seriesValue, error) {
+	at, field, err := r.seriesType(series)
 	if err != nil {
 		return nil, err
 	}
 
-	// Формируем выражение агрегации
-	var aggExpr string
-	switch aggregation {
-	case "sum":
-		aggExpr = "SUM((a.value->>'data')::float)"
-	case "avg":
-		aggExpr = "AVG((a.value->>'data')::float)"
-	case "count":
-		aggExpr = "COUNT(*)"
-	case "min":
-		aggExpr = "MIN((a.value->>'data')::float)"
-	case "max":
-		aggExpr = "MAX((a.value->>'data')::float)"
-	default:
-		aggExpr = "0"
+	src, err := r.seriesSource(chart, series, at, field, startDate, endDate, shift, zone)
+	if err != nil {
+		return nil, err
+	}
+	windowExpr := "value"
+	baseExpr := "NULL::float"
+	if chart.Transform != nil && *chart.Transform != "" {
+		if windowExpr, err = windowExpression(*chart.Transform, period); err != nil {
+			return nil, err
+		}
+		baseExpr = "value"
 	}
 
+	// Пустые периоды: filled перечисляет все бакеты диапазона
+	filled := "SELECT bucket, value FROM data"
+	if chart.Fill != nil && (*chart.Fill == "zero" || *chart.Fill == "null") {
+		valueCol := "d.value"
+		if *chart.Fill == "zero" {
+			valueCol = "COALESCE(d.value, 0)"
+		}
+		filled = `SELECT g.bucket, ` + valueCol + ` AS value
+			FROM generate_series(` + bucketExpression(period, "$4::timestamp", zone.WeekStart) + `, $5::timestamp, interval '1 ` + period + `') AS g(bucket)
+			LEFT JOIN data d ON d.bucket = g.bucket`
+	}
+
+	groupExpr, _ := buildGroupExpression(period, src.local, zone.WeekStart)
 	rows, err := r.db.Query(`
-		SELECT date_trunc($1, a.created_at) as period,
-		       `+aggExpr+` as value
-		FROM activities a
-		JOIN note n ON a.note_id = n.id
-		WHERE a.type_id = $2
-		  AND a.is_deleted = FALSE
-		  AND n.space_id = $3
-		  AND a.created_at BETWEEN $4 AND $5
-		GROUP BY period
-		ORDER BY period
-	`, periodType.Name, chart.ActivityTypeID, chart.SpaceID, startDate, endDate)
+		WITH data AS (
+			SELECT `+groupExpr+` as bucket,
+			       (`+src.aggregate+`)::float as value
+			`+src.from+`
+			GROUP BY bucket
+		), filled AS (
+			`+filled+`
+		)
+		SELECT bucket, `+windowExpr+` AS value, `+baseExpr+` AS base
+		FROM filled
+		ORDER BY bucket
+	`, src.params...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var dataPoints []models.ChartDataPoint
+	var values []seriesValue
 	for rows.Next() {
-		var point models.ChartDataPoint
-		err := rows.Scan(&point.Date, &point.Value)
+		var v seriesValue
+		var value, base sql.NullFloat64
+		if err := rows.Scan(&v.bucket, &value, &base); err != nil {
+			return nil, err
+		}
+		if value.Valid {
+			v.value = &value.Float64
+		}
+		if base.Valid {
+			v.base = &base.Float64
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
+
+// dailySeries aggregates a series per local day over the chart's range, or
+// the last defaultDays days when the chart has none. Transforms and fill do
+// not apply.
+func (r *ChartsRepository) dailySeries(chart *models.Chart, series models.ChartSeries, defaultDays int, zone models.UserSettings) ([]seriesValue, time.Time, time.Time, error) {
+	loc, err := zone.Location()
+	if err != nil {
+		return nil, time.Time{}, time.Time{}, err
+	}
+	daily := *chart
+	daily.Transform, daily.Fill = nil, nil
+	if daily.RangeDays == nil && daily.RangeFrom == nil {
+		daily.RangeDays = &defaultDays
+	}
+	startDate, endDate, err := chartRange(&daily, "day", models.WallTime(time.Now(), loc))
+	if err != nil {
+		return nil, startDate, endDate, err
+	}
+	values, err := r.getSeriesData(&daily, series, "day", startDate, endDate, nil, zone)
+	return values, startDate, endDate, err
+}
+
+// GetHeatmapData returns the daily values of the chart's first series, over
+// the last year unless the chart has a range.
+func (r *ChartsRepository) GetHeatmapData(chart *models.Chart, zone models.UserSettings) (*models.HeatmapData, error) {
+	values, startDate, endDate, err := r.dailySeries(chart, chart.Series[0], 365, zone)
+	if err != nil {
+		return nil, err
+	}
+	data := &models.HeatmapData{
+		From: startDate.Format("2006-01-02"),
+		To:   endDate.Format("2006-01-02"),
+		Days: make([]models.HeatmapDay, 0, len(values)),
+	}
+	for _, v := range values {
+		if v.value == nil {
+			continue
+		}
+		data.Days = append(data.Days, models.HeatmapDay{Date: v.bucket.Format("2006-01-02"), Value: *v.value})
+		if data.Min == nil || *v.value < *data.Min {
+			lo := *v.value
+			data.Min = &lo
+		}
+		if data.Max == nil || *v.value > *data.Max {
+			hi := *v.value
+			data.Max = &hi
+		}
+	}
+	return data, nil
+}
+
+// GetScatterData pairs the daily values of the chart's first two series. Days
+// where either has no data are left out.
+func (r *ChartsRepository) GetScatterData(chart *models.Chart, zone models.UserSettings) ([]models.ScatterPoint, error) {
+	xs, _, _, err := r.dailySeries(chart, chart.Series[0], 90, zone)
+	if err != nil {
+		return nil, err
+	}
+	ys, _, _, err := r.dailySeries(chart, chart.Series[1], 90, zone)
+	if err != nil {
+		return nil, err
+	}
+	byDay := make(map[string]float64, len(ys))
+	for _, y := range ys {
+		if y.value != nil {
+			byDay[y.bucket.Format("2006-01-02")] = *y.value
+		}
+	}
+	points := make([]models.ScatterPoint, 0)
+	for _, x := range xs {
+		day := x.bucket.Format("2006-01-02")
+		if y, ok := byDay[day]; ok && x.value != nil {
+			points = append(points, models.ScatterPoint{Date: day, X: *x.value, Y: y})
+		}
+	}
+	return points, nil
+}
+
+// GetPieData splits the chart's first series over the chart's range by value
+// (boolean, enum and rating types; counts of activities) or by the tags of
+// the activities' notes (the series aggregate per tag). An activity whose note
+// has several tags counts toward each.
+func (r *ChartsRepository) GetPieData(chart *models.Chart, zone models.UserSettings) ([]models.PieSlice, error) {
+	loc, err := zone.Location()
+	if err != nil {
+		return nil, err
+	}
+	periodType := types.GetPeriodTypeByID(chart.PeriodID)
+	if periodType == nil {
+		return nil, nil
+	}
+	startDate, endDate, err := chartRange(chart, periodType.Name, models.WallTime(time.Now(), loc))
+	if err != nil {
+		return nil, err
+	}
+	series := chart.Series[0]
+	at, field, err := r.seriesType(series)
+	if err != nil {
+		return nil, err
+	}
+	valueExpr := activityValueExpression(field)
+
+	byTag := chart.Options != nil && chart.Options.GroupBy == "tag"
+	var query string
+	var params []interface{}
+	if byTag {
+		aggExpr, err := buildAggregatorExpression(at.ValueType, at.Aggregation, valueExpr)
 		if err != nil {
 			return nil, err
 		}
-		dataPoints = append(dataPoints, point)
+		var from string
+		from, params = seriesActivities(chart, series, field, "LEFT JOIN note_to_tag nt ON nt.note_id = n.id LEFT JOIN tag t ON t.id = nt.tag_id", startDate, endDate, nil, zone)
+		query = `SELECT COALESCE(t.name, '') AS key, (` + aggExpr + `)::float AS value
+			` + from + `
+			GROUP BY key
+			ORDER BY value DESC, key`
+	} else {
+		var from string
+		from, params = seriesActivities(chart, series, field, "", startDate, endDate, nil, zone)
+		query = `SELECT ` + valueExpr + ` AS key, COUNT(*)::float AS value
+			` + from + `
+			GROUP BY key
+			ORDER BY value DESC, key`
 	}
+	rows, err := r.db.Query(query, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	return dataPoints, nil
+	counts := make(map[string]float64)
+	var keys []string
+	for rows.Next() {
+		var key sql.NullString
+		var value sql.NullFloat64
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key.String)
+		counts[key.String] = value.Float64
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	labels := make(map[string]string)
+	if !byTag {
+		// Options without activities still get a slice, in their order
+		for _, v := range at.OptionValues() {
+			if _, ok := counts[v]; !ok {
+				keys = append(keys, v)
+			}
+		}
+		for _, o := range at.Options {
+			if o.Label != "" {
+				labels[o.Value] = o.Label
+			}
+		}
+	}
+	var total float64
+	for _, k := range keys {
+		total += counts[k]
+	}
+	slices := make([]models.PieSlice, 0, len(keys))
+	for _, k := range keys {
+		slice := models.PieSlice{Key: k, Label: k, Value: counts[k]}
+		if l, ok := labels[k]; ok {
+			slice.Label = l
+		}
+		if total != 0 {
+			slice.Share = counts[k] / total
+		}
+		slices = append(slices, slice)
+	}
+	return slices, nil
+}
+
+// GetHistogramData counts the single values of the chart's first series over
+// the chart's range in bins of equal width. Times are in seconds.
+func (r *ChartsRepository) GetHistogramData(chart *models.Chart, zone models.UserSettings) ([]models.HistogramBin, error) {
+	loc, err := zone.Location()
+	if err != nil {
+		return nil, err
+	}
+	periodType := types.GetPeriodTypeByID(chart.PeriodID)
+	if periodType == nil {
+		return nil, nil
+	}
+	startDate, endDate, err := chartRange(chart, periodType.Name, models.WallTime(time.Now(), loc))
+	if err != nil {
+		return nil, err
+	}
+	series := chart.Series[0]
+	at, field, err := r.seriesType(series)
+	if err != nil {
+		return nil, err
+	}
+	valueExpr := "(" + activityValueExpression(field) + ")::float"
+	if at.ValueType == "time" {
+		valueExpr = "EXTRACT(EPOCH FROM (" + activityValueExpression(field) + ")::interval)::float"
+	}
+	from, params := seriesActivities(chart, series, field, "", startDate, endDate, nil, zone)
+	rows, err := r.db.Query(`SELECT `+valueExpr+` AS value `+from, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []float64
+	for rows.Next() {
+		var v sql.NullFloat64
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		if v.Valid {
+			values = append(values, v.Float64)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	bins := 10
+	if chart.Options != nil && chart.Options.Bins > 0 {
+		bins = chart.Options.Bins
+	}
+	result := make([]models.HistogramBin, 0, bins)
+	for _, b := range stats.Histogram(values, bins) {
+		result = append(result, models.HistogramBin{From: b.From, To: b.To, Count: b.Count})
+	}
+	return result, nil
+}
+
+// chartRange resolves the chart's range to local wall times given the local
+// time now: the last RangeDays days including today, or the dates RangeFrom
+// to RangeTo (today when unset). Without either it is the last period.
+func chartRange(chart *models.Chart, period string, now time.Time) (time.Time, time.Time, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	endOfDay := func(d time.Time) time.Time { return d.AddDate(0, 0, 1).Add(-time.Microsecond) }
+	switch {
+	case chart.RangeDays != nil:
+		return today.AddDate(0, 0, 1-*chart.RangeDays), endOfDay(today), nil
+	case chart.RangeFrom != nil:
+		start, err := time.ParseInLocation("2006-01-02", *chart.RangeFrom, now.Location())
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		end := today
+		if chart.RangeTo != nil {
+			if end, err = time.ParseInLocation("2006-01-02", *chart.RangeTo, now.Location()); err != nil {
+				return time.Time{}, time.Time{}, err
+			}
+		}
+		return start, endOfDay(end), nil
+	}
+	switch period {
+	case "week":
+		return now.AddDate(0, 0, -7), now, nil
+	case "month":
+		return now.AddDate(0, -1, 0), now, nil
+	case "year":
+		return now.AddDate(-1, 0, 0), now, nil
+	default:
+		return now.AddDate(0, 0, -1), now, nil
+	}
 }
@@ -0,0 +1,180 @@
+package repository
+
+import (
+	"database/sql"
+	"focuz-api/models"
+
+	"github.com/lib/pq"
+)
+
+type DashboardsRepository struct {
+	db *sql.DB
+}
+
+func NewDashboardsRepository(db *sql.DB) *DashboardsRepository {
+	return &DashboardsRepository{db: db}
+}
+
+const dashboardColumns = `id, space_id, created_by, name, range_days, to_char(range_from, 'YYYY-MM-DD'), to_char(range_to, 'YYYY-MM-DD'), tags, is_deleted, created_at, modified_at`
+
+func scanDashboard(row rowScanner) (*models.Dashboard, error) {
+	var d models.Dashboard
+	err := row.Scan(&d.ID, &d.SpaceID, &d.CreatedBy, &d.Name, &d.RangeDays, &d.RangeFrom, &d.RangeTo, pq.Array(&d.Tags), &d.IsDeleted, &d.CreatedAt, &d.ModifiedAt)
+	if err != nil {
+		return nil, err
+	}
+	d.Widgets = make([]models.DashboardWidget, 0)
+	return &d, nil
+}
+
+// Create stores a dashboard with its widgets.
+func (r *DashboardsRepository) Create(d *models.Dashboard) (*models.Dashboard, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	created, err := scanDashboard(tx.QueryRow(`
+		INSERT INTO dashboards (space_id, created_by, name, range_days, range_from, range_to, tags, created_at, modified_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW(), NOW())
+		RETURNING `+dashboardColumns,
+		d.SpaceID, d.CreatedBy, d.Name, d.RangeDays, d.RangeFrom, d.RangeTo, pq.Array(d.Tags)))
+	if err != nil {
+		return nil, err
+	}
+	if err := insertWidgets(tx, created.ID, d.Widgets); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	created.Widgets = append(created.Widgets, d.Widgets...)
+	return created, nil
+}
+
+func (r *DashboardsRepository) GetByID(id int) (*models.Dashboard, error) {
+	d, err := scanDashboard(r.db.QueryRow(`SELECT `+dashboardColumns+` FROM dashboards WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := r.loadWidgets([]*models.Dashboard{d}); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Update saves the settings of a dashboard and replaces its widgets.
+func (r *DashboardsRepository) Update(d *models.Dashboard) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(`
+		UPDATE dashboards
+		SET name = $1, range_days = $2, range_from = $3, range_to = $4, tags = $5, modified_at = NOW()
+		WHERE id = $6
+	`, d.Name, d.RangeDays, d.RangeFrom, d.RangeTo, pq.Array(d.Tags), d.ID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM dashboard_widgets WHERE dashboard_id = $1`, d.ID); err != nil {
+		return err
+	}
+	if err := insertWidgets(tx, d.ID, d.Widgets); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *DashboardsRepository) UpdateDeleted(id int, isDeleted bool) error {
+	_, err := r.db.Exec(`
+		UPDATE dashboards
+		SET is_deleted = $1, modified_at = NOW()
+		WHERE id = $2
+	`, isDeleted, id)
+	return err
+}
+
+// List returns a page of the space's dashboards with their widgets, by name.
+func (r *DashboardsRepository) List(spaceID, offset, limit int) ([]*models.Dashboard, int, error) {
+	var total int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM dashboards WHERE space_id = $1 AND is_deleted = FALSE`, spaceID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := r.db.Query(`
+		SELECT `+dashboardColumns+`
+		FROM dashboards
+		WHERE space_id = $1 AND is_deleted = FALSE
+		ORDER BY name, id
+		LIMIT $2 OFFSET $3
+	`, spaceID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	result := make([]*models.Dashboard, 0)
+	for rows.Next() {
+		d, err := scanDashboard(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		result = append(result, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	if err := r.loadWidgets(result); err != nil {
+		return nil, 0, err
+	}
+	return result, total, nil
+}
+
+// loadWidgets fills in the widgets of the dashboards, in order.
+func (r *DashboardsRepository) loadWidgets(dashboards []*models.Dashboard) error {
+	if len(dashboards) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(dashboards))
+	byID := make(map[int]*models.Dashboard, len(dashboards))
+	for i, d := range dashboards {
+		ids[i] = int64(d.ID)
+		byID[d.ID] = d
+	}
+	rows, err := r.db.Query(`
+		SELECT dashboard_id, chart_id, x, y, w, h
+		FROM dashboard_widgets
+		WHERE dashboard_id = ANY($1)
+		ORDER BY dashboard_id, position
+	`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var dashboardID int
+		var w models.DashboardWidget
+		if err := rows.Scan(&dashboardID, &w.ChartID, &w.X, &w.Y, &w.W, &w.H); err != nil {
+			return err
+		}
+		d := byID[dashboardID]
+		d.Widgets = append(d.Widgets, w)
+	}
+	return rows.Err()
+}
+
+func insertWidgets(tx *sql.Tx, dashboardID int, widgets []models.DashboardWidget) error {
+	for i, w := range widgets {
+		_, err := tx.Exec(`
+			INSERT INTO dashboard_widgets (dashboard_id, position, chart_id, x, y, w, h)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+		`, dashboardID, i, w.ChartID, w.X, w.Y, w.W, w.H)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -4,6 +4,10 @@ import (
 	"database/sql"
 	"encoding/json"
 	"focuz-api/models"
+	"focuz-api/pkg/fracindex"
+	"time"
+
+	"github.com/lib/pq"
 )
 
 type FiltersRepository struct {
@@ -14,33 +18,138 @@ func NewFiltersRepository(db *sql.DB) *FiltersRepository {
 	return &FiltersRepository{db: db}
 }
 
-func (r *FiltersRepository) CreateFilter(userID, spaceID int, name string, parentID *int, params json.RawMessage) (*models.Filter, error) {
+// CreateFilter inserts a filter. An empty position appends it to the space.
+func (r *FiltersRepository) CreateFilter(userID, spaceID int, name string, parentID *int, params json.RawMessage, inheritParams bool, visibility, position string) (*models.Filter, error) {
+	if position == "" {
+		var err error
+		if position, err = nextFilterPosition(r.db, spaceID); err != nil {
+			return nil, err
+		}
+	}
 	var id int
 	err := r.db.QueryRow(`
-		INSERT INTO filters (user_id, space_id, parent_id, name, params, is_deleted, created_at, modified_at)
-		VALUES ($1, $2, $3, $4, $5, FALSE, NOW(), NOW())
+		INSERT INTO filters (user_id, space_id, parent_id, name, params, inherit_params, visibility, position, is_deleted, created_at, modified_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, FALSE, NOW(), NOW())
 		RETURNING id
-	`, userID, spaceID, parentID, name, params).Scan(&id)
+	`, userID, spaceID, parentID, name, params, inheritParams, visibility, position).Scan(&id)
 	if err != nil {
 		return nil, err
 	}
 	return r.GetByID(id)
 }
 
-func (r *FiltersRepository) UpdateFilter(id int, name *string, parentID *int, params *json.RawMessage) error {
-	// Update dynamic fields; set modified_at
-	// We update only provided fields by coalescing to current values
+// UpdateFilter updates only provided fields by coalescing to current values.
+func (r *FiltersRepository) UpdateFilter(id int, upd models.FilterUpdate) error {
 	_, err := r.db.Exec(`
 		UPDATE filters SET
 			name = COALESCE($2, name),
-			parent_id = $3,
-			params = COALESCE($4, params),
+			parent_id = CASE WHEN $3 THEN $4 ELSE parent_id END,
+			params = COALESCE($5, params),
+			inherit_params = COALESCE($6, inherit_params),
+			visibility = COALESCE($7, visibility),
+			position = COALESCE($8, position),
 			modified_at = NOW()
 		WHERE id = $1 AND is_deleted = FALSE
-	`, id, name, parentID, params)
+	`, id, upd.Name, upd.SetParent, upd.ParentID, upd.Params, upd.InheritParams, upd.Visibility, upd.Position)
 	return err
 }
 
+// NeighborPositions returns the positions right before and after key among
+// the space's filters visible to the user, ignoring excludeID. Empty strings
+// mean the start or end of the list.
+func (r *FiltersRepository) NeighborPositions(spaceID, userID, excludeID int, key string) (string, string, error) {
+	var prev, next sql.NullString
+	err := r.db.QueryRow(`
+		SELECT
+			(SELECT MAX(position) FROM filters
+			 WHERE space_id = $1 AND is_deleted = FALSE AND id <> $3 AND position < $4
+			   AND (visibility = 'space' OR user_id = $2)),
+			(SELECT MIN(position) FROM filters
+			 WHERE space_id = $1 AND is_deleted = FALSE AND id <> $3 AND position > $4
+			   AND (visibility = 'space' OR user_id = $2))
+	`, spaceID, userID, excludeID, key).Scan(&prev, &next)
+	return prev.String, next.String, err
+}
+
+// nextFilterPosition returns a key after every filter of the space.
+func nextFilterPosition(db *sql.DB, spaceID int) (string, error) {
+	var last sql.NullString
+	if err := db.QueryRow(`SELECT MAX(position) FROM filters WHERE space_id = $1`, spaceID).Scan(&last); err != nil {
+		return "", err
+	}
+	return fracindex.Between(last.String, "")
+}
+
+// GetAncestors returns the parent chain of a filter, nearest parent first.
+// Deleted filters are included; the walk stops if the chain loops.
+func (r *FiltersRepository) GetAncestors(id int) ([]*models.Filter, error) {
+	rows, err := r.db.Query(`
+		WITH RECURSIVE chain AS (
+			SELECT f.parent_id AS id, 1 AS depth, ARRAY[f.id] AS path
+			FROM filters f WHERE f.id = $1 AND f.parent_id IS NOT NULL
+			UNION ALL
+			SELECT f.parent_id, c.depth + 1, c.path || f.id
+			FROM filters f JOIN chain c ON f.id = c.id
+			WHERE f.parent_id IS NOT NULL AND NOT f.id = ANY(c.path)
+		)
+		SELECT f.id, f.user_id, f.space_id, f.parent_id, f.name, f.params, f.inherit_params, f.visibility, f.position, f.is_deleted, f.created_at, f.modified_at
+		FROM chain c JOIN filters f ON f.id = c.id
+		WHERE NOT c.id = ANY(c.path)
+		ORDER BY c.depth
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*models.Filter
+	for rows.Next() {
+		f, err := scanFilter(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, f)
+	}
+	return items, rows.Err()
+}
+
+// WouldCreateCycle reports whether making parentID the parent of id would
+// put id into its own ancestor chain.
+func (r *FiltersRepository) WouldCreateCycle(id, parentID int) (bool, error) {
+	return filterWouldCreateCycle(r.db, id, parentID)
+}
+
+func filterWouldCreateCycle(db *sql.DB, id, parentID int) (bool, error) {
+	if id == parentID {
+		return true, nil
+	}
+	var found bool
+	err := db.QueryRow(`
+		WITH RECURSIVE chain AS (
+			SELECT id, parent_id, ARRAY[id] AS path FROM filters WHERE id = $2
+			UNION ALL
+			SELECT f.id, f.parent_id, c.path || f.id
+			FROM filters f JOIN chain c ON f.id = c.parent_id
+			WHERE NOT f.id = ANY(c.path)
+		)
+		SELECT EXISTS (SELECT 1 FROM chain WHERE id = $1)
+	`, id, parentID).Scan(&found)
+	return found, err
+}
+
+// HasSharedChildren reports whether the filter has live children shared
+// with the space, which keep it from becoming private.
+func (r *FiltersRepository) HasSharedChildren(id int) (bool, error) {
+	return filterHasSharedChildren(r.db, id)
+}
+
+func filterHasSharedChildren(db *sql.DB, id int) (bool, error) {
+	var found bool
+	err := db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM filters WHERE parent_id = $1 AND is_deleted = FALSE AND visibility = 'space')
+	`, id).Scan(&found)
+	return found, err
+}
+
 func (r *FiltersRepository) SetDeleted(id int, isDeleted bool) error {
 	_, err := r.db.Exec(`
 		UPDATE filters SET is_deleted = $2, modified_at = NOW() WHERE id = $1
@@ -49,34 +158,31 @@ func (r *FiltersRepository) SetDeleted(id int, isDeleted bool) error {
 }
 
 func (r *FiltersRepository) GetByID(id int) (*models.Filter, error) {
-	var f models.Filter
-	var parentID sql.NullInt64
-	err := r.db.QueryRow(`
-		SELECT id, user_id, space_id, parent_id, name, params, is_deleted, created_at, modified_at
+	return getFilterByID(r.db, id)
+}
+
+func getFilterByID(db *sql.DB, id int) (*models.Filter, error) {
+	f, err := scanFilter(db.QueryRow(`
+		SELECT id, user_id, space_id, parent_id, name, params, inherit_params, visibility, position, is_deleted, created_at, modified_at
 		FROM filters WHERE id = $1
-	`, id).Scan(&f.ID, &f.UserID, &f.SpaceID, &parentID, &f.Name, &f.Params, &f.IsDeleted, &f.CreatedAt, &f.ModifiedAt)
+	`, id))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
-	if err != nil {
-		return nil, err
-	}
-	if parentID.Valid {
-		pid := int(parentID.Int64)
-		f.ParentID = &pid
-	}
-	return &f, nil
+	return f, err
 }
 
-func (r *FiltersRepository) List(spaceID int, page, pageSize int) ([]*models.Filter, int, error) {
+// List returns a page of the space's filters visible to the user, in
+// position order.
+func (r *FiltersRepository) List(spaceID, userID int, page, pageSize int) ([]*models.Filter, int, error) {
 	offset := (page - 1) * pageSize
 	rows, err := r.db.Query(`
-		SELECT id, user_id, space_id, parent_id, name, params, is_deleted, created_at, modified_at
+		SELECT id, user_id, space_id, parent_id, name, params, inherit_params, visibility, position, is_deleted, created_at, modified_at
 		FROM filters
-		WHERE space_id = $1 AND is_deleted = FALSE
-		ORDER BY id
-		LIMIT $2 OFFSET $3
-	`, spaceID, pageSize, offset)
+		WHERE space_id = $1 AND is_deleted = FALSE AND (visibility = 'space' OR user_id = $2)
+		ORDER BY position, id
+		LIMIT $3 OFFSET $4
+	`, spaceID, userID, pageSize, offset)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -84,22 +190,95 @@ func (r *FiltersRepository) List(spaceID int, page, pageSize int) ([]*models.Fil
 
 	var items []*models.Filter
 	for rows.Next() {
-		var f models.Filter
-		var parentID sql.NullInt64
-		if err := rows.Scan(&f.ID, &f.UserID, &f.SpaceID, &parentID, &f.Name, &f.Params, &f.IsDeleted, &f.CreatedAt, &f.ModifiedAt); err != nil {
+		f, err := scanFilter(rows)
+		if err != nil {
 			return nil, 0, err
 		}
-		if parentID.Valid {
-			pid := int(parentID.Int64)
-			f.ParentID = &pid
-		}
-		items = append(items, &f)
+		items = append(items, f)
 	}
 
 	var total int
-	err = r.db.QueryRow(`SELECT COUNT(*) FROM filters WHERE space_id = $1 AND is_deleted = FALSE`, spaceID).Scan(&total)
+	err = r.db.QueryRow(`
+		SELECT COUNT(*) FROM filters
+		WHERE space_id = $1 AND is_deleted = FALSE AND (visibility = 'space' OR user_id = $2)
+	`, spaceID, userID).Scan(&total)
 	if err != nil {
 		return nil, 0, err
 	}
 	return items, total, nil
 }
+
+// ListBySpace returns all non-deleted filters of a space visible to the user.
+func (r *FiltersRepository) ListBySpace(spaceID, userID int) ([]*models.Filter, error) {
+	rows, err := r.db.Query(`
+		SELECT id, user_id, space_id, parent_id, name, params, inherit_params, visibility, position, is_deleted, created_at, modified_at
+		FROM filters
+		WHERE space_id = $1 AND is_deleted = FALSE AND (visibility = 'space' OR user_id = $2)
+		ORDER BY position, id
+	`, spaceID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*models.Filter
+	for rows.Next() {
+		f, err := scanFilter(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, f)
+	}
+	return items, rows.Err()
+}
+
+// MarkViewed records that the user has just opened the filter.
+func (r *FiltersRepository) MarkViewed(userID, filterID int) (time.Time, error) {
+	var viewedAt time.Time
+	err := r.db.QueryRow(`
+		INSERT INTO filter_views (user_id, filter_id, last_viewed_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT (user_id, filter_id) DO UPDATE SET last_viewed_at = EXCLUDED.last_viewed_at
+		RETURNING last_viewed_at
+	`, userID, filterID).Scan(&viewedAt)
+	return viewedAt, err
+}
+
+// GetLastViewed returns last_viewed_at by filter ID for the given filters.
+// Filters the user has never opened are absent from the map.
+func (r *FiltersRepository) GetLastViewed(userID int, filterIDs []int) (map[int]time.Time, error) {
+	rows, err := r.db.Query(`
+		SELECT filter_id, last_viewed_at FROM filter_views
+		WHERE user_id = $1 AND filter_id = ANY($2)
+	`, userID, pq.Array(filterIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[int]time.Time{}
+	for rows.Next() {
+		var id int
+		var t time.Time
+		if err := rows.Scan(&id, &t); err != nil {
+			return nil, err
+		}
+		out[id] = t
+	}
+	return out, rows.Err()
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanFilter(row rowScanner) (*models.Filter, error) {
+	var f models.Filter
+	var parentID sql.NullInt64
+	if err := row.Scan(&f.ID, &f.UserID, &f.SpaceID, &parentID, &f.Name, &f.Params, &f.InheritParams, &f.Visibility, &f.Position, &f.IsDeleted, &f.CreatedAt, &f.ModifiedAt); err != nil {
+		return nil, err
+	}
+	if parentID.Valid {
+		pid := int(parentID.Int64)
+		f.ParentID = &pid
+	}
+	return &f, nil
+}
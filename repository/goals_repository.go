@@ -0,0 +1,206 @@
+package repository
+
+import (
+	"database/sql"
+	"focuz-api/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type GoalsRepository struct {
+	db *sql.DB
+}
+
+func NewGoalsRepository(db *sql.DB) *GoalsRepository {
+	return &GoalsRepository{db: db}
+}
+
+const goalColumns = `id, space_id, user_id, created_by, activity_type_id, field_path, period, operator, target, is_deleted, created_at, modified_at`
+
+func scanGoal(row rowScanner) (*models.Goal, error) {
+	var g models.Goal
+	var userID sql.NullInt64
+	var fieldPath sql.NullString
+	err := row.Scan(&g.ID, &g.SpaceID, &userID, &g.CreatedBy, &g.ActivityTypeID, &fieldPath, &g.PeriodID, &g.Operator, &g.Target, &g.IsDeleted, &g.CreatedAt, &g.ModifiedAt)
+	if err != nil {
+		return nil, err
+	}
+	if userID.Valid {
+		id := int(userID.Int64)
+		g.UserID = &id
+	}
+	if fieldPath.Valid {
+		p := fieldPath.String
+		g.FieldPath = &p
+	}
+	return &g, nil
+}
+
+func (r *GoalsRepository) Create(g *models.Goal) (*models.Goal, error) {
+	return scanGoal(r.db.QueryRow(`
+		INSERT INTO goals (space_id, user_id, created_by, activity_type_id, field_path, period, operator, target, created_at, modified_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW(), NOW())
+		RETURNING `+goalColumns,
+		g.SpaceID, g.UserID, g.CreatedBy, g.ActivityTypeID, g.FieldPath, g.PeriodID, g.Operator, g.Target))
+}
+
+func (r *GoalsRepository) GetByID(id int) (*models.Goal, error) {
+	g, err := scanGoal(r.db.QueryRow(`SELECT `+goalColumns+` FROM goals WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return g, err
+}
+
+func (r *GoalsRepository) Update(g *models.Goal) error {
+	_, err := r.db.Exec(`
+		UPDATE goals
+		SET field_path = $1, period = $2, operator = $3, target = $4, modified_at = NOW()
+		WHERE id = $5
+	`, g.FieldPath, g.PeriodID, g.Operator, g.Target, g.ID)
+	return err
+}
+
+func (r *GoalsRepository) UpdateDeleted(id int, isDeleted bool) error {
+	_, err := r.db.Exec(`
+		UPDATE goals
+		SET is_deleted = $1, modified_at = NOW()
+		WHERE id = $2
+	`, isDeleted, id)
+	return err
+}
+
+// List returns the goals of a space the user sees (space goals and the
+// user's own personal goals), paginated.
+func (r *GoalsRepository) List(spaceID, userID, offset, limit int) ([]*models.Goal, int, error) {
+	where := `space_id = $1 AND is_deleted = FALSE AND (user_id IS NULL OR user_id = $2)`
+	var total int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM goals WHERE `+where, spaceID, userID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := r.db.Query(`
+		SELECT `+goalColumns+`
+		FROM goals
+		WHERE `+where+`
+		ORDER BY id
+		LIMIT $3 OFFSET $4
+	`, spaceID, userID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	result := make([]*models.Goal, 0)
+	for rows.Next() {
+		g, err := scanGoal(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		result = append(result, g)
+	}
+	return result, total, rows.Err()
+}
+
+// ListActive returns all non-deleted goals, limited to one space when
+// spaceID is positive.
+func (r *GoalsRepository) ListActive(spaceID int) ([]*models.Goal, error) {
+	query := `SELECT ` + goalColumns + ` FROM goals WHERE is_deleted = FALSE`
+	var args []interface{}
+	if spaceID > 0 {
+		query += ` AND space_id = $1`
+		args = append(args, spaceID)
+	}
+	rows, err := r.db.Query(query+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var result []*models.Goal
+	for rows.Next() {
+		g, err := scanGoal(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, g)
+	}
+	return result, rows.Err()
+}
+
+// GoalPeriodValue is the aggregated value of a goal's activity type in one period.
+type GoalPeriodValue struct {
+	Start time.Time
+	Value float64
+}
+
+// PeriodValues aggregates the goal's activity type (at, or one of its fields)
+// per period with the same bucketing and aggregation as the activity analysis,
+// in the time zone and week start of settings. Period starts are local wall
+// times; since, when given, is the local wall time of the first period read.
+// Personal goals count only their user's activities.
+func (r *GoalsRepository) PeriodValues(g *models.Goal, at *models.ActivityType, field []string, period string, settings models.UserSettings, since *time.Time) ([]GoalPeriodValue, error) {
+	localExpr := localDateExpr("$3")
+	groupExpr, _ := buildGroupExpression(period, localExpr, settings.WeekStart)
+	valueExpr := activityValueExpression(field)
+	aggExpr, err := buildAggregatorExpression(at.ValueType, at.Aggregation, valueExpr)
+	if err != nil {
+		return nil, err
+	}
+	conds := []string{
+		"a.is_deleted = FALSE",
+		"(n.id IS NULL OR n.is_deleted = FALSE)",
+		"a.space_id = $1",
+		"a.type_id = $2",
+	}
+	params := []interface{}{g.SpaceID, g.ActivityTypeID, settings.Timezone}
+	if g.UserID != nil {
+		conds = append(conds, "a.user_id = $"+strconv.Itoa(len(params)+1))
+		params = append(params, *g.UserID)
+	}
+	if len(field) > 0 {
+		conds = append(conds, valueExpr+" IS NOT NULL")
+	}
+	if since != nil {
+		conds = append(conds, localExpr+" >= $"+strconv.Itoa(len(params)+1))
+		params = append(params, *since)
+	}
+	rows, err := r.db.Query(`
+		SELECT `+groupExpr+` AS start, `+aggExpr+` AS value
+		FROM activities a
+		LEFT JOIN note n ON a.note_id = n.id
+		WHERE `+strings.Join(conds, " AND ")+`
+		GROUP BY `+groupExpr+`
+		ORDER BY `+groupExpr, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var result []GoalPeriodValue
+	for rows.Next() {
+		var v GoalPeriodValue
+		var value sql.NullFloat64
+		if err := rows.Scan(&v.Start, &value); err != nil {
+			return nil, err
+		}
+		if !value.Valid {
+			continue
+		}
+		v.Value = value.Float64
+		result = append(result, v)
+	}
+	return result, rows.Err()
+}
+
+// MarkNotified records that a notification of the given kind (event type)
+// was sent for the goal, user and period. It reports false when it was already recorded.
+func (r *GoalsRepository) MarkNotified(goalID, userID int, kind string, periodStart time.Time) (bool, error) {
+	res, err := r.db.Exec(`
+		INSERT INTO goal_notifications (goal_id, user_id, kind, period_start)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT DO NOTHING
+	`, goalID, userID, kind, periodStart)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
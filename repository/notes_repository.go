@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"focuz-api/initializers"
 	"focuz-api/models"
+	notequery "focuz-api/pkg/query"
 	"strconv"
 	"strings"
 	"time"
@@ -275,25 +276,6 @@ func (r *NotesRepository) GetNotes(userID, spaceID int, filters models.NoteFilte
 	conditions = append(conditions, "n.space_id = $"+strconv.Itoa(idx))
 	params = append(params, spaceID)
 	idx++
-	if filters.ParentID != nil {
-		conditions = append(conditions, "n.parent_id = $"+strconv.Itoa(idx))
-		params = append(params, *filters.ParentID)
-		idx++
-	} else if filters.NotReply {
-		conditions = append(conditions, "n.parent_id IS NULL")
-	}
-
-	// Add date filters
-	if filters.DateFrom != nil {
-		conditions = append(conditions, "n.date >= $"+strconv.Itoa(idx))
-		params = append(params, *filters.DateFrom)
-		idx++
-	}
-	if filters.DateTo != nil {
-		conditions = append(conditions, "n.date <= $"+strconv.Itoa(idx))
-		params = append(params, *filters.DateTo)
-		idx++
-	}
 
 	query := `
 		SELECT 
@@ -325,34 +307,9 @@ func (r *NotesRepository) GetNotes(userID, spaceID int, filters models.NoteFilte
 		LEFT JOIN note p ON n.parent_id = p.id
 	`
 
-	// Process tags with include/exclude logic safely (parameterized)
-	var includeTags []string
-	var excludeTags []string
-	for _, tag := range filters.Tags {
-		if strings.HasPrefix(tag, "!") {
-			excludeTags = append(excludeTags, strings.TrimPrefix(tag, "!"))
-		} else if tag != "" {
-			includeTags = append(includeTags, tag)
-		}
-	}
-
-	// Include: note must contain ALL includeTags
-	if len(includeTags) > 0 {
-		// Count distinct matched tags for this note and compare with number of includeTags
-		conditions = append(conditions,
-			"(SELECT COUNT(DISTINCT t.name) FROM tag t JOIN note_to_tag nt ON nt.tag_id = t.id WHERE nt.note_id = n.id AND t.name = ANY($"+strconv.Itoa(idx)+")) = $"+strconv.Itoa(idx+1),
-		)
-		params = append(params, pq.Array(includeTags), len(includeTags))
-		idx += 2
-	}
-	// Exclude: note must NOT have any of excludeTags
-	if len(excludeTags) > 0 {
-		conditions = append(conditions,
-			"NOT EXISTS (SELECT 1 FROM tag xt JOIN note_to_tag xnt ON xnt.tag_id = xt.id WHERE xnt.note_id = n.id AND xt.name = ANY($"+strconv.Itoa(idx)+"))",
-		)
-		params = append(params, pq.Array(excludeTags))
-		idx++
-	}
+	filterConds, filterParams, idx := noteFilterConditions(filters, idx)
+	conditions = append(conditions, filterConds...)
+	params = append(params, filterParams...)
 
 	if len(conditions) > 0 {
 		query += " WHERE " + joinConditions(conditions, " AND ")
@@ -453,6 +410,134 @@ func (r *NotesRepository) GetNotes(userID, spaceID int, filters models.NoteFilte
 	return notes, total, nil
 }
 
+// NoteCountSpec is one set of filters for CountMatches. When Since is set,
+// notes created after it are also counted as new.
+type NoteCountSpec struct {
+	Filters models.NoteFilters
+	Since   *time.Time
+}
+
+// NoteCount is the result for one NoteCountSpec.
+type NoteCount struct {
+	Total int
+	New   int
+}
+
+// CountMatches counts notes of a space matching each spec in a single pass
+// over the space's notes. Results are in spec order.
+func (r *NotesRepository) CountMatches(spaceID int, specs []NoteCountSpec) ([]NoteCount, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	params := []interface{}{spaceID}
+	idx := 2
+	var cols []string
+	for _, spec := range specs {
+		conds, args, next := noteFilterConditions(spec.Filters, idx)
+		params = append(params, args...)
+		idx = next
+		cond := "TRUE"
+		if len(conds) > 0 {
+			cond = joinConditions(conds, " AND ")
+		}
+		cols = append(cols, "COUNT(*) FILTER (WHERE "+cond+")")
+		if spec.Since != nil {
+			cols = append(cols, "COUNT(*) FILTER (WHERE "+cond+" AND n.created_at > $"+strconv.Itoa(idx)+")")
+			params = append(params, *spec.Since)
+			idx++
+		}
+	}
+	query := "SELECT " + joinConditions(cols, ", ") + " FROM note n WHERE n.is_deleted = FALSE AND n.space_id = $1"
+
+	raw := make([]int, len(cols))
+	dest := make([]interface{}, len(cols))
+	for i := range raw {
+		dest[i] = &raw[i]
+	}
+	if err := r.db.QueryRow(query, params...).Scan(dest...); err != nil {
+		return nil, err
+	}
+	out := make([]NoteCount, len(specs))
+	i := 0
+	for n, spec := range specs {
+		out[n].Total = raw[i]
+		i++
+		if spec.Since != nil {
+			out[n].New = raw[i]
+			i++
+		} else {
+			out[n].New = out[n].Total
+		}
+	}
+	return out, nil
+}
+
+// noteFilterConditions builds the WHERE conditions for NoteFilters over the
+// note table aliased as "n", numbering placeholders from idx. It returns the
+// next free placeholder index. Space and deletion checks are left to callers.
+func noteFilterConditions(filters models.NoteFilters, idx int) ([]string, []interface{}, int) {
+	var conds []string
+	var args []interface{}
+	if filters.ParentID != nil {
+		conds = append(conds, "n.parent_id = $"+strconv.Itoa(idx))
+		args = append(args, *filters.ParentID)
+		idx++
+	} else if filters.NotReply {
+		conds = append(conds, "n.parent_id IS NULL")
+	}
+
+	// Add date filters
+	if filters.DateFrom != nil {
+		conds = append(conds, "n.date >= $"+strconv.Itoa(idx))
+		args = append(args, *filters.DateFrom)
+		idx++
+	}
+	if filters.DateTo != nil {
+		conds = append(conds, "n.date <= $"+strconv.Itoa(idx))
+		args = append(args, *filters.DateTo)
+		idx++
+	}
+
+	// Process tags with include/exclude logic safely (parameterized)
+	var includeTags []string
+	var excludeTags []string
+	for _, tag := range filters.Tags {
+		if strings.HasPrefix(tag, "!") {
+			excludeTags = append(excludeTags, strings.TrimPrefix(tag, "!"))
+		} else if tag != "" {
+			includeTags = append(includeTags, tag)
+		}
+	}
+
+	// Include: note must contain ALL includeTags
+	if len(includeTags) > 0 {
+		// Count distinct matched tags for this note and compare with number of includeTags
+		conds = append(conds,
+			"(SELECT COUNT(DISTINCT t.name) FROM tag t JOIN note_to_tag nt ON nt.tag_id = t.id WHERE nt.note_id = n.id AND t.name = ANY($"+strconv.Itoa(idx)+")) = $"+strconv.Itoa(idx+1),
+		)
+		args = append(args, pq.Array(includeTags), len(includeTags))
+		idx += 2
+	}
+	// Exclude: note must NOT have any of excludeTags
+	if len(excludeTags) > 0 {
+		conds = append(conds,
+			"NOT EXISTS (SELECT 1 FROM tag xt JOIN note_to_tag xnt ON xnt.tag_id = xt.id WHERE xnt.note_id = n.id AND xt.name = ANY($"+strconv.Itoa(idx)+"))",
+		)
+		args = append(args, pq.Array(excludeTags))
+		idx++
+	}
+
+	// Boolean query language (q=); compiled into a single parameterized condition
+	if filters.Query != nil {
+		cond, qargs := notequery.Compile(filters.Query, idx, time.Now())
+		conds = append(conds, cond)
+		args = append(args, qargs...)
+		idx += len(qargs)
+	}
+
+	return conds, args, idx
+}
+
 func (r *NotesRepository) getActivitiesForNote(noteID int) ([]models.NoteActivity, error) {
 	rows, err := r.db.Query(`
 		SELECT a.id, a.type_id, a.value->>'data', at.unit
@@ -0,0 +1,285 @@
+package repository
+
+import (
+	"database/sql"
+	"focuz-api/models"
+	"strings"
+	"time"
+)
+
+// maxRollupZones bounds the time zones a space is rolled up in, those of the
+// most members. Analyses in further zones read the activities.
+const maxRollupZones = 8
+
+// RollupsRepository maintains the daily activity rollups (see migration
+// 000017): the triggers keep them current, this rebuilds and checks them.
+type RollupsRepository struct {
+	db *sql.DB
+}
+
+func NewRollupsRepository(db *sql.DB) *RollupsRepository {
+	return &RollupsRepository{db: db}
+}
+
+// RollupZone is a space rolled up in a time zone.
+type RollupZone struct {
+	SpaceID  int
+	Timezone string
+}
+
+// Zones lists the rolled-up zones of a space, or of every space when spaceID
+// is 0.
+func (r *RollupsRepository) Zones(spaceID int) ([]RollupZone, error) {
+	rows, err := r.db.Query(`
+		SELECT space_id, timezone
+		FROM activity_rollup_zones
+		WHERE $1 = 0 OR space_id = $1
+		ORDER BY space_id, timezone
+	`, spaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var zones []RollupZone
+	for rows.Next() {
+		var z RollupZone
+		if err := rows.Scan(&z.SpaceID, &z.Timezone); err != nil {
+			return nil, err
+		}
+		zones = append(zones, z)
+	}
+	return zones, rows.Err()
+}
+
+// Rebuild recomputes the rollups of a space in a zone from its activities.
+func (r *RollupsRepository) Rebuild(z RollupZone) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext('activity_rollups'), $1)`, z.SpaceID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM activity_daily_rollups WHERE space_id = $1 AND timezone = $2`, z.SpaceID, z.Timezone); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`SELECT build_activity_rollups($1, $2, NULL, NULL)`, z.SpaceID, z.Timezone); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RollupMismatch is a day whose rollup differs from its activities. Missing
+// is set when only one side has the day.
+type RollupMismatch struct {
+	Timezone string
+	TypeID   int
+	Day      string
+	Missing  bool
+}
+
+// Check compares the rollups of a space in a zone with the same aggregates
+// computed from its activities the way analyses filter them.
+func (r *RollupsRepository) Check(z RollupZone) ([]RollupMismatch, error) {
+	local := localDateExpr("$2")
+	value := "activity_rollup_value(a.value)"
+	rows, err := r.db.Query(`
+		WITH raw AS (
+			SELECT a.type_id, `+local+`::date AS day, COUNT(*) AS count, COUNT(`+value+`) AS value_count,
+			       SUM(`+value+`) AS sum, SUM(`+value+` ^ 2) AS sum_squares, MIN(`+value+`) AS min, MAX(`+value+`) AS max
+			FROM activities a
+			JOIN activity_types aty ON a.type_id = aty.id
+			LEFT JOIN note n ON a.note_id = n.id
+			WHERE a.space_id = $1
+			  AND a.is_deleted = FALSE
+			  AND (n.id IS NULL OR n.is_deleted = FALSE)
+			  AND aty.value_type IN ('integer', 'float')
+			GROUP BY 1, 2
+		), rolled AS (
+			SELECT * FROM activity_daily_rollups WHERE space_id = $1 AND timezone = $2
+		)
+		SELECT COALESCE(raw.type_id, rolled.type_id), to_char(COALESCE(raw.day, rolled.day), 'YYYY-MM-DD'),
+		       raw.type_id IS NULL OR rolled.type_id IS NULL
+		FROM raw
+		FULL JOIN rolled ON rolled.type_id = raw.type_id AND rolled.day = raw.day
+		WHERE raw.type_id IS NULL OR rolled.type_id IS NULL
+		   OR raw.count <> rolled.count OR raw.value_count <> rolled.value_count
+		   OR abs(COALESCE(raw.sum, 0) - COALESCE(rolled.sum, 0)) > 1e-9 * GREATEST(1, abs(raw.sum))
+		   OR abs(COALESCE(raw.sum_squares, 0) - COALESCE(rolled.sum_squares, 0)) > 1e-9 * GREATEST(1, abs(raw.sum_squares))
+		   OR raw.min IS DISTINCT FROM rolled.min OR raw.max IS DISTINCT FROM rolled.max
+		ORDER BY 1, 2
+	`, z.SpaceID, z.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var mismatches []RollupMismatch
+	for rows.Next() {
+		m := RollupMismatch{Timezone: z.Timezone}
+		if err := rows.Scan(&m.TypeID, &m.Day, &m.Missing); err != nil {
+			return nil, err
+		}
+		mismatches = append(mismatches, m)
+	}
+	return mismatches, rows.Err()
+}
+
+// SyncZones rolls every space up in the time zones of its members' settings,
+// at most maxRollupZones per space, and drops the zones no member uses any
+// more. New zones are built here, so analyses never build them; until then
+// they read the activities.
+func (r *RollupsRepository) SyncZones() (added, removed int, err error) {
+	rows, err := r.db.Query(`
+		WITH wanted AS (
+			SELECT space_id, timezone,
+			       row_number() OVER (PARTITION BY space_id ORDER BY COUNT(*) DESC, timezone) AS rank
+			FROM user_to_space uts
+			JOIN users u ON u.id = uts.user_id
+			WHERE uts.is_pending = FALSE
+			GROUP BY space_id, timezone
+		)
+		SELECT COALESCE(w.space_id, z.space_id), COALESCE(w.timezone, z.timezone), w.space_id IS NOT NULL
+		FROM (SELECT * FROM wanted WHERE rank <= $1) w
+		FULL JOIN activity_rollup_zones z ON z.space_id = w.space_id AND z.timezone = w.timezone
+		WHERE w.space_id IS NULL OR z.space_id IS NULL
+		ORDER BY 1, 2
+	`, maxRollupZones)
+	if err != nil {
+		return 0, 0, err
+	}
+	type change struct {
+		zone RollupZone
+		add  bool
+	}
+	var changes []change
+	for rows.Next() {
+		var c change
+		if err := rows.Scan(&c.zone.SpaceID, &c.zone.Timezone, &c.add); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		changes = append(changes, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+	for _, c := range changes {
+		if !c.add {
+			// The zone's rollups go with it (ON DELETE CASCADE)
+			if _, err := r.db.Exec(`DELETE FROM activity_rollup_zones WHERE space_id = $1 AND timezone = $2`, c.zone.SpaceID, c.zone.Timezone); err != nil {
+				return added, removed, err
+			}
+			removed++
+			continue
+		}
+		if err := r.addZone(c.zone); err != nil {
+			return added, removed, err
+		}
+		added++
+	}
+	return added, removed, nil
+}
+
+// addZone registers a zone of a space and builds its rollups.
+func (r *RollupsRepository) addZone(z RollupZone) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// Writers of the space wait, so the build sees all their activities and
+	// they see the new zone
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext('activity_rollups'), $1)`, z.SpaceID); err != nil {
+		return err
+	}
+	res, err := tx.Exec(`
+		INSERT INTO activity_rollup_zones (space_id, timezone, created_at) VALUES ($1, $2, NOW())
+		ON CONFLICT DO NOTHING
+	`, z.SpaceID, z.Timezone)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return err
+	}
+	if _, err := tx.Exec(`SELECT build_activity_rollups($1, $2, NULL, NULL)`, z.SpaceID, z.Timezone); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// rollupZoneReady reports whether the space is rolled up in timezone.
+func rollupZoneReady(db *sql.DB, spaceID int, timezone string) (bool, error) {
+	var ready bool
+	err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM activity_rollup_zones WHERE space_id = $1 AND timezone = $2)`, spaceID, timezone).Scan(&ready)
+	return ready, err
+}
+
+// rollupVariance is the sample variance from the rollups' sums, 0 for a
+// single value as in statisticalAggregate.
+const rollupVariance = "CASE WHEN SUM(ru.value_count) > 1 THEN GREATEST((SUM(ru.sum_squares) - SUM(ru.sum) ^ 2 / SUM(ru.value_count)) / (SUM(ru.value_count) - 1), 0) ELSE 0 END"
+
+// rollupAggregate is the aggregate agg over daily rollups (ru), if rollups
+// keep what it needs.
+func rollupAggregate(agg string) (string, bool) {
+	switch strings.ToLower(agg) {
+	case "sum":
+		return "SUM(ru.sum)", true
+	case "count":
+		return "SUM(ru.count)::float", true
+	case "avg":
+		return "SUM(ru.sum) / NULLIF(SUM(ru.value_count), 0)", true
+	case "min":
+		return "MIN(ru.min)", true
+	case "max":
+		return "MAX(ru.max)", true
+	case "variance":
+		return rollupVariance, true
+	case "stddev":
+		return "sqrt(" + rollupVariance + ")", true
+	}
+	return "", false
+}
+
+// rollupDayExpr is the local day of a rollup as a wall time, in place of
+// localDateExpr.
+const rollupDayExpr = "ru.day::timestamp"
+
+// rollupsApply reports whether an aggregation of type at can read the daily
+// rollups instead of the activities: a plain integer or float value (no field
+// path, tags or saved filter) aggregated in a way the rollups keep, over
+// whole local days.
+func rollupsApply(at *models.ActivityType, field []string, filtered bool, startDate, endDate *time.Time) bool {
+	if at.ValueType != "integer" && at.ValueType != "float" || len(field) > 0 || filtered || at.OptionValues() != nil {
+		return false
+	}
+	if _, ok := rollupAggregate(at.Aggregation); !ok {
+		return false
+	}
+	midnight := func(t time.Time) bool {
+		return t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 && t.Nanosecond() == 0
+	}
+	return (startDate == nil || midnight(*startDate)) && (endDate == nil || midnight(endDate.Add(time.Microsecond)))
+}
+
+// rollupActivities returns the FROM and WHERE clauses over the daily rollups
+// (ru) of a type in a space that stand in for the activities of an analysis,
+// with the local day local between the given bounds. $1 must be the time
+// zone; the other placeholders are passed in, and empty bounds are open.
+func rollupActivities(local, spaceParam, typeParam, startParam, endParam string, liveType bool) string {
+	from := "FROM activity_daily_rollups ru"
+	conds := []string{"ru.space_id = " + spaceParam, "ru.timezone = $1", "ru.type_id = " + typeParam}
+	if liveType {
+		from += "\nJOIN activity_types aty ON ru.type_id = aty.id"
+		conds = append(conds, "aty.is_deleted = FALSE")
+	}
+	if startParam != "" {
+		conds = append(conds, local+" >= "+startParam)
+	}
+	if endParam != "" {
+		conds = append(conds, local+" <= "+endParam)
+	}
+	return from + "\nWHERE " + strings.Join(conds, " AND ")
+}
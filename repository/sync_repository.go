@@ -4,8 +4,11 @@ import (
 	"database/sql"
 	"encoding/json"
 	"focuz-api/models"
+	"focuz-api/pkg/fracindex"
 	"focuz-api/types"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/lib/pq"
 )
@@ -58,6 +61,8 @@ func (r *SyncRepository) GetChangesSince(userID int, accessibleSpaceIDs []int, s
               'user_id', a.user_id,
               'type_id', a.type_id,
               'value', a.value,
+              'space_id', a.space_id,
+              'occurred_at', to_char(a.occurred_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS.MS"Z"'),
               'created_at', to_char(a.created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS.MS"Z"'),
               'modified_at', to_char(a.modified_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS.MS"Z"')
             ) ORDER BY a.modified_at ASC, a.id ASC)
@@ -70,6 +75,32 @@ func (r *SyncRepository) GetChangesSince(userID int, accessibleSpaceIDs []int, s
               'space_id', c.space_id,
               'kind_id', c.kind,
               'activity_type_id', c.activity_type_id,
+              'field_path', c.field_path,
+              'aggregation', c.aggregation,
+              'transform', c.transform,
+              'range_days', c.range_days,
+              'range_from', to_char(c.range_from, 'YYYY-MM-DD'),
+              'range_to', to_char(c.range_to, 'YYYY-MM-DD'),
+              'fill', c.fill,
+              'series', c.series,
+              'options', c.options,
+              'tags', c.tags,
+              'filter_id', c.filter_id,
+              'annotation_tag', c.annotation_tag,
+              'annotations', COALESCE((
+                SELECT json_agg(json_build_object(
+                  'id', ca.id,
+                  'user_id', ca.user_id,
+                  'date', to_char(ca.date, 'YYYY-MM-DD'),
+                  'end_date', to_char(ca.end_date, 'YYYY-MM-DD'),
+                  'label', ca.label,
+                  'note_id', ca.note_id,
+                  'created_at', to_char(ca.created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS.MS"Z"'),
+                  'modified_at', to_char(ca.modified_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS.MS"Z"'),
+                  'deleted_at', CASE WHEN ca.is_deleted THEN to_char(ca.modified_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS.MS"Z"') ELSE NULL END
+                ) ORDER BY ca.modified_at ASC, ca.id ASC)
+                FROM chart_annotations ca WHERE ca.chart_id = c.id
+              ), '[]'::json),
               'period_id', c.period,
               'name', c.name,
               'description', c.description,
@@ -97,6 +128,7 @@ func (r *SyncRepository) GetChangesSince(userID int, accessibleSpaceIDs []int, s
           n.modified_at > $2 OR
           EXISTS (SELECT 1 FROM activities a WHERE a.note_id = n.id AND a.modified_at > $2) OR
           EXISTS (SELECT 1 FROM chart c WHERE c.note_id = n.id AND c.modified_at > $2) OR
+          EXISTS (SELECT 1 FROM chart c JOIN chart_annotations ca ON ca.chart_id = c.id WHERE c.note_id = n.id AND ca.modified_at > $2) OR
           EXISTS (SELECT 1 FROM attachments att WHERE att.note_id = n.id AND att.modified_at > $2)
         )
         ORDER BY n.id
@@ -186,9 +218,10 @@ func (r *SyncRepository) GetChangesSince(userID int, accessibleSpaceIDs []int, s
 	}
 	tagRows.Close()
 
-	// Filters
+	// Filters. Other members' private filters are sent as tombstones so that a
+	// filter turned private disappears from their clients.
 	filterRows, err := r.db.Query(`
-		SELECT id, user_id, space_id, parent_id, name, params, created_at, modified_at, is_deleted
+		SELECT id, user_id, space_id, parent_id, name, params, inherit_params, visibility, position, created_at, modified_at, is_deleted
 		FROM filters
 		WHERE space_id = ANY($1)
 		AND modified_at > $2
@@ -198,15 +231,20 @@ func (r *SyncRepository) GetChangesSince(userID int, accessibleSpaceIDs []int, s
 	}
 	for filterRows.Next() {
 		var id, userIDRow, spaceID int
-		var name string
+		var name, visibility, position string
 		var paramsRaw []byte
 		var created, modified time.Time
-		var isDeleted bool
+		var isDeleted, inheritParams bool
 		var parentID sql.NullInt64
-		if err := filterRows.Scan(&id, &userIDRow, &spaceID, &parentID, &name, &paramsRaw, &created, &modified, &isDeleted); err != nil {
+		if err := filterRows.Scan(&id, &userIDRow, &spaceID, &parentID, &name, &paramsRaw, &inheritParams, &visibility, &position, &created, &modified, &isDeleted); err != nil {
 			filterRows.Close()
 			return nil, err
 		}
+		if visibility == models.FilterVisibilityPrivate && userIDRow != userID {
+			idCopy := id
+			resp.Filters = append(resp.Filters, types.FilterChange{ID: &idCopy, SpaceID: spaceID, UserID: userIDRow, Visibility: visibility, CreatedAt: created, ModifiedAt: modified, DeletedAt: &modified})
+			continue
+		}
 		var params interface{}
 		_ = json.Unmarshal(paramsRaw, &params)
 		var deletedAt *time.Time
@@ -219,18 +257,55 @@ func (r *SyncRepository) GetChangesSince(userID int, accessibleSpaceIDs []int, s
 			parentPtr = &tmp
 		}
 		// Align with pointer ID in type
-		idCopy := id
-		resp.Filters = append(resp.Filters, types.FilterChange{ID: &idCopy, SpaceID: spaceID, UserID: userIDRow, ParentID: parentPtr, Name: name, Params: params, CreatedAt: created, ModifiedAt: modified, DeletedAt: deletedAt})
+		idCopy, inheritCopy := id, inheritParams
+		resp.Filters = append(resp.Filters, types.FilterChange{ID: &idCopy, SpaceID: spaceID, UserID: userIDRow, ParentID: parentPtr, Name: name, Params: params, InheritParams: &inheritCopy, Visibility: visibility, Position: position, CreatedAt: created, ModifiedAt: modified, DeletedAt: deletedAt})
 	}
 	filterRows.Close()
 
 	// Root-level charts removed from pull; charts are nested under notes now.
 
-	// Removed: root-level Activities and Attachments. They are now nested under notes.
+	// Attachments and note activities are nested under notes; only activities
+	// without a note are returned at the root (see below).
+
+	// Activity type categories (default or space-specific, include deleted)
+	catRows, err := r.db.Query(`
+		SELECT id, space_id, name, icon, sort_order, is_deleted, created_at, modified_at
+		FROM activity_type_category
+		WHERE modified_at > $2
+		AND (space_id IS NULL OR space_id = ANY($1))
+		ORDER BY id
+	`, pq.Array(accessibleSpaceIDs), since)
+	if err != nil {
+		return nil, err
+	}
+	for catRows.Next() {
+		var it types.ActivityTypeCategoryChange
+		var spaceID sql.NullInt64
+		var icon sql.NullString
+		var isDeleted bool
+		if err := catRows.Scan(&it.ID, &spaceID, &it.Name, &icon, &it.SortOrder, &isDeleted, &it.CreatedAt, &it.ModifiedAt); err != nil {
+			catRows.Close()
+			return nil, err
+		}
+		if spaceID.Valid {
+			tmp := int(spaceID.Int64)
+			it.SpaceID = &tmp
+		}
+		it.IsDefault = !spaceID.Valid
+		if icon.Valid {
+			it.Icon = &icon.String
+		}
+		if isDeleted {
+			deletedAt := it.ModifiedAt
+			it.DeletedAt = &deletedAt
+		}
+		resp.ActivityTypeCategories = append(resp.ActivityTypeCategories, it)
+	}
+	catRows.Close()
 
 	// Activity types (default or space-specific)
 	atyRows, err := r.db.Query(`
-		SELECT id, name, value_type, min_value, max_value, aggregation, space_id, is_default, unit, category_id, created_at, modified_at
+		SELECT id, name, value_type, min_value, max_value, aggregation, space_id, is_default, unit, category_id, created_at, modified_at, options, fields
 		FROM activity_types
 		WHERE modified_at > $2
 		AND (is_default = TRUE OR space_id = ANY($1))
@@ -245,7 +320,9 @@ func (r *SyncRepository) GetChangesSince(userID int, accessibleSpaceIDs []int, s
 		var minV, maxV sql.NullFloat64
 		var unit sql.NullString
 		var catID sql.NullInt64
-		if err := atyRows.Scan(&it.ID, &it.Name, &it.ValueType, &minV, &maxV, &it.Aggregation, &spaceID, &it.IsDefault, &unit, &catID, &it.CreatedAt, &it.ModifiedAt); err != nil {
+		var options []byte
+		var fields []byte
+		if err := atyRows.Scan(&it.ID, &it.Name, &it.ValueType, &minV, &maxV, &it.Aggregation, &spaceID, &it.IsDefault, &unit, &catID, &it.CreatedAt, &it.ModifiedAt, &options, &fields); err != nil {
 			atyRows.Close()
 			return nil, err
 		}
@@ -268,10 +345,52 @@ func (r *SyncRepository) GetChangesSince(userID int, accessibleSpaceIDs []int, s
 			tmp := int(catID.Int64)
 			it.CategoryID = &tmp
 		}
+		if len(options) > 0 {
+			it.Options = options
+		}
+		if len(fields) > 0 {
+			it.Fields = fields
+		}
 		resp.ActivityTypes = append(resp.ActivityTypes, it)
 	}
 	atyRows.Close()
 
+	// Activities without a note (include deleted)
+	actRows, err := r.db.Query(`
+		SELECT id, user_id, space_id, type_id, value, occurred_at, created_at, modified_at, is_deleted
+		FROM activities
+		WHERE note_id IS NULL
+		AND space_id = ANY($1)
+		AND modified_at > $2
+		ORDER BY id
+	`, pq.Array(accessibleSpaceIDs), since)
+	if err != nil {
+		return nil, err
+	}
+	for actRows.Next() {
+		var a types.ActivityChange
+		var spaceID int
+		var value []byte
+		var occurredAt sql.NullTime
+		var isDeleted bool
+		if err := actRows.Scan(&a.ID, &a.UserID, &spaceID, &a.TypeID, &value, &occurredAt, &a.CreatedAt, &a.ModifiedAt, &isDeleted); err != nil {
+			actRows.Close()
+			return nil, err
+		}
+		a.SpaceID = &spaceID
+		_ = json.Unmarshal(value, &a.Value)
+		if occurredAt.Valid {
+			t := occurredAt.Time
+			a.OccurredAt = &t
+		}
+		if isDeleted {
+			deletedAt := a.ModifiedAt
+			a.DeletedAt = &deletedAt
+		}
+		resp.Activities = append(resp.Activities, a)
+	}
+	actRows.Close()
+
 	return resp, nil
 }
 
@@ -322,9 +441,9 @@ func (r *SyncRepository) ApplyChanges(userID int, payload types.SyncPushRequest)
 						}
 						isDeleted := a.DeletedAt != nil
 						if _, err := r.db.Exec(`
-							INSERT INTO activities (user_id, type_id, value, note_id, created_at, modified_at, is_deleted)
-							VALUES ($1, $2, $3, $4, $5, $6, $7)
-						`, userID, a.TypeID, val, newID, createdAt, modifiedAt, isDeleted); err != nil {
+							INSERT INTO activities (user_id, type_id, value, note_id, space_id, occurred_at, created_at, modified_at, is_deleted)
+							VALUES ($1, $2, $3, $4, (SELECT space_id FROM note WHERE id = $4), $8, $5, $6, $7)
+						`, userID, a.TypeID, val, newID, createdAt, modifiedAt, isDeleted, a.OccurredAt); err != nil {
 							return nil, err
 						}
 						resp.Applied++
@@ -333,7 +452,7 @@ func (r *SyncRepository) ApplyChanges(userID int, payload types.SyncPushRequest)
 					} else {
 						// Update existing by LWW
 						if a.ModifiedAt.After(existingModified) {
-							_, err := r.db.Exec(`UPDATE activities SET value = $2, is_deleted = $3, modified_at = NOW() WHERE id = $1`, existingID, val, a.DeletedAt != nil)
+							_, err := r.db.Exec(`UPDATE activities SET value = $2, is_deleted = $3, occurred_at = COALESCE($4, occurred_at), modified_at = NOW() WHERE id = $1`, existingID, val, a.DeletedAt != nil, a.OccurredAt)
 							if err != nil {
 								return nil, err
 							}
@@ -361,9 +480,11 @@ func (r *SyncRepository) ApplyChanges(userID int, payload types.SyncPushRequest)
 					if currentNoteID != newID {
 						continue
 					}
+					if err := r.applyChartAnnotations(userID, ch.ID, ch.Annotations, resp); err != nil {
+						return nil, err
+					}
 					if ch.ModifiedAt.After(currentModified) {
-						_, err := r.db.Exec(`UPDATE chart SET name = $2, description = $3, kind = $4, period = $5, activity_type_id = $6, is_deleted = $7, modified_at = NOW() WHERE id = $1`, ch.ID, ch.Name, ch.Description, ch.KindID, ch.PeriodID, ch.ActivityTypeID, ch.DeletedAt != nil)
-						if err != nil {
+						if err := r.updateNoteChart(ch); err != nil {
 							return nil, err
 						}
 						resp.Applied++
@@ -427,7 +548,7 @@ func (r *SyncRepository) ApplyChanges(userID int, payload types.SyncPushRequest)
 							continue
 						}
 						if a.ModifiedAt.After(currentModified) {
-							_, err := r.db.Exec(`UPDATE activities SET value = $2, is_deleted = $3, modified_at = NOW() WHERE id = $1`, a.ID, val, a.DeletedAt != nil)
+							_, err := r.db.Exec(`UPDATE activities SET value = $2, is_deleted = $3, occurred_at = COALESCE($4, occurred_at), modified_at = NOW() WHERE id = $1`, a.ID, val, a.DeletedAt != nil, a.OccurredAt)
 							if err != nil {
 								return nil, err
 							}
@@ -452,9 +573,9 @@ func (r *SyncRepository) ApplyChanges(userID int, payload types.SyncPushRequest)
 						}
 						isDeleted := a.DeletedAt != nil
 						if _, err := r.db.Exec(`
-							INSERT INTO activities (user_id, type_id, value, note_id, created_at, modified_at, is_deleted)
-							VALUES ($1, $2, $3, $4, $5, $6, $7)
-						`, userID, a.TypeID, val, *n.ID, createdAt, modifiedAt, isDeleted); err != nil {
+							INSERT INTO activities (user_id, type_id, value, note_id, space_id, occurred_at, created_at, modified_at, is_deleted)
+							VALUES ($1, $2, $3, $4, (SELECT space_id FROM note WHERE id = $4), $8, $5, $6, $7)
+						`, userID, a.TypeID, val, *n.ID, createdAt, modifiedAt, isDeleted, a.OccurredAt); err != nil {
 							return nil, err
 						}
 						resp.Applied++
@@ -462,7 +583,7 @@ func (r *SyncRepository) ApplyChanges(userID int, payload types.SyncPushRequest)
 						return nil, err
 					} else {
 						if a.ModifiedAt.After(existingModified) {
-							_, err := r.db.Exec(`UPDATE activities SET value = $2, is_deleted = $3, modified_at = NOW() WHERE id = $1`, existingID, val, a.DeletedAt != nil)
+							_, err := r.db.Exec(`UPDATE activities SET value = $2, is_deleted = $3, occurred_at = COALESCE($4, occurred_at), modified_at = NOW() WHERE id = $1`, existingID, val, a.DeletedAt != nil, a.OccurredAt)
 							if err != nil {
 								return nil, err
 							}
@@ -490,9 +611,11 @@ func (r *SyncRepository) ApplyChanges(userID int, payload types.SyncPushRequest)
 					if currentNoteID != *n.ID {
 						continue
 					}
+					if err := r.applyChartAnnotations(userID, ch.ID, ch.Annotations, resp); err != nil {
+						return nil, err
+					}
 					if ch.ModifiedAt.After(currentModified) {
-						_, err := r.db.Exec(`UPDATE chart SET name = $2, description = $3, kind = $4, period = $5, activity_type_id = $6, is_deleted = $7, modified_at = NOW() WHERE id = $1`, ch.ID, ch.Name, ch.Description, ch.KindID, ch.PeriodID, ch.ActivityTypeID, ch.DeletedAt != nil)
-						if err != nil {
+						if err := r.updateNoteChart(ch); err != nil {
 							return nil, err
 						}
 						resp.Applied++
@@ -568,7 +691,7 @@ func (r *SyncRepository) ApplyChanges(userID int, payload types.SyncPushRequest)
 							continue
 						}
 						if a.ModifiedAt.After(currentModified) {
-							_, err := r.db.Exec(`UPDATE activities SET value = $2, is_deleted = $3, modified_at = NOW() WHERE id = $1`, a.ID, val, a.DeletedAt != nil)
+							_, err := r.db.Exec(`UPDATE activities SET value = $2, is_deleted = $3, occurred_at = COALESCE($4, occurred_at), modified_at = NOW() WHERE id = $1`, a.ID, val, a.DeletedAt != nil, a.OccurredAt)
 							if err != nil {
 								return nil, err
 							}
@@ -593,9 +716,9 @@ func (r *SyncRepository) ApplyChanges(userID int, payload types.SyncPushRequest)
 						}
 						isDeleted := a.DeletedAt != nil
 						if _, err := r.db.Exec(`
-							INSERT INTO activities (user_id, type_id, value, note_id, created_at, modified_at, is_deleted)
-							VALUES ($1, $2, $3, $4, $5, $6, $7)
-						`, userID, a.TypeID, val, *n.ID, createdAt, modifiedAt, isDeleted); err != nil {
+							INSERT INTO activities (user_id, type_id, value, note_id, space_id, occurred_at, created_at, modified_at, is_deleted)
+							VALUES ($1, $2, $3, $4, (SELECT space_id FROM note WHERE id = $4), $8, $5, $6, $7)
+						`, userID, a.TypeID, val, *n.ID, createdAt, modifiedAt, isDeleted, a.OccurredAt); err != nil {
 							return nil, err
 						}
 						resp.Applied++
@@ -603,7 +726,7 @@ func (r *SyncRepository) ApplyChanges(userID int, payload types.SyncPushRequest)
 						return nil, err
 					} else {
 						if a.ModifiedAt.After(existingModified) {
-							_, err := r.db.Exec(`UPDATE activities SET value = $2, is_deleted = $3, modified_at = NOW() WHERE id = $1`, existingID, val, a.DeletedAt != nil)
+							_, err := r.db.Exec(`UPDATE activities SET value = $2, is_deleted = $3, occurred_at = COALESCE($4, occurred_at), modified_at = NOW() WHERE id = $1`, existingID, val, a.DeletedAt != nil, a.OccurredAt)
 							if err != nil {
 								return nil, err
 							}
@@ -631,9 +754,11 @@ func (r *SyncRepository) ApplyChanges(userID int, payload types.SyncPushRequest)
 					if currentNoteID != *n.ID {
 						continue
 					}
+					if err := r.applyChartAnnotations(userID, ch.ID, ch.Annotations, resp); err != nil {
+						return nil, err
+					}
 					if ch.ModifiedAt.After(currentModified) {
-						_, err := r.db.Exec(`UPDATE chart SET name = $2, description = $3, kind = $4, period = $5, activity_type_id = $6, is_deleted = $7, modified_at = NOW() WHERE id = $1`, ch.ID, ch.Name, ch.Description, ch.KindID, ch.PeriodID, ch.ActivityTypeID, ch.DeletedAt != nil)
-						if err != nil {
+						if err := r.updateNoteChart(ch); err != nil {
 							return nil, err
 						}
 						resp.Applied++
@@ -645,21 +770,43 @@ func (r *SyncRepository) ApplyChanges(userID int, payload types.SyncPushRequest)
 		}
 	}
 
-	// Filters (create when id is nil; otherwise LWW on name/params/parent)
+	// Filters (create when id is nil; otherwise LWW on name/params/parent/inheritance/
+	// visibility/position). Reparenting that would create a cycle, edits of other
+	// members' private filters and params or parents the filter endpoints would
+	// reject are reported as conflicts. Empty visibility/position and omitted
+	// inheritance keep the server value (defaults on create).
 	for _, f := range payload.Filters {
+		if f.Visibility != "" && !models.IsValidFilterVisibility(f.Visibility) {
+			f.Visibility = ""
+		}
+		if f.Position != "" && !fracindex.Valid(f.Position) {
+			f.Position = ""
+		}
 		// Create new when no ID provided
 		if f.ID == nil {
-			// Require spaceId and name; params may be any JSON
+			// Require spaceId and name
 			if f.SpaceID == 0 || f.Name == "" {
 				continue
 			}
+			visibility, position, err := r.newFilterPlacement(f)
+			if err != nil {
+				return nil, err
+			}
+			ok, err := r.checkFilterChange(f, f.SpaceID, userID, 0, visibility)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				resp.Conflicts = append(resp.Conflicts, types.Conflict{Resource: "filter", Reason: "invalid"})
+				continue
+			}
 			paramsBytes, _ := json.Marshal(f.Params)
 			var newID int
-			err := r.db.QueryRow(`
-                INSERT INTO filters (user_id, space_id, parent_id, name, params, is_deleted, created_at, modified_at)
-                VALUES ($1, $2, $3, $4, $5, FALSE, COALESCE($6, NOW()), NOW())
+			err = r.db.QueryRow(`
+                INSERT INTO filters (user_id, space_id, parent_id, name, params, inherit_params, visibility, position, is_deleted, created_at, modified_at)
+                VALUES ($1, $2, $3, $4, $5, $6, $7, $8, FALSE, COALESCE($9, NOW()), NOW())
                 RETURNING id
-            `, userID, f.SpaceID, f.ParentID, f.Name, paramsBytes, f.CreatedAt).Scan(&newID)
+            `, userID, f.SpaceID, f.ParentID, f.Name, paramsBytes, f.InheritParams != nil && *f.InheritParams, visibility, position, f.CreatedAt).Scan(&newID)
 			if err != nil {
 				return nil, err
 			}
@@ -670,15 +817,40 @@ func (r *SyncRepository) ApplyChanges(userID int, payload types.SyncPushRequest)
 			continue
 		}
 
+		if f.ParentID != nil {
+			cycle, err := filterWouldCreateCycle(r.db, *f.ID, *f.ParentID)
+			if err != nil {
+				return nil, err
+			}
+			if cycle {
+				resp.Conflicts = append(resp.Conflicts, types.Conflict{Resource: "filter", ID: *f.ID, Reason: "cycle"})
+				continue
+			}
+		}
+
 		var serverModified time.Time
-		err := r.db.QueryRow(`SELECT modified_at FROM filters WHERE id = $1`, *f.ID).Scan(&serverModified)
+		var ownerID, serverSpaceID int
+		var serverVisibility string
+		err := r.db.QueryRow(`SELECT modified_at, user_id, space_id, visibility FROM filters WHERE id = $1`, *f.ID).Scan(&serverModified, &ownerID, &serverSpaceID, &serverVisibility)
 		if err == sql.ErrNoRows {
 			// Create with forced id to preserve client-known id
+			visibility, position, err := r.newFilterPlacement(f)
+			if err != nil {
+				return nil, err
+			}
+			ok, err := r.checkFilterChange(f, f.SpaceID, userID, 0, visibility)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				resp.Conflicts = append(resp.Conflicts, types.Conflict{Resource: "filter", ID: *f.ID, Reason: "invalid"})
+				continue
+			}
 			paramsBytes, _ := json.Marshal(f.Params)
-			_, err := r.db.Exec(`
-                INSERT INTO filters (id, user_id, space_id, parent_id, name, params, is_deleted, created_at, modified_at)
-                VALUES ($1, $2, $3, $4, $5, $6, $7, COALESCE($8, NOW()), NOW())
-            `, *f.ID, f.UserID, f.SpaceID, f.ParentID, f.Name, paramsBytes, f.DeletedAt != nil, f.CreatedAt)
+			_, err = r.db.Exec(`
+                INSERT INTO filters (id, user_id, space_id, parent_id, name, params, inherit_params, visibility, position, is_deleted, created_at, modified_at)
+                VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, COALESCE($11, NOW()), NOW())
+            `, *f.ID, f.UserID, f.SpaceID, f.ParentID, f.Name, paramsBytes, f.InheritParams != nil && *f.InheritParams, visibility, position, f.DeletedAt != nil, f.CreatedAt)
 			if err != nil {
 				return nil, err
 			}
@@ -687,9 +859,31 @@ func (r *SyncRepository) ApplyChanges(userID int, payload types.SyncPushRequest)
 		} else if err != nil {
 			return nil, err
 		}
+		if ownerID != userID && (serverVisibility == models.FilterVisibilityPrivate || (f.Visibility != "" && f.Visibility != serverVisibility)) {
+			resp.Conflicts = append(resp.Conflicts, types.Conflict{Resource: "filter", ID: *f.ID, Reason: "forbidden"})
+			continue
+		}
+		visibility, changedID := serverVisibility, 0
+		if f.Visibility != "" && f.Visibility != serverVisibility {
+			visibility, changedID = f.Visibility, *f.ID
+		}
+		ok, err := r.checkFilterChange(f, serverSpaceID, userID, changedID, visibility)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			resp.Conflicts = append(resp.Conflicts, types.Conflict{Resource: "filter", ID: *f.ID, Reason: "invalid"})
+			continue
+		}
 		if f.ModifiedAt.After(serverModified) {
 			paramsBytes, _ := json.Marshal(f.Params)
-			_, err := r.db.Exec(`UPDATE filters SET name = $2, parent_id = $3, params = $4, is_deleted = $5, modified_at = NOW() WHERE id = $1`, *f.ID, f.Name, f.ParentID, paramsBytes, f.DeletedAt != nil)
+			_, err := r.db.Exec(`
+                UPDATE filters SET name = $2, parent_id = $3, params = $4, inherit_params = COALESCE($5, inherit_params) AND $3::int IS NOT NULL,
+                    visibility = COALESCE(NULLIF($6, ''), visibility),
+                    position = COALESCE(NULLIF($7, ''), position),
+                    is_deleted = $8, modified_at = NOW()
+                WHERE id = $1
+            `, *f.ID, f.Name, f.ParentID, paramsBytes, f.InheritParams, f.Visibility, f.Position, f.DeletedAt != nil)
 			if err != nil {
 				return nil, err
 			}
@@ -728,7 +922,7 @@ func (r *SyncRepository) ApplyChanges(userID int, payload types.SyncPushRequest)
 		}
 		if a.ModifiedAt.After(serverModified) {
 			val, _ := json.Marshal(a.Value)
-			_, err := r.db.Exec(`UPDATE activities SET value = $2, is_deleted = $3, modified_at = NOW() WHERE id = $1`, a.ID, val, a.DeletedAt != nil)
+			_, err := r.db.Exec(`UPDATE activities SET value = $2, is_deleted = $3, occurred_at = COALESCE($4, occurred_at), modified_at = NOW() WHERE id = $1`, a.ID, val, a.DeletedAt != nil, a.OccurredAt)
 			if err != nil {
 				return nil, err
 			}
@@ -761,9 +955,161 @@ func (r *SyncRepository) replaceNoteTags(noteID int, tags []string, spaceID int)
 	return nil
 }
 
+// applyChartAnnotations applies the pushed annotations of a chart, last write
+// wins. New annotations may only point at notes of the chart's space;
+// annotations that are not valid are reported as conflicts.
+func (r *SyncRepository) applyChartAnnotations(userID, chartID int, annotations []types.ChartAnnotationChange, resp *types.SyncPushResponse) error {
+	for _, a := range annotations {
+		a.Label = strings.TrimSpace(a.Label)
+		id := 0
+		if a.ID != nil {
+			id = *a.ID
+		}
+		if !validAnnotationChange(a) {
+			resp.Conflicts = append(resp.Conflicts, types.Conflict{Resource: "chart_annotation", ID: id, Reason: "invalid"})
+			continue
+		}
+		if a.ID == nil {
+			var newID int
+			err := r.db.QueryRow(`
+				INSERT INTO chart_annotations (chart_id, user_id, date, end_date, label, note_id, is_deleted, created_at, modified_at)
+				SELECT c.id, $2::int, $3::date, $4::date, $5::text, (SELECT n.id FROM note n WHERE n.id = $6 AND n.space_id = c.space_id), $7::boolean, NOW(), NOW()
+				FROM chart c WHERE c.id = $1
+				RETURNING id
+			`, chartID, userID, a.Date, a.EndDate, a.Label, a.NoteID, a.DeletedAt != nil).Scan(&newID)
+			if err != nil {
+				return err
+			}
+			resp.Applied++
+			if a.ClientID != nil {
+				resp.Mappings = append(resp.Mappings, types.Mapping{Resource: "chart_annotation", ClientID: *a.ClientID, ServerID: newID})
+			}
+			continue
+		}
+		var currentChartID int
+		var currentModified time.Time
+		err := r.db.QueryRow(`SELECT chart_id, modified_at FROM chart_annotations WHERE id = $1`, id).Scan(&currentChartID, &currentModified)
+		if err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if currentChartID != chartID {
+			continue
+		}
+		if a.ModifiedAt.After(currentModified) {
+			_, err := r.db.Exec(`
+				UPDATE chart_annotations ca
+				SET date = $2, end_date = $3, label = $4, is_deleted = $6, modified_at = NOW(),
+				    note_id = (SELECT n.id FROM note n JOIN chart c ON c.space_id = n.space_id WHERE n.id = $5 AND c.id = ca.chart_id)
+				WHERE ca.id = $1
+			`, id, a.Date, a.EndDate, a.Label, a.NoteID, a.DeletedAt != nil)
+			if err != nil {
+				return err
+			}
+			resp.Applied++
+		} else {
+			resp.Conflicts = append(resp.Conflicts, types.Conflict{Resource: "chart_annotation", ID: id, Reason: "server-newer"})
+		}
+	}
+	return nil
+}
+
+// validAnnotationChange checks the dates and label of a pushed annotation as
+// the annotation endpoints do.
+func validAnnotationChange(a types.ChartAnnotationChange) bool {
+	if a.Label == "" || utf8.RuneCountInString(a.Label) > 255 {
+		return false
+	}
+	date, err := time.Parse("2006-01-02", a.Date)
+	if err != nil {
+		return false
+	}
+	if a.EndDate != nil {
+		end, err := time.Parse("2006-01-02", *a.EndDate)
+		if err != nil || end.Before(date) {
+			return false
+		}
+	}
+	return true
+}
+
+// updateNoteChart writes a chart pushed under its note. Omitted or null
+// fields keep their value, except tags and filter_id which null clears.
+func (r *SyncRepository) updateNoteChart(ch types.ChartChange) error {
+	_, err := r.db.Exec(`
+		UPDATE chart SET name = $2, description = $3, kind = $4, period = $5, activity_type_id = $6, is_deleted = $7,
+			field_path = COALESCE($8, field_path), aggregation = COALESCE($9, aggregation), transform = COALESCE($10, transform),
+			range_days = COALESCE($11, range_days), range_from = COALESCE($12::date, range_from), range_to = COALESCE($13::date, range_to),
+			fill = COALESCE($14, fill), series = COALESCE($15::jsonb, series), options = COALESCE($16::jsonb, options),
+			tags = CASE WHEN $17::jsonb IS NULL THEN tags WHEN $17::jsonb = 'null' THEN NULL ELSE ARRAY(SELECT jsonb_array_elements_text($17::jsonb)) END,
+			filter_id = CASE WHEN $18::jsonb IS NULL THEN filter_id ELSE ($18::jsonb #>> '{}')::int END,
+			annotation_tag = COALESCE($19, annotation_tag), modified_at = NOW()
+		WHERE id = $1
+	`, ch.ID, ch.Name, ch.Description, ch.KindID, ch.PeriodID, ch.ActivityTypeID, ch.DeletedAt != nil, ch.FieldPath, ch.Aggregation, ch.Transform, ch.RangeDays, ch.RangeFrom, ch.RangeTo, ch.Fill, rawJSON(ch.Series), rawJSON(ch.Options), sentJSON(ch.Tags), sentJSON(ch.FilterID), ch.AnnotationTag)
+	return err
+}
+
+// rawJSON passes a raw JSON value to a JSONB parameter; omitted and null
+// values are NULL.
+func rawJSON(raw json.RawMessage) sql.NullString {
+	v := string(raw)
+	return sql.NullString{String: v, Valid: v != "" && v != "null"}
+}
+
+// sentJSON passes a raw JSON value to a JSONB parameter, null included; only
+// omitted values are NULL.
+func sentJSON(raw json.RawMessage) sql.NullString {
+	return sql.NullString{String: string(raw), Valid: len(raw) > 0}
+}
+
 func toString(s *string) string {
 	if s == nil {
 		return ""
 	}
 	return *s
 }
+
+// checkFilterChange checks a pushed filter of spaceID as the filter endpoints
+// do: params must be a valid params object and the parent, if any, a live
+// filter of the space that userID can see and that may hold a filter of the
+// resulting visibility. Inheritance needs a parent. The existing filter
+// changedID, if above 0, changes visibility and must have no shared children
+// to become private.
+func (r *SyncRepository) checkFilterChange(f types.FilterChange, spaceID, userID, changedID int, visibility string) (bool, error) {
+	raw, err := json.Marshal(f.Params)
+	if err != nil {
+		return false, nil
+	}
+	if _, err := models.ParseFilterParams(raw); err != nil {
+		return false, nil
+	}
+	if visibility == models.FilterVisibilityPrivate && changedID > 0 {
+		shared, err := filterHasSharedChildren(r.db, changedID)
+		if err != nil || shared {
+			return false, err
+		}
+	}
+	if f.ParentID == nil {
+		return f.InheritParams == nil || !*f.InheritParams, nil
+	}
+	parent, err := getFilterByID(r.db, *f.ParentID)
+	if err != nil {
+		return false, err
+	}
+	return parent != nil && !parent.IsDeleted && parent.SpaceID == spaceID && parent.VisibleTo(userID) && parent.CanParent(visibility), nil
+}
+
+// newFilterPlacement returns visibility and position for a pushed filter
+// that does not exist yet, defaulting to a shared filter at the end.
+func (r *SyncRepository) newFilterPlacement(f types.FilterChange) (string, string, error) {
+	visibility := f.Visibility
+	if visibility == "" {
+		visibility = models.FilterVisibilitySpace
+	}
+	if f.Position != "" {
+		return visibility, f.Position, nil
+	}
+	position, err := nextFilterPosition(r.db, f.SpaceID)
+	return visibility, position, err
+}
@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"database/sql"
+	"focuz-api/models"
+)
+
+type UsersRepository struct {
+	db *sql.DB
+}
+
+func NewUsersRepository(db *sql.DB) *UsersRepository {
+	return &UsersRepository{db: db}
+}
+
+// GetSettings returns the user's settings; unknown users get the defaults.
+func (r *UsersRepository) GetSettings(userID int) (models.UserSettings, error) {
+	var s models.UserSettings
+	err := r.db.QueryRow(`SELECT timezone, week_start FROM users WHERE id = $1`, userID).Scan(&s.Timezone, &s.WeekStart)
+	if err == sql.ErrNoRows {
+		return models.DefaultUserSettings, nil
+	}
+	if err != nil {
+		return models.DefaultUserSettings, err
+	}
+	return s, nil
+}
+
+func (r *UsersRepository) UpdateSettings(userID int, s models.UserSettings) error {
+	_, err := r.db.Exec(`UPDATE users SET timezone = $1, week_start = $2 WHERE id = $3`, s.Timezone, s.WeekStart, userID)
+	return err
+}
@@ -0,0 +1,32 @@
+package types
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Transforms derive a series from the per-period values: moving averages over
+// the last 7 or 30 periods and the running total.
+var Transforms = []string{"ma7", "ma30", "cumsum"}
+
+func IsTransform(name string) bool {
+	for _, t := range Transforms {
+		if t == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ParsePercentile parses a percentile aggregation such as "p90" and returns
+// the percentile (1-99).
+func ParsePercentile(agg string) (int, bool) {
+	if !strings.HasPrefix(agg, "p") || len(agg) < 2 || len(agg) > 3 {
+		return 0, false
+	}
+	p, err := strconv.Atoi(agg[1:])
+	if err != nil || p < 1 || p > 99 || agg[1] == '0' {
+		return 0, false
+	}
+	return p, true
+}
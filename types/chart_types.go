@@ -10,9 +10,16 @@ type PeriodType struct {
 	Name string `json:"name"`
 }
 
+// ChartTypes are the chart kinds. Line and bar charts plot series per period;
+// calendarHeatmap plots daily values, pie a distribution, scatter two series
+// paired by day and histogram the distribution of single values.
 var ChartTypes = []ChartType{
 	{ID: 1, Name: "lineChart"},
 	{ID: 2, Name: "barChart"},
+	{ID: 3, Name: "calendarHeatmap"},
+	{ID: 4, Name: "pie"},
+	{ID: 5, Name: "scatter"},
+	{ID: 6, Name: "histogram"},
 }
 
 var PeriodTypes = []PeriodType{
@@ -22,6 +29,58 @@ var PeriodTypes = []PeriodType{
 	{ID: 4, Name: "year"},
 }
 
+// ChartFills say how chart data returns buckets without activities: none
+// leaves them out, zero and null return them with that value.
+var ChartFills = []string{"none", "zero", "null"}
+
+func IsChartFill(name string) bool {
+	for _, f := range ChartFills {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Comparisons name the earlier range chart data and analyses can be compared
+// with: the range just before (previous) or the same range a year earlier.
+var Comparisons = []string{"previous", "year_ago"}
+
+func IsComparison(name string) bool {
+	for _, c := range Comparisons {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// TrendMethods are the trends fitted to analyses and chart series: a least
+// squares line (linear) or an exponentially weighted moving average (ewma).
+var TrendMethods = []string{"linear", "ewma"}
+
+func IsTrendMethod(name string) bool {
+	for _, m := range TrendMethods {
+		if m == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ForecastMethods project analyses and chart series: simple exponential
+// smoothing (ses) or Holt's linear method (holt).
+var ForecastMethods = []string{"ses", "holt"}
+
+func IsForecastMethod(name string) bool {
+	for _, m := range ForecastMethods {
+		if m == name {
+			return true
+		}
+	}
+	return false
+}
+
 func GetChartTypeByID(id int) *ChartType {
 	for _, t := range ChartTypes {
 		if t.ID == id {
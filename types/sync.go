@@ -1,6 +1,9 @@
 package types
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // SyncPullResponse represents all changes since a given timestamp.
 type SyncPullResponse struct {
@@ -9,6 +12,10 @@ type SyncPullResponse struct {
 	Tags          []TagChange          `json:"tags"`
 	Filters       []FilterChange       `json:"filters"`
 	ActivityTypes []ActivityTypeChange `json:"activityTypes"`
+	// Default and space categories, including deleted ones
+	ActivityTypeCategories []ActivityTypeCategoryChange `json:"activityTypeCategories"`
+	// Activities without a note; note activities are nested in Notes
+	Activities []ActivityChange `json:"activities"`
 }
 
 type SpaceChange struct {
@@ -48,16 +55,19 @@ type TagChange struct {
 }
 
 type FilterChange struct {
-	ID         *int        `json:"id,omitempty"`
-	ClientID   *string     `json:"clientId,omitempty"`
-	SpaceID    int         `json:"space_id"`
-	UserID     int         `json:"user_id"`
-	ParentID   *int        `json:"parent_id,omitempty"`
-	Params     interface{} `json:"params"`
-	Name       string      `json:"name"`
-	CreatedAt  time.Time   `json:"created_at"`
-	ModifiedAt time.Time   `json:"modified_at"`
-	DeletedAt  *time.Time  `json:"deleted_at,omitempty"`
+	ID            *int        `json:"id,omitempty"`
+	ClientID      *string     `json:"clientId,omitempty"`
+	SpaceID       int         `json:"space_id"`
+	UserID        int         `json:"user_id"`
+	ParentID      *int        `json:"parent_id,omitempty"`
+	Params        interface{} `json:"params"`
+	InheritParams *bool       `json:"inherit_params,omitempty"`
+	Visibility    string      `json:"visibility,omitempty"`
+	Position      string      `json:"position,omitempty"`
+	Name          string      `json:"name"`
+	CreatedAt     time.Time   `json:"created_at"`
+	ModifiedAt    time.Time   `json:"modified_at"`
+	DeletedAt     *time.Time  `json:"deleted_at,omitempty"`
 }
 
 type ChartChange struct {
@@ -66,6 +76,13 @@ type ChartChange struct {
 	UserID         int        `json:"user_id"`
 	KindID         int        `json:"kind_id"`
 	ActivityTypeID int        `json:"activity_type_id"`
+	FieldPath      *string    `json:"field_path,omitempty"`
+	Aggregation    *string    `json:"aggregation,omitempty"`
+	Transform      *string    `json:"transform,omitempty"`
+	RangeDays      *int       `json:"range_days,omitempty"`
+	RangeFrom      *string    `json:"range_from,omitempty"`
+	RangeTo        *string    `json:"range_to,omitempty"`
+	Fill           *string    `json:"fill,omitempty"`
 	PeriodID       int        `json:"period_id"`
 	Name           string     `json:"name"`
 	Description    *string    `json:"description,omitempty"`
@@ -73,14 +90,44 @@ type ChartChange struct {
 	CreatedAt      time.Time  `json:"created_at"`
 	ModifiedAt     time.Time  `json:"modified_at"`
 	DeletedAt      *time.Time `json:"deleted_at,omitempty"`
+	// Series is the raw series list of multi-series charts; activity_type_id,
+	// field_path and aggregation describe the first series.
+	Series json.RawMessage `json:"series,omitempty"`
+	// Options is the raw kind-specific settings object (bins, groupBy).
+	Options json.RawMessage `json:"options,omitempty"`
+	// Tags and FilterID scope the chart's activities by note tags or a saved
+	// filter. They stay raw so that a push tells null (clear) from omitted (keep).
+	Tags     json.RawMessage `json:"tags,omitempty"`
+	FilterID json.RawMessage `json:"filter_id,omitempty"`
+	// AnnotationTag turns the notes carrying it into annotations; those are
+	// not synced, only the chart's own Annotations (pull + push).
+	AnnotationTag *string                 `json:"annotation_tag,omitempty"`
+	Annotations   []ChartAnnotationChange `json:"annotations,omitempty"`
+}
+
+// ChartAnnotationChange is an annotation of a chart. Push creates one when ID
+// is nil and maps ClientID to the new ID.
+type ChartAnnotationChange struct {
+	ID         *int       `json:"id,omitempty"`
+	ClientID   *string    `json:"clientId,omitempty"`
+	UserID     int        `json:"user_id"`
+	Date       string     `json:"date"`
+	EndDate    *string    `json:"end_date,omitempty"`
+	Label      string     `json:"label"`
+	NoteID     *int       `json:"note_id,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ModifiedAt time.Time  `json:"modified_at"`
+	DeletedAt  *time.Time `json:"deleted_at,omitempty"`
 }
 
 type ActivityChange struct {
 	ID         int         `json:"id"`
 	UserID     int         `json:"user_id"`
 	NoteID     *int        `json:"note_id,omitempty"`
+	SpaceID    *int        `json:"space_id,omitempty"`
 	TypeID     int         `json:"type_id"`
 	Value      interface{} `json:"value"`
+	OccurredAt *time.Time  `json:"occurred_at,omitempty"`
 	CreatedAt  time.Time   `json:"created_at"`
 	ModifiedAt time.Time   `json:"modified_at"`
 	DeletedAt  *time.Time  `json:"deleted_at,omitempty"`
@@ -111,6 +158,22 @@ type ActivityTypeChange struct {
 	CategoryID  *int      `json:"category_id,omitempty"`
 	CreatedAt   time.Time `json:"created_at"`
 	ModifiedAt  time.Time `json:"modified_at"`
+	// Options is the raw option list of enum and rating types.
+	Options json.RawMessage `json:"options,omitempty"`
+	// Fields is the raw field schema of composite types.
+	Fields json.RawMessage `json:"fields,omitempty"`
+}
+
+type ActivityTypeCategoryChange struct {
+	ID         int        `json:"id"`
+	SpaceID    *int       `json:"space_id,omitempty"`
+	Name       string     `json:"name"`
+	Icon       *string    `json:"icon,omitempty"`
+	SortOrder  int        `json:"sort_order"`
+	IsDefault  bool       `json:"is_default"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ModifiedAt time.Time  `json:"modified_at"`
+	DeletedAt  *time.Time `json:"deleted_at,omitempty"`
 }
 
 // SyncPushRequest contains local changes from client.
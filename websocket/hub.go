@@ -6,6 +6,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"focuz-api/pkg/appenv"
@@ -27,8 +28,12 @@ type Client struct {
 type Hub struct {
 	register   chan *Client
 	unregister chan *Client
+
+	mu sync.Mutex
 	// Map of userID to set of clients
 	clientsByUser map[int]map[*Client]bool
+	// Called when the last client of a user goes away
+	onDisconnect []func(userID int)
 }
 
 // NewHub creates and starts a new Hub loop.
@@ -46,30 +51,63 @@ func (h *Hub) run() {
 	for {
 		select {
 		case c := <-h.register:
+			h.mu.Lock()
 			set, ok := h.clientsByUser[c.userID]
 			if !ok {
 				set = make(map[*Client]bool)
 				h.clientsByUser[c.userID] = set
 			}
 			set[c] = true
+			h.mu.Unlock()
 		case c := <-h.unregister:
+			gone := false
+			h.mu.Lock()
 			if set, ok := h.clientsByUser[c.userID]; ok {
 				if _, exists := set[c]; exists {
 					delete(set, c)
 					close(c.send)
 					if len(set) == 0 {
 						delete(h.clientsByUser, c.userID)
+						gone = true
 					}
 				}
 			}
+			h.mu.Unlock()
+			if gone {
+				h.disconnected(c.userID)
+			}
 		}
 	}
 }
 
+// OnDisconnect registers fn to be called when the last client of a user
+// disconnects. Register before serving clients.
+func (h *Hub) OnDisconnect(fn func(userID int)) {
+	h.onDisconnect = append(h.onDisconnect, fn)
+}
+
+func (h *Hub) disconnected(userID int) {
+	for _, fn := range h.onDisconnect {
+		fn(userID)
+	}
+}
+
+// Connected reports whether the user has a connected client.
+func (h *Hub) Connected(userID int) bool {
+	if h == nil {
+		return false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.clientsByUser[userID]) > 0
+}
+
 func (h *Hub) NotifyUser(userID int, payload []byte) {
 	if h == nil {
 		return
 	}
+	gone := false
+	h.mu.Lock()
 	if set, ok := h.clientsByUser[userID]; ok {
 		for c := range set {
 			select {
@@ -81,8 +119,13 @@ func (h *Hub) NotifyUser(userID int, payload []byte) {
 		}
 		if len(set) == 0 {
 			delete(h.clientsByUser, userID)
+			gone = true
 		}
 	}
+	h.mu.Unlock()
+	if gone {
+		h.disconnected(userID)
+	}
 }
 
 var upgrader = websocket.Upgrader{